@@ -0,0 +1,282 @@
+// Package auditlog records the server's visits and uploads as a
+// sequence of numbered events, kept in a ring in memory and, if the
+// log has a file, appended to it as newline-delimited JSON. Readers
+// resume from the last sequence number they saw:
+//
+//	l.Since(ctx, cursor, func(e auditlog.Event) error {
+//		cursor = e.Seq
+//		...
+//	})
+package auditlog
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/internal/clock"
+	"github.com/bradfitz/talk-yapc-asia-2015/internal/jsonenc"
+)
+
+// Kinds of Event.
+const (
+	Visit  = "visit"
+	Upload = "upload"
+)
+
+// An Event is one entry in the log.
+type Event struct {
+	Seq  int64     `json:"seq"` // from 1, with no gaps
+	Time time.Time `json:"time"`
+	Kind string    `json:"kind"`
+
+	// For visits. Count is how many visits the event records; batches
+	// have more than one.
+	Visitor int64 `json:"visitor,omitempty"` // the count after them
+	Count   int64 `json:"count,omitempty"`
+
+	// For uploads.
+	Size int64  `json:"size,omitempty"`
+	Alg  string `json:"alg,omitempty"` // the digest's hash, if not sha1
+	Sum  string `json:"sum,omitempty"` // in hex
+}
+
+// UnmarshalJSON decodes an Event, taking Sum from "sha1" if there's no
+// "sum", as in logs written before the field was renamed.
+func (e *Event) UnmarshalJSON(b []byte) error {
+	type event Event // without this method
+	var v struct {
+		event
+		SHA1 string `json:"sha1"`
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	*e = Event(v.event)
+	if e.Sum == "" {
+		e.Sum = v.SHA1
+	}
+	return nil
+}
+
+// AppendJSON appends e's JSON encoding, the same as encoding/json's,
+// without a newline.
+func (e Event) AppendJSON(b []byte) []byte {
+	b = append(b, `{"seq":`...)
+	b = jsonenc.Int(b, e.Seq)
+	b = append(b, `,"time":`...)
+	b = jsonenc.Time(b, e.Time)
+	b = append(b, `,"kind":`...)
+	b = jsonenc.String(b, e.Kind)
+	if e.Visitor != 0 {
+		b = append(b, `,"visitor":`...)
+		b = jsonenc.Int(b, e.Visitor)
+	}
+	if e.Count != 0 {
+		b = append(b, `,"count":`...)
+		b = jsonenc.Int(b, e.Count)
+	}
+	if e.Size != 0 {
+		b = append(b, `,"size":`...)
+		b = jsonenc.Int(b, e.Size)
+	}
+	if e.Alg != "" {
+		b = append(b, `,"alg":`...)
+		b = jsonenc.String(b, e.Alg)
+	}
+	if e.Sum != "" {
+		b = append(b, `,"sum":`...)
+		b = jsonenc.String(b, e.Sum)
+	}
+	return append(b, '}')
+}
+
+// ErrExpired is returned by Since when events after the cursor have
+// already left the ring and the log has no file to read them from.
+var ErrExpired = errors.New("auditlog: events after cursor no longer retained")
+
+// chunk is how many events Since copies out of the ring at a time.
+const chunk = 64
+
+// A Log is an audit log. Its methods may be called concurrently.
+type Log struct {
+	path string // or "" for memory only
+
+	mu   sync.Mutex
+	f    *os.File // opened for appending, if path != ""
+	ring []Event
+	next int64 // Seq of the next event
+}
+
+// New returns a Log held only in memory, keeping the last size
+// events. Size must be positive.
+func New(size int) *Log {
+	return &Log{ring: make([]Event, size), next: 1}
+}
+
+// Open returns a Log that also appends to the file at path, creating
+// it if need be. Its ring is filled from the end of the file, and
+// numbering carries on from the file's last event. A last line cut
+// short by a crash is removed.
+func Open(path string, size int) (*Log, error) {
+	l := New(size)
+	l.path = path
+	end, err := l.scanFile(context.Background(), 0, func(e Event) error {
+		if e.Seq != l.next {
+			return fmt.Errorf("event %d where %d was expected", e.Seq, l.next)
+		}
+		l.ring[l.next%int64(len(l.ring))] = e
+		l.next++
+		return nil
+	})
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("auditlog: reading %s: %w", path, err)
+	}
+	l.f, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := l.f.Truncate(end); err != nil {
+		l.f.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// Close closes the log's file, if it has one.
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return nil
+	}
+	err := l.f.Close()
+	l.f = nil
+	return err
+}
+
+// Append numbers e, stamps it with the current time if it has none,
+// and adds it to the log. The event is in the ring even if writing it
+// to the file fails.
+func (l *Log) Append(e Event) (Event, error) {
+	if e.Time.IsZero() {
+		e.Time = clock.Now()
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	e.Seq = l.next
+	l.next++
+	l.ring[e.Seq%int64(len(l.ring))] = e
+	if l.f == nil {
+		return e, nil
+	}
+	_, err := l.f.Write(append(e.AppendJSON(nil), '\n'))
+	return e, err
+}
+
+// Last returns the Seq of the latest event, or 0 if there are none.
+func (l *Log) Last() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.next - 1
+}
+
+// Since calls fn on each event after seq, oldest first, until fn
+// returns an error, which Since returns. Events appended during the
+// call may or may not be visited. Events that have left the ring are
+// read from the file; without one, Since returns ErrExpired.
+func (l *Log) Since(ctx context.Context, seq int64, fn func(Event) error) error {
+	l.mu.Lock()
+	oldest := l.next - int64(len(l.ring))
+	l.mu.Unlock()
+	if seq+1 < oldest {
+		if l.path == "" {
+			return ErrExpired
+		}
+		_, err := l.scanFile(ctx, seq, func(e Event) error {
+			if e.Seq >= oldest {
+				return errRingReached
+			}
+			seq = e.Seq
+			return fn(e)
+		})
+		if err != errRingReached && err != nil {
+			return err
+		}
+		if seq+1 < oldest {
+			// Writing them to the file failed.
+			return fmt.Errorf("%w: file lacks events %d through %d", ErrExpired, seq+1, oldest-1)
+		}
+	}
+	buf := make([]Event, 0, chunk)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		buf = buf[:0]
+		l.mu.Lock()
+		if seq+1 < l.next-int64(len(l.ring)) {
+			// Overwritten while fn ran; the file has them.
+			l.mu.Unlock()
+			return l.Since(ctx, seq, fn)
+		}
+		for s := seq + 1; s < l.next && len(buf) < chunk; s++ {
+			buf = append(buf, l.ring[s%int64(len(l.ring))])
+		}
+		l.mu.Unlock()
+		if len(buf) == 0 {
+			return nil
+		}
+		for _, e := range buf {
+			if err := fn(e); err != nil {
+				return err
+			}
+			seq = e.Seq
+		}
+	}
+}
+
+var errRingReached = errors.New("reached the ring")
+
+// scanFile calls fn on each event in the file after seq, and returns
+// the offset just past the last complete line. A line still being
+// written, with no newline yet, is left for next time.
+func (l *Log) scanFile(ctx context.Context, seq int64, fn func(Event) error) (end int64, err error) {
+	f, err := os.Open(l.path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	br := bufio.NewReader(f)
+	for n := 1; ; n++ {
+		line, err := br.ReadBytes('\n')
+		if err == io.EOF {
+			return end, nil
+		}
+		if err != nil {
+			return end, err
+		}
+		if n%chunk == 0 {
+			if err := ctx.Err(); err != nil {
+				return end, err
+			}
+		}
+		var e Event
+		if err := json.Unmarshal(line, &e); err != nil {
+			return end, fmt.Errorf("line %d: %v", n, err)
+		}
+		end += int64(len(line))
+		if e.Seq <= seq {
+			continue
+		}
+		if err := fn(e); err != nil {
+			return end, err
+		}
+	}
+}
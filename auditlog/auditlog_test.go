@@ -0,0 +1,131 @@
+package auditlog
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func seqs(t *testing.T, l *Log, since int64) []int64 {
+	t.Helper()
+	var got []int64
+	if err := l.Since(context.Background(), since, func(e Event) error {
+		got = append(got, e.Seq)
+		return nil
+	}); err != nil {
+		t.Fatalf("Since(%d): %v", since, err)
+	}
+	return got
+}
+
+func TestAppendJSONMatchesEncodingJSON(t *testing.T) {
+	at := time.Date(2015, 8, 22, 10, 0, 0, 0, time.UTC)
+	for _, e := range []Event{
+		{Seq: 1, Time: at, Kind: Visit, Visitor: 42},
+		{Seq: 2, Time: at, Kind: Visit, Visitor: 51, Count: 9},
+		{Seq: 3, Time: at, Kind: Upload, Size: 1 << 20, Sum: "da39a3ee"},
+		{Seq: 4, Time: at, Kind: Upload, Size: 5, Alg: "sha256", Sum: "2cf24dba"},
+	} {
+		want, _ := json.Marshal(e)
+		if got := e.AppendJSON(nil); string(got) != string(want) {
+			t.Errorf("AppendJSON = %s; want %s", got, want)
+		}
+	}
+}
+
+func TestReadOldSHA1Field(t *testing.T) {
+	var e Event
+	if err := json.Unmarshal([]byte(`{"seq":3,"kind":"upload","size":5,"sha1":"aaf4"}`), &e); err != nil || e.Sum != "aaf4" || e.Seq != 3 {
+		t.Errorf("event with sha1 field = %+v, %v; want Sum aaf4", e, err)
+	}
+}
+
+func TestMemory(t *testing.T) {
+	l := New(100)
+	for i := 0; i < 250; i++ {
+		l.Append(Event{Kind: Visit, Visitor: int64(i + 1)})
+	}
+	if n := l.Last(); n != 250 {
+		t.Errorf("Last = %d; want 250", n)
+	}
+	got := seqs(t, l, 200)
+	if len(got) != 50 || got[0] != 201 || got[49] != 250 {
+		t.Errorf("Since(200) visited %d events, %v..; want 201 through 250", len(got), got[:1])
+	}
+	if got := seqs(t, l, 250); len(got) != 0 {
+		t.Errorf("Since(Last) = %v; want nothing", got)
+	}
+	if got := seqs(t, l, 150); len(got) != 100 {
+		t.Errorf("Since(150) visited %d events; want all 100 in the ring", len(got))
+	}
+	err := l.Since(context.Background(), 149, func(Event) error { return nil })
+	if !errors.Is(err, ErrExpired) {
+		t.Errorf("Since(149) = %v; want ErrExpired", err)
+	}
+}
+
+func TestFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.ndjson")
+	l, err := Open(path, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 30; i++ {
+		l.Append(Event{Kind: Upload, Size: int64(i + 1)})
+	}
+	// Old events come from the file, then the ring takes over.
+	got := seqs(t, l, 5)
+	if len(got) != 25 || got[0] != 6 || got[24] != 30 {
+		t.Errorf("Since(5) visited %d events; want 6 through 30", len(got))
+	}
+	for i, s := range got {
+		if s != int64(i+6) {
+			t.Fatalf("Since(5) visited %v; want consecutive", got)
+		}
+	}
+	l.Close()
+
+	// A torn last line is dropped on reopen, and numbering carries on.
+	f, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	f.WriteString(`{"seq":31,"ti`)
+	f.Close()
+	l, err = Open(path, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if e, err := l.Append(Event{Kind: Visit, Visitor: 1}); err != nil || e.Seq != 31 {
+		t.Errorf("Append after reopen = seq %d, %v; want 31, nil", e.Seq, err)
+	}
+	if got := seqs(t, l, 0); len(got) != 31 || got[30] != 31 {
+		t.Errorf("Since(0) after reopen visited %d events; want 31", len(got))
+	}
+}
+
+func TestSinceStops(t *testing.T) {
+	l := New(10)
+	for i := 0; i < 5; i++ {
+		l.Append(Event{Kind: Visit})
+	}
+	stop := errors.New("stop")
+	n := 0
+	err := l.Since(context.Background(), 0, func(Event) error {
+		n++
+		if n == 2 {
+			return stop
+		}
+		return nil
+	})
+	if err != stop || n != 2 {
+		t.Errorf("Since = %v after %d events; want fn's error after 2", err, n)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := l.Since(ctx, 0, func(Event) error { return nil }); err != context.Canceled {
+		t.Errorf("Since with canceled context = %v; want context.Canceled", err)
+	}
+}
@@ -0,0 +1,114 @@
+// Package x shows bounds-check elimination (BCE) on the loops that
+// build the upload response, "sha1 = <hex> in <n> bytes".
+//
+// Each indexing of a slice compiles to a bounds check unless the
+// compiler can prove the index is in range. The naive loops below
+// leave a check in every iteration; their BCE counterparts are
+// written so the proof is easy. See which checks remain with
+//
+//	go build -gcflags=-d=ssa/check_bce/debug=1
+//
+// (TestBoundsChecks does exactly that) and what it's worth with
+//
+//	go test -bench=.
+//
+// Expect little: a check that never fails is a perfectly predicted
+// branch, and on a 2026 Xeon each BCE version here runs at about the
+// speed of its naive one, except hexReslice, which is slower. Remove
+// checks from a loop the profiler points at, then measure; don't
+// contort code for BCE on faith.
+package x
+
+const hexDigits = "0123456789abcdef"
+
+// hexNaive writes the hex encoding of src to dst, which must be at
+// least twice as long. The compiler can't tell that i*2+1 is within
+// dst, so both stores are checked on every iteration.
+func hexNaive(dst, src []byte) {
+	for i, v := range src {
+		dst[i*2] = hexDigits[v>>4]
+		dst[i*2+1] = hexDigits[v&0x0f]
+	}
+}
+
+// hexBCE is hexNaive for a SHA-1 sum, the only size the response
+// needs. With both lengths constant the compiler proves every index
+// in range, leaving no checks at all.
+func hexBCE(dst *[40]byte, src *[20]byte) {
+	for i, v := range src {
+		dst[2*i] = hexDigits[v>>4]
+		dst[2*i+1] = hexDigits[v&0x0f]
+	}
+}
+
+// hexReslice is the other common BCE idiom: the loop condition states
+// what the body needs, len(dst) >= 2, so the stores to dst[0] and
+// dst[1] need no checks. It eliminates every check, yet it's about
+// three times slower than hexNaive: updating two slice headers per
+// byte costs more than two well-predicted checks ever did.
+func hexReslice(dst, src []byte) {
+	for len(src) > 0 && len(dst) >= 2 {
+		v := src[0]
+		dst[0] = hexDigits[v>>4]
+		dst[1] = hexDigits[v&0x0f]
+		dst, src = dst[2:], src[1:]
+	}
+}
+
+// itoaNaive writes n's decimal digits to the end of buf and returns
+// the index of the first. buf's length is unknown, so every digit's
+// store is checked.
+func itoaNaive(buf []byte, n uint64) int {
+	i := len(buf)
+	for n >= 10 {
+		i--
+		buf[i] = byte('0' + n%10)
+		n /= 10
+	}
+	i--
+	buf[i] = byte('0' + n)
+	return i
+}
+
+// itoaBCE writes to a fixed-size array, and the loop stops while i is
+// still positive, so only the store of the last digit is checked. A
+// uint64 has at most 20 digits, so the condition never actually cuts
+// the loop short.
+func itoaBCE(buf *[20]byte, n uint64) int {
+	i := len(buf)
+	for n >= 10 && i > 1 {
+		i--
+		buf[i] = byte('0' + n%10)
+		n /= 10
+	}
+	i--
+	buf[i] = byte('0' + n)
+	return i
+}
+
+// appendResponseNaive and appendResponseBCE append the upload
+// response to dst.
+
+func appendResponseNaive(dst []byte, sum [20]byte, size uint64) []byte {
+	dst = append(dst, "sha1 = "...)
+	n := len(dst)
+	dst = append(dst, make([]byte, 2*len(sum))...)
+	hexNaive(dst[n:], sum[:])
+	dst = append(dst, " in "...)
+	var buf [20]byte
+	i := itoaNaive(buf[:], size)
+	dst = append(dst, buf[i:]...)
+	return append(dst, " bytes"...)
+}
+
+func appendResponseBCE(dst []byte, sum [20]byte, size uint64) []byte {
+	dst = append(dst, "sha1 = "...)
+	var hex [2 * len(sum)]byte
+	hexBCE(&hex, &sum)
+	dst = append(dst, hex[:]...)
+	dst = append(dst, " in "...)
+	var buf [20]byte
+	i := itoaBCE(&buf, size)
+	dst = append(dst, buf[i:]...)
+	return append(dst, " bytes"...)
+}
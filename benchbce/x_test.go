@@ -0,0 +1,140 @@
+package x
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"testing"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/internal/benchtest"
+)
+
+var (
+	sum  = sha1.Sum([]byte("hello"))
+	sink []byte
+)
+
+func TestResponse(t *testing.T) {
+	want := fmt.Sprintf("sha1 = %x in %d bytes", sum, uint64(18446744073709551615))
+	for _, fn := range []func([]byte, [20]byte, uint64) []byte{appendResponseNaive, appendResponseBCE} {
+		if got := string(fn(nil, sum, 18446744073709551615)); got != want {
+			t.Errorf("got %q; want %q", got, want)
+		}
+		if got, want := string(fn(nil, sum, 0)), fmt.Sprintf("sha1 = %x in 0 bytes", sum); got != want {
+			t.Errorf("got %q; want %q", got, want)
+		}
+	}
+}
+
+func BenchmarkHexNaive(b *testing.B) {
+	dst := make([]byte, 40)
+	for benchtest.Loop(b) {
+		hexNaive(dst, sum[:])
+	}
+}
+
+func BenchmarkHexBCE(b *testing.B) {
+	var dst [40]byte
+	for benchtest.Loop(b) {
+		hexBCE(&dst, &sum)
+	}
+}
+
+func BenchmarkHexReslice(b *testing.B) {
+	dst := make([]byte, 40)
+	for benchtest.Loop(b) {
+		hexReslice(dst, sum[:])
+	}
+}
+
+func BenchmarkItoaNaive(b *testing.B) {
+	var buf [20]byte
+	for i := 0; benchtest.Loop(b); i++ {
+		itoaNaive(buf[:], uint64(i)*1e9)
+	}
+}
+
+func BenchmarkItoaBCE(b *testing.B) {
+	var buf [20]byte
+	for i := 0; benchtest.Loop(b); i++ {
+		itoaBCE(&buf, uint64(i)*1e9)
+	}
+}
+
+func BenchmarkResponseNaive(b *testing.B) {
+	b.ReportAllocs()
+	buf := make([]byte, 0, 128)
+	for i := 0; benchtest.Loop(b); i++ {
+		sink = appendResponseNaive(buf[:0], sum, uint64(i))
+	}
+}
+
+func BenchmarkResponseBCE(b *testing.B) {
+	b.ReportAllocs()
+	buf := make([]byte, 0, 128)
+	for i := 0; benchtest.Loop(b); i++ {
+		sink = appendResponseBCE(buf[:0], sum, uint64(i))
+	}
+}
+
+// TestBoundsChecks builds the package with the compiler reporting
+// each bounds check it couldn't eliminate, and checks that the BCE
+// versions really have fewer.
+func TestBoundsChecks(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping compiler run in short mode")
+	}
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("no go tool in $PATH")
+	}
+	out, err := exec.Command(goTool, "build", "-gcflags=-d=ssa/check_bce/debug=1", ".").CombinedOutput()
+	if err != nil {
+		t.Fatalf("go build: %v\n%s", err, out)
+	}
+	checks := checksByFunc(t, out)
+	t.Logf("bounds checks left: %v", checks)
+
+	for _, fn := range []string{"hexBCE", "hexReslice"} {
+		if n := checks[fn]; n != 0 {
+			t.Errorf("%s has %d bounds checks; want 0", fn, n)
+		}
+	}
+	for _, pair := range [][2]string{{"hexNaive", "hexBCE"}, {"itoaNaive", "itoaBCE"}} {
+		naive, bce := pair[0], pair[1]
+		if checks[naive] == 0 {
+			t.Errorf("%s has no bounds checks; the compiler got smarter, so the demo needs a new naive loop", naive)
+		}
+		if checks[bce] >= checks[naive] {
+			t.Errorf("%s has %d bounds checks, %s has %d; want fewer in %s", bce, checks[bce], naive, checks[naive], bce)
+		}
+	}
+}
+
+var rxCheck = regexp.MustCompile(`(?m)^\./x\.go:(\d+):\d+: Found Is(Slice)?InBounds$`)
+
+// checksByFunc maps the compiler's check_bce output to the functions
+// in x.go the reported lines fall in.
+func checksByFunc(t *testing.T, out []byte) map[string]int {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "x.go", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checks := make(map[string]int)
+	for _, m := range rxCheck.FindAllSubmatch(out, -1) {
+		line, _ := strconv.Atoi(string(m[1]))
+		for _, d := range f.Decls {
+			fd, ok := d.(*ast.FuncDecl)
+			if ok && fset.Position(fd.Pos()).Line <= line && line <= fset.Position(fd.End()).Line {
+				checks[fd.Name.Name]++
+			}
+		}
+	}
+	return checks
+}
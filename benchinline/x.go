@@ -0,0 +1,41 @@
+// Package x measures what a function call costs, to inform how deep
+// a middleware chain can get before its calls show up in profiles.
+//
+// The compiler inlines small functions, so the call itself vanishes;
+// //go:noinline keeps the call, to show what inlining saves. Calls
+// through an interface or a func value usually can't be inlined,
+// since the compiler can't see which function they'll reach. Run
+//
+//	go test -bench=.
+//
+// and see TestInlining for which of these the compiler inlines.
+package x
+
+func add(a, b int) int { return a + b }
+
+//go:noinline
+func addNoinline(a, b int) int { return a + b }
+
+type adder interface {
+	add(a, b int) int
+}
+
+type plus struct{}
+
+func (plus) add(a, b int) int { return a + b }
+
+// A handler is a stand-in for http.Handler: one func per layer.
+type handler func(int) int
+
+// wrap is a middleware: it returns a closure capturing next.
+func wrap(next handler) handler {
+	return func(x int) int { return next(x) + 1 }
+}
+
+// chain wraps h in n middlewares.
+func chain(h handler, n int) handler {
+	for i := 0; i < n; i++ {
+		h = wrap(h)
+	}
+	return h
+}
@@ -0,0 +1,94 @@
+package x
+
+import (
+	"os/exec"
+	"regexp"
+	"testing"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/internal/benchtest"
+)
+
+var sink int
+
+func BenchmarkDirect(b *testing.B) {
+	x := 0
+	for i := 0; benchtest.Loop(b); i++ {
+		x = add(x, i)
+	}
+	sink = x
+}
+
+func BenchmarkNoinline(b *testing.B) {
+	x := 0
+	for i := 0; benchtest.Loop(b); i++ {
+		x = addNoinline(x, i)
+	}
+	sink = x
+}
+
+// adders is a slice so the compiler can't prove which adder it holds
+// and devirtualize the call.
+var adders = []adder{plus{}}
+
+func BenchmarkInterface(b *testing.B) {
+	a := adders[0]
+	x := 0
+	for i := 0; benchtest.Loop(b); i++ {
+		x = a.add(x, i)
+	}
+	sink = x
+}
+
+func BenchmarkClosure(b *testing.B) {
+	y := 1
+	f := func(x int) int { return x + y } // captures y
+	fs := []func(int) int{f}
+	x := 0
+	for benchtest.Loop(b) {
+		x = fs[0](x)
+	}
+	sink = x
+}
+
+func benchChain(b *testing.B, depth int) {
+	h := chain(func(x int) int { return x }, depth)
+	x := 0
+	for benchtest.Loop(b) {
+		x = h(x)
+	}
+	sink = x
+}
+
+func BenchmarkChain1(b *testing.B)  { benchChain(b, 1) }
+func BenchmarkChain5(b *testing.B)  { benchChain(b, 5) }
+func BenchmarkChain20(b *testing.B) { benchChain(b, 20) }
+
+// TestInlining builds the package with -gcflags=-m=2 and checks the
+// compiler's inlining decisions are the ones the benchmarks assume.
+func TestInlining(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping compiler run in short mode")
+	}
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("no go tool in $PATH")
+	}
+	out, err := exec.Command(goTool, "build", "-gcflags=-m=2", ".").CombinedOutput()
+	if err != nil {
+		t.Fatalf("go build -gcflags=-m=2: %v\n%s", err, out)
+	}
+	for _, tt := range []struct {
+		rx   string
+		want bool
+	}{
+		{`can inline add( |$)`, true},
+		{`can inline plus\.add( |$)`, true},
+		{`can inline wrap( |$)`, true},
+		{`can inline addNoinline( |$)`, false},
+		{`cannot inline addNoinline: marked go:noinline`, true},
+	} {
+		if got := regexp.MustCompile(`(?m)^\S+: ` + tt.rx).Match(out); got != tt.want {
+			t.Errorf("-m=2 output matches %q = %v; want %v", tt.rx, got, tt.want)
+		}
+	}
+}
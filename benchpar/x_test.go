@@ -4,6 +4,8 @@ import (
 	"sync"
 	"sync/atomic"
 	"testing"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/internal/benchtest"
 )
 
 var (
@@ -50,7 +52,7 @@ func bench(b *testing.B, fn func()) {
 			}
 		})
 	} else {
-		for i := 0; i < b.N; i++ {
+		for benchtest.Loop(b) {
 			fn()
 		}
 	}
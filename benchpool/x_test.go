@@ -0,0 +1,182 @@
+// Package x contrasts reusing request-scoped objects through a
+// sync.Pool with allocating them fresh each time. Run with
+//
+//	go test -bench=. -benchmem
+//
+// Pooling wins when objects are big enough that allocating and
+// collecting them costs more than the pool's own bookkeeping. It
+// loses for tiny objects, and it can quietly waste memory when
+// objects vary in size, so measure before reaching for it.
+package x
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/internal/benchtest"
+)
+
+type small struct {
+	id    int64
+	flags uint32
+}
+
+type medium struct {
+	id     int64
+	header [16]string
+	buf    [1 << 10]byte
+}
+
+type large struct {
+	id  int64
+	buf [64 << 10]byte
+}
+
+var sink interface{}
+
+// bench runs fn in parallel. What fn returns is kept until the next
+// call, so fresh allocations really reach the heap, as they would if
+// a handler stored them anywhere, without every goroutine contending
+// on one global.
+func bench(b *testing.B, fn func() interface{}) {
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		var last interface{}
+		for pb.Next() {
+			last = fn()
+		}
+		sink = last
+	})
+}
+
+var (
+	smallPool  = sync.Pool{New: func() interface{} { return new(small) }}
+	mediumPool = sync.Pool{New: func() interface{} { return new(medium) }}
+	largePool  = sync.Pool{New: func() interface{} { return new(large) }}
+)
+
+// Each use writes the first and last bytes, like a handler filling in
+// its request state.
+
+func BenchmarkAllocSmall(b *testing.B) {
+	bench(b, func() interface{} {
+		s := new(small)
+		s.id, s.flags = 1, 2
+		return s
+	})
+}
+
+// BenchmarkPoolSmall gains little or nothing: a 16-byte object is
+// about as cheap to allocate as to Get and Put.
+func BenchmarkPoolSmall(b *testing.B) {
+	bench(b, func() interface{} {
+		s := smallPool.Get().(*small)
+		*s = small{}
+		s.id, s.flags = 1, 2
+		smallPool.Put(s)
+		return nil
+	})
+}
+
+func BenchmarkAllocMedium(b *testing.B) {
+	bench(b, func() interface{} {
+		m := new(medium)
+		m.id, m.buf[len(m.buf)-1] = 1, 2
+		return m
+	})
+}
+
+func BenchmarkPoolMedium(b *testing.B) {
+	bench(b, func() interface{} {
+		m := mediumPool.Get().(*medium)
+		*m = medium{}
+		m.id, m.buf[len(m.buf)-1] = 1, 2
+		mediumPool.Put(m)
+		return nil
+	})
+}
+
+func BenchmarkAllocLarge(b *testing.B) {
+	bench(b, func() interface{} {
+		l := new(large)
+		l.id, l.buf[len(l.buf)-1] = 1, 2
+		return l
+	})
+}
+
+func BenchmarkPoolLarge(b *testing.B) {
+	bench(b, func() interface{} {
+		l := largePool.Get().(*large)
+		l.id, l.buf[len(l.buf)-1] = 1, 2 // no need to clear all of buf
+		largePool.Put(l)
+		return nil
+	})
+}
+
+// BenchmarkPoolSliceValue is where pooling loses outright: putting a
+// []byte rather than a *[]byte in the pool converts the slice header
+// to an interface{}, which allocates on every Put. It's slower than
+// the allocation it meant to avoid and still allocates.
+var slicePool = sync.Pool{New: func() interface{} { return make([]byte, 64) }}
+
+func BenchmarkAllocSliceValue(b *testing.B) {
+	bench(b, func() interface{} {
+		buf := make([]byte, 64)
+		buf[0] = 1
+		return &buf[0] // a pointer, so returning it doesn't allocate too
+	})
+}
+
+func BenchmarkPoolSliceValue(b *testing.B) {
+	bench(b, func() interface{} {
+		buf := slicePool.Get().([]byte)
+		buf[0] = 1
+		slicePool.Put(buf)
+		return nil
+	})
+}
+
+// The mixed benchmarks need a 1 KB buffer for most requests and a
+// 1 MB one for every hundredth. Pooled buffers that grew stay grown,
+// so the pool fills with 1 MB buffers that mostly serve 1 KB
+// requests: far more memory held than the allocating version needs.
+// The retained-KB metric is the capacity of the buffer each request
+// ended up holding, on average.
+
+func mixedSize(i int) int {
+	if i%100 == 0 {
+		return 1 << 20
+	}
+	return 1 << 10
+}
+
+func BenchmarkAllocMixed(b *testing.B) {
+	b.ReportAllocs()
+	var held int
+	for i := 0; benchtest.Loop(b); i++ {
+		buf := make([]byte, mixedSize(i))
+		buf[len(buf)-1] = 1
+		held += cap(buf)
+		sink = buf
+	}
+	b.ReportMetric(float64(held)/float64(b.N)/1024, "retained-KB")
+}
+
+var mixedPool = sync.Pool{New: func() interface{} { return new([]byte) }}
+
+func BenchmarkPoolMixed(b *testing.B) {
+	b.ReportAllocs()
+	var held int
+	for i := 0; benchtest.Loop(b); i++ {
+		bp := mixedPool.Get().(*[]byte)
+		n := mixedSize(i)
+		if cap(*bp) < n {
+			*bp = make([]byte, n)
+		}
+		buf := (*bp)[:n]
+		buf[len(buf)-1] = 1
+		held += cap(buf)
+		mixedPool.Put(bp)
+	}
+	b.ReportMetric(float64(held)/float64(b.N)/1024, "retained-KB")
+}
@@ -0,0 +1,52 @@
+// Package x measures SHA-1 and SHA-256 throughput, the work behind
+// stepn's /upload, at a few input sizes. Run with
+//
+//	go test -v -bench=.
+//
+// The MB/s columns depend heavily on the CPU: with SHA extensions
+// (SHA-NI on x86, the ARMv8 crypto instructions on arm64) hashing can
+// be several times faster than without. TestImplementation logs which
+// implementation this machine gets. To see the difference on one
+// machine, turn the extensions off and compare:
+//
+//	GODEBUG=cpu.sha=off go test -bench=.
+package x
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"hash"
+	"strconv"
+	"testing"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/cpufeat"
+	"github.com/bradfitz/talk-yapc-asia-2015/internal/benchtest"
+)
+
+var sizes = []int{64, 1 << 10, 64 << 10}
+
+func TestImplementation(t *testing.T) {
+	info := cpufeat.Detect()
+	t.Logf("%s with %v: sha1 uses %s, sha256 uses %s", info.Arch, info.Features, info.SHA1, info.SHA256)
+}
+
+var sink []byte
+
+func benchHash(b *testing.B, newHash func() hash.Hash) {
+	for _, size := range sizes {
+		b.Run(strconv.Itoa(size), func(b *testing.B) {
+			buf := make([]byte, size)
+			h := newHash()
+			sum := make([]byte, 0, h.Size())
+			b.SetBytes(int64(size))
+			for benchtest.Loop(b) {
+				h.Reset()
+				h.Write(buf)
+				sink = h.Sum(sum[:0])
+			}
+		})
+	}
+}
+
+func BenchmarkSHA1(b *testing.B)   { benchHash(b, sha1.New) }
+func BenchmarkSHA256(b *testing.B) { benchHash(b, sha256.New) }
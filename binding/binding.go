@@ -0,0 +1,117 @@
+// Package binding reads and validates request parameters, collecting
+// every violation instead of stopping at the first, so a client with
+// several bad parameters learns about all of them in one 400.
+//
+//	b := binding.New(r)
+//	id := b.Match("id", rxOptionalID, errcode.ErrInvalidID)
+//	n := b.Int("n", 50, 1, 100)
+//	if err := b.Err(); err != nil {
+//		errcode.Write(w, err)
+//		return
+//	}
+package binding
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/errcode"
+)
+
+// A Violation is one invalid parameter.
+type Violation struct {
+	Param string `json:"param"`
+	Error string `json:"error"`
+
+	err error
+}
+
+// Errors is every Violation found in a request, in the order the
+// handler checked the parameters. That order is fixed by the handler's
+// code, so it doesn't depend on the order of the parameters in the
+// request.
+//
+// Errors wraps errcode.ErrInvalidParams, so errcode.Write replies
+// with a 400 and lists the violations in the response's details. It
+// also wraps each violation's own error.
+type Errors []Violation
+
+func (e Errors) Error() string {
+	var sb strings.Builder
+	sb.WriteString("invalid parameters: ")
+	for i, v := range e {
+		if i > 0 {
+			sb.WriteString("; ")
+		}
+		sb.WriteString(v.Param + ": " + v.Error)
+	}
+	return sb.String()
+}
+
+func (e Errors) Unwrap() []error {
+	errs := []error{errcode.ErrInvalidParams}
+	for _, v := range e {
+		errs = append(errs, v.err)
+	}
+	return errs
+}
+
+func (e Errors) Details() interface{} { return []Violation(e) }
+
+// A Binder reads parameters from one request.
+type Binder struct {
+	r    *http.Request
+	errs Errors
+}
+
+// New returns a Binder for r's form values.
+func New(r *http.Request) *Binder { return &Binder{r: r} }
+
+func (b *Binder) fail(name string, err error) {
+	b.errs = append(b.errs, Violation{Param: name, Error: err.Error(), err: err})
+}
+
+// Match returns the named parameter, recording err as a violation if
+// it doesn't match rx.
+func (b *Binder) Match(name string, rx *regexp.Regexp, err error) string {
+	v := b.r.FormValue(name)
+	if !rx.MatchString(v) {
+		b.fail(name, err)
+	}
+	return v
+}
+
+// Int returns the named parameter as an integer in [min, max], or def
+// if it's missing. A malformed or out of range value is a violation.
+func (b *Binder) Int(name string, def, min, max int64) int64 {
+	s := b.r.FormValue(name)
+	if s == "" {
+		return def
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < min || n > max {
+		b.fail(name, fmt.Errorf("must be an integer from %d to %d", min, max))
+		return def
+	}
+	return n
+}
+
+// Check records err as a violation of the named parameter if ok is
+// false, for rules the other methods don't cover.
+func (b *Binder) Check(name string, ok bool, err error) {
+	if !ok {
+		b.fail(name, err)
+	}
+}
+
+// Err returns the violations found so far as Errors, or nil if there
+// were none.
+func (b *Binder) Err() error {
+	if len(b.errs) == 0 {
+		return nil
+	}
+	return b.errs
+}
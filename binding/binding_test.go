@@ -0,0 +1,93 @@
+package binding
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"testing"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/errcode"
+)
+
+var rxDigits = regexp.MustCompile(`^\d*$`)
+
+// bind checks the same parameters, in the same order, as a handler would.
+func bind(url string) error {
+	b := New(httptest.NewRequest("GET", url, nil))
+	b.Match("id", rxDigits, errcode.ErrInvalidID)
+	b.Int("n", 50, 1, 100)
+	b.Check("sort", b.r.FormValue("sort") != "sideways", errors.New("unknown sort order"))
+	return b.Err()
+}
+
+func params(err error) []string {
+	var out []string
+	for _, v := range err.(Errors) {
+		out = append(out, v.Param)
+	}
+	return out
+}
+
+func TestValid(t *testing.T) {
+	if err := bind("/?id=12&n=3"); err != nil {
+		t.Errorf("valid params: %v", err)
+	}
+	b := New(httptest.NewRequest("GET", "/", nil))
+	if n := b.Int("n", 50, 1, 100); n != 50 || b.Err() != nil {
+		t.Errorf("missing n = %d, %v; want default 50", n, b.Err())
+	}
+}
+
+func TestAllViolationsCollected(t *testing.T) {
+	err := bind("/?id=x&n=1000&sort=sideways")
+	if got, want := params(err), []string{"id", "n", "sort"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("violations = %q; want %q", got, want)
+	}
+	if !errors.Is(err, errcode.ErrInvalidParams) || !errors.Is(err, errcode.ErrInvalidID) {
+		t.Errorf("%v should wrap ErrInvalidParams and ErrInvalidID", err)
+	}
+	if got := errcode.Lookup(err); got != errcode.ErrInvalidParams {
+		t.Errorf("Lookup = %q; want invalid_params", got.Code)
+	}
+}
+
+func TestOrderStable(t *testing.T) {
+	// The order is the handler's check order, however the query is
+	// written and however often it's asked.
+	want := []string{"id", "n", "sort"}
+	for _, url := range []string{
+		"/?id=x&n=0&sort=sideways",
+		"/?sort=sideways&n=0&id=x",
+		"/?n=0&sort=sideways&id=x",
+	} {
+		for i := 0; i < 10; i++ {
+			if got := params(bind(url)); !reflect.DeepEqual(got, want) {
+				t.Fatalf("%s: violations = %q; want %q", url, got, want)
+			}
+		}
+	}
+}
+
+func TestWriteDetails(t *testing.T) {
+	rw := httptest.NewRecorder()
+	errcode.Write(rw, bind("/?n=zero&id=x"))
+	if rw.Code != 400 {
+		t.Errorf("status = %d; want 400", rw.Code)
+	}
+	var res struct {
+		Code    string
+		Details []Violation
+	}
+	if err := json.Unmarshal(rw.Body.Bytes(), &res); err != nil {
+		t.Fatalf("bad JSON %q: %v", rw.Body, err)
+	}
+	want := []Violation{
+		{Param: "id", Error: "optional numeric id is invalid"},
+		{Param: "n", Error: "must be an integer from 1 to 100"},
+	}
+	if res.Code != "invalid_params" || !reflect.DeepEqual(res.Details, want) {
+		t.Errorf("response = %+v; want invalid_params with %+v", res, want)
+	}
+}
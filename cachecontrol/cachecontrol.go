@@ -0,0 +1,132 @@
+// Package cachecontrol sets each response's Cache-Control header from
+// one table of routes, so how long a client or proxy may keep a
+// response is decided in one place rather than by each handler.
+package cachecontrol
+
+import (
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Cache-Control values for the usual classes of route.
+const (
+	// Immutable is for content whose URL changes when it does, such
+	// as a static file with a version in its name: keep it a year
+	// and never revalidate.
+	Immutable = "public, max-age=31536000, immutable"
+
+	// NoStore is for live numbers, such as stats, that are stale as
+	// soon as they're sent, and for anything secret.
+	NoStore = "no-store"
+
+	// Private is for pages that differ by visitor, such as one
+	// reading a session cookie: only the browser may keep it, and
+	// must revalidate it, with its ETag if it has one, before reuse.
+	Private = "private, no-cache"
+
+	// Revalidate lets any cache keep a response, as long as it
+	// checks with the server before each reuse.
+	Revalidate = "no-cache"
+)
+
+// A Policy says which Cache-Control value goes on which routes'
+// responses.
+type Policy struct {
+	// Default is the value for a path no route matches. Empty means
+	// no header.
+	Default string
+
+	// Routes gives the value by request path. A key ending in "/"
+	// matches the whole subtree under it, as with http.ServeMux, and
+	// the longest matching key wins.
+	Routes map[string]string
+}
+
+// For returns the Cache-Control value p gives a successful response
+// for path.
+func (p *Policy) For(path string) string {
+	v, best := p.Default, -1
+	for pat, rv := range p.Routes {
+		if pat == path || strings.HasSuffix(pat, "/") && strings.HasPrefix(path, pat) {
+			if len(pat) > best {
+				v, best = rv, len(pat)
+			}
+		}
+	}
+	return v
+}
+
+// Wrap wraps h to set Cache-Control on its responses as p says. Only
+// a 2xx or 304 response gets its route's value; any other status
+// gets NoStore, so a missing file's 404 or an overloaded server's 503
+// is never cached as if it were the answer. A Cache-Control h sets
+// itself is left alone.
+func (p *Policy) Wrap(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cw := &writer{ResponseWriter: w, p: p, path: r.URL.Path}
+		h.ServeHTTP(cw, r)
+		if !cw.wroteHeader {
+			// An empty 200, which net/http is about to send.
+			cw.setHeader(http.StatusOK)
+		}
+	})
+}
+
+type writer struct {
+	http.ResponseWriter
+	p           *Policy
+	path        string
+	wroteHeader bool
+}
+
+func (w *writer) setHeader(code int) {
+	w.wroteHeader = true
+	hdr := w.Header()
+	if _, set := hdr["Cache-Control"]; set {
+		return
+	}
+	v := NoStore
+	if code >= 200 && code < 300 || code == http.StatusNotModified {
+		v = w.p.For(w.path)
+	}
+	if v != "" {
+		hdr.Set("Cache-Control", v)
+	}
+}
+
+func (w *writer) WriteHeader(code int) {
+	if !w.wroteHeader && code >= 200 {
+		w.setHeader(code)
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.setHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// Flush lets event streams flush through the wrapper.
+func (w *writer) Flush() {
+	if !w.wroteHeader {
+		w.setHeader(http.StatusOK)
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// ReadFrom lets a body copied in, as http.ServeContent copies a file,
+// reach the underlying writer's ReadFrom, which on Linux is sendfile.
+func (w *writer) ReadFrom(src io.Reader) (int64, error) {
+	if !w.wroteHeader {
+		w.setHeader(http.StatusOK)
+	}
+	return io.Copy(w.ResponseWriter, src)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *writer) Unwrap() http.ResponseWriter { return w.ResponseWriter }
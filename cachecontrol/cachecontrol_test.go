@@ -0,0 +1,69 @@
+package cachecontrol
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWrap(t *testing.T) {
+	p := &Policy{
+		Default: Revalidate,
+		Routes: map[string]string{
+			"/":              Private,
+			"/static/":       Immutable,
+			"/static/dev/":   NoStore,
+			"/stats":         NoStore,
+			"/debug/logtail": "",
+		},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/missing":
+			http.NotFound(w, r)
+		case "/unchanged":
+			w.WriteHeader(http.StatusNotModified)
+		case "/own":
+			w.Header().Set("Cache-Control", "max-age=60")
+			io.WriteString(w, "mine")
+		case "/flushed":
+			w.(http.Flusher).Flush()
+		case "/empty":
+		default:
+			io.WriteString(w, "hello")
+		}
+	})
+	h := p.Wrap(mux)
+	for _, tt := range []struct {
+		path, want string
+	}{
+		{"/", Private},
+		{"/some/page", Private},
+		{"/static/app.3f2a.js", Immutable},
+		{"/static/dev/app.js", NoStore},
+		{"/stats", NoStore},
+		{"/stats/more", Private}, // "/stats" has no subtree
+		{"/debug/logtail", ""},
+		{"/missing", NoStore},
+		{"/unchanged", Private},
+		{"/own", "max-age=60"},
+		{"/flushed", Private},
+		{"/empty", Private},
+	} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", tt.path, nil))
+		got, set := rec.Header()["Cache-Control"]
+		if tt.want == "" && set || tt.want != "" && (len(got) != 1 || got[0] != tt.want) {
+			t.Errorf("%s: Cache-Control = %q; want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestDefault(t *testing.T) {
+	p := &Policy{Default: Revalidate, Routes: map[string]string{"/stats": NoStore}}
+	if got := p.For("/anything"); got != Revalidate {
+		t.Errorf("For(/anything) = %q; want the default %q", got, Revalidate)
+	}
+}
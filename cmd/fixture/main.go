@@ -0,0 +1,50 @@
+// The fixture command writes a fixture of demo state for stepn to
+// start from, the workshop's unless its flags say otherwise:
+//
+//	fixture -o workshop.json
+//	stepn serve -fixture=workshop.json
+//
+// The same flags always write the same fixture, so every run of the
+// talk starts from the same state.
+package main
+
+import (
+	"flag"
+	"io"
+	"log"
+	"os"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/fixture"
+)
+
+var (
+	out      = flag.String("o", "-", `file to write the fixture to, or "-" for stdout`)
+	visitors = flag.Int64("visitors", fixture.Workshop.Visitors, "visitor count")
+	nUploads = flag.Int("uploads", fixture.Workshop.Uploads, "uploads in the history")
+	sessions = flag.Int("sessions", fixture.Workshop.Sessions, "resumable uploads part way through")
+	blobs    = flag.Int("blobs", fixture.Workshop.Blobs, "files to serve under /blob/")
+	seed     = flag.Int64("seed", fixture.Workshop.Seed, "seed for the generated uploads and content")
+)
+
+// write writes the fixture spec describes to w.
+func write(w io.Writer, spec fixture.Spec) error {
+	return fixture.Generate(spec).Write(w)
+}
+
+func main() {
+	flag.Parse()
+	spec := fixture.Workshop
+	spec.Visitors, spec.Uploads, spec.Sessions, spec.Blobs, spec.Seed = *visitors, *nUploads, *sessions, *blobs, *seed
+	w := io.Writer(os.Stdout)
+	if *out != "-" {
+		f, err := os.Create(*out)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		w = f
+	}
+	if err := write(w, spec); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/fixture"
+)
+
+func TestWrite(t *testing.T) {
+	spec := fixture.Workshop
+	spec.Visitors, spec.Uploads = 42, 5
+	var buf bytes.Buffer
+	if err := write(&buf, spec); err != nil {
+		t.Fatal(err)
+	}
+	got, err := fixture.Read(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := fixture.Generate(spec); !reflect.DeepEqual(got, want) {
+		t.Errorf("read back %+v; want %+v", got, want)
+	}
+}
@@ -0,0 +1,47 @@
+// The webhookd command is a webhook receiver for trying out stepn's
+// -webhook notifications: it checks each request's signature and
+// prints the event.
+//
+//	webhookd -secret=s3cret &
+//	stepn -webhook=http://127.0.0.1:9090/ -webhooksecret=s3cret
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"net/http"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/webhook"
+)
+
+var (
+	addr   = flag.String("addr", "127.0.0.1:9090", "host:port to listen on")
+	secret = flag.String("secret", "", "shared secret the sender signs with")
+)
+
+func handler(secret []byte) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "bad method; want POST", http.StatusMethodNotAllowed)
+			return
+		}
+		ev, err := webhook.Receive(secret, r)
+		if err != nil {
+			log.Printf("Rejected request from %s: %v", r.RemoteAddr, err)
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		data, _ := json.Marshal(ev.Data)
+		log.Printf("%s at %s: %s", ev.Type, ev.Time.Format("15:04:05"), data)
+	})
+}
+
+func main() {
+	flag.Parse()
+	if *secret == "" {
+		log.Fatal("-secret is required")
+	}
+	log.Printf("Receiving webhooks on %s", *addr)
+	log.Fatal(http.ListenAndServe(*addr, handler([]byte(*secret))))
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/webhook"
+)
+
+func TestHandler(t *testing.T) {
+	h := handler([]byte("s3cret"))
+	body := []byte(`{"type":"visitor.milestone","time":"2015-08-22T10:00:00Z","data":{"visitor":1000}}`)
+	for _, tt := range []struct {
+		name string
+		sig  string
+		want int
+	}{
+		{"signed", webhook.Sign([]byte("s3cret"), body, time.Now()), 200},
+		{"wrong secret", webhook.Sign([]byte("guess"), body, time.Now()), 401},
+		{"unsigned", "", 401},
+	} {
+		req := httptest.NewRequest("POST", "/", bytes.NewReader(body))
+		req.Header.Set(webhook.SignatureHeader, tt.sig)
+		rw := httptest.NewRecorder()
+		h.ServeHTTP(rw, req)
+		if rw.Code != tt.want {
+			t.Errorf("%s: status %d; want %d", tt.name, rw.Code, tt.want)
+		}
+	}
+}
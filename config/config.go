@@ -0,0 +1,121 @@
+// Package config lets every flag of the demo servers also be set from
+// the environment, for running them where editing a command line is
+// awkward, such as in a container. Call Parse instead of flag.Parse.
+//
+// The variable for a flag is YAPC_ and its name in upper case, with
+// dashes as underscores: -listen falls back to $YAPC_LISTEN. A flag
+// given on the command line wins over its variable.
+package config
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Listen is the address the servers' main listener binds, shared so
+// every server spells the flag the same way. See Listener.
+var (
+	Listen     = flag.String("listen", "127.0.0.1:8080", "host:port to serve on, or unix:/path/to.sock for a Unix socket; ignored under systemd socket activation")
+	SocketMode = flag.String("socketmode", "0660", "with -listen=unix:..., the socket file's permissions, in octal")
+)
+
+// Listener listens on addr, which is a TCP host:port or, with a
+// "unix:" prefix, the path of a Unix socket, such as one for nginx to
+// proxy to. A socket file left by a server that died is removed
+// first, but not one a running server is still accepting on. The
+// socket gets the permissions in -socketmode, and its file is removed
+// when the listener is closed.
+//
+// If systemd started the process by socket activation, Listener
+// returns the socket systemd passed instead, and addr is ignored; the
+// unit's .socket file says where to listen. Likewise for the socket
+// passed by a server restarting through StartReplacement.
+func Listener(addr string) (net.Listener, error) {
+	if ln, err := activated(); ln != nil || err != nil {
+		return ln, err
+	}
+	if ln, err := inherited(); ln != nil || err != nil {
+		return ln, err
+	}
+	path, ok := strings.CutPrefix(addr, "unix:")
+	if !ok {
+		return net.Listen("tcp", addr)
+	}
+	mode, err := strconv.ParseUint(*SocketMode, 8, 32)
+	if err != nil {
+		return nil, fmt.Errorf("bad -socketmode %q: %v", *SocketMode, err)
+	}
+	if fi, err := os.Lstat(path); err == nil {
+		if fi.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and isn't a socket", path)
+		}
+		if c, err := net.Dial("unix", path); err == nil {
+			c.Close()
+			return nil, fmt.Errorf("%s is in use by another server", path)
+		}
+		os.Remove(path)
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, os.FileMode(mode)); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+// EnvName returns the environment variable for the named flag.
+func EnvName(flagName string) string {
+	return "YAPC_" + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// Parse parses the command line, then sets each flag not on it from
+// its environment variable, if that's set. A bad value exits the
+// process with status 2, as flag.Parse does.
+func Parse() { ParseArgs(flag.CommandLine, os.Args[1:]) }
+
+// ParseArgs is Parse for another FlagSet and arguments, such as a
+// subcommand's. Its flags fall back to the same variables, so a
+// subcommand's -admin and the server's share $YAPC_ADMIN.
+func ParseArgs(fs *flag.FlagSet, args []string) {
+	usage := fs.Usage
+	if usage == nil {
+		usage = fs.PrintDefaults
+	}
+	fs.Usage = func() {
+		usage()
+		fmt.Fprintf(fs.Output(), "Any flag may instead be set in the environment, as %s for -listen.\n", EnvName("listen"))
+	}
+	if err := parse(fs, args, os.LookupEnv); err != nil {
+		fmt.Fprintln(fs.Output(), err)
+		fs.Usage()
+		os.Exit(2)
+	}
+}
+
+func parse(fs *flag.FlagSet, args []string, lookupEnv func(string) (string, bool)) error {
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	onCommandLine := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { onCommandLine[f.Name] = true })
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if err != nil || onCommandLine[f.Name] {
+			return
+		}
+		env := EnvName(f.Name)
+		if v, ok := lookupEnv(env); ok {
+			if serr := fs.Set(f.Name, v); serr != nil {
+				err = fmt.Errorf("invalid value %q for $%s: %v", v, env, serr)
+			}
+		}
+	})
+	return err
+}
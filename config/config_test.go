@@ -0,0 +1,120 @@
+package config
+
+import (
+	"context"
+	"flag"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEnvName(t *testing.T) {
+	for name, want := range map[string]string{
+		"listen":     "YAPC_LISTEN",
+		"drain":      "YAPC_DRAIN",
+		"max-upload": "YAPC_MAX_UPLOAD",
+	} {
+		if got := EnvName(name); got != want {
+			t.Errorf("EnvName(%q) = %q; want %q", name, got, want)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	newFlags := func() (*flag.FlagSet, *string, *time.Duration, *int) {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		return fs, fs.String("listen", "127.0.0.1:8080", ""), fs.Duration("drain", 10*time.Second, ""), fs.Int("bufsize", 32, "")
+	}
+	env := map[string]string{
+		"YAPC_LISTEN":  ":9000",
+		"YAPC_DRAIN":   "3s",
+		"YAPC_UNKNOWN": "ignored",
+	}
+	lookup := func(k string) (string, bool) { v, ok := env[k]; return v, ok }
+
+	fs, listen, drain, bufsize := newFlags()
+	if err := parse(fs, []string{"-drain=1m"}, lookup); err != nil {
+		t.Fatal(err)
+	}
+	if *listen != ":9000" {
+		t.Errorf("listen = %q; want the environment's :9000", *listen)
+	}
+	if *drain != time.Minute {
+		t.Errorf("drain = %v; want the command line's 1m", *drain)
+	}
+	if *bufsize != 32 {
+		t.Errorf("bufsize = %d; want the default 32", *bufsize)
+	}
+
+	env["YAPC_BUFSIZE"] = "lots"
+	fs, _, _, _ = newFlags()
+	if err := parse(fs, nil, lookup); err == nil || !strings.Contains(err.Error(), "$YAPC_BUFSIZE") {
+		t.Errorf("bad environment value: err = %v; want one naming $YAPC_BUFSIZE", err)
+	}
+}
+
+func TestUnixListener(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "demo.sock")
+	ln, err := Listener("unix:" + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go http.Serve(ln, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "hello over "+r.Host)
+	}))
+
+	if fi, err := os.Stat(path); err != nil || fi.Mode().Perm() != 0660 {
+		t.Errorf("socket mode = %v, %v; want 0660", fi.Mode().Perm(), err)
+	}
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", path)
+		},
+	}}
+	res, err := client.Get("http://demo/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	if string(body) != "hello over demo" {
+		t.Errorf("got %q", body)
+	}
+
+	if _, err := Listener("unix:" + path); err == nil {
+		t.Error("second listener on a socket in use succeeded")
+	}
+	ln.Close()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("socket file left after Close: %v", err)
+	}
+}
+
+func TestUnixListenerStale(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "demo.sock")
+	// Leave a socket file behind, as a crashed server would.
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln.(*net.UnixListener).SetUnlinkOnClose(false)
+	ln.Close()
+
+	ln, err = Listener("unix:" + path)
+	if err != nil {
+		t.Fatalf("over a stale socket: %v", err)
+	}
+	ln.Close()
+
+	os.WriteFile(path, []byte("not a socket"), 0644)
+	if _, err := Listener("unix:" + path); err == nil {
+		t.Error("replaced a regular file")
+	}
+}
@@ -0,0 +1,93 @@
+package config
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+)
+
+// Variables a server sets for the replacement StartReplacement starts.
+const (
+	listenFDEnv  = "YAPC_LISTEN_FD"  // the listener is on fd 3
+	handoffFDEnv = "YAPC_HANDOFF_FD" // fd 4 reaches EOF on release
+)
+
+// StartReplacement starts a new copy of this program, with the same
+// arguments, to take over ln for a restart without downtime: the
+// replacement's Listener returns ln's socket instead of listening
+// anew, so no connection is refused in between.
+//
+// The replacement's WaitHandoff blocks until release is called, so
+// the old process can finish its requests and save its state for the
+// new one to load first. Meanwhile new connections wait in the
+// socket's backlog.
+//
+// Under systemd, which watches the main process's PID, restart the
+// unit instead.
+func StartReplacement(ln net.Listener) (release func(), err error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	return startReplacement(ln, exe, os.Args[1:])
+}
+
+func startReplacement(ln net.Listener, name string, args []string) (release func(), err error) {
+	fl, ok := ln.(interface{ File() (*os.File, error) })
+	if !ok {
+		return nil, errors.New("listener can't be handed off")
+	}
+	f, err := fl.File()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	defer pr.Close()
+
+	cmd := exec.Command(name, args...)
+	cmd.Env = append(os.Environ(), listenFDEnv+"=3", handoffFDEnv+"=4")
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	cmd.ExtraFiles = []*os.File{f, pr}
+	if err := cmd.Start(); err != nil {
+		pw.Close()
+		return nil, err
+	}
+	cmd.Process.Release()
+	// Closing a Unix socket's listener would remove the file the
+	// replacement is now listening behind.
+	if ul, ok := ln.(*net.UnixListener); ok {
+		ul.SetUnlinkOnClose(false)
+	}
+	return func() { pw.Close() }, nil
+}
+
+// WaitHandoff, in a server started by StartReplacement, blocks until
+// the old server releases it. Elsewhere it returns at once. Call it
+// before loading any state the old server saves on its way out.
+func WaitHandoff() {
+	if os.Getenv(handoffFDEnv) == "" {
+		return
+	}
+	os.Unsetenv(handoffFDEnv)
+	f := os.NewFile(4, "handoff")
+	io.Copy(io.Discard, f)
+	f.Close()
+}
+
+// inherited returns the listener a server restarting by
+// StartReplacement passed this process, or nil if there isn't one.
+func inherited() (net.Listener, error) {
+	if os.Getenv(listenFDEnv) == "" {
+		return nil, nil
+	}
+	os.Unsetenv(listenFDEnv)
+	f := os.NewFile(3, "inherited listener")
+	defer f.Close()
+	return net.FileListener(f)
+}
@@ -0,0 +1,79 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestHandoffChild is the replacement process of TestHandoff.
+func TestHandoffChild(t *testing.T) {
+	if os.Getenv("CONFIG_TEST_HANDOFF_CHILD") != "1" {
+		t.Skip("only run as TestHandoff's child")
+	}
+	WaitHandoff()
+	released := time.Now()
+	ln, err := Listener("127.0.0.1:0") // ignored
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	c, err := ln.Accept()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Fprintf(c, "%s released at %d\n", ln.Addr(), released.UnixNano())
+	c.Close()
+	os.Exit(0)
+}
+
+func TestHandoff(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no fd inheritance on Windows")
+	}
+	t.Setenv("CONFIG_TEST_HANDOFF_CHILD", "1")
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	release, err := startReplacement(ln, os.Args[0], []string{"-test.run=^TestHandoffChild$"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A client arriving mid-restart connects, and waits in the
+	// backlog for the replacement.
+	c, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	ln.Close()
+	time.Sleep(50 * time.Millisecond) // as if draining
+	releasedAt := time.Now()
+	release()
+
+	c.SetDeadline(time.Now().Add(10 * time.Second))
+	line, err := bufio.NewReader(c).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	var gotAddr string
+	var childReleased int64
+	if _, err := fmt.Sscanf(strings.TrimSpace(line), "%s released at %d", &gotAddr, &childReleased); err != nil {
+		t.Fatalf("child said %q: %v", line, err)
+	}
+	if gotAddr != addr {
+		t.Errorf("child listened on %s; want the inherited %s", gotAddr, addr)
+	}
+	if time.Unix(0, childReleased).Before(releasedAt) {
+		t.Errorf("child stopped waiting before release")
+	}
+}
@@ -0,0 +1,43 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+)
+
+// listenFdsStart is the first descriptor systemd passes, per
+// sd_listen_fds(3).
+const listenFdsStart = 3
+
+// activated returns the socket systemd passed this process for socket
+// activation, or nil if it didn't pass one. Only one socket is
+// supported. The variables are cleared so that a child process
+// doesn't think the socket is its own.
+func activated() (net.Listener, error) {
+	fds := os.Getenv("LISTEN_FDS")
+	// LISTEN_PID guards against variables inherited from a parent
+	// that was activated itself.
+	if fds == "" || os.Getenv("LISTEN_PID") != strconv.Itoa(os.Getpid()) {
+		return nil, nil
+	}
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+	n, err := strconv.Atoi(fds)
+	if err != nil || n < 1 {
+		return nil, fmt.Errorf("bad LISTEN_FDS %q", fds)
+	}
+	if n > 1 {
+		return nil, fmt.Errorf("systemd passed %d sockets; want 1", n)
+	}
+	f := os.NewFile(listenFdsStart, "systemd socket")
+	// FileListener dups the descriptor, so f can go.
+	defer f.Close()
+	ln, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("systemd socket: %v", err)
+	}
+	return ln, nil
+}
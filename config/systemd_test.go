@@ -0,0 +1,96 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// TestActivatedChild is the child process of TestSocketActivation.
+func TestActivatedChild(t *testing.T) {
+	if os.Getenv("CONFIG_TEST_ACTIVATED_CHILD") != "1" {
+		t.Skip("only run as TestSocketActivation's child")
+	}
+	// An address it can't listen on, to show it's not used.
+	ln, err := Listener("unix:/nonexistent/dir/demo.sock")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	c, err := ln.Accept()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Fprintf(c, "%s LISTEN_FDS=%q\n", ln.Addr(), os.Getenv("LISTEN_FDS"))
+	c.Close()
+	os.Exit(0)
+}
+
+func TestSocketActivation(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no socket activation on Windows")
+	}
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("no sh to set LISTEN_PID with")
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := ln.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	addr := ln.Addr().String()
+	ln.Close() // f keeps the socket open for the child
+
+	// Like systemd, pass the socket as fd 3 and set LISTEN_PID to the
+	// child's PID, which sh's $$ is once it execs.
+	cmd := exec.Command(sh, "-c", `LISTEN_PID=$$ exec "$0" "$@"`, os.Args[0], "-test.run=^TestActivatedChild$")
+	cmd.Env = append(os.Environ(), "CONFIG_TEST_ACTIVATED_CHILD=1", "LISTEN_FDS=1")
+	cmd.ExtraFiles = []*os.File{f}
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer cmd.Process.Kill()
+	f.Close()
+
+	c, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	line, err := bufio.NewReader(c).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := addr + ` LISTEN_FDS=""`; strings.TrimSpace(line) != want {
+		t.Errorf("child said %q; want %q", line, want)
+	}
+	if err := cmd.Wait(); err != nil {
+		t.Errorf("child: %v", err)
+	}
+}
+
+func TestNotActivated(t *testing.T) {
+	// Variables meant for some other process are left alone.
+	t.Setenv("LISTEN_FDS", "1")
+	t.Setenv("LISTEN_PID", "1")
+	ln, err := Listener("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	if os.Getenv("LISTEN_FDS") != "1" {
+		t.Error("LISTEN_FDS cleared for a different process")
+	}
+}
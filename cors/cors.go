@@ -0,0 +1,113 @@
+// Package cors lets browser apps on other origins call the server's
+// JSON API, by answering CORS preflight requests and marking the
+// responses to allowed origins as readable.
+package cors
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/errcode"
+)
+
+// A Policy says which cross-origin requests browsers may make.
+type Policy struct {
+	// Origins are the allowed origins, such as
+	// "https://app.example.com". "*" allows any origin.
+	Origins []string
+	Methods []string      // allowed methods; default GET, HEAD, and POST
+	Headers []string      // request headers allowed beyond the CORS-safelisted ones
+	MaxAge  time.Duration // how long browsers may cache a preflight; 0 for not at all
+}
+
+func (p *Policy) methods() []string {
+	if len(p.Methods) == 0 {
+		return []string{"GET", "HEAD", "POST"}
+	}
+	return p.Methods
+}
+
+func (p *Policy) allowOrigin(origin string) bool {
+	for _, o := range p.Origins {
+		if o == "*" || strings.EqualFold(o, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Policy) allowMethod(m string) bool {
+	for _, am := range p.methods() {
+		if am == m {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Policy) allowHeader(h string) bool {
+	for _, ah := range p.Headers {
+		if strings.EqualFold(ah, h) {
+			return true
+		}
+	}
+	return false
+}
+
+// Wrap wraps h to apply p. Requests without an Origin header, such as
+// same-origin ones and those from curl, pass through untouched.
+//
+// A preflight (an OPTIONS request with Access-Control-Request-Method)
+// is answered here with a 204 if the origin, method, and headers it
+// asks about are all allowed, and a 403 if not. Other requests from an
+// allowed origin reach h with Access-Control-Allow-Origin set; from
+// any other origin, they reach h without it, and the browser keeps the
+// response from the page.
+func (p *Policy) Wrap(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+		hdr := w.Header()
+		hdr.Add("Vary", "Origin")
+		reqMethod := r.Header.Get("Access-Control-Request-Method")
+		if r.Method != "OPTIONS" || reqMethod == "" {
+			if p.allowOrigin(origin) {
+				hdr.Set("Access-Control-Allow-Origin", origin)
+			}
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		hdr.Add("Vary", "Access-Control-Request-Method")
+		hdr.Add("Vary", "Access-Control-Request-Headers")
+		if !p.allowOrigin(origin) || !p.allowMethod(reqMethod) {
+			errcode.Write(w, errcode.ErrForbidden)
+			return
+		}
+		var reqHeaders []string
+		for _, f := range strings.Split(r.Header.Get("Access-Control-Request-Headers"), ",") {
+			if f = strings.TrimSpace(f); f == "" {
+				continue
+			}
+			if !p.allowHeader(f) {
+				errcode.Write(w, errcode.ErrForbidden)
+				return
+			}
+			reqHeaders = append(reqHeaders, f)
+		}
+		hdr.Set("Access-Control-Allow-Origin", origin)
+		hdr.Set("Access-Control-Allow-Methods", strings.Join(p.methods(), ", "))
+		if len(reqHeaders) > 0 {
+			hdr.Set("Access-Control-Allow-Headers", strings.Join(reqHeaders, ", "))
+		}
+		if p.MaxAge > 0 {
+			hdr.Set("Access-Control-Max-Age", strconv.Itoa(int(p.MaxAge/time.Second)))
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,111 @@
+package cors
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWrap(t *testing.T) {
+	p := &Policy{
+		Origins: []string{"https://app.example.com"},
+		Methods: []string{"GET", "POST"},
+		Headers: []string{"Content-Type", "Authorization"},
+		MaxAge:  10 * time.Minute,
+	}
+	h := p.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("handled"))
+	}))
+	const app = "https://app.example.com"
+	for _, tt := range []struct {
+		name    string
+		method  string
+		headers map[string]string
+
+		code       int
+		handled    bool
+		allowOrig  string
+		allowHdrs  string
+		maxAge     string
+		wantMethod bool // Access-Control-Allow-Methods set
+	}{
+		{name: "same origin", method: "GET", code: 200, handled: true},
+		{name: "allowed GET", method: "GET", headers: map[string]string{"Origin": app}, code: 200, handled: true, allowOrig: app},
+		{name: "origin case", method: "GET", headers: map[string]string{"Origin": "https://APP.example.com"}, code: 200, handled: true, allowOrig: "https://APP.example.com"},
+		{name: "other origin GET", method: "GET", headers: map[string]string{"Origin": "https://evil.example"}, code: 200, handled: true},
+		{name: "plain OPTIONS", method: "OPTIONS", headers: map[string]string{"Origin": app}, code: 200, handled: true, allowOrig: app},
+		{
+			name: "preflight", method: "OPTIONS",
+			headers: map[string]string{"Origin": app, "Access-Control-Request-Method": "POST", "Access-Control-Request-Headers": "content-type, authorization"},
+			code:    204, allowOrig: app, allowHdrs: "content-type, authorization", maxAge: "600", wantMethod: true,
+		},
+		{
+			name: "preflight without headers", method: "OPTIONS",
+			headers: map[string]string{"Origin": app, "Access-Control-Request-Method": "GET"},
+			code:    204, allowOrig: app, maxAge: "600", wantMethod: true,
+		},
+		{
+			name: "preflight from other origin", method: "OPTIONS",
+			headers: map[string]string{"Origin": "https://evil.example", "Access-Control-Request-Method": "GET"},
+			code:    403,
+		},
+		{
+			name: "preflight for disallowed method", method: "OPTIONS",
+			headers: map[string]string{"Origin": app, "Access-Control-Request-Method": "DELETE"},
+			code:    403,
+		},
+		{
+			name: "preflight for disallowed header", method: "OPTIONS",
+			headers: map[string]string{"Origin": app, "Access-Control-Request-Method": "POST", "Access-Control-Request-Headers": "Content-Type, X-Secret"},
+			code:    403,
+		},
+	} {
+		req := httptest.NewRequest(tt.method, "/", nil)
+		for k, v := range tt.headers {
+			req.Header.Set(k, v)
+		}
+		rw := httptest.NewRecorder()
+		h.ServeHTTP(rw, req)
+		hdr := rw.Header()
+		if rw.Code != tt.code {
+			t.Errorf("%s: status %d; want %d", tt.name, rw.Code, tt.code)
+		}
+		if handled := rw.Body.String() == "handled"; handled != tt.handled {
+			t.Errorf("%s: reached handler = %v; want %v", tt.name, handled, tt.handled)
+		}
+		if got := hdr.Get("Access-Control-Allow-Origin"); got != tt.allowOrig {
+			t.Errorf("%s: Allow-Origin = %q; want %q", tt.name, got, tt.allowOrig)
+		}
+		if got := hdr.Get("Access-Control-Allow-Headers"); got != tt.allowHdrs {
+			t.Errorf("%s: Allow-Headers = %q; want %q", tt.name, got, tt.allowHdrs)
+		}
+		if got := hdr.Get("Access-Control-Max-Age"); got != tt.maxAge {
+			t.Errorf("%s: Max-Age = %q; want %q", tt.name, got, tt.maxAge)
+		}
+		if got := hdr.Get("Access-Control-Allow-Methods"); (got == "GET, POST") != tt.wantMethod {
+			t.Errorf("%s: Allow-Methods = %q", tt.name, got)
+		}
+		if varies := len(hdr.Values("Vary")) > 0; varies != (tt.headers["Origin"] != "") {
+			t.Errorf("%s: Vary = %q", tt.name, hdr.Values("Vary"))
+		}
+	}
+}
+
+func TestWildcard(t *testing.T) {
+	h := (&Policy{Origins: []string{"*"}}).Wrap(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	req := httptest.NewRequest("OPTIONS", "/", nil)
+	req.Header.Set("Origin", "https://anywhere.example")
+	req.Header.Set("Access-Control-Request-Method", "HEAD")
+	rw := httptest.NewRecorder()
+	h.ServeHTTP(rw, req)
+	if rw.Code != 204 || rw.Header().Get("Access-Control-Allow-Origin") != "https://anywhere.example" {
+		t.Errorf("preflight = %d, Allow-Origin %q", rw.Code, rw.Header().Get("Access-Control-Allow-Origin"))
+	}
+	if got := rw.Header().Get("Access-Control-Allow-Methods"); got != "GET, HEAD, POST" {
+		t.Errorf("default Allow-Methods = %q", got)
+	}
+	if got := rw.Header().Get("Access-Control-Max-Age"); got != "" {
+		t.Errorf("Max-Age = %q with none configured", got)
+	}
+}
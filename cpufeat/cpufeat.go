@@ -0,0 +1,112 @@
+// Package cpufeat reports which CPU features crypto/sha1 and
+// crypto/sha256 can use on this machine, and so which of their
+// implementations is running. The same benchmark can differ several
+// times over between two laptops just because one has SHA extensions.
+//
+// The standard library doesn't export its own feature detection, so
+// this reads /proc/cpuinfo and mirrors the library's selection logic.
+// Elsewhere than Linux the implementations are reported as unknown.
+package cpufeat
+
+import (
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// Info describes the hashing this process gets.
+type Info struct {
+	Arch     string   `json:"arch"`
+	Features []string `json:"features"` // the relevant ones the CPU has, by GODEBUG name
+	SHA1     string   `json:"sha1"`     // implementation crypto/sha1 uses
+	SHA256   string   `json:"sha256"`   // implementation crypto/sha256 uses
+}
+
+// Detect inspects the CPU and the GODEBUG environment variable, which
+// can turn features off (GODEBUG=cpu.sha=off).
+func Detect() Info {
+	cpuinfo, _ := os.ReadFile("/proc/cpuinfo")
+	return detect(runtime.GOARCH, string(cpuinfo), os.Getenv("GODEBUG"))
+}
+
+// cpuinfoNames maps the /proc/cpuinfo names of the features that
+// matter to their GODEBUG option names.
+var cpuinfoNames = map[string]map[string]string{
+	"amd64": {
+		"avx":    "avx",
+		"avx2":   "avx2",
+		"bmi1":   "bmi1",
+		"bmi2":   "bmi2",
+		"sha_ni": "sha",
+		"sse4_1": "sse41",
+		"ssse3":  "ssse3",
+	},
+	"arm64": {
+		"sha1": "sha1",
+		"sha2": "sha2",
+	},
+}
+
+func detect(arch, cpuinfo, godebug string) Info {
+	info := Info{Arch: arch, Features: []string{}, SHA1: "unknown", SHA256: "unknown"}
+	names, ok := cpuinfoNames[arch]
+	if !ok || cpuinfo == "" {
+		return info
+	}
+	has := map[string]bool{}
+	for _, line := range strings.Split(cpuinfo, "\n") {
+		key, val, ok := strings.Cut(line, ":")
+		key = strings.TrimSpace(key)
+		if !ok || (key != "flags" && key != "Features") {
+			continue
+		}
+		for _, f := range strings.Fields(val) {
+			if name, ok := names[f]; ok {
+				has[name] = true
+			}
+		}
+		break // the first CPU speaks for all
+	}
+	for _, opt := range strings.Split(godebug, ",") {
+		name, ok := strings.CutPrefix(strings.TrimSpace(opt), "cpu.")
+		if !ok || !strings.HasSuffix(name, "=off") {
+			continue
+		}
+		name = strings.TrimSuffix(name, "=off")
+		if name == "all" {
+			has = map[string]bool{}
+		}
+		delete(has, name)
+	}
+	for _, name := range names {
+		if has[name] {
+			info.Features = append(info.Features, name)
+		}
+	}
+	sort.Strings(info.Features)
+
+	switch arch {
+	case "amd64":
+		shani := has["avx"] && has["sha"] && has["sse41"] && has["ssse3"]
+		info.SHA1, info.SHA256 = "amd64 assembly", "amd64 assembly"
+		switch {
+		case shani:
+			info.SHA1, info.SHA256 = "SHA-NI", "SHA-NI"
+		case has["avx"] && has["avx2"] && has["bmi2"]:
+			info.SHA256 = "AVX2"
+			if has["bmi1"] {
+				info.SHA1 = "AVX2 (inputs of 256 bytes or more)"
+			}
+		}
+	case "arm64":
+		info.SHA1, info.SHA256 = "generic Go", "generic Go"
+		if has["sha1"] {
+			info.SHA1 = "ARMv8 SHA1 instructions"
+		}
+		if has["sha2"] {
+			info.SHA256 = "ARMv8 SHA2 instructions"
+		}
+	}
+	return info
+}
@@ -0,0 +1,33 @@
+package cpufeat
+
+import (
+	"reflect"
+	"testing"
+)
+
+const (
+	x86Modern = "processor\t: 0\nflags\t\t: fpu sse2 ssse3 sse4_1 avx avx2 bmi1 bmi2 sha_ni\n\nprocessor\t: 1\nflags\t\t: fpu\n"
+	x86Old    = "processor\t: 0\nflags\t\t: fpu sse2 ssse3 sse4_1 avx\n"
+	arm       = "processor\t: 0\nFeatures\t: fp asimd aes pmull sha1 sha2 crc32\n"
+)
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		arch, cpuinfo, godebug string
+		want                   Info
+	}{
+		{"amd64", x86Modern, "", Info{"amd64", []string{"avx", "avx2", "bmi1", "bmi2", "sha", "sse41", "ssse3"}, "SHA-NI", "SHA-NI"}},
+		{"amd64", x86Modern, "cpu.sha=off", Info{"amd64", []string{"avx", "avx2", "bmi1", "bmi2", "sse41", "ssse3"}, "AVX2 (inputs of 256 bytes or more)", "AVX2"}},
+		{"amd64", x86Modern, "http2debug=1,cpu.all=off", Info{"amd64", []string{}, "amd64 assembly", "amd64 assembly"}},
+		{"amd64", x86Old, "", Info{"amd64", []string{"avx", "sse41", "ssse3"}, "amd64 assembly", "amd64 assembly"}},
+		{"arm64", arm, "", Info{"arm64", []string{"sha1", "sha2"}, "ARMv8 SHA1 instructions", "ARMv8 SHA2 instructions"}},
+		{"arm64", arm, "cpu.sha2=off", Info{"arm64", []string{"sha1"}, "ARMv8 SHA1 instructions", "generic Go"}},
+		{"amd64", "", "", Info{"amd64", []string{}, "unknown", "unknown"}},
+		{"riscv64", "isa\t: rv64imafdc\n", "", Info{"riscv64", []string{}, "unknown", "unknown"}},
+	}
+	for _, tt := range tests {
+		if got := detect(tt.arch, tt.cpuinfo, tt.godebug); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("detect(%s, GODEBUG=%q) = %+v; want %+v", tt.arch, tt.godebug, got, tt.want)
+		}
+	}
+}
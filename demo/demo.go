@@ -5,6 +5,8 @@ import (
 	"log"
 	"net/http"
 	"regexp"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/config"
 )
 
 var visitors int
@@ -22,7 +24,12 @@ func handleHi(w http.ResponseWriter, r *http.Request) {
 }
 
 func main() {
-	log.Printf("Starting on port 8080")
+	config.Parse()
+	ln, err := config.Listener(*config.Listen)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Starting on %s", *config.Listen)
 	http.HandleFunc("/hi", handleHi)
-	log.Fatal(http.ListenAndServe("127.0.0.1:8080", nil))
+	log.Fatal(http.Serve(ln, nil))
 }
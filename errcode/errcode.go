@@ -0,0 +1,92 @@
+// Package errcode defines the errors the demo's handlers and backends
+// share, and maps them in one place to HTTP statuses and the
+// machine-readable codes clients see in JSON error responses.
+//
+// Backends wrap a sentinel with %w so that handlers can report the
+// underlying cause while clients still get a stable code:
+//
+//	return fmt.Errorf("reading count: %w", errcode.ErrBackendUnavailable)
+package errcode
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// An Error is an error with an HTTP status and a machine-readable code.
+type Error struct {
+	Code   string // stable identifier, such as "bad_method"
+	Status int    // HTTP status code
+	Msg    string // human-readable description
+}
+
+func (e *Error) Error() string { return e.Msg }
+
+var (
+	ErrBadMethod          = &Error{"bad_method", http.StatusMethodNotAllowed, "bad method"}
+	ErrUnauthorized       = &Error{"unauthorized", http.StatusUnauthorized, "unauthorized"}
+	ErrForbidden          = &Error{"forbidden", http.StatusForbidden, "forbidden"}
+	ErrInvalidID          = &Error{"invalid_id", http.StatusBadRequest, "optional numeric id is invalid"}
+	ErrInvalidParams      = &Error{"invalid_params", http.StatusBadRequest, "invalid parameters"}
+	ErrTooLarge           = &Error{"too_large", http.StatusRequestEntityTooLarge, "request body too large"}
+	ErrBadBody            = &Error{"bad_body", http.StatusBadRequest, "malformed request body"}
+	ErrBadDigest          = &Error{"bad_digest", http.StatusBadRequest, "malformed expected digest"}
+	ErrDigestMismatch     = &Error{"digest_mismatch", http.StatusUnprocessableEntity, "body doesn't match its expected digest"}
+	ErrRateLimited        = &Error{"rate_limited", http.StatusTooManyRequests, "too many requests"}
+	ErrBackendUnavailable = &Error{"backend_unavailable", http.StatusServiceUnavailable, "backend unavailable"}
+	ErrBadGateway         = &Error{"bad_gateway", http.StatusBadGateway, "upstream server failed"}
+	ErrOverloaded         = &Error{"overloaded", http.StatusServiceUnavailable, "server overloaded"}
+	ErrCursorExpired      = &Error{"cursor_expired", http.StatusGone, "cursor too old"}
+	ErrUploadNotFound     = &Error{"upload_not_found", http.StatusNotFound, "no such upload, or it expired"}
+	ErrUploadConflict     = &Error{"upload_conflict", http.StatusConflict, "chunk doesn't continue the upload"}
+)
+
+// internal describes errors that carry no *Error.
+var internal = &Error{"internal", http.StatusInternalServerError, "internal error"}
+
+// Lookup returns the *Error that err is or wraps. Errors from the
+// standard library with an obvious equivalent map to it; anything
+// else is an internal error.
+func Lookup(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	var mbe *http.MaxBytesError
+	if errors.As(err, &mbe) {
+		return ErrTooLarge
+	}
+	return internal
+}
+
+// A Response is the JSON body of an error response.
+type Response struct {
+	Code    string      `json:"code"`
+	Error   string      `json:"error"`
+	Details interface{} `json:"details,omitempty"`
+}
+
+// A Detailer is an error with structured detail for clients, such as
+// a list of every invalid parameter.
+type Detailer interface {
+	error
+	Details() interface{}
+}
+
+// Write replies to the request with err as JSON, using the status and
+// code from Lookup. The message is err's full text, including any
+// wrapped cause. If err is or wraps a Detailer, its details are
+// included too.
+func Write(w http.ResponseWriter, err error) {
+	e := Lookup(err)
+	res := Response{Code: e.Code, Error: err.Error()}
+	var d Detailer
+	if errors.As(err, &d) {
+		res.Details = d.Details()
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(e.Status)
+	json.NewEncoder(w).Encode(res)
+}
@@ -0,0 +1,60 @@
+package errcode
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestIsAs(t *testing.T) {
+	err := fmt.Errorf("loading count: %w", ErrBackendUnavailable)
+	if !errors.Is(err, ErrBackendUnavailable) {
+		t.Errorf("errors.Is(wrapped, ErrBackendUnavailable) = false")
+	}
+	if errors.Is(err, ErrTooLarge) {
+		t.Errorf("errors.Is(wrapped, ErrTooLarge) = true")
+	}
+	var e *Error
+	if !errors.As(err, &e) || e.Code != "backend_unavailable" {
+		t.Errorf("errors.As(wrapped) = %v; want backend_unavailable", e)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	rw := httptest.NewRecorder()
+	_, mbe := ioutil.ReadAll(http.MaxBytesReader(rw, ioutil.NopCloser(strings.NewReader("too long")), 3))
+	tests := []struct {
+		err  error
+		want *Error
+	}{
+		{ErrBadMethod, ErrBadMethod},
+		{fmt.Errorf("id %q: %w", "x", ErrInvalidID), ErrInvalidID},
+		{mbe, ErrTooLarge},
+		{errors.New("boom"), internal},
+	}
+	for _, tt := range tests {
+		if got := Lookup(tt.err); got != tt.want {
+			t.Errorf("Lookup(%v) = %v; want %v", tt.err, got.Code, tt.want.Code)
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	rw := httptest.NewRecorder()
+	Write(rw, fmt.Errorf("loading count: %w", ErrBackendUnavailable))
+	if rw.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d; want 503", rw.Code)
+	}
+	var res Response
+	if err := json.Unmarshal(rw.Body.Bytes(), &res); err != nil {
+		t.Fatalf("bad JSON %q: %v", rw.Body, err)
+	}
+	if res.Code != "backend_unavailable" || res.Error != "loading count: backend unavailable" {
+		t.Errorf("response = %+v", res)
+	}
+}
@@ -0,0 +1,188 @@
+// Package fixture reads and writes the demo state stepn can start
+// from with serve -fixture: the visitor count, the upload history,
+// resumable uploads part way through, and files for /blob/. With a
+// fixture, every run of the talk starts from the same state, and one
+// with something in it to show.
+//
+// cmd/fixture writes the workshop's fixture:
+//
+//	go run ./cmd/fixture >workshop.json
+//	stepn serve -fixture=workshop.json
+package fixture
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/store"
+)
+
+// A Fixture is a server's state to start from.
+type Fixture struct {
+	Visitors int64          `json:"visitors"`
+	Uploads  []store.Upload `json:"uploads,omitempty"` // oldest first, as they were added
+	Sessions []Session      `json:"sessions,omitempty"`
+	Blobs    []Blob         `json:"blobs,omitempty"`
+}
+
+// A Session is a resumable upload part way through. Its chunks are
+// the bytes received so far, which the server hashes into the
+// session's state as if they'd been uploaded.
+type Session struct {
+	ID     string   `json:"id"`
+	Alg    string   `json:"alg"`
+	Total  int64    `json:"total"` // the whole upload's size, or -1 if unknown
+	Chunks []string `json:"chunks"`
+}
+
+// Received returns the number of bytes of s's upload received.
+func (s Session) Received() int64 {
+	var n int64
+	for _, c := range s.Chunks {
+		n += int64(len(c))
+	}
+	return n
+}
+
+// A Blob is a file to serve under /blob/.
+type Blob struct {
+	Name string `json:"name"` // a file name, without directories
+	Data string `json:"data"`
+}
+
+// Read reads a fixture written by Write, and checks it.
+func Read(r io.Reader) (*Fixture, error) {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	f := new(Fixture)
+	if err := dec.Decode(f); err != nil {
+		return nil, fmt.Errorf("fixture: %v", err)
+	}
+	if err := f.check(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *Fixture) check() error {
+	if f.Visitors < 0 {
+		return fmt.Errorf("fixture: negative visitor count %d", f.Visitors)
+	}
+	ids := make(map[string]bool)
+	for _, s := range f.Sessions {
+		switch {
+		case s.ID == "" || ids[s.ID]:
+			return fmt.Errorf("fixture: session ID %q is empty or repeated", s.ID)
+		case s.Alg == "":
+			return fmt.Errorf("fixture: session %s has no alg", s.ID)
+		case s.Total >= 0 && s.Received() >= s.Total:
+			return fmt.Errorf("fixture: session %s has %d of its %d bytes; it's not part way through", s.ID, s.Received(), s.Total)
+		}
+		ids[s.ID] = true
+	}
+	names := make(map[string]bool)
+	for _, b := range f.Blobs {
+		if b.Name == "" || b.Name != path.Base(b.Name) || strings.HasPrefix(b.Name, ".") || names[b.Name] {
+			return fmt.Errorf("fixture: blob name %q isn't a plain file name, or is repeated", b.Name)
+		}
+		names[b.Name] = true
+	}
+	return nil
+}
+
+// Write writes f as indented JSON, for reading with Read and for
+// people to edit.
+func (f *Fixture) Write(w io.Writer) error {
+	if err := f.check(); err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(f)
+}
+
+// A Spec says how much of each kind of state Generate makes.
+type Spec struct {
+	Visitors int64
+	Uploads  int
+	Sessions int
+	Blobs    int
+	Start    time.Time // the first upload's time; the rest follow a few minutes apart
+	Seed     int64
+}
+
+// Workshop is the spec of the fixture the talk starts from: a visitor
+// count just short of a milestone, a page of upload history, and a
+// couple of uploads to resume.
+var Workshop = Spec{
+	Visitors: 9990,
+	Uploads:  30,
+	Sessions: 2,
+	Blobs:    3,
+	Start:    time.Date(2015, 8, 22, 9, 0, 0, 0, time.UTC),
+	Seed:     1,
+}
+
+// Generate returns a fixture made to spec. The same spec always makes
+// the same fixture.
+func Generate(spec Spec) *Fixture {
+	rnd := rand.New(rand.NewSource(spec.Seed))
+	f := &Fixture{Visitors: spec.Visitors}
+	t := spec.Start
+	for i := 0; i < spec.Uploads; i++ {
+		t = t.Add(time.Duration(1+rnd.Intn(5)) * time.Minute)
+		body := content(rnd, 1+rnd.Intn(64<<10))
+		u := store.Upload{Time: t, Size: int64(len(body))}
+		if i%3 == 2 {
+			u.Alg, u.Sum = "sha256", fmt.Sprintf("%x", sha256.Sum256([]byte(body)))
+		} else {
+			u.Sum = fmt.Sprintf("%x", sha1.Sum([]byte(body)))
+		}
+		f.Uploads = append(f.Uploads, u)
+	}
+	for i := 0; i < spec.Sessions; i++ {
+		id := sha256.Sum256([]byte(fmt.Sprintf("session %d of seed %d", i, spec.Seed)))
+		s := Session{ID: hex.EncodeToString(id[:16]), Alg: "sha1"}
+		if i%2 == 1 {
+			s.Alg = "sha256"
+		}
+		// Two chunks in, with one to go.
+		size := 1 + rnd.Intn(16<<10)
+		for j := 0; j < 2; j++ {
+			s.Chunks = append(s.Chunks, content(rnd, size))
+		}
+		s.Total = 3 * int64(size)
+		f.Sessions = append(f.Sessions, s)
+	}
+	for i := 0; i < spec.Blobs; i++ {
+		f.Blobs = append(f.Blobs, Blob{
+			Name: fmt.Sprintf("slide-%02d.txt", i+1),
+			Data: content(rnd, 1<<10+rnd.Intn(4<<10)),
+		})
+	}
+	return f
+}
+
+// words are what generated content is made of, so it reads as text
+// in a terminal and compresses like it.
+var words = strings.Fields(`go gopher http handler profile allocation
+	escape inline benchmark goroutine channel mutex sync pool buffer
+	sha1 hash counter visitor yapc tokyo`)
+
+// content returns n bytes of words.
+func content(rnd *rand.Rand, n int) string {
+	var b strings.Builder
+	for b.Len() < n {
+		b.WriteString(words[rnd.Intn(len(words))])
+		b.WriteByte(' ')
+	}
+	return b.String()[:n]
+}
@@ -0,0 +1,62 @@
+package fixture
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	want := Generate(Workshop)
+	var buf bytes.Buffer
+	if err := want.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Read(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Read(Write(f)) differs from f:\n got %+v\nwant %+v", got, want)
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	f := Generate(Workshop)
+	if f.Visitors != Workshop.Visitors || len(f.Uploads) != Workshop.Uploads || len(f.Sessions) != Workshop.Sessions || len(f.Blobs) != Workshop.Blobs {
+		t.Errorf("Generate(Workshop) = %d visitors, %d uploads, %d sessions, %d blobs; want %+v",
+			f.Visitors, len(f.Uploads), len(f.Sessions), len(f.Blobs), Workshop)
+	}
+	for i := 1; i < len(f.Uploads); i++ {
+		if !f.Uploads[i].Time.After(f.Uploads[i-1].Time) {
+			t.Errorf("upload %d at %v isn't after upload %d at %v", i, f.Uploads[i].Time, i-1, f.Uploads[i-1].Time)
+		}
+	}
+	if !reflect.DeepEqual(Generate(Workshop), f) {
+		t.Error("Generate(Workshop) made a different fixture the second time")
+	}
+	other := Workshop
+	other.Seed++
+	if reflect.DeepEqual(Generate(other), f) {
+		t.Error("Generate made the same fixture from another seed")
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	for _, in := range []string{
+		`{"visitors":-1}`,
+		`{"visitor":5}`,
+		`{"sessions":[{"id":"a","alg":"sha1","total":-1},{"id":"a","alg":"sha1","total":-1}]}`,
+		`{"sessions":[{"id":"a","total":-1}]}`,
+		`{"sessions":[{"id":"a","alg":"sha1","total":3,"chunks":["abc"]}]}`,
+		`{"blobs":[{"name":"../etc/passwd"}]}`,
+		`{"blobs":[{"name":".hidden"}]}`,
+		`{"blobs":[{"name":"a"},{"name":"a"}]}`,
+		`[]`,
+	} {
+		if f, err := Read(strings.NewReader(in)); err == nil {
+			t.Errorf("Read(%s) = %+v; want an error", in, f)
+		}
+	}
+}
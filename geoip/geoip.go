@@ -0,0 +1,96 @@
+// Package geoip maps IP addresses to country codes using a table of
+// address ranges read from CSV, one range per line:
+//
+//	1.0.0.0,1.0.0.255,AU
+//	2001:200::,2001:200:ffff:ffff:ffff:ffff:ffff:ffff,JP
+//
+// Free tables in this shape (such as DB-IP's "IP to Country Lite")
+// are easy to come by. Lines starting with # are comments.
+package geoip
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"sort"
+	"strings"
+)
+
+type entry struct {
+	first, last netip.Addr
+	country     string
+}
+
+// A DB is a loaded range table. It's read-only, so safe for
+// concurrent use.
+type DB struct {
+	ranges []entry // sorted by first; no overlaps
+}
+
+// Open loads the table in the named file.
+func Open(path string) (*DB, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	db, err := Load(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return db, nil
+}
+
+// Load reads a table from r. Ranges may be in any order but mustn't
+// overlap.
+func Load(r io.Reader) (*DB, error) {
+	cr := csv.NewReader(r)
+	cr.Comment = '#'
+	cr.FieldsPerRecord = 3
+	db := new(DB)
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := cr.FieldPos(0)
+		first, err1 := netip.ParseAddr(strings.TrimSpace(rec[0]))
+		last, err2 := netip.ParseAddr(strings.TrimSpace(rec[1]))
+		if err1 != nil || err2 != nil || first.Is4() != last.Is4() || last.Less(first) {
+			return nil, fmt.Errorf("line %d: bad range %s-%s", line, rec[0], rec[1])
+		}
+		db.ranges = append(db.ranges, entry{first, last, strings.ToUpper(strings.TrimSpace(rec[2]))})
+	}
+	sort.Slice(db.ranges, func(i, j int) bool { return db.ranges[i].first.Less(db.ranges[j].first) })
+	for i := 1; i < len(db.ranges); i++ {
+		if !db.ranges[i-1].last.Less(db.ranges[i].first) {
+			return nil, fmt.Errorf("range starting %v overlaps the one before it", db.ranges[i].first)
+		}
+	}
+	return db, nil
+}
+
+// Len returns the number of ranges in the table.
+func (db *DB) Len() int { return len(db.ranges) }
+
+// Lookup returns the country code for ip, or "" if no range holds it.
+// IPv4-mapped IPv6 addresses are looked up as IPv4.
+func (db *DB) Lookup(ip netip.Addr) string {
+	ip = ip.Unmap()
+	// The last range starting at or before ip is the only one that
+	// could hold it.
+	i := sort.Search(len(db.ranges), func(i int) bool { return ip.Less(db.ranges[i].first) }) - 1
+	if i < 0 {
+		return ""
+	}
+	e := db.ranges[i]
+	if e.first.Is4() != ip.Is4() || e.last.Less(ip) {
+		return ""
+	}
+	return e.country
+}
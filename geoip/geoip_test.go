@@ -0,0 +1,56 @@
+package geoip
+
+import (
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+const table = `# first,last,country
+2001:200::,2001:200:ffff:ffff:ffff:ffff:ffff:ffff,jp
+1.0.0.0,1.0.0.255,AU
+1.0.1.0,1.0.3.255,CN
+8.8.8.0,8.8.8.255,US
+`
+
+func TestLookup(t *testing.T) {
+	db, err := Load(strings.NewReader(table))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if db.Len() != 4 {
+		t.Errorf("Len = %d; want 4", db.Len())
+	}
+	for _, tt := range []struct {
+		ip, want string
+	}{
+		{"1.0.0.0", "AU"},
+		{"1.0.0.255", "AU"},
+		{"1.0.2.7", "CN"},
+		{"1.0.4.0", ""},
+		{"0.255.255.255", ""},
+		{"8.8.8.8", "US"},
+		{"::ffff:8.8.8.8", "US"},
+		{"2001:200::1", "JP"},
+		{"2001:201::", ""},
+		{"::1", ""},
+	} {
+		if got := db.Lookup(netip.MustParseAddr(tt.ip)); got != tt.want {
+			t.Errorf("Lookup(%s) = %q; want %q", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	for _, bad := range []string{
+		"1.0.0.0,1.0.0.255\n",
+		"1.0.0.0,nope,AU\n",
+		"1.0.0.9,1.0.0.1,AU\n",
+		"1.0.0.0,::1,AU\n",
+		"1.0.0.0,1.0.0.255,AU\n1.0.0.128,1.0.1.0,CN\n",
+	} {
+		if _, err := Load(strings.NewReader(bad)); err == nil {
+			t.Errorf("Load(%q) succeeded; want error", bad)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package gziphttp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/internal/benchtest"
+)
+
+var page = strings.Repeat("<p>You are visitor number 123456! This is your 3rd visit.</p>\n", 64)
+
+func TestWrap(t *testing.T) {
+	c := &Compressor{MinSize: 100}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/big", func(w http.ResponseWriter, r *http.Request) {
+		// In pieces smaller than MinSize, to be held back.
+		for i := 0; i < len(page); i += 50 {
+			io.WriteString(w, page[i:min(i+50, len(page))])
+		}
+	})
+	mux.HandleFunc("/small", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, "tiny")
+	})
+	mux.HandleFunc("/created", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, page)
+	})
+	mux.HandleFunc("/png", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		io.WriteString(w, page)
+	})
+	mux.HandleFunc("/encoded", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "br")
+		io.WriteString(w, page)
+	})
+	mux.HandleFunc("/stream", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "data: 1\n\n")
+		w.(http.Flusher).Flush()
+		io.WriteString(w, page)
+	})
+	mux.HandleFunc("/binary", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		io.WriteString(w, page)
+	})
+	mux.HandleFunc("/copied", func(w http.ResponseWriter, r *http.Request) {
+		// Through the writer's ReadFrom.
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		io.Copy(w, struct{ io.Reader }{strings.NewReader(page)})
+	})
+	mux.HandleFunc("/copiedbinary", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		io.Copy(w, struct{ io.Reader }{strings.NewReader(page)})
+	})
+	mux.HandleFunc("/ranged", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "page.html", time.Time{}, strings.NewReader(page))
+	})
+	mux.HandleFunc("/notmodified", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotModified)
+	})
+	h := c.Wrap(mux)
+
+	for _, tt := range []struct {
+		path, rng, acceptEncoding string
+
+		code    int
+		gzipped bool
+		ctype   string
+		body    string
+	}{
+		{path: "/big", acceptEncoding: "gzip", code: 200, gzipped: true, ctype: "text/html; charset=utf-8", body: page},
+		{path: "/big", acceptEncoding: "gzip;q=0", code: 200, ctype: "text/html; charset=utf-8", body: page},
+		{path: "/big", code: 200, ctype: "text/html; charset=utf-8", body: page},
+		{path: "/small", acceptEncoding: "gzip", code: 200, ctype: "text/plain", body: "tiny"},
+		{path: "/created", acceptEncoding: "gzip", code: 201, gzipped: true, ctype: "application/json", body: page},
+		{path: "/png", acceptEncoding: "gzip", code: 200, ctype: "image/png", body: page},
+		{path: "/encoded", acceptEncoding: "gzip", code: 200, ctype: "text/html; charset=utf-8", body: page},
+		{path: "/stream", acceptEncoding: "gzip", code: 200, ctype: "text/event-stream", body: "data: 1\n\n" + page},
+		{path: "/binary", acceptEncoding: "gzip", code: 200, ctype: "application/octet-stream", body: page},
+		{path: "/copied", acceptEncoding: "gzip", code: 200, gzipped: true, ctype: "text/html; charset=utf-8", body: page},
+		{path: "/copiedbinary", acceptEncoding: "gzip", code: 200, ctype: "application/octet-stream", body: page},
+		{path: "/ranged", acceptEncoding: "gzip", code: 200, ctype: "text/html; charset=utf-8", body: page},
+		{path: "/ranged", rng: "bytes=0-999", acceptEncoding: "gzip", code: 206, ctype: "text/html; charset=utf-8", body: page[:1000]},
+		{path: "/notmodified", acceptEncoding: "gzip", code: 304},
+	} {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", tt.path, nil)
+		if tt.acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+		}
+		if tt.rng != "" {
+			req.Header.Set("Range", tt.rng)
+		}
+		h.ServeHTTP(rec, req)
+		name := tt.path + " (" + tt.rng + tt.acceptEncoding + ")"
+		res := rec.Result()
+		if res.StatusCode != tt.code {
+			t.Errorf("%s: status = %d; want %d", name, res.StatusCode, tt.code)
+		}
+		if got := res.Header.Get("Vary"); got != "Accept-Encoding" {
+			t.Errorf("%s: Vary = %q", name, got)
+		}
+		if got := res.Header.Get("Content-Type"); got != tt.ctype {
+			t.Errorf("%s: Content-Type = %q; want %q", name, got, tt.ctype)
+		}
+		body := rec.Body.Bytes()
+		if gotGzip := res.Header.Get("Content-Encoding") == "gzip"; gotGzip != tt.gzipped {
+			t.Errorf("%s: gzipped = %v; want %v", name, gotGzip, tt.gzipped)
+		} else if gotGzip {
+			zr, err := gzip.NewReader(bytes.NewReader(body))
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			if body, err = io.ReadAll(zr); err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+		}
+		if string(body) != tt.body {
+			t.Errorf("%s: body = %d bytes; want %d", name, len(body), len(tt.body))
+		}
+	}
+}
+
+// BenchmarkWriter compares allocating a gzip.Writer for each response
+// with reusing them from a sync.Pool, as a Compressor does, for a
+// 4KB page:
+//
+//	go test -run=^$ -bench=Writer -benchmem ./gziphttp
+func BenchmarkWriter(b *testing.B) {
+	body := []byte(page)
+	b.Run("PerRequest", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(page)))
+		for benchtest.Loop(b) {
+			gz := gzip.NewWriter(io.Discard)
+			gz.Write(body)
+			gz.Close()
+		}
+	})
+	b.Run("Pooled", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(page)))
+		c := new(Compressor)
+		for benchtest.Loop(b) {
+			gz := c.getWriter(nil)
+			gz.Reset(io.Discard)
+			gz.Write(body)
+			gz.Close()
+			c.pool.Put(gz)
+		}
+	})
+}
+
+// BenchmarkWrap measures the whole middleware serving the same page,
+// compressed and not.
+func BenchmarkWrap(b *testing.B) {
+	body := []byte(page)
+	h := new(Compressor).Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(body)
+	}))
+	for _, ae := range []string{"", "gzip"} {
+		name := "Identity"
+		if ae != "" {
+			name = "Gzip"
+		}
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(page)))
+			f := benchtest.NewFixture(b, "GET / HTTP/1.1\r\nAccept-Encoding: "+ae+"\r\n\r\n")
+			for benchtest.Loop(b) {
+				f.Reset()
+				h.ServeHTTP(f.Rec, f.Req)
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+// Package headeraudit checks every response a handler sends against a
+// header policy: the security headers that must be there, the ones
+// that would fingerprint the server, and a size budget. A violation
+// is reported, or in development, turned into a 500 no one can miss.
+package headeraudit
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// A Policy is what a response's headers must satisfy.
+type Policy struct {
+	// RequiredHTML are headers every HTML response must have.
+	RequiredHTML []string
+
+	// Forbidden are headers no response may have, such as Server or
+	// X-Powered-By.
+	Forbidden []string
+
+	// MaxBytes is the most the header block may take, counting each
+	// line as "Name: value\r\n". 0 means no limit. Headers net/http
+	// adds as it writes, such as Date, aren't counted.
+	MaxBytes int
+
+	// Fail replaces a violating response with a 500 listing the
+	// problems, instead of sending it.
+	Fail bool
+
+	// Report, if non-nil, is called with each violating response's
+	// problems. By default they're logged with slog.
+	Report func(r *http.Request, problems []string)
+}
+
+// Check returns h's problems under p, or nil if it has none.
+func (p *Policy) Check(h http.Header) []string {
+	var problems []string
+	if strings.HasPrefix(strings.ToLower(h.Get("Content-Type")), "text/html") {
+		for _, k := range p.RequiredHTML {
+			if h.Get(k) == "" {
+				problems = append(problems, "missing "+k)
+			}
+		}
+	}
+	for _, k := range p.Forbidden {
+		if _, ok := h[http.CanonicalHeaderKey(k)]; ok {
+			problems = append(problems, "forbidden "+k)
+		}
+	}
+	if p.MaxBytes > 0 {
+		n := 0
+		for k, vv := range h {
+			for _, v := range vv {
+				n += len(k) + len(": ") + len(v) + len("\r\n")
+			}
+		}
+		if n > p.MaxBytes {
+			problems = append(problems, fmt.Sprintf("%d header bytes, over the budget of %d", n, p.MaxBytes))
+		}
+	}
+	return problems
+}
+
+// Wrap wraps h to check its responses' headers when it sends them.
+// It must wrap any middleware that adds headers to be checked, such as
+// secheaders, so that it sees their headers too.
+func (p *Policy) Wrap(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(&writer{ResponseWriter: w, p: p, r: r}, r)
+	})
+}
+
+func (p *Policy) report(r *http.Request, problems []string) {
+	if p.Report != nil {
+		p.Report(r, problems)
+		return
+	}
+	slog.Warn("response headers violate policy", "method", r.Method, "path", r.URL.Path, "problems", problems)
+}
+
+type writer struct {
+	http.ResponseWriter
+	p       *Policy
+	r       *http.Request
+	checked bool
+	failed  bool // replaced by a 500; the handler's writes are dropped
+}
+
+// check checks the headers about to be sent, with body as the start
+// of the body if the Content-Type is yet to be sniffed from it.
+func (w *writer) check(body []byte) {
+	w.checked = true
+	hdr := w.Header()
+	if _, ok := hdr["Content-Type"]; !ok && len(body) > 0 {
+		hdr.Set("Content-Type", http.DetectContentType(body))
+	}
+	problems := w.p.Check(hdr)
+	if problems == nil {
+		return
+	}
+	w.p.report(w.r, problems)
+	if !w.p.Fail {
+		return
+	}
+	w.failed = true
+	clear(hdr)
+	hdr.Set("Content-Type", "text/plain; charset=utf-8")
+	hdr.Set("X-Content-Type-Options", "nosniff")
+	w.ResponseWriter.WriteHeader(http.StatusInternalServerError)
+	fmt.Fprintf(w.ResponseWriter, "response headers violate policy:\n%s\n", strings.Join(problems, "\n"))
+}
+
+func (w *writer) WriteHeader(code int) {
+	if !w.checked && code >= 200 {
+		w.check(nil)
+	}
+	if !w.failed {
+		w.ResponseWriter.WriteHeader(code)
+	}
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	if !w.checked {
+		w.check(p)
+	}
+	if w.failed {
+		return len(p), nil
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// Flush lets event streams flush through the wrapper.
+func (w *writer) Flush() {
+	if !w.checked {
+		w.check(nil)
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// ReadFrom lets a body copied in, as http.ServeContent copies a file,
+// reach the underlying writer's ReadFrom, which on Linux is sendfile.
+// A body whose type is yet to be sniffed goes through Write instead.
+func (w *writer) ReadFrom(src io.Reader) (int64, error) {
+	if !w.checked {
+		if _, ok := w.Header()["Content-Type"]; !ok {
+			return io.Copy(struct{ io.Writer }{w}, src)
+		}
+		w.check(nil)
+	}
+	if w.failed {
+		return io.Copy(io.Discard, src)
+	}
+	return io.Copy(w.ResponseWriter, src)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *writer) Unwrap() http.ResponseWriter { return w.ResponseWriter }
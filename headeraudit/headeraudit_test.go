@@ -0,0 +1,75 @@
+package headeraudit
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+var policy = Policy{
+	RequiredHTML: []string{"Content-Security-Policy", "X-Content-Type-Options"},
+	Forbidden:    []string{"Server", "X-Powered-By"},
+	MaxBytes:     200,
+}
+
+func TestCheck(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		h    http.Header
+		want []string
+	}{
+		{"plain", http.Header{"Content-Type": {"text/plain"}}, nil},
+		{"html", http.Header{"Content-Type": {"text/html"}, "Content-Security-Policy": {"default-src 'self'"}, "X-Content-Type-Options": {"nosniff"}}, nil},
+		{"bare html", http.Header{"Content-Type": {"TEXT/HTML; charset=utf-8"}}, []string{"missing Content-Security-Policy", "missing X-Content-Type-Options"}},
+		{"fingerprint", http.Header{"Server": {"stepn/1.0"}, "X-Powered-By": {"Go"}}, []string{"forbidden Server", "forbidden X-Powered-By"}},
+		{"big", http.Header{"X-Big": {strings.Repeat("a", 200)}}, []string{"209 header bytes, over the budget of 200"}},
+	} {
+		got := policy.Check(tt.h)
+		if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+			t.Errorf("%s: Check = %q; want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestWrap(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "fine")
+	})
+	mux.HandleFunc("/bad", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "stepn")
+		io.WriteString(w, "<html><h1>Welcome!</h1>") // sniffed as HTML
+	})
+	for _, fail := range []bool{false, true} {
+		p := policy
+		p.Fail = fail
+		var reported []string
+		p.Report = func(r *http.Request, problems []string) {
+			reported = append(reported, r.URL.Path+": "+strings.Join(problems, ", "))
+		}
+		h := p.Wrap(mux)
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", "/ok", nil))
+		if rec.Code != 200 || rec.Body.String() != "fine" {
+			t.Errorf("Fail=%v: /ok = %d %q", fail, rec.Code, rec.Body)
+		}
+
+		rec = httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", "/bad", nil))
+		body := rec.Body.String()
+		if fail {
+			if rec.Code != 500 || !strings.Contains(body, "forbidden Server") || rec.Header().Get("Server") != "" {
+				t.Errorf("Fail=true: /bad = %d %q, Server %q; want a 500 listing the problems", rec.Code, body, rec.Header().Get("Server"))
+			}
+		} else if rec.Code != 200 || !strings.Contains(body, "Welcome") {
+			t.Errorf("Fail=false: /bad = %d %q; want it sent as is", rec.Code, body)
+		}
+		want := "/bad: missing Content-Security-Policy, missing X-Content-Type-Options, forbidden Server"
+		if len(reported) != 1 || reported[0] != want {
+			t.Errorf("Fail=%v: reported %q; want [%q]", fail, reported, want)
+		}
+	}
+}
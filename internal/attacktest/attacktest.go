@@ -0,0 +1,253 @@
+// Package attacktest sends a running server the requests a hostile
+// client would, and checks that each gets a safe answer, so a fix for
+// one attack stays fixed.
+//
+// A server's tests start it and describe what to attack:
+//
+//	func TestAttacks(t *testing.T) {
+//		ts := httptest.NewServer(h)
+//		defer ts.Close()
+//		attacktest.Run(t, ts.URL, attacktest.Target{Reflect: []string{"/hi?color="}})
+//	}
+package attacktest
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// A Target says which of a server's URLs to attack, and how. A zero
+// field skips its attacks.
+type Target struct {
+	// Reflect are URLs ending in a parameter's "=", such as
+	// "/hi?color=", whose value a page might echo. Each gets
+	// reflected-XSS payloads.
+	Reflect []string
+
+	// Inject are URLs ending in a parameter's "=", such as "/?id=",
+	// whose value might end up in a response header. Each gets
+	// CRLF-injection payloads.
+	Inject []string
+
+	// FilePrefixes are paths, such as "/static/", that might serve
+	// files. Each gets path-traversal attempts.
+	FilePrefixes []string
+
+	// Secret is text that no traversal's response may contain. The
+	// default is the start of /etc/passwd's first line.
+	Secret string
+
+	// MaxHeaderBytes is the server's limit on request headers. A
+	// request with far bigger ones must get a 431.
+	MaxHeaderBytes int
+
+	// Upload is a path taking a PUT body, and ReadTimeout how long the
+	// server allows a whole request. A body trickled in a byte at a
+	// time must be cut off soon after ReadTimeout.
+	Upload      string
+	ReadTimeout time.Duration
+}
+
+// Run attacks the server at baseURL, such as "http://127.0.0.1:8080",
+// as tg describes, in one subtest per kind of attack.
+func Run(t *testing.T, baseURL string, tg Target) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &attacker{base: strings.TrimSuffix(baseURL, "/"), addr: u.Host}
+	if len(tg.Reflect) > 0 {
+		t.Run("ReflectedXSS", func(t *testing.T) { a.reflectedXSS(t, tg.Reflect) })
+	}
+	if len(tg.Inject) > 0 {
+		t.Run("HeaderInjection", func(t *testing.T) { a.headerInjection(t, tg.Inject) })
+	}
+	if len(tg.FilePrefixes) > 0 {
+		secret := tg.Secret
+		if secret == "" {
+			secret = "root:x:0:0"
+		}
+		t.Run("PathTraversal", func(t *testing.T) { a.pathTraversal(t, tg.FilePrefixes, secret) })
+	}
+	if tg.MaxHeaderBytes > 0 {
+		t.Run("OversizedHeaders", func(t *testing.T) { a.oversizedHeaders(t, tg.MaxHeaderBytes) })
+	}
+	if tg.Upload != "" && tg.ReadTimeout > 0 {
+		t.Run("SlowBody", func(t *testing.T) { a.slowBody(t, tg.Upload, tg.ReadTimeout) })
+	}
+}
+
+type attacker struct {
+	base string // URL without a trailing slash
+	addr string // host:port, for raw connections
+}
+
+// get fetches path and returns its response with the body read.
+func (a *attacker) get(t *testing.T, path string) (*http.Response, string) {
+	t.Helper()
+	res, err := http.Get(a.base + path)
+	if err != nil {
+		t.Fatalf("GET %s: %v", path, err)
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("GET %s: reading body: %v", path, err)
+	}
+	return res, string(body)
+}
+
+// raw sends req, a whole HTTP/1.1 request, on a new connection and
+// returns the response with the body read.
+func (a *attacker) raw(t *testing.T, req string) (*http.Response, string) {
+	t.Helper()
+	c, err := net.Dial("tcp", a.addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.SetDeadline(time.Now().Add(10 * time.Second))
+	go io.WriteString(c, req) // the server may answer before reading it all
+	res, err := http.ReadResponse(bufio.NewReader(c), nil)
+	if err != nil {
+		t.Fatalf("reading response to %.40q: %v", req, err)
+	}
+	defer res.Body.Close()
+	body, _ := io.ReadAll(res.Body)
+	return res, string(body)
+}
+
+var xssPayloads = []string{
+	`<script>alert(1)</script>`,
+	`"><img src=x onerror=alert(1)>`,
+	`red'><svg onload=alert(1)>`,
+	`red; background: url(javascript:alert(1))`,
+	`</style><script>alert(1)</script>`,
+}
+
+func (a *attacker) reflectedXSS(t *testing.T, urls []string) {
+	for _, u := range urls {
+		for _, p := range xssPayloads {
+			res, body := a.get(t, u+url.QueryEscape(p))
+			if !strings.Contains(body, p) {
+				continue
+			}
+			ct := res.Header.Get("Content-Type")
+			if strings.HasPrefix(ct, "text/html") || res.Header.Get("X-Content-Type-Options") != "nosniff" {
+				t.Errorf("%s%s: payload echoed unescaped in %q response", u, p, ct)
+			}
+		}
+	}
+}
+
+var injectPayloads = []string{
+	"1\r\nX-Injected: yes",
+	"1\nX-Injected: yes",
+	"1\r\nSet-Cookie: injected=yes",
+	"1\r\n\r\n<script>alert(1)</script>",
+}
+
+func (a *attacker) headerInjection(t *testing.T, urls []string) {
+	for _, u := range urls {
+		for _, p := range injectPayloads {
+			path := u + url.QueryEscape(p)
+			res, _ := a.get(t, path)
+			if res.Header.Get("X-Injected") != "" {
+				t.Errorf("%s: injected X-Injected header", path)
+			}
+			for _, c := range res.Header.Values("Set-Cookie") {
+				if strings.Contains(c, "injected") {
+					t.Errorf("%s: injected cookie %q", path, c)
+				}
+			}
+		}
+		// Unescaped, a CR or LF ends the request line early. The
+		// server must reject it rather than read on.
+		res, _ := a.raw(t, "GET "+u+"1\rX-Injected: yes HTTP/1.1\r\nHost: x\r\nConnection: close\r\n\r\n")
+		if res.StatusCode != http.StatusBadRequest {
+			t.Errorf("raw CR in %s: status %d; want 400", u, res.StatusCode)
+		}
+	}
+}
+
+var traversals = []string{
+	"../../../../../../etc/passwd",
+	"..%2f..%2f..%2f..%2f..%2f..%2fetc%2fpasswd",
+	"%2e%2e/%2e%2e/%2e%2e/%2e%2e/%2e%2e/%2e%2e/etc/passwd",
+	"..%252f..%252f..%252f..%252f..%252f..%252fetc%252fpasswd",
+	"....//....//....//....//....//....//etc/passwd",
+	"..\\..\\..\\..\\..\\..\\etc\\passwd",
+	"/etc/passwd",
+}
+
+func (a *attacker) pathTraversal(t *testing.T, prefixes []string, secret string) {
+	for _, prefix := range prefixes {
+		for _, tr := range traversals {
+			path := prefix + tr
+			res, body := a.raw(t, "GET "+path+" HTTP/1.1\r\nHost: x\r\nConnection: close\r\n\r\n")
+			if strings.Contains(body, secret) {
+				t.Errorf("GET %s: %d response leaks %q", path, res.StatusCode, secret)
+			}
+		}
+	}
+}
+
+func (a *attacker) oversizedHeaders(t *testing.T, max int) {
+	// net/http allows 4KB of slack beyond MaxHeaderBytes.
+	big := strings.Repeat("a", 2*max+4096)
+	res, _ := a.raw(t, "GET / HTTP/1.1\r\nHost: x\r\nX-Big: "+big+"\r\nConnection: close\r\n\r\n")
+	if res.StatusCode != http.StatusRequestHeaderFieldsTooLarge {
+		t.Errorf("%d bytes of headers: status %d; want 431", len(big), res.StatusCode)
+	}
+}
+
+func (a *attacker) slowBody(t *testing.T, path string, readTimeout time.Duration) {
+	c, err := net.Dial("tcp", a.addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	t0 := time.Now()
+	fmt.Fprintf(c, "PUT %s HTTP/1.1\r\nHost: x\r\nContent-Length: %d\r\n\r\n", path, 1<<20)
+
+	// Trickle the body until the server gives up on it.
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		tick := time.NewTicker(readTimeout / 20)
+		defer tick.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-tick.C:
+				if _, err := c.Write([]byte("a")); err != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	limit := 2*readTimeout + time.Second
+	c.SetReadDeadline(t0.Add(limit))
+	res, err := http.ReadResponse(bufio.NewReader(c), nil)
+	if err == nil {
+		io.Copy(io.Discard, res.Body)
+		res.Body.Close()
+		if res.StatusCode == http.StatusOK {
+			t.Errorf("trickled body accepted with a 200")
+		}
+	} else if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		t.Fatalf("server still reading a trickled body after %v; ReadTimeout is %v", limit, readTimeout)
+	}
+	if d := time.Since(t0); d > limit {
+		t.Errorf("server took %v to give up on a trickled body; ReadTimeout is %v", d, readTimeout)
+	}
+}
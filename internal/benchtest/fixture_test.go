@@ -0,0 +1,102 @@
+package benchtest
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+const put = "PUT /?x=1 HTTP/1.1\r\nContent-Length: 5\r\n\r\nhello"
+
+// call is a handler whose response depends on the call number, the
+// request body, and the form.
+func call(n int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		r.ParseForm()
+		if n == 0 {
+			r.Form.Set("x", "stale")
+		}
+		w.Header().Set("X-Call", strconv.Itoa(n))
+		w.WriteHeader(200 + n)
+		w.Write(body)
+		io.WriteString(w, r.Form.Get("x"))
+	}
+}
+
+// TestNaiveReuse shows what goes wrong when a benchmark reuses a
+// recorder and request, resetting only the recorder's body.
+func TestNaiveReuse(t *testing.T) {
+	f := NewFixture(t, put)
+	rw, req := f.Rec, f.Req
+	call(0)(rw, req)
+	rw.Body.Reset()
+	call(1)(rw, req)
+
+	if rw.Code != 200 {
+		t.Errorf("Code = %d; expected the first call's 200 to stick", rw.Code)
+	}
+	if got := rw.Result().Header.Get("X-Call"); got != "0" {
+		t.Errorf("result X-Call = %q; expected the first call's header snapshot", got)
+	}
+	if got := rw.Body.String(); got != "stale" {
+		t.Errorf("body = %q; expected an empty request body and a cached form", got)
+	}
+}
+
+func TestFixtureReset(t *testing.T) {
+	f := NewFixture(t, put)
+	for n := 0; n < 3; n++ {
+		f.Reset()
+		call(n)(f.Rec, f.Req)
+		if f.Rec.Code != 200+n {
+			t.Errorf("call %d: Code = %d; want %d", n, f.Rec.Code, 200+n)
+		}
+		if got, want := f.Rec.Result().Header.Get("X-Call"), strconv.Itoa(n); got != want {
+			t.Errorf("call %d: result X-Call = %q; want %q", n, got, want)
+		}
+		if got, want := f.Rec.Body.String(), "hello1"; n > 0 && got != want {
+			t.Errorf("call %d: body = %q; want %q", n, got, want)
+		}
+	}
+}
+
+func TestPool(t *testing.T) {
+	var news int
+	p := &Pool{New: func() *Fixture {
+		news++
+		return NewFixture(t, put)
+	}}
+	f := p.Get()
+	call(0)(f.Rec, f.Req)
+	p.Put(f)
+	f = p.Get()
+	if f.Rec.Body.Len() != 0 || f.Rec.Code != 200 {
+		t.Errorf("pooled fixture not reset: Code %d, body %q", f.Rec.Code, f.Rec.Body)
+	}
+	if news < 1 {
+		t.Errorf("New called %d times", news)
+	}
+}
+
+// BenchmarkFixture and BenchmarkNewRecorder compare Reset with
+// building a new request and recorder for each call.
+func BenchmarkFixture(b *testing.B) {
+	b.ReportAllocs()
+	f := NewFixture(b, put)
+	h := call(1)
+	for Loop(b) {
+		f.Reset()
+		h(f.Rec, f.Req)
+	}
+}
+
+func BenchmarkNewRecorder(b *testing.B) {
+	b.ReportAllocs()
+	h := call(1)
+	for Loop(b) {
+		h(httptest.NewRecorder(), NewFixture(b, put).Req)
+	}
+}
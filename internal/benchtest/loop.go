@@ -0,0 +1,46 @@
+// Package benchtest has helpers for the repo's benchmarks: Loop,
+// Fixtures for calling handlers without the reuse pitfalls, and a
+// Transport for HTTP clients that skips the network.
+package benchtest
+
+import (
+	"sync"
+	"testing"
+)
+
+// Loop reports whether b should run another iteration, like
+// testing.B.Loop, which it calls on Go 1.24 and later. Write
+//
+//	for benchtest.Loop(b) {
+//		...
+//	}
+//
+// Setup before the first call isn't timed, and neither is anything
+// after the last. Unlike the compiler's special case for a literal
+// "for b.Loop()", calls in the body may still be optimized away, so
+// keep assigning results to a package-level sink.
+func Loop(b *testing.B) bool { return loop(b) }
+
+// loops is each running benchmark's iterations so far, for
+// compatLoop.
+var loops sync.Map // *testing.B => *int
+
+// compatLoop is Loop for Go releases before testing.B.Loop. Those call
+// the benchmark function once per b.N, so it runs b.N iterations and
+// then forgets b, ready for the next call.
+func compatLoop(b *testing.B) bool {
+	v, ok := loops.Load(b)
+	if !ok {
+		v = new(int)
+		loops.Store(b, v)
+		b.ResetTimer()
+	}
+	i := v.(*int)
+	if *i < b.N {
+		*i++
+		return true
+	}
+	b.StopTimer()
+	loops.Delete(b)
+	return false
+}
@@ -0,0 +1,7 @@
+//go:build go1.24
+
+package benchtest
+
+import "testing"
+
+var loop = (*testing.B).Loop
@@ -0,0 +1,29 @@
+package benchtest
+
+import "testing"
+
+func TestCompatLoop(t *testing.T) {
+	var calls, iters int
+	testing.Benchmark(func(b *testing.B) {
+		calls++
+		n := 0
+		for compatLoop(b) {
+			n++
+		}
+		if n != b.N {
+			t.Errorf("ran %d iterations; want b.N = %d", n, b.N)
+		}
+		iters += n
+	})
+	if calls < 2 {
+		t.Errorf("benchmark called %d times; want the usual ramp-up of b.N", calls)
+	}
+	if iters == 0 {
+		t.Error("no iterations")
+	}
+}
+
+func BenchmarkLoop(b *testing.B) {
+	for Loop(b) {
+	}
+}
@@ -0,0 +1,52 @@
+package benchtest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+)
+
+// A Transport is an http.RoundTripper that serves each request by
+// calling Handler directly, with no sockets, connections, or HTTP
+// parsing, so a client-driven benchmark measures the handler and not
+// the kernel's networking.
+//
+// The handler gets its own copy of the request, shaped as a server's
+// request is, and the whole response is buffered before RoundTrip
+// returns. So handlers that stream forever, such as /events, never
+// return, and ones that hijack the connection, such as /live, fail.
+type Transport struct {
+	Handler http.Handler
+
+	// RemoteAddr is the server request's RemoteAddr, by default
+	// "127.0.0.1:1".
+	RemoteAddr string
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		defer req.Body.Close()
+	}
+	sreq := req.Clone(req.Context())
+	sreq.RequestURI = req.URL.RequestURI()
+	u, err := url.ParseRequestURI(sreq.RequestURI)
+	if err != nil {
+		return nil, err
+	}
+	sreq.URL = u
+	if sreq.Host == "" {
+		sreq.Host = req.URL.Host
+	}
+	if sreq.Body == nil {
+		sreq.Body = http.NoBody
+	}
+	sreq.RemoteAddr = t.RemoteAddr
+	if sreq.RemoteAddr == "" {
+		sreq.RemoteAddr = "127.0.0.1:1"
+	}
+	rec := httptest.NewRecorder()
+	t.Handler.ServeHTTP(rec, sreq)
+	res := rec.Result()
+	res.Request = req
+	return res, nil
+}
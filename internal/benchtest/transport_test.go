@@ -0,0 +1,29 @@
+package benchtest
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestTransport(t *testing.T) {
+	c := &http.Client{Transport: &Transport{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("X-Seen", r.Method+" "+r.Host+" "+r.RequestURI+" "+r.URL.String()+" "+r.RemoteAddr)
+		w.WriteHeader(http.StatusTeapot)
+		w.Write(body)
+	})}}
+	res, err := c.Post("http://demo.example/upload?x=1", "text/plain", strings.NewReader("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	if res.StatusCode != http.StatusTeapot || string(body) != "hello" {
+		t.Errorf("got %v %q; want 418 hello", res.Status, body)
+	}
+	if got, want := res.Header.Get("X-Seen"), "POST demo.example /upload?x=1 /upload?x=1 127.0.0.1:1"; got != want {
+		t.Errorf("handler saw %q; want %q", got, want)
+	}
+}
@@ -0,0 +1,22 @@
+// Package clock makes the timestamps the server exports. Durations need
+// nothing from it: time.Now's monotonic reading already keeps
+// time.Since and Sub safe from the wall clock being stepped.
+//
+// Timestamps that leave the process, in JSON responses, files, and
+// webhooks, come from Now or Stamp: wall time in UTC, to the
+// millisecond, with no monotonic reading. Whichever encoder writes one
+// (encoding/json or jsonenc), it's RFC 3339 with a Z, so timestamps
+// from different handlers and hosts compare as what they are.
+package clock
+
+import "time"
+
+// Precision is what exported timestamps are truncated to.
+const Precision = time.Millisecond
+
+// Now returns the current time as an exported timestamp.
+func Now() time.Time { return Stamp(time.Now()) }
+
+// Stamp returns t in UTC, truncated to Precision. Its monotonic
+// reading is dropped, so it's no good for measuring durations.
+func Stamp(t time.Time) time.Time { return t.UTC().Truncate(Precision) }
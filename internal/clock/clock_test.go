@@ -0,0 +1,24 @@
+package clock
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStamp(t *testing.T) {
+	tokyo := time.FixedZone("JST", 9*3600)
+	in := time.Date(2015, 8, 22, 19, 0, 1, 123456789, tokyo)
+	got := Stamp(in)
+	if want := time.Date(2015, 8, 22, 10, 0, 1, 123000000, time.UTC); got != want {
+		t.Errorf("Stamp(%v) = %v; want %v", in, got, want)
+	}
+	b, _ := json.Marshal(got)
+	if string(b) != `"2015-08-22T10:00:01.123Z"` {
+		t.Errorf("stamp encodes as %s", b)
+	}
+	if s := Now().String(); strings.Contains(s, "m=") {
+		t.Errorf("Now() = %s; want no monotonic reading", s)
+	}
+}
@@ -0,0 +1,112 @@
+// Package jsonenc appends JSON values to byte slices without
+// reflection, for the few response types on stepn's hot path. A type
+// writes itself field by field with these functions:
+//
+//	b = append(b, `{"visitors":`...)
+//	b = jsonenc.Int(b, s.Visitors)
+//	b = append(b, '}')
+//
+// The output is byte for byte what encoding/json produces for the same
+// values, HTML escaping included, so switching a type over doesn't
+// change its responses. Unlike encoding/json, nothing here fails: a
+// NaN or infinite float is written as null, and a time outside years
+// 0 through 9999 is written anyway.
+package jsonenc
+
+import (
+	"math"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+const hex = "0123456789abcdef"
+
+// Int appends n.
+func Int(b []byte, n int64) []byte { return strconv.AppendInt(b, n, 10) }
+
+// Bool appends v.
+func Bool(b []byte, v bool) []byte { return strconv.AppendBool(b, v) }
+
+// Float appends f the way encoding/json formats a float64: plain
+// decimal, or exponent form for very large and very small magnitudes.
+func Float(b []byte, f float64) []byte {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return append(b, "null"...)
+	}
+	format := byte('f')
+	if abs := math.Abs(f); abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+		format = 'e'
+	}
+	b = strconv.AppendFloat(b, f, format, -1, 64)
+	if format == 'e' {
+		// Shorten e-09 to e-9, as encoding/json does.
+		n := len(b)
+		if n >= 4 && b[n-4] == 'e' && b[n-3] == '-' && b[n-2] == '0' {
+			b[n-2] = b[n-1]
+			b = b[:n-1]
+		}
+	}
+	return b
+}
+
+// Time appends t as a quoted RFC 3339 string, as time.Time's
+// MarshalJSON does.
+func Time(b []byte, t time.Time) []byte {
+	b = append(b, '"')
+	b = t.AppendFormat(b, time.RFC3339Nano)
+	return append(b, '"')
+}
+
+// String appends s quoted. Like encoding/json, it escapes <, >, and &
+// so the output is safe inside HTML, and replaces invalid UTF-8 with
+// U+FFFD.
+func String(b []byte, s string) []byte {
+	b = append(b, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		if c := s[i]; c < utf8.RuneSelf {
+			if c >= 0x20 && c != '"' && c != '\\' && c != '<' && c != '>' && c != '&' {
+				i++
+				continue
+			}
+			b = append(b, s[start:i]...)
+			switch c {
+			case '"', '\\':
+				b = append(b, '\\', c)
+			case '\b':
+				b = append(b, '\\', 'b')
+			case '\f':
+				b = append(b, '\\', 'f')
+			case '\n':
+				b = append(b, '\\', 'n')
+			case '\r':
+				b = append(b, '\\', 'r')
+			case '\t':
+				b = append(b, '\\', 't')
+			default:
+				b = append(b, '\\', 'u', '0', '0', hex[c>>4], hex[c&0xf])
+			}
+			i++
+			start = i
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case r == utf8.RuneError && size == 1:
+			b = append(b, s[start:i]...)
+			b = append(b, "\ufffd"...)
+		case r == '\u2028' || r == '\u2029':
+			// Valid JSON, but not valid JavaScript.
+			b = append(b, s[start:i]...)
+			b = append(b, '\\', 'u', '2', '0', '2', hex[r&0xf])
+		default:
+			i += size
+			continue
+		}
+		i += size
+		start = i
+	}
+	b = append(b, s[start:]...)
+	return append(b, '"')
+}
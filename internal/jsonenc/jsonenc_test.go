@@ -0,0 +1,64 @@
+package jsonenc
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+)
+
+func stdlib(t *testing.T, v interface{}) string {
+	t.Helper()
+	j, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(j)
+}
+
+func TestMatchesEncodingJSON(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"plain",
+		`quote " backslash \ slash /`,
+		"<script>&amp;</script>",
+		"\b\f\n\r\t\x00\x1f\x7f",
+		"héllo, 世界 🎉",
+		"bad \xff utf-8 \xe2\x28\xa1",
+		"line\u2028para\u2029sep",
+	} {
+		if got, want := string(String(nil, s)), stdlib(t, s); got != want {
+			t.Errorf("String(%q) = %s; want %s", s, got, want)
+		}
+	}
+	for _, n := range []int64{0, 1, -1, math.MaxInt64, math.MinInt64} {
+		if got, want := string(Int(nil, n)), stdlib(t, n); got != want {
+			t.Errorf("Int(%d) = %s; want %s", n, got, want)
+		}
+	}
+	for _, f := range []float64{0, 1, -2.5, 14.4, 1e-6, 1e-7, 123456789, 1e20, 1e21, -1.5e-300, math.MaxFloat64} {
+		if got, want := string(Float(nil, f)), stdlib(t, f); got != want {
+			t.Errorf("Float(%v) = %s; want %s", f, got, want)
+		}
+	}
+	for _, tm := range []time.Time{
+		{},
+		time.Date(2015, 8, 22, 10, 0, 0, 0, time.UTC),
+		time.Date(2015, 8, 22, 10, 0, 0, 123456000, time.FixedZone("JST", 9*60*60)),
+	} {
+		if got, want := string(Time(nil, tm)), stdlib(t, tm); got != want {
+			t.Errorf("Time(%v) = %s; want %s", tm, got, want)
+		}
+	}
+	if got, want := string(Bool(nil, true)), "true"; got != want {
+		t.Errorf("Bool(true) = %s; want %s", got, want)
+	}
+}
+
+func TestFloatNonFinite(t *testing.T) {
+	for _, f := range []float64{math.NaN(), math.Inf(1), math.Inf(-1)} {
+		if got := string(Float(nil, f)); got != "null" {
+			t.Errorf("Float(%v) = %s; want null", f, got)
+		}
+	}
+}
@@ -0,0 +1,15 @@
+//go:build bolt
+
+package migrate
+
+import "github.com/bradfitz/talk-yapc-asia-2015/store"
+
+func init() {
+	openers["bolt"] = func(path string) (Backend, error) {
+		db, err := store.OpenBolt(path)
+		if err != nil {
+			return nil, err
+		}
+		return db, nil
+	}
+}
@@ -0,0 +1,134 @@
+// Package migrate copies the visitor count, and the upload history
+// where both ends keep one, from one counter backend to another, then
+// reads the destination back to verify the copy. It's the engine of
+// "stepn migrate", which lets a presenter switch stepn's backend
+// between sections of the talk without the count starting over:
+//
+//	stepn migrate -from=file:visitors.state -to=redis:localhost:6379
+//
+// Backends are named kind:arg, where kind is one of
+//
+//	file   a snapshot file, as written by stepn -state
+//	redis  a Redis server's host:port, as used by stepn -redis
+//	bolt   a bbolt database file, as used by stepn -db (needs -tags=bolt)
+//
+// Stop the server first; a count that's still moving won't verify.
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/store"
+)
+
+// A Backend is a Counter that Copy can also set directly.
+type Backend interface {
+	store.Counter
+	Store(ctx context.Context, v int64) error
+	// Close flushes and releases the backend.
+	Close() error
+}
+
+// openers maps a backend kind to its constructor. Files built with
+// build tags add to it.
+var openers = map[string]func(arg string) (Backend, error){
+	"file":  openFile,
+	"redis": openRedis,
+}
+
+// Open opens a backend named kind:arg.
+func Open(spec string) (Backend, error) {
+	i := strings.Index(spec, ":")
+	if i < 0 {
+		return nil, fmt.Errorf("backend %q isn't of form kind:arg", spec)
+	}
+	kind, arg := spec[:i], spec[i+1:]
+	fn, ok := openers[kind]
+	if !ok {
+		var kinds []string
+		for k := range openers {
+			kinds = append(kinds, k)
+		}
+		sort.Strings(kinds)
+		return nil, fmt.Errorf("unknown backend kind %q; want one of %s", kind, strings.Join(kinds, ", "))
+	}
+	return fn(arg)
+}
+
+// fileBackend is a snapshot file, loaded into memory on open and
+// written back on Close.
+type fileBackend struct {
+	store.Memory
+	snap *store.Snapshotter
+}
+
+func openFile(path string) (Backend, error) {
+	fb := new(fileBackend)
+	fb.snap = &store.Snapshotter{Path: path, C: &fb.Memory}
+	if err := fb.snap.Restore(); err != nil {
+		return nil, err
+	}
+	return fb, nil
+}
+
+func (fb *fileBackend) Store(_ context.Context, v int64) error {
+	fb.Memory.Store(v)
+	return nil
+}
+
+func (fb *fileBackend) Close() error { return fb.snap.Snapshot() }
+
+func openRedis(addr string) (Backend, error) {
+	return &store.Redis{Addr: addr}, nil
+}
+
+// Copy copies src's count, and its recent uploads if both src and dst
+// are UploadLogs, to dst. It refuses to lower dst's count unless force
+// is set. It returns the count copied.
+func Copy(ctx context.Context, src, dst Backend, maxUploads int, force bool) (int64, error) {
+	n, err := src.Load(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("reading source count: %v", err)
+	}
+	old, err := dst.Load(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("reading destination count: %v", err)
+	}
+	if old > n && !force {
+		return 0, fmt.Errorf("destination count %d is higher than source's %d; use -force to overwrite it", old, n)
+	}
+	if err := dst.Store(ctx, n); err != nil {
+		return 0, fmt.Errorf("writing destination count: %v", err)
+	}
+	if got, err := dst.Load(ctx); err != nil || got != n {
+		return 0, fmt.Errorf("verifying destination count: read back %d, %v; want %d", got, err, n)
+	}
+
+	srcLog, ok1 := src.(store.UploadLog)
+	dstLog, ok2 := dst.(store.UploadLog)
+	if !ok1 || !ok2 || maxUploads <= 0 {
+		return n, nil
+	}
+	ups, err := srcLog.Recent(ctx, maxUploads)
+	if err != nil {
+		return 0, fmt.Errorf("reading source uploads: %v", err)
+	}
+	// Recent is newest first; add oldest first so the order survives.
+	for i := len(ups) - 1; i >= 0; i-- {
+		if err := dstLog.Add(ctx, ups[i]); err != nil {
+			return 0, fmt.Errorf("writing destination uploads: %v", err)
+		}
+	}
+	got, err := dstLog.Recent(ctx, len(ups))
+	if err != nil {
+		return 0, fmt.Errorf("verifying destination uploads: %v", err)
+	}
+	if len(ups) > 0 && !reflect.DeepEqual(got, ups) {
+		return 0, fmt.Errorf("verifying destination uploads: read back %d that don't match the %d copied", len(got), len(ups))
+	}
+	return n, nil
+}
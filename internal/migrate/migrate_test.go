@@ -0,0 +1,89 @@
+package migrate
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/store"
+	"github.com/bradfitz/talk-yapc-asia-2015/store/fakeredis"
+)
+
+func TestMigrateFileToRedis(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "visitors")
+	if err := ioutil.WriteFile(path, []byte("1234\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := fakeredis.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	src, err := Open("file:" + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst, err := Open("redis:" + s.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.Close()
+	if n, err := Copy(ctx, src, dst, 10, false); err != nil || n != 1234 {
+		t.Fatalf("Copy = %d, %v; want 1234, nil", n, err)
+	}
+	if n, err := dst.Incr(ctx); err != nil || n != 1235 {
+		t.Errorf("Incr on destination = %d, %v; want 1235, nil", n, err)
+	}
+}
+
+func TestMigrateRefusesToLowerCount(t *testing.T) {
+	ctx := context.Background()
+	src, dst := new(fileBackend), new(fileBackend)
+	src.Store(ctx, 5)
+	dst.Store(ctx, 10)
+	if _, err := Copy(ctx, src, dst, 10, false); err == nil || !strings.Contains(err.Error(), "-force") {
+		t.Fatalf("Copy onto higher count = %v; want error mentioning -force", err)
+	}
+	if _, err := Copy(ctx, src, dst, 10, true); err != nil {
+		t.Fatalf("Copy with force: %v", err)
+	}
+	if n, _ := dst.Load(ctx); n != 5 {
+		t.Errorf("destination count = %d; want 5", n)
+	}
+}
+
+// memBackend is a Backend that also keeps an upload history.
+type memBackend struct {
+	store.Memory
+	*store.MemoryUploads
+}
+
+func (m *memBackend) Store(_ context.Context, v int64) error { m.Memory.Store(v); return nil }
+func (m *memBackend) Close() error                           { return nil }
+
+func TestMigrateUploads(t *testing.T) {
+	ctx := context.Background()
+	src := &memBackend{MemoryUploads: store.NewMemoryUploads(10)}
+	dst := &memBackend{MemoryUploads: store.NewMemoryUploads(10)}
+	for i := 1; i <= 5; i++ {
+		src.Add(ctx, store.Upload{Time: time.Unix(int64(i), 0), Size: int64(i)})
+	}
+	if _, err := Copy(ctx, src, dst, 3, false); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := dst.Recent(ctx, 10)
+	if len(got) != 3 || got[0].Size != 5 || got[2].Size != 3 {
+		t.Errorf("destination uploads = %+v; want sizes 5, 4, 3", got)
+	}
+}
+
+func TestOpenUnknownKind(t *testing.T) {
+	if _, err := Open("sqlite:x.db"); err == nil || !strings.Contains(err.Error(), "file, redis") {
+		t.Errorf("open of unknown kind = %v; want error listing kinds", err)
+	}
+}
@@ -0,0 +1,190 @@
+// Package simnet simulates a network of nodes in virtual time, so a
+// distributed algorithm's bugs reproduce from a seed instead of
+// flaking.
+//
+// Everything runs on the caller's goroutine: a Network keeps one queue
+// of pending deliveries and timers, ordered by virtual time, and Step
+// pops them one at a time. Message delays and drops come from a
+// generator seeded by New, and ties break in the order events were
+// scheduled, so the same seed and the same node code give the same
+// run, event for event.
+//
+// Nodes are callbacks, not goroutines. A node's state lives in its
+// receive func's closure or receiver, and it acts later with After:
+//
+//	net := simnet.New(seed)
+//	net.AddNode(1, func(m simnet.Message) { ... net.Send(1, m.From, reply) })
+//	net.After(10*time.Millisecond, gossip)
+//	net.RunFor(time.Minute)
+package simnet
+
+import (
+	"container/heap"
+	"fmt"
+	"math/rand/v2"
+	"time"
+)
+
+// A NodeID names a node.
+type NodeID int
+
+// A Message is a payload in flight from one node to another.
+type Message struct {
+	From, To NodeID
+	Payload  interface{}
+}
+
+// A Network is a simulated network. Set its fields before running it.
+type Network struct {
+	// Each message takes from MinDelay to MaxDelay to arrive, chosen
+	// uniformly. The defaults are 1ms and 10ms.
+	MinDelay, MaxDelay time.Duration
+
+	// DropRate is the fraction of messages lost in transit.
+	DropRate float64
+
+	// Trace, if non-nil, is called with each event as it happens.
+	Trace func(format string, args ...interface{})
+
+	rand  *rand.Rand
+	now   time.Duration
+	seq   uint64 // events scheduled, for breaking ties
+	queue eventQueue
+	nodes map[NodeID]func(Message)
+	group map[NodeID]int // partition side; all 0 when healed
+
+	Sent, Delivered, Dropped int
+}
+
+// New returns an empty Network whose randomness comes from seed.
+func New(seed uint64) *Network {
+	return &Network{
+		MinDelay: time.Millisecond,
+		MaxDelay: 10 * time.Millisecond,
+		rand:     rand.New(rand.NewPCG(seed, seed)),
+		nodes:    make(map[NodeID]func(Message)),
+		group:    make(map[NodeID]int),
+	}
+}
+
+// Rand returns the network's seeded generator, for nodes' own random
+// choices, such as which peer to gossip with. Using any other source
+// makes runs unrepeatable.
+func (n *Network) Rand() *rand.Rand { return n.rand }
+
+// Now returns the virtual time since the network was created.
+func (n *Network) Now() time.Duration { return n.now }
+
+// AddNode adds a node that receives its messages by calling recv.
+func (n *Network) AddNode(id NodeID, recv func(Message)) {
+	if _, dup := n.nodes[id]; dup {
+		panic(fmt.Sprintf("simnet: duplicate node %d", id))
+	}
+	n.nodes[id] = recv
+}
+
+// Send sends payload from one node to another. It's delivered after a
+// random delay, unless it's dropped or, when it arrives, the two nodes
+// are on different sides of a partition.
+func (n *Network) Send(from, to NodeID, payload interface{}) {
+	n.Sent++
+	if n.DropRate > 0 && n.rand.Float64() < n.DropRate {
+		n.Dropped++
+		n.trace("drop %d->%d %v", from, to, payload)
+		return
+	}
+	delay := n.MinDelay
+	if span := n.MaxDelay - n.MinDelay; span > 0 {
+		delay += time.Duration(n.rand.Int64N(int64(span) + 1))
+	}
+	m := Message{From: from, To: to, Payload: payload}
+	n.schedule(delay, func() { n.deliver(m) })
+}
+
+func (n *Network) deliver(m Message) {
+	recv, ok := n.nodes[m.To]
+	if !ok || n.group[m.From] != n.group[m.To] {
+		n.Dropped++
+		n.trace("lost %d->%d %v", m.From, m.To, m.Payload)
+		return
+	}
+	n.Delivered++
+	n.trace("recv %d->%d %v", m.From, m.To, m.Payload)
+	recv(m)
+}
+
+// After calls fn once d of virtual time has passed.
+func (n *Network) After(d time.Duration, fn func()) {
+	n.schedule(d, fn)
+}
+
+// Partition splits the nodes so that only nodes in the same group can
+// reach each other. Nodes in no group form one more group together.
+// Messages already in flight across the split are lost.
+func (n *Network) Partition(groups ...[]NodeID) {
+	clear(n.group)
+	for i, g := range groups {
+		for _, id := range g {
+			n.group[id] = i + 1
+		}
+	}
+	n.trace("partition %v", groups)
+}
+
+// Heal ends any partition.
+func (n *Network) Heal() {
+	clear(n.group)
+	n.trace("heal")
+}
+
+// Step runs the next event, advancing virtual time to it. It reports
+// false if there was none.
+func (n *Network) Step() bool {
+	if len(n.queue) == 0 {
+		return false
+	}
+	e := heap.Pop(&n.queue).(event)
+	n.now = e.at
+	e.fn()
+	return true
+}
+
+// RunFor runs events until d of virtual time has passed, or none are
+// left. Either way the clock ends d later.
+func (n *Network) RunFor(d time.Duration) {
+	end := n.now + d
+	for len(n.queue) > 0 && n.queue[0].at <= end {
+		n.Step()
+	}
+	n.now = end
+}
+
+func (n *Network) schedule(d time.Duration, fn func()) {
+	n.seq++
+	heap.Push(&n.queue, event{at: n.now + d, seq: n.seq, fn: fn})
+}
+
+func (n *Network) trace(format string, args ...interface{}) {
+	if n.Trace != nil {
+		n.Trace("%v "+format, append([]interface{}{n.now}, args...)...)
+	}
+}
+
+type event struct {
+	at  time.Duration
+	seq uint64
+	fn  func()
+}
+
+type eventQueue []event
+
+func (q eventQueue) Len() int { return len(q) }
+func (q eventQueue) Less(i, j int) bool {
+	if q[i].at != q[j].at {
+		return q[i].at < q[j].at
+	}
+	return q[i].seq < q[j].seq
+}
+func (q eventQueue) Swap(i, j int)         { q[i], q[j] = q[j], q[i] }
+func (q *eventQueue) Push(x interface{})   { *q = append(*q, x.(event)) }
+func (q *eventQueue) Pop() (x interface{}) { x, *q = (*q)[len(*q)-1], (*q)[:len(*q)-1]; return x }
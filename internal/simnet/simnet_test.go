@@ -0,0 +1,134 @@
+package simnet
+
+import (
+	"fmt"
+	"hash/fnv"
+	"testing"
+	"time"
+)
+
+// gcounter is a grow-only counter replicated by gossip: each node
+// counts its own increments and keeps the highest count it has heard
+// from every other node. It's the smallest distributed counter to
+// exercise the harness with.
+type gcounter struct {
+	net    *Network
+	id     NodeID
+	peers  []NodeID
+	counts map[NodeID]int64
+}
+
+func (g *gcounter) total() (n int64) {
+	for _, c := range g.counts {
+		n += c
+	}
+	return n
+}
+
+func (g *gcounter) receive(m Message) {
+	for id, c := range m.Payload.(map[NodeID]int64) {
+		g.counts[id] = max(g.counts[id], c)
+	}
+}
+
+func (g *gcounter) gossip() {
+	peer := g.peers[g.net.Rand().IntN(len(g.peers))]
+	if peer != g.id {
+		state := make(map[NodeID]int64, len(g.counts))
+		for id, c := range g.counts {
+			state[id] = c
+		}
+		g.net.Send(g.id, peer, state)
+	}
+	g.net.After(10*time.Millisecond, g.gossip)
+}
+
+// simulate runs five gossiping counters through increments, a
+// partition, and a heal, returning them and a hash of the trace.
+func simulate(t *testing.T, seed uint64) ([]*gcounter, uint64) {
+	net := New(seed)
+	net.DropRate = 0.2
+	h := fnv.New64a()
+	net.Trace = func(format string, args ...interface{}) { fmt.Fprintf(h, format+"\n", args...) }
+	ids := []NodeID{1, 2, 3, 4, 5}
+	var nodes []*gcounter
+	for _, id := range ids {
+		g := &gcounter{net: net, id: id, peers: ids, counts: map[NodeID]int64{}}
+		net.AddNode(id, g.receive)
+		net.After(time.Duration(id)*time.Millisecond, g.gossip)
+		nodes = append(nodes, g)
+	}
+	incr := func() {
+		g := nodes[net.Rand().IntN(len(nodes))]
+		g.counts[g.id]++
+	}
+
+	for i := 0; i < 50; i++ {
+		incr()
+		net.RunFor(time.Millisecond)
+	}
+	net.Partition([]NodeID{1, 2}, []NodeID{3, 4, 5})
+	for i := 0; i < 50; i++ {
+		incr()
+		net.RunFor(time.Millisecond)
+	}
+	net.RunFor(time.Second)
+	if a, b := nodes[0].total(), nodes[4].total(); a == b {
+		t.Errorf("nodes 1 and 5 agree on %d across the partition", a)
+	}
+	net.Heal()
+	net.RunFor(5 * time.Second)
+	return nodes, h.Sum64()
+}
+
+func TestGossipConverges(t *testing.T) {
+	nodes, _ := simulate(t, 1)
+	for _, g := range nodes {
+		if n := g.total(); n != 100 {
+			t.Errorf("node %d counts %d after healing; want 100", g.id, n)
+		}
+	}
+}
+
+func TestDeterministic(t *testing.T) {
+	_, h1 := simulate(t, 42)
+	_, h2 := simulate(t, 42)
+	_, h3 := simulate(t, 43)
+	if h1 != h2 {
+		t.Errorf("same seed, different traces: %x, %x", h1, h2)
+	}
+	if h1 == h3 {
+		t.Errorf("seeds 42 and 43 gave the same trace")
+	}
+}
+
+func TestNetwork(t *testing.T) {
+	net := New(1)
+	net.MinDelay, net.MaxDelay = 5*time.Millisecond, 5*time.Millisecond
+	var got []string
+	for _, id := range []NodeID{1, 2, 3} {
+		id := id
+		net.AddNode(id, func(m Message) {
+			got = append(got, fmt.Sprintf("%v %d->%d %v", net.Now(), m.From, id, m.Payload))
+		})
+	}
+	net.Send(1, 2, "a")
+	net.Send(1, 3, "b")
+	net.After(2*time.Millisecond, func() { net.Partition([]NodeID{1}) })
+	net.Send(2, 3, "c") // both on the unlisted side
+	net.RunFor(10 * time.Millisecond)
+	net.Heal()
+	net.Send(1, 9, "nobody")
+	net.RunFor(10 * time.Millisecond)
+
+	want := []string{"5ms 2->3 c"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("delivered %q; want %q", got, want)
+	}
+	if net.Sent != 4 || net.Delivered != 1 || net.Dropped != 3 {
+		t.Errorf("sent, delivered, dropped = %d, %d, %d; want 4, 1, 3", net.Sent, net.Delivered, net.Dropped)
+	}
+	if net.Now() != 20*time.Millisecond {
+		t.Errorf("Now = %v; want 20ms", net.Now())
+	}
+}
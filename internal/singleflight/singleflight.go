@@ -0,0 +1,81 @@
+// Package singleflight collapses concurrent calls for the same key
+// into one, whose result they all get.
+//
+// It's golang.org/x/sync/singleflight's Group.Do, and no more, as the
+// module's only dependencies outside the standard library are its
+// plugins'. Two differences: when fn panics, the callers waiting on it
+// get ErrPanicked rather than a panic of their own, and with
+// DoContext, a caller can give up waiting.
+package singleflight
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrPanicked is what the callers waiting on a Do get if its fn
+// panics.
+var ErrPanicked = errors.New("singleflight: function panicked")
+
+// A call is a Do in flight, or done.
+type call struct {
+	done chan struct{} // closed when fn has returned
+	val  interface{}
+	err  error
+	dups int
+}
+
+// A Group is a namespace of keys. Its zero value is ready to use.
+type Group struct {
+	mu sync.Mutex
+	m  map[string]*call
+}
+
+// Do runs fn and returns its results, unless a call for key is
+// already running, in which case it waits for that one and returns its
+// results instead. shared reports whether the results went to more
+// than one caller. fn mustn't call Do with the same key.
+func (g *Group) Do(key string, fn func() (interface{}, error)) (v interface{}, err error, shared bool) {
+	return g.DoContext(context.Background(), key, fn)
+}
+
+// DoContext is Do, except that a caller waiting for another's call
+// stops when ctx is done, returning ctx.Err(). The call goes on for
+// the others; a caller running fn itself stops only if fn does.
+func (g *Group) DoContext(ctx context.Context, key string, fn func() (interface{}, error)) (v interface{}, err error, shared bool) {
+	g.mu.Lock()
+	if g.m == nil {
+		g.m = make(map[string]*call)
+	}
+	if c, ok := g.m[key]; ok {
+		c.dups++
+		g.mu.Unlock()
+		select {
+		case <-c.done:
+			return c.val, c.err, true
+		case <-ctx.Done():
+			return nil, ctx.Err(), true
+		}
+	}
+	c := &call{done: make(chan struct{})}
+	g.m[key] = c
+	g.mu.Unlock()
+
+	// Deferred, so that a panicking fn doesn't leave its waiters
+	// stuck; they get ErrPanicked, and the panic goes on up.
+	returned := false
+	defer func() {
+		if !returned {
+			c.err = ErrPanicked
+		}
+		g.mu.Lock()
+		delete(g.m, key)
+		shared = c.dups > 0
+		g.mu.Unlock()
+		close(c.done)
+	}()
+	c.val, c.err = fn()
+	returned = true
+	return c.val, c.err, false // shared is set on the way out
+}
@@ -0,0 +1,138 @@
+package singleflight
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestDo(t *testing.T) {
+	var g Group
+	v, err, shared := g.Do("key", func() (interface{}, error) { return "bar", nil })
+	if v != "bar" || err != nil || shared {
+		t.Errorf("Do = %v, %v, %v; want bar, nil, false", v, err, shared)
+	}
+	want := errors.New("boom")
+	if _, err, _ := g.Do("key", func() (interface{}, error) { return nil, want }); err != want {
+		t.Errorf("Do error = %v; want %v", err, want)
+	}
+}
+
+// TestDoCollapses starts callers while the first is blocked and checks
+// that fn runs once and they all share its result.
+func TestDoCollapses(t *testing.T) {
+	var g Group
+	var calls int32
+	release := make(chan struct{})
+	started := make(chan struct{})
+	fn := func() (interface{}, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			close(started)
+		}
+		<-release
+		return 42, nil
+	}
+	const n = 10
+	var wg sync.WaitGroup
+	results := make(chan bool, n)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		v, _, shared := g.Do("key", fn)
+		results <- v == 42 && shared
+	}()
+	<-started
+	for i := 1; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, _, shared := g.Do("key", fn)
+			results <- v == 42 && shared
+		}()
+	}
+	// Wait for the others to join the call before releasing it.
+	for {
+		g.mu.Lock()
+		dups := g.m["key"].dups
+		g.mu.Unlock()
+		if dups == n-1 {
+			break
+		}
+	}
+	close(release)
+	wg.Wait()
+	close(results)
+	for ok := range results {
+		if !ok {
+			t.Error("a caller didn't get the shared result")
+		}
+	}
+	if calls != 1 {
+		t.Errorf("fn ran %d times; want 1", calls)
+	}
+}
+
+func TestDoPanic(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	go func() {
+		defer func() { recover() }()
+		g.Do("key", func() (interface{}, error) {
+			<-release
+			panic("boom")
+		})
+	}()
+	for {
+		g.mu.Lock()
+		_, ok := g.m["key"]
+		g.mu.Unlock()
+		if ok {
+			break
+		}
+	}
+	done := make(chan error)
+	go func() {
+		_, err, _ := g.Do("key", func() (interface{}, error) { return nil, nil })
+		done <- err
+	}()
+	for {
+		g.mu.Lock()
+		dups := g.m["key"].dups
+		g.mu.Unlock()
+		if dups == 1 {
+			break
+		}
+	}
+	close(release)
+	if err := <-done; err != ErrPanicked {
+		t.Errorf("waiter got %v; want ErrPanicked", err)
+	}
+}
+
+func TestDoContextCanceled(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	started := make(chan struct{})
+	leader := make(chan interface{})
+	go func() {
+		v, _, _ := g.Do("key", func() (interface{}, error) {
+			close(started)
+			<-release
+			return 42, nil
+		})
+		leader <- v
+	}()
+	<-started
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	// The waiter gives up, but the call it joined goes on.
+	if _, err, _ := g.DoContext(ctx, "key", func() (interface{}, error) { return nil, nil }); err != context.Canceled {
+		t.Errorf("canceled waiter got %v; want context.Canceled", err)
+	}
+	close(release)
+	if v := <-leader; v != 42 {
+		t.Errorf("leader got %v; want 42", v)
+	}
+}
@@ -0,0 +1,28 @@
+// Package step0 is what the step0 program serves: the talk's first,
+// slowest handler. Keep it the same as ../../../step0/x.go.
+package step0
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+)
+
+var visitors int
+
+func handleHi(w http.ResponseWriter, r *http.Request) {
+	if match, _ := regexp.MatchString(`^\w*$`, r.FormValue("color")); !match {
+		http.Error(w, "Optional color is invalid", http.StatusBadRequest)
+		return
+	}
+	visitors++
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte("<h1 style='color: " + r.FormValue("color") + "'>Welcome!</h1>You are visitor number " + fmt.Sprint(visitors) + "!"))
+}
+
+// Handler returns the routes step0's main registers.
+func Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/hi", handleHi)
+	return mux
+}
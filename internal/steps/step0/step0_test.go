@@ -0,0 +1,11 @@
+package step0
+
+import (
+	"testing"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/internal/steps"
+)
+
+func TestSameAsProgram(t *testing.T) {
+	steps.SameDecls(t, "step0.go", "../../../step0/x.go", "main", "Handler")
+}
@@ -0,0 +1,35 @@
+// Package step1 is what the step1 program serves: step0's handler
+// with the regexp compiled once. Keep it the same as
+// ../../../step1/x.go.
+package step1
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+)
+
+var visitors int
+
+var rxOptionalID = regexp.MustCompile(`^\d*$`)
+
+func handleRoot(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		http.Error(w, "Bad method.", http.StatusBadRequest)
+		return
+	}
+	if !rxOptionalID.MatchString(r.FormValue("id")) {
+		http.Error(w, "Optional numeric id is invalid", http.StatusBadRequest)
+		return
+	}
+	visitors++
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte("<h1>Welcome!</h1>You are visitor number " + fmt.Sprint(visitors) + "!"))
+}
+
+// Handler returns the routes step1's main registers.
+func Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", handleRoot)
+	return mux
+}
@@ -0,0 +1,11 @@
+package step1
+
+import (
+	"testing"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/internal/steps"
+)
+
+func TestSameAsProgram(t *testing.T) {
+	steps.SameDecls(t, "step1.go", "../../../step1/x.go", "main", "Handler")
+}
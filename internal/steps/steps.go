@@ -0,0 +1,62 @@
+// Package steps holds what the step0 and step1 talk programs serve,
+// as importable packages, for "stepn serve -compare" to mount beside
+// stepn. A main package can't be imported, so each subpackage is a
+// copy of its program's handler and the variables it uses, and
+// TestSameAsProgram in each fails if the two drift apart.
+package steps
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// SameDecls fails t unless the Go files at copyPath and progPath
+// have the same top-level declarations, ignoring imports and the
+// functions named in skip, such as progPath's main.
+func SameDecls(t *testing.T, copyPath, progPath string, skip ...string) {
+	t.Helper()
+	got, want := decls(t, copyPath, skip), decls(t, progPath, skip)
+	if strings.Join(got, "\n\n") != strings.Join(want, "\n\n") {
+		t.Errorf("%s has drifted from %s:\n\n%s\n\nwant:\n\n%s", copyPath, progPath, strings.Join(got, "\n\n"), strings.Join(want, "\n\n"))
+	}
+}
+
+func decls(t *testing.T, path string, skip []string) []string {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, path, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out []string
+	for _, d := range f.Decls {
+		switch d := d.(type) {
+		case *ast.GenDecl:
+			if d.Tok == token.IMPORT {
+				continue
+			}
+		case *ast.FuncDecl:
+			if contains(skip, d.Name.Name) {
+				continue
+			}
+		}
+		var sb strings.Builder
+		printer.Fprint(&sb, fset, d)
+		out = append(out, sb.String())
+	}
+	sort.Strings(out)
+	return out
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,195 @@
+// Package logtail keeps the most recent log lines in memory and
+// serves them, followed by new ones, as a Server-Sent Events stream.
+//
+// Install it as the log package's output:
+//
+//	ring := logtail.NewRing(1000)
+//	log.SetOutput(io.MultiWriter(os.Stderr, ring))
+//	http.Handle("/debug/logtail", ring)
+package logtail
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A Level is a log line's severity.
+type Level int
+
+const (
+	Debug Level = iota
+	Info
+	Warn
+	Error
+)
+
+var levelNames = []string{"DEBUG", "INFO", "WARN", "ERROR"}
+
+func (l Level) String() string { return levelNames[l] }
+
+// ParseLevel parses a level name such as "warn", case-insensitively.
+func ParseLevel(s string) (Level, bool) {
+	for i, name := range levelNames {
+		if strings.EqualFold(s, name) {
+			return Level(i), true
+		}
+	}
+	return 0, false
+}
+
+// LevelOf guesses the level of a log line. Lines containing
+// "ERROR:", "WARN:", or "DEBUG:" (or slog's "level=ERROR" and so
+// on) get that level; everything else is Info.
+func LevelOf(line string) Level {
+	for l := Error; l >= Debug; l-- {
+		name := levelNames[l]
+		if strings.Contains(line, name+":") || strings.Contains(line, "level="+name) {
+			return l
+		}
+	}
+	return Info
+}
+
+// A Ring is an io.Writer holding the last lines written to it.
+// It is also an http.Handler streaming those lines.
+type Ring struct {
+	mu      sync.Mutex
+	lines   []string // circular; len(lines) == capacity
+	n       int      // total lines ever written
+	partial []byte   // incomplete last line
+	subs    map[chan string]bool
+}
+
+// NewRing returns a Ring holding up to size lines.
+func NewRing(size int) *Ring {
+	return &Ring{
+		lines: make([]string, size),
+		subs:  make(map[chan string]bool),
+	}
+}
+
+// Write splits p into lines and records each complete one.
+// It never blocks on slow subscribers; they miss lines instead.
+func (r *Ring) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.partial = append(r.partial, p...)
+	for {
+		i := bytes.IndexByte(r.partial, '\n')
+		if i < 0 {
+			break
+		}
+		line := string(r.partial[:i])
+		r.partial = r.partial[i+1:]
+		r.lines[r.n%len(r.lines)] = line
+		r.n++
+		for ch := range r.subs {
+			select {
+			case ch <- line:
+			default:
+			}
+		}
+	}
+	if len(r.partial) == 0 {
+		r.partial = nil
+	}
+	return len(p), nil
+}
+
+// Last returns up to the last n lines, oldest first.
+func (r *Ring) Last(n int) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.lastLocked(n)
+}
+
+func (r *Ring) lastLocked(n int) []string {
+	if n > r.n {
+		n = r.n
+	}
+	if n > len(r.lines) {
+		n = len(r.lines)
+	}
+	out := make([]string, 0, n)
+	for i := r.n - n; i < r.n; i++ {
+		out = append(out, r.lines[i%len(r.lines)])
+	}
+	return out
+}
+
+// subscribe returns the last n lines and a channel of lines written
+// after them. The caller must call unsubscribe when done.
+func (r *Ring) subscribe(n int) ([]string, chan string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ch := make(chan string, 64)
+	r.subs[ch] = true
+	return r.lastLocked(n), ch
+}
+
+func (r *Ring) unsubscribe(ch chan string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.subs, ch)
+}
+
+// ServeHTTP streams the last lines and then follows new ones as
+// Server-Sent Events until the client goes away.
+//
+// Query parameters:
+//
+//	n      number of old lines to send first (default 100)
+//	level  minimum level to send: debug, info, warn, or error
+func (r *Ring) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	f, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	n := 100
+	if v := req.FormValue("n"); v != "" {
+		var err error
+		if n, err = strconv.Atoi(v); err != nil || n < 0 {
+			http.Error(w, "Bad n", http.StatusBadRequest)
+			return
+		}
+	}
+	min := Debug
+	if v := req.FormValue("level"); v != "" {
+		if min, ok = ParseLevel(v); !ok {
+			http.Error(w, "Bad level", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// The stream outlives any server WriteTimeout.
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	backlog, ch := r.subscribe(n)
+	defer r.unsubscribe(ch)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	send := func(line string) {
+		if LevelOf(line) >= min {
+			fmt.Fprintf(w, "data: %s\n\n", line)
+		}
+	}
+	for _, line := range backlog {
+		send(line)
+	}
+	f.Flush()
+	for {
+		select {
+		case line := <-ch:
+			send(line)
+			f.Flush()
+		case <-req.Context().Done():
+			return
+		}
+	}
+}
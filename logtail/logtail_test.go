@@ -0,0 +1,79 @@
+package logtail
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRingLast(t *testing.T) {
+	r := NewRing(3)
+	fmt.Fprintf(r, "a\nb\n")
+	fmt.Fprintf(r, "c\nd")
+	if got, want := r.Last(10), []string{"a", "b", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Last = %q; want %q", got, want)
+	}
+	fmt.Fprintf(r, "\ne\n")
+	if got, want := r.Last(10), []string{"c", "d", "e"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Last = %q; want %q", got, want)
+	}
+	if got, want := r.Last(1), []string{"e"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Last(1) = %q; want %q", got, want)
+	}
+}
+
+func TestLevelOf(t *testing.T) {
+	tests := []struct {
+		line string
+		want Level
+	}{
+		{"2015/08/22 10:00:00 Starting on port 8080", Info},
+		{"2015/08/22 10:00:00 ERROR: disk full", Error},
+		{"2015/08/22 10:00:00 WARN: slow", Warn},
+		{"time=... level=DEBUG msg=hi", Debug},
+	}
+	for _, tt := range tests {
+		if got := LevelOf(tt.line); got != tt.want {
+			t.Errorf("LevelOf(%q) = %v; want %v", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestServeFollow(t *testing.T) {
+	r := NewRing(10)
+	fmt.Fprintf(r, "old info\nERROR: old error\n")
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL + "?level=error")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if got, want := res.Header.Get("Content-Type"), "text/event-stream"; got != want {
+		t.Errorf("Content-Type = %q; want %q", got, want)
+	}
+	br := bufio.NewReader(res.Body)
+	next := func() string {
+		for {
+			line, err := br.ReadString('\n')
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.HasPrefix(line, "data: ") {
+				return strings.TrimSpace(strings.TrimPrefix(line, "data: "))
+			}
+		}
+	}
+	if got := next(); got != "ERROR: old error" {
+		t.Errorf("first event = %q", got)
+	}
+	fmt.Fprintf(r, "new info\nERROR: new error\n")
+	if got := next(); got != "ERROR: new error" {
+		t.Errorf("followed event = %q", got)
+	}
+}
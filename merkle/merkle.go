@@ -0,0 +1,101 @@
+// Package merkle computes the Merkle tree hash of data sent in
+// chunks, as RFC 6962 defines it for Certificate Transparency logs:
+// each chunk is a leaf, hashed with SHA-256, and the root covers them
+// all in order. A client that keeps its chunks' leaf hashes can check
+// any prefix of an upload against the server's root for it, without
+// either side hashing the data again.
+//
+// Leaves and interior nodes are hashed with different prefixes, so a
+// node can't pass for a leaf.
+package merkle
+
+import (
+	"crypto/sha256"
+	"hash"
+)
+
+// Size is the size of a leaf or root hash, in bytes.
+const Size = sha256.Size
+
+// NewLeaf returns a hash that, once written a chunk's bytes, sums to
+// the chunk's leaf hash. It's for chunks streamed rather than held.
+func NewLeaf() hash.Hash {
+	h := sha256.New()
+	h.Write([]byte{0x00})
+	return h
+}
+
+// Leaf returns the leaf hash of chunk.
+func Leaf(chunk []byte) []byte {
+	h := NewLeaf()
+	h.Write(chunk)
+	return h.Sum(nil)
+}
+
+func node(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{0x01})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+// Root returns the root hash of a tree of the given leaf hashes, in
+// order. The left subtree of each node holds the largest power of two
+// leaves fewer than the node has in all. The root of no leaves is the
+// SHA-256 of nothing.
+func Root(leaves [][]byte) []byte {
+	switch len(leaves) {
+	case 0:
+		sum := sha256.Sum256(nil)
+		return sum[:]
+	case 1:
+		return leaves[0]
+	}
+	k := 1
+	for k*2 < len(leaves) {
+		k *= 2
+	}
+	return node(Root(leaves[:k]), Root(leaves[k:]))
+}
+
+// A Range is the compact range of the leaves appended to it so far:
+// the roots of the largest perfect subtrees they make up, left to
+// right, one per set bit of their count. It gives the same root as
+// Root over all the leaves, while holding and hashing only a
+// logarithmic number of nodes.
+//
+// Append leaves r as it was, so copies of a Range may be shared.
+type Range struct {
+	n     uint64
+	nodes [][]byte
+}
+
+// Len returns the number of leaves appended to r.
+func (r Range) Len() uint64 { return r.n }
+
+// Append returns r with leaf appended.
+func (r Range) Append(leaf []byte) Range {
+	nodes := make([][]byte, len(r.nodes), len(r.nodes)+1)
+	copy(nodes, r.nodes)
+	nodes = append(nodes, leaf)
+	// Each trailing one bit of the old count is a subtree the same
+	// size as the one the new leaf completes.
+	for n := r.n; n&1 == 1; n >>= 1 {
+		i := len(nodes) - 2
+		nodes = append(nodes[:i], node(nodes[i], nodes[i+1]))
+	}
+	return Range{r.n + 1, nodes}
+}
+
+// Root returns the root hash over r's leaves, as Root would.
+func (r Range) Root() []byte {
+	if len(r.nodes) == 0 {
+		return Root(nil)
+	}
+	root := r.nodes[len(r.nodes)-1]
+	for i := len(r.nodes) - 2; i >= 0; i-- {
+		root = node(r.nodes[i], root)
+	}
+	return root
+}
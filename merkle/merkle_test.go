@@ -0,0 +1,99 @@
+package merkle
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"testing"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/internal/benchtest"
+)
+
+// TestRoot checks Root against the RFC 6962 test vectors from
+// Certificate Transparency's reference implementation: the roots of
+// the first n of these leaves.
+func TestRoot(t *testing.T) {
+	inputs := []string{"", "00", "10", "2021", "3031", "40414243", "5051525354555657", "606162636465666768696a6b6c6d6e6f"}
+	roots := []string{
+		"6e340b9cffb37a989ca544e6bb780a2c78901d3fb33738768511a30617afa01d",
+		"fac54203e7cc696cf0dfcb42c92a1d9dbaf70ad9e621f4bd8d98662f00e3c125",
+		"aeb6bcfe274b70a14fb067a5e5578264db0fa9b51af5e0ba159158f329e06e77",
+		"d37ee418976dd95753c1c73862b9398fa2a2cf9b4ff0fdfe8b30cd95209614b7",
+		"4e3bbb1f7b478dcfe71fb631631519a3bca12c9aefca1612bfce4c13a86264d4",
+		"76e67dadbcdf1e10e1b74ddc608abd2f98dfb16fbce75277b5232a127f2087ef",
+		"ddb89be403809e325750d3d263cd78929c2942b7942a34b77e122c9594a74c8c",
+		"5dc9da79a70659a9ad559cb701ded9a2ab9d823aad2f4960cfe370eff4604328",
+	}
+	var leaves [][]byte
+	for i, in := range inputs {
+		b, _ := hex.DecodeString(in)
+		leaves = append(leaves, Leaf(b))
+		if got := hex.EncodeToString(Root(leaves)); got != roots[i] {
+			t.Errorf("root of %d leaves = %s; want %s", i+1, got, roots[i])
+		}
+	}
+	if got, want := Root(nil), sha256.Sum256(nil); !bytes.Equal(got, want[:]) {
+		t.Errorf("root of no leaves = %x; want %x", got, want)
+	}
+}
+
+func TestNewLeafMatchesLeaf(t *testing.T) {
+	h := NewLeaf()
+	h.Write([]byte("hello, "))
+	h.Write([]byte("world"))
+	if got, want := h.Sum(nil), Leaf([]byte("hello, world")); !bytes.Equal(got, want) {
+		t.Errorf("streamed leaf = %x; want %x", got, want)
+	}
+}
+
+func TestRangeMatchesRoot(t *testing.T) {
+	var r Range
+	var leaves [][]byte
+	for i := 0; i < 70; i++ {
+		if got, want := r.Root(), Root(leaves); !bytes.Equal(got, want) {
+			t.Fatalf("Range root of %d leaves = %x; want %x", i, got, want)
+		}
+		leaf := Leaf([]byte{byte(i)})
+		leaves = append(leaves, leaf)
+		before := r
+		r = r.Append(leaf)
+		if got, want := before.Root(), Root(leaves[:i]); !bytes.Equal(got, want) {
+			t.Fatalf("Append changed the Range it was called on")
+		}
+	}
+	if r.Len() != 70 {
+		t.Errorf("Len = %d; want 70", r.Len())
+	}
+}
+
+// BenchmarkRoot measures recomputing the root over an upload's leaves
+// against appending the last to a Range of the rest and taking its
+// root, as the server does after each chunk. Smaller chunks mean more
+// leaves to verify the upload by, but a bigger tree:
+//
+//	go test -run=^$ -bench=Root ./merkle
+func BenchmarkRoot(b *testing.B) {
+	for _, n := range []int{16, 256, 4096} {
+		leaves := make([][]byte, n)
+		for i := range leaves {
+			leaves[i] = Leaf([]byte{byte(i)})
+		}
+		b.Run(fmt.Sprintf("leaves=%d", n), func(b *testing.B) {
+			b.ReportAllocs()
+			for benchtest.Loop(b) {
+				Root(leaves)
+			}
+		})
+		b.Run(fmt.Sprintf("range/leaves=%d", n), func(b *testing.B) {
+			var r Range
+			for _, l := range leaves[:n-1] {
+				r = r.Append(l)
+			}
+			b.ReportAllocs()
+			for benchtest.Loop(b) {
+				r.Append(leaves[n-1]).Root()
+			}
+		})
+	}
+}
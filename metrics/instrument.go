@@ -0,0 +1,139 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	instrumentOnce  sync.Once
+	requestsTotal   *CounterVec
+	requestDuration *HistogramVec
+	inFlight        int64 // must be accessed atomically
+)
+
+func initInstrument() {
+	requestsTotal = NewCounterVec("http_requests_total", "HTTP requests served, by handler and status code.", "handler", "code")
+	requestDuration = NewHistogramVec("http_request_duration_seconds", "HTTP response latency, by handler.", nil, "handler")
+	NewGaugeFunc("http_requests_in_flight", "HTTP requests being served by instrumented handlers.", func() float64 {
+		return float64(InFlight())
+	})
+}
+
+// InFlight returns how many requests instrumented handlers are
+// serving right now.
+func InFlight() int64 { return atomic.LoadInt64(&inFlight) }
+
+// Instrument wraps h so that its requests are counted and timed in
+// Default under the given handler name.
+//
+// The name, rather than the request path, becomes the label value,
+// so the number of series stays fixed no matter what paths clients
+// ask for.
+func Instrument(name string, h http.Handler) http.Handler {
+	instrumentOnce.Do(initInstrument)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serveInstrumented(name, h, w, r)
+	})
+}
+
+// InstrumentMux is like Instrument, but names each request after the
+// mux pattern it matches, such as "/upload" or "/debug/pprof/". A
+// pattern's method is left out of the name, so "PUT /upload" is
+// "/upload" too.
+//
+// Requests that match no pattern, or only the catch-all "/" pattern
+// for some other path, are all named "unknown", so a client scanning
+// for paths adds at most one series.
+func InstrumentMux(mux *http.ServeMux) http.Handler {
+	instrumentOnce.Do(initInstrument)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, pattern := mux.Handler(r)
+		serveInstrumented(RouteName(pattern, r), mux, w, r)
+	})
+}
+
+// RouteName returns the name InstrumentMux uses for r, which matched
+// pattern.
+func RouteName(pattern string, r *http.Request) string {
+	if _, path, ok := strings.Cut(pattern, " "); ok {
+		pattern = path
+	}
+	if pattern == "" || pattern == "/" && r.URL.Path != "/" {
+		return "unknown"
+	}
+	return pattern
+}
+
+func serveInstrumented(name string, h http.Handler, w http.ResponseWriter, r *http.Request) {
+	atomic.AddInt64(&inFlight, 1)
+	defer atomic.AddInt64(&inFlight, -1)
+	t0 := time.Now()
+	sw := &statusWriter{ResponseWriter: w}
+	// A panic on its way up still counts, as a 500 if nothing was
+	// written yet, since that's what a recovering caller will send.
+	returned := false
+	defer func() {
+		code := sw.status()
+		if !returned && sw.code == 0 {
+			code = http.StatusInternalServerError
+		}
+		requestDuration.Observe(time.Since(t0).Seconds(), name)
+		requestsTotal.Inc(name, strconv.Itoa(code))
+	}()
+	h.ServeHTTP(sw, r)
+	returned = true
+}
+
+// statusWriter records the status code written through it.
+type statusWriter struct {
+	http.ResponseWriter
+	code int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if w.code == 0 {
+		w.code = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(p []byte) (int, error) {
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *statusWriter) status() int {
+	if w.code == 0 {
+		return http.StatusOK
+	}
+	return w.code
+}
+
+// Flush lets streaming handlers, such as Server-Sent Events, flush
+// through the wrapper.
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// ReadFrom lets a body copied in, as http.ServeContent copies a file,
+// reach the underlying writer's ReadFrom, which on Linux is sendfile.
+func (w *statusWriter) ReadFrom(src io.Reader) (int64, error) {
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	return io.Copy(w.ResponseWriter, src)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer,
+// for handlers that hijack the connection.
+func (w *statusWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
@@ -0,0 +1,102 @@
+package metrics
+
+import "math"
+
+// A Latencies is a snapshot of a latency histogram, summed across
+// label values.
+type Latencies struct {
+	Bounds []float64 // bucket upper bounds, in seconds, ascending
+	Counts []uint64  // per bucket, not cumulative; the last is +Inf
+}
+
+// RequestLatencies returns the latencies of every request Instrument
+// and InstrumentMux have recorded so far. Subtract an earlier snapshot
+// to see just the requests in between.
+func RequestLatencies() Latencies {
+	instrumentOnce.Do(initInstrument)
+	return requestDuration.snapshot()
+}
+
+func (h *HistogramVec) snapshot() Latencies {
+	l := Latencies{Bounds: h.buckets, Counts: make([]uint64, len(h.buckets)+1)}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, hg := range h.vals {
+		for i, n := range hg.counts {
+			l.Counts[i] += n
+		}
+	}
+	return l
+}
+
+// Sub returns the observations in l that weren't yet in old, an
+// earlier snapshot of the same histogram.
+func (l Latencies) Sub(old Latencies) Latencies {
+	d := Latencies{Bounds: l.Bounds, Counts: make([]uint64, len(l.Counts))}
+	for i, n := range l.Counts {
+		if i < len(old.Counts) {
+			n -= old.Counts[i]
+		}
+		d.Counts[i] = n
+	}
+	return d
+}
+
+// Count returns the number of observations.
+func (l Latencies) Count() uint64 {
+	var n uint64
+	for _, c := range l.Counts {
+		n += c
+	}
+	return n
+}
+
+// Quantile estimates the q quantile, such as 0.99, in seconds, by
+// interpolating within the bucket it falls in, as Prometheus's
+// histogram_quantile does. It returns NaN with no observations, and
+// the largest bound if the quantile is beyond it.
+func (l Latencies) Quantile(q float64) float64 {
+	total := l.Count()
+	if total == 0 {
+		return math.NaN()
+	}
+	rank := q * float64(total)
+	var cum float64
+	for i, n := range l.Counts {
+		if n == 0 || cum+float64(n) < rank {
+			cum += float64(n)
+			continue
+		}
+		if i == len(l.Bounds) {
+			return l.Bounds[len(l.Bounds)-1]
+		}
+		lo := 0.0
+		if i > 0 {
+			lo = l.Bounds[i-1]
+		}
+		return lo + (l.Bounds[i]-lo)*(rank-cum)/float64(n)
+	}
+	return l.Bounds[len(l.Bounds)-1]
+}
+
+// A RouteSummary is one route's request count and latency
+// percentiles, in seconds.
+type RouteSummary struct {
+	Route    string  `json:"route"`
+	Requests uint64  `json:"requests"`
+	P50      float64 `json:"p50"`
+	P95      float64 `json:"p95"`
+	P99      float64 `json:"p99"`
+}
+
+// Summarize returns l's count and percentiles as route's summary. l
+// must have at least one observation.
+func (l Latencies) Summarize(route string) RouteSummary {
+	return RouteSummary{
+		Route:    route,
+		Requests: l.Count(),
+		P50:      l.Quantile(0.5),
+		P95:      l.Quantile(0.95),
+		P99:      l.Quantile(0.99),
+	}
+}
@@ -0,0 +1,144 @@
+// Package metrics is a small instrumentation library: counters,
+// gauges, and histograms, served in the Prometheus text format.
+//
+// Any step can opt in by wrapping its handlers with Instrument, or
+// its whole mux with InstrumentMux, and serving Default at /metrics:
+//
+//	http.Handle("/", metrics.Instrument("root", http.HandlerFunc(handleRoot)))
+//	http.Handle("/metrics", metrics.Default)
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Default is the registry used by Instrument, InstrumentMux, and the
+// package-level constructors.
+var Default = NewRegistry()
+
+// A Registry holds metrics and serves them.
+type Registry struct {
+	mu      sync.Mutex
+	metrics map[string]metric
+}
+
+type metric interface {
+	write(w io.Writer, name string)
+	kind() string
+	help() string
+}
+
+// NewRegistry returns an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{metrics: make(map[string]metric)}
+}
+
+func (r *Registry) register(name string, m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, dup := r.metrics[name]; dup {
+		panic("metrics: duplicate metric " + name)
+	}
+	r.metrics[name] = m
+}
+
+// ServeHTTP writes every metric, sorted by name, in the Prometheus
+// text exposition format.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	r.WriteText(w)
+}
+
+// WriteText writes every metric to w in the Prometheus text format.
+func (r *Registry) WriteText(w io.Writer) {
+	r.mu.Lock()
+	names := make([]string, 0, len(r.metrics))
+	for name := range r.metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	ms := make([]metric, len(names))
+	for i, name := range names {
+		ms[i] = r.metrics[name]
+	}
+	r.mu.Unlock()
+	for i, name := range names {
+		m := ms[i]
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, m.help(), name, m.kind())
+		m.write(w, name)
+	}
+}
+
+// labelSet is a series' label values, joined with '\xff'.
+type labelSet string
+
+func makeLabelSet(names, values []string) labelSet {
+	if len(values) != len(names) {
+		panic(fmt.Sprintf("metrics: got %d label values for labels %q", len(values), names))
+	}
+	return labelSet(strings.Join(values, "\xff"))
+}
+
+// format renders the set as {a="x",b="y"}, with extra appended.
+func (ls labelSet) format(names []string, extra ...string) string {
+	if len(names) == 0 && len(extra) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteByte('{')
+	var values []string
+	if len(names) > 0 {
+		values = strings.Split(string(ls), "\xff")
+	}
+	for i, name := range names {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(name)
+		sb.WriteString(`="`)
+		sb.WriteString(escape(values[i]))
+		sb.WriteByte('"')
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		if sb.Len() > 1 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(extra[i])
+		sb.WriteString(`="`)
+		sb.WriteString(escape(extra[i+1]))
+		sb.WriteByte('"')
+	}
+	sb.WriteByte('}')
+	return sb.String()
+}
+
+var escaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escape(s string) string { return escaper.Replace(s) }
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, +1):
+		return "+Inf"
+	case v == math.Trunc(v) && math.Abs(v) < 1e15:
+		return strconv.FormatInt(int64(v), 10)
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// sortedKeys returns the label sets of m in order.
+func sortedKeys[V any](m map[labelSet]V) []labelSet {
+	keys := make([]labelSet, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
@@ -0,0 +1,172 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRegistryFormat(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounterVec("uploads_total", "Uploads.", "result")
+	c.Inc("ok")
+	c.Inc("ok")
+	c.Add(0.5, `we"ird`)
+	r.NewGaugeFunc("visitors", "Visitors so far.", func() float64 { return 42 })
+	h := r.NewHistogramVec("latency_seconds", "Latency.", []float64{0.1, 1}, "handler")
+	h.Observe(0.05, "root")
+	h.Observe(0.5, "root")
+	h.Observe(3, "root")
+
+	var buf bytes.Buffer
+	r.WriteText(&buf)
+	want := `# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{handler="root",le="0.1"} 1
+latency_seconds_bucket{handler="root",le="1"} 2
+latency_seconds_bucket{handler="root",le="+Inf"} 3
+latency_seconds_sum{handler="root"} 3.55
+latency_seconds_count{handler="root"} 3
+# HELP uploads_total Uploads.
+# TYPE uploads_total counter
+uploads_total{result="ok"} 2
+uploads_total{result="we\"ird"} 0.5
+# HELP visitors Visitors so far.
+# TYPE visitors gauge
+visitors 42
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestInstrument(t *testing.T) {
+	var during int64
+	h := Instrument("teapot", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		during = InFlight()
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	for i := 0; i < 3; i++ {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/anything", nil))
+	}
+	if got := requestsTotal.Value("teapot", "418"); got != 3 {
+		t.Errorf("requests counted = %v; want 3", got)
+	}
+	if during != 1 || InFlight() != 0 {
+		t.Errorf("InFlight = %d during request, %d after; want 1, 0", during, InFlight())
+	}
+
+	rw := httptest.NewRecorder()
+	Default.ServeHTTP(rw, httptest.NewRequest("GET", "/metrics", nil))
+	for _, want := range []string{
+		`http_requests_total{handler="teapot",code="418"} 3`,
+		`http_request_duration_seconds_count{handler="teapot"} 3`,
+	} {
+		if !strings.Contains(rw.Body.String(), want) {
+			t.Errorf("/metrics missing %q", want)
+		}
+	}
+}
+
+func TestInstrumentMuxBoundsCardinality(t *testing.T) {
+	mux := http.NewServeMux()
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	mux.Handle("/", ok)
+	mux.Handle("/upload", ok)
+	mux.Handle("/static/", ok)
+	h := InstrumentMux(mux)
+
+	before := requestsTotal.Len()
+	// A scanner probing thousands of distinct paths.
+	for i := 0; i < 5000; i++ {
+		for _, p := range []string{"/wp-admin/%d.php", "/static/%d.css", "/upload/%d", "/.git/%d"} {
+			h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", fmt.Sprintf(p, i), nil))
+		}
+	}
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("PUT", "/upload", nil))
+	if n := requestsTotal.Len() - before; n > 4 {
+		t.Errorf("scan added %d series; want at most 4 (/, /upload, /static/, unknown)", n)
+	}
+	for _, tt := range []struct {
+		route string
+		want  float64
+	}{
+		{"unknown", 15000},
+		{"/static/", 5000},
+		{"/", 1},
+		{"/upload", 1},
+	} {
+		if got := requestsTotal.Value(tt.route, "200"); got != tt.want {
+			t.Errorf("requests for %q = %v; want %v", tt.route, got, tt.want)
+		}
+	}
+}
+
+func TestInstrumentMuxMethodPatterns(t *testing.T) {
+	mux := http.NewServeMux()
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	mux.Handle("PUT /hash", ok)
+	mux.Handle("GET /hash", ok)
+	h := InstrumentMux(mux)
+	before := requestsTotal.Value("/hash", "200")
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("PUT", "/hash", nil))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/hash", nil))
+	if got := requestsTotal.Value("/hash", "200") - before; got != 2 {
+		t.Errorf("requests for /hash went up by %v; want 2, both methods under one name", got)
+	}
+}
+
+func TestInstrumentPanic(t *testing.T) {
+	h := Instrument("panicky", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+	func() {
+		defer func() { recover() }()
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	}()
+	if got := requestsTotal.Value("panicky", "500"); got != 1 {
+		t.Errorf("panicking requests counted as 500 = %v; want 1", got)
+	}
+	if n := InFlight(); n != 0 {
+		t.Errorf("InFlight after panic = %d; want 0", n)
+	}
+}
+
+func TestLatencies(t *testing.T) {
+	h := NewRegistry().NewHistogramVec("latency_seconds", "Latency.", []float64{0.1, 1}, "handler")
+	for i := 0; i < 10; i++ {
+		h.Observe(0.05, "root")
+	}
+	old := h.snapshot()
+	for i := 0; i < 8; i++ {
+		h.Observe(0.5, "upload")
+	}
+	h.Observe(0.05, "root")
+	h.Observe(3, "upload")
+
+	d := h.snapshot().Sub(old)
+	if d.Count() != 10 || fmt.Sprint(d.Counts) != "[1 8 1]" {
+		t.Fatalf("delta counts = %v; want [1 8 1]", d.Counts)
+	}
+	for _, tt := range []struct{ q, want float64 }{
+		{0.05, 0.05}, // halfway through the first bucket
+		{0.5, 0.55},  // 4 of the second bucket's 8
+		{0.99, 1},    // in +Inf, so the largest bound
+	} {
+		if got := d.Quantile(tt.q); fmt.Sprintf("%.3f", got) != fmt.Sprintf("%.3f", tt.want) {
+			t.Errorf("Quantile(%v) = %v; want %v", tt.q, got, tt.want)
+		}
+	}
+	if q := (Latencies{Bounds: []float64{1}, Counts: []uint64{0, 0}}).Quantile(0.5); q == q {
+		t.Errorf("Quantile of nothing = %v; want NaN", q)
+	}
+
+	s := d.Summarize("all")
+	if got := fmt.Sprintf("%d %.3f %.3f %.3f", s.Requests, s.P50, s.P95, s.P99); got != "10 0.550 1.000 1.000" {
+		t.Errorf("Summarize = %s; want 10 requests, p50 0.55, p95 and p99 1", got)
+	}
+}
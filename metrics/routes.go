@@ -0,0 +1,184 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math/bits"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// LogHistogram buckets: one below 1.024µs, four per power of two up to
+// 2^36ns (about 69s), and one above that.
+const (
+	logMinShift   = 10
+	logMaxShift   = 36
+	logSubBuckets = 4
+	numLogBuckets = (logMaxShift-logMinShift)*logSubBuckets + 2
+)
+
+// logBounds are the LogHistogram bucket upper bounds, in seconds.
+var logBounds = func() []float64 {
+	b := make([]float64, numLogBuckets-1)
+	b[0] = float64(1<<logMinShift) / 1e9
+	for i := 1; i < len(b); i++ {
+		e := logMinShift + (i-1)/logSubBuckets
+		sub := (i - 1) % logSubBuckets
+		b[i] = float64(int64(logSubBuckets+sub+1)<<(e-2)) / 1e9
+	}
+	return b
+}()
+
+// A LogHistogram counts durations in fixed log-scale buckets, each
+// a quarter to a seventh as wide as the values in it are large, so a
+// quantile read from it is within that much of the truth at any
+// latency. Observe is two atomic adds and no lock, cheap enough to
+// call on every request. The zero value is ready to use.
+type LogHistogram struct {
+	counts [numLogBuckets]uint64 // must be accessed atomically
+	sum    int64                 // nanoseconds; must be accessed atomically
+}
+
+func logBucket(ns int64) int {
+	if ns < 1<<logMinShift {
+		return 0
+	}
+	e := bits.Len64(uint64(ns)) - 1
+	if e >= logMaxShift {
+		return numLogBuckets - 1
+	}
+	sub := int(ns>>(e-2)) & (logSubBuckets - 1)
+	return 1 + (e-logMinShift)*logSubBuckets + sub
+}
+
+// Observe records d.
+func (h *LogHistogram) Observe(d time.Duration) {
+	atomic.AddUint64(&h.counts[logBucket(int64(d))], 1)
+	atomic.AddInt64(&h.sum, int64(d))
+}
+
+// Latencies returns a snapshot of h. Observations racing with it may
+// or may not be included.
+func (h *LogHistogram) Latencies() Latencies {
+	l := Latencies{Bounds: logBounds, Counts: make([]uint64, numLogBuckets)}
+	for i := range h.counts {
+		l.Counts[i] = atomic.LoadUint64(&h.counts[i])
+	}
+	return l
+}
+
+// Sum returns the total of the observed durations.
+func (h *LogHistogram) Sum() time.Duration { return time.Duration(atomic.LoadInt64(&h.sum)) }
+
+// Reset forgets every observation. Observations racing with it may be
+// kept or lost.
+func (h *LogHistogram) Reset() {
+	for i := range h.counts {
+		atomic.StoreUint64(&h.counts[i], 0)
+	}
+	atomic.StoreInt64(&h.sum, 0)
+}
+
+// RouteLatencies records each route's response latency in its own
+// LogHistogram, and serves them as a Prometheus summary with the
+// 50th, 95th, and 99th percentiles.
+type RouteLatencies struct {
+	desc   string
+	routes sync.Map // route name to *LogHistogram
+}
+
+// NewRouteLatencies registers a RouteLatencies in r.
+func (r *Registry) NewRouteLatencies(name, help string) *RouteLatencies {
+	rl := &RouteLatencies{desc: help}
+	r.register(name, rl)
+	return rl
+}
+
+// NewRouteLatencies registers a RouteLatencies in Default.
+func NewRouteLatencies(name, help string) *RouteLatencies {
+	return Default.NewRouteLatencies(name, help)
+}
+
+// Route returns the histogram for the named route, creating it if
+// need be.
+func (rl *RouteLatencies) Route(name string) *LogHistogram {
+	if h, ok := rl.routes.Load(name); ok {
+		return h.(*LogHistogram)
+	}
+	h, _ := rl.routes.LoadOrStore(name, new(LogHistogram))
+	return h.(*LogHistogram)
+}
+
+// Handler wraps h, the handler for a mux pattern, to time its
+// requests. The histograms are looked up once, here, so the cost per
+// request is two monotonic clock reads and the adds;
+// BenchmarkRouteLatencies measures it. As with InstrumentMux, requests that reach the
+// catch-all "/" pattern for another path are recorded as "unknown".
+func (rl *RouteLatencies) Handler(pattern string, h http.Handler) http.Handler {
+	hist := rl.Route(pattern)
+	var unknown *LogHistogram
+	if pattern == "/" {
+		unknown = rl.Route("unknown")
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t0 := time.Since(clockBase)
+		h.ServeHTTP(w, r)
+		d := time.Since(clockBase) - t0
+		if unknown != nil && r.URL.Path != "/" {
+			unknown.Observe(d)
+			return
+		}
+		hist.Observe(d)
+	})
+}
+
+// clockBase lets Handler read only the monotonic clock: time.Since
+// on a time with a monotonic reading skips the wall clock, which
+// time.Now also reads, and that's most of the cost of a time.Now.
+var clockBase = time.Now()
+
+// Summaries returns the routes that have served requests, sorted by
+// name.
+func (rl *RouteLatencies) Summaries() []RouteSummary {
+	out := []RouteSummary{}
+	rl.routes.Range(func(k, v interface{}) bool {
+		l := v.(*LogHistogram).Latencies()
+		if l.Count() > 0 {
+			out = append(out, l.Summarize(k.(string)))
+		}
+		return true
+	})
+	sort.Slice(out, func(i, j int) bool { return out[i].Route < out[j].Route })
+	return out
+}
+
+// Reset resets every route's histogram. To Prometheus it looks like a
+// restart.
+func (rl *RouteLatencies) Reset() {
+	rl.routes.Range(func(_, v interface{}) bool {
+		v.(*LogHistogram).Reset()
+		return true
+	})
+}
+
+func (rl *RouteLatencies) kind() string { return "summary" }
+func (rl *RouteLatencies) help() string { return rl.desc }
+
+func (rl *RouteLatencies) write(w io.Writer, name string) {
+	labels := []string{"route"}
+	for _, s := range rl.Summaries() {
+		ls := makeLabelSet(labels, []string{s.Route})
+		for _, q := range []struct {
+			q string
+			v float64
+		}{{"0.5", s.P50}, {"0.95", s.P95}, {"0.99", s.P99}} {
+			fmt.Fprintf(w, "%s%s %s\n", name, ls.format(labels, "quantile", q.q), formatFloat(q.v))
+		}
+		h, _ := rl.routes.Load(s.Route)
+		fmt.Fprintf(w, "%s_sum%s %s\n", name, ls.format(labels), formatFloat(h.(*LogHistogram).Sum().Seconds()))
+		fmt.Fprintf(w, "%s_count%s %d\n", name, ls.format(labels), s.Requests)
+	}
+}
@@ -0,0 +1,141 @@
+package metrics
+
+import (
+	"bytes"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLogBucket(t *testing.T) {
+	for _, tt := range []struct {
+		d    time.Duration
+		want int
+	}{
+		{0, 0},
+		{1023, 0},
+		{1024, 1},
+		{1279, 1},
+		{1280, 2},
+		{2047, 4},
+		{2048, 5},
+		{math.MaxInt64, numLogBuckets - 1},
+	} {
+		if got := logBucket(int64(tt.d)); got != tt.want {
+			t.Errorf("logBucket(%d) = %d; want %d", tt.d, got, tt.want)
+		}
+	}
+	// Every bucket's upper bound is the next one's lowest value.
+	for i, b := range logBounds {
+		ns := int64(math.Round(b * 1e9))
+		if got := logBucket(ns - 1); got != i {
+			t.Errorf("logBucket(%d) = %d; want %d", ns-1, got, i)
+		}
+		if got := logBucket(ns); got != i+1 {
+			t.Errorf("logBucket(%d) = %d; want %d", ns, got, i+1)
+		}
+	}
+}
+
+func TestLogHistogramQuantiles(t *testing.T) {
+	var h LogHistogram
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 1; i <= 1000; i++ {
+				h.Observe(time.Duration(i) * time.Millisecond)
+			}
+		}()
+	}
+	wg.Wait()
+	l := h.Latencies()
+	if n := l.Count(); n != 4000 {
+		t.Fatalf("Count = %d; want 4000", n)
+	}
+	for _, q := range []float64{0.5, 0.9, 0.99} {
+		got, want := l.Quantile(q), q // seconds, for 1ms through 1s
+		if math.Abs(got-want)/want > 0.15 {
+			t.Errorf("Quantile(%v) = %v; want within 15%% of %v", q, got, want)
+		}
+	}
+	if got, want := h.Sum(), 4*500500*time.Millisecond; got != want {
+		t.Errorf("Sum = %v; want %v", got, want)
+	}
+}
+
+func TestRouteLatencies(t *testing.T) {
+	r := NewRegistry()
+	rl := r.NewRouteLatencies("route_latency_seconds", "Latency by route.")
+	ok := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+	mux := http.NewServeMux()
+	mux.Handle("/", rl.Handler("/", ok))
+	mux.Handle("/upload", rl.Handler("/upload", ok))
+	rl.Handler("/idle", ok)
+	for _, path := range []string{"/", "/upload", "/upload", "/nope"} {
+		mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	var got []string
+	for _, s := range rl.Summaries() {
+		got = append(got, s.Route)
+		if s.P99 <= 0 || s.P99 > 1 {
+			t.Errorf("%s: p99 = %v", s.Route, s.P99)
+		}
+	}
+	if strings.Join(got, " ") != "/ /upload unknown" {
+		t.Errorf("summarized routes = %q; want /, /upload, unknown (and not /idle)", got)
+	}
+
+	var buf bytes.Buffer
+	r.WriteText(&buf)
+	for _, want := range []string{
+		"# TYPE route_latency_seconds summary\n",
+		`route_latency_seconds{route="/upload",quantile="0.99"} `,
+		`route_latency_seconds_count{route="/upload"} 2` + "\n",
+		`route_latency_seconds_count{route="unknown"} 1` + "\n",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("output lacks %q:\n%s", want, buf.String())
+		}
+	}
+
+	rl.Reset()
+	if s := rl.Summaries(); len(s) != 0 {
+		t.Errorf("Summaries after Reset = %+v; want none", s)
+	}
+}
+
+// BenchmarkRouteLatencies measures what Handler adds to a request,
+// which should stay under 100ns:
+//
+//	go test -run=^$ -bench=RouteLatencies
+//
+// On a VM whose monotonic clock costs 43ns a read, Timed takes about
+// 90ns more than Bare, nearly all of it the two reads.
+func BenchmarkRouteLatencies(b *testing.B) {
+	rl := NewRegistry().NewRouteLatencies("route_latency_seconds", "Latency by route.")
+	noop := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+	req := httptest.NewRequest("GET", "/upload", nil)
+	w := httptest.NewRecorder()
+	for _, bb := range []struct {
+		name string
+		h    http.Handler
+	}{
+		{"Bare", noop},
+		{"Timed", rl.Handler("/upload", noop)},
+	} {
+		b.Run(bb.name, func(b *testing.B) {
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					bb.h.ServeHTTP(w, req)
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package metrics
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/internal/clock"
+)
+
+// An SLO is a service level objective for the requests recorded by
+// Instrument and InstrumentMux.
+type SLO struct {
+	Name      string
+	Objective float64 // fraction of requests that must be good, such as 0.99
+
+	// Latency, if non-zero, is how fast a good request must be. It's
+	// rounded down to a histogram bucket bound, so pick one of those.
+	// If zero, a request is good unless it got a 5xx status.
+	Latency time.Duration
+}
+
+// counts returns how many requests have been recorded, and how many of
+// those were bad under s.
+func (s SLO) counts() (bad, total float64) {
+	if s.Latency != 0 {
+		good, total := requestDuration.countAtMost(s.Latency.Seconds())
+		return float64(total - good), float64(total)
+	}
+	return requestsTotal.sumWhere(func(values []string) bool {
+		return strings.HasPrefix(values[1], "5")
+	})
+}
+
+// An Alert is an SLO burning its error budget too fast.
+type Alert struct {
+	SLO      string    `json:"slo"`
+	BurnRate float64   `json:"burnRate"` // over the short window
+	Since    time.Time `json:"since"`
+}
+
+// An Evaluator watches SLOs and raises an Alert for each one whose
+// error budget is burning at Threshold times the sustainable rate or
+// more, over both the Short and the Long window. Requiring both keeps
+// a brief spike from alerting while letting the alert clear soon after
+// the problem does.
+//
+// A burn rate of 1 spends exactly the whole budget (1 - Objective)
+// over time; the default Threshold of 14.4 over an hour spends 2% of
+// a 30-day budget.
+type Evaluator struct {
+	SLOs      []SLO
+	Short     time.Duration // default 5m
+	Long      time.Duration // default 1h
+	Threshold float64       // default 14.4
+
+	mu      sync.Mutex
+	samples map[string][]sample // by SLO name, oldest first
+	active  map[string]*Alert
+}
+
+type sample struct {
+	t          time.Time
+	bad, total float64
+}
+
+func (e *Evaluator) short() time.Duration {
+	if e.Short == 0 {
+		return 5 * time.Minute
+	}
+	return e.Short
+}
+
+func (e *Evaluator) long() time.Duration {
+	if e.Long == 0 {
+		return time.Hour
+	}
+	return e.Long
+}
+
+func (e *Evaluator) threshold() float64 {
+	if e.Threshold == 0 {
+		return 14.4
+	}
+	return e.Threshold
+}
+
+// Evaluate samples each SLO's request counts at time now and updates
+// the active alerts.
+func (e *Evaluator) Evaluate(now time.Time) {
+	instrumentOnce.Do(initInstrument)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.samples == nil {
+		e.samples = make(map[string][]sample)
+		e.active = make(map[string]*Alert)
+	}
+	for _, s := range e.SLOs {
+		bad, total := s.counts()
+		ss := append(e.samples[s.Name], sample{now, bad, total})
+		// Keep one sample at least Long old to measure from.
+		for len(ss) > 1 && now.Sub(ss[1].t) >= e.long() {
+			ss = ss[1:]
+		}
+		e.samples[s.Name] = ss
+
+		budget := 1 - s.Objective
+		shortBurn := burnRate(ss, now.Add(-e.short()), budget)
+		longBurn := burnRate(ss, now.Add(-e.long()), budget)
+		if shortBurn >= e.threshold() && longBurn >= e.threshold() {
+			if a := e.active[s.Name]; a != nil {
+				a.BurnRate = shortBurn
+			} else {
+				e.active[s.Name] = &Alert{SLO: s.Name, BurnRate: shortBurn, Since: clock.Stamp(now)}
+			}
+		} else {
+			delete(e.active, s.Name)
+		}
+	}
+}
+
+// burnRate returns the rate the budget was spent at between the
+// latest sample and the last one taken at or before since, or the
+// oldest one if there's no sample that old yet.
+func burnRate(ss []sample, since time.Time, budget float64) float64 {
+	last := ss[len(ss)-1]
+	from := ss[0]
+	for _, s := range ss {
+		if s.t.After(since) {
+			break
+		}
+		from = s
+	}
+	total := last.total - from.total
+	if total <= 0 || budget <= 0 {
+		return 0
+	}
+	return (last.bad - from.bad) / total / budget
+}
+
+// Alerts returns the active alerts, sorted by SLO name.
+func (e *Evaluator) Alerts() []Alert {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	out := []Alert{}
+	for _, a := range e.active {
+		out = append(out, *a)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].SLO < out[j].SLO })
+	return out
+}
+
+// Run calls Evaluate every interval until stop is closed.
+func (e *Evaluator) Run(every time.Duration, stop <-chan struct{}) {
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for {
+		select {
+		case now := <-t.C:
+			e.Evaluate(now)
+		case <-stop:
+			return
+		}
+	}
+}
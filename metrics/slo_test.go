@@ -0,0 +1,73 @@
+package metrics
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestEvaluator(t *testing.T) {
+	var status int
+	h := Instrument("slo", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	serve := func(n, code int) {
+		status = code
+		for i := 0; i < n; i++ {
+			h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+		}
+	}
+	alerting := func(e *Evaluator) (names []string) {
+		for _, a := range e.Alerts() {
+			names = append(names, a.SLO)
+		}
+		return
+	}
+
+	e := &Evaluator{
+		SLOs: []SLO{
+			{Name: "errors", Objective: 0.9},
+			{Name: "latency", Objective: 0.9, Latency: 100 * time.Millisecond},
+		},
+		Short:     time.Minute,
+		Long:      10 * time.Minute,
+		Threshold: 2,
+	}
+	t0 := time.Unix(1e9, 0)
+	e.Evaluate(t0)
+
+	serve(10, 200)
+	e.Evaluate(t0.Add(1 * time.Minute))
+	if got := alerting(e); len(got) != 0 {
+		t.Fatalf("alerts after good traffic = %q; want none", got)
+	}
+
+	// All errors in the short window and half over the long one: burn
+	// rates of 10 and 5.
+	serve(10, 500)
+	e.Evaluate(t0.Add(2 * time.Minute))
+	if got := alerting(e); len(got) != 1 || got[0] != "errors" {
+		t.Fatalf("alerts after errors = %q; want [errors]", got)
+	}
+	if a := e.Alerts()[0]; math.Abs(a.BurnRate-10) > 1e-9 || !a.Since.Equal(t0.Add(2*time.Minute)) {
+		t.Errorf("alert = %+v; want burn rate 10 (all errors in the short window) since t0+2m", a)
+	}
+
+	for i := 0; i < 20; i++ {
+		requestDuration.Observe(0.5, "slo")
+	}
+	e.Evaluate(t0.Add(3 * time.Minute))
+	if got := alerting(e); len(got) != 1 || got[0] != "latency" {
+		t.Errorf("alerts after slow requests = %q; want [latency], errors having cleared in the short window", got)
+	}
+
+	// Plenty of good traffic clears the short window, so everything
+	// resolves even though the long window still remembers.
+	serve(100, 200)
+	e.Evaluate(t0.Add(4 * time.Minute))
+	if got := alerting(e); len(got) != 0 {
+		t.Errorf("alerts after recovery = %q; want none", got)
+	}
+}
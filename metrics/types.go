@@ -0,0 +1,197 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// A CounterVec is a family of counters partitioned by labels.
+type CounterVec struct {
+	desc   string
+	labels []string
+
+	mu   sync.Mutex
+	vals map[labelSet]float64
+}
+
+// NewCounterVec registers a CounterVec in r.
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{desc: help, labels: labels, vals: make(map[labelSet]float64)}
+	r.register(name, c)
+	return c
+}
+
+// NewCounterVec registers a CounterVec in Default.
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return Default.NewCounterVec(name, help, labels...)
+}
+
+// Add adds v to the counter with the given label values.
+func (c *CounterVec) Add(v float64, labelValues ...string) {
+	ls := makeLabelSet(c.labels, labelValues)
+	c.mu.Lock()
+	c.vals[ls] += v
+	c.mu.Unlock()
+}
+
+// Inc adds one to the counter with the given label values.
+func (c *CounterVec) Inc(labelValues ...string) { c.Add(1, labelValues...) }
+
+// Value returns the counter with the given label values.
+func (c *CounterVec) Value(labelValues ...string) float64 {
+	ls := makeLabelSet(c.labels, labelValues)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.vals[ls]
+}
+
+// Len returns how many label combinations the CounterVec has seen.
+func (c *CounterVec) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.vals)
+}
+
+// sumWhere returns the sum of the counters whose label values match,
+// and the sum of all of them.
+func (c *CounterVec) sumWhere(match func(labelValues []string) bool) (matched, total float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for ls, v := range c.vals {
+		if match(strings.Split(string(ls), "\xff")) {
+			matched += v
+		}
+		total += v
+	}
+	return
+}
+
+func (c *CounterVec) kind() string { return "counter" }
+func (c *CounterVec) help() string { return c.desc }
+
+func (c *CounterVec) write(w io.Writer, name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, ls := range sortedKeys(c.vals) {
+		fmt.Fprintf(w, "%s%s %s\n", name, ls.format(c.labels), formatFloat(c.vals[ls]))
+	}
+}
+
+// A GaugeFunc is a gauge whose value is computed at scrape time.
+type GaugeFunc struct {
+	desc string
+	fn   func() float64
+}
+
+// NewGaugeFunc registers a gauge in r reporting fn's value.
+func (r *Registry) NewGaugeFunc(name, help string, fn func() float64) {
+	r.register(name, &GaugeFunc{desc: help, fn: fn})
+}
+
+// NewGaugeFunc registers a gauge in Default reporting fn's value.
+func NewGaugeFunc(name, help string, fn func() float64) { Default.NewGaugeFunc(name, help, fn) }
+
+func (g *GaugeFunc) kind() string { return "gauge" }
+func (g *GaugeFunc) help() string { return g.desc }
+
+func (g *GaugeFunc) write(w io.Writer, name string) {
+	fmt.Fprintf(w, "%s %s\n", name, formatFloat(g.fn()))
+}
+
+// DefBuckets are the default histogram buckets, in seconds, suited
+// to request latencies.
+var DefBuckets = []float64{.0001, .0005, .001, .005, .01, .05, .1, .5, 1, 5}
+
+// A HistogramVec is a family of histograms partitioned by labels.
+type HistogramVec struct {
+	desc    string
+	labels  []string
+	buckets []float64 // upper bounds, ascending
+
+	mu   sync.Mutex
+	vals map[labelSet]*histogram
+}
+
+type histogram struct {
+	counts []uint64 // per bucket, not cumulative; last is +Inf
+	sum    float64
+	count  uint64
+}
+
+// NewHistogramVec registers a HistogramVec in r. If buckets is nil,
+// DefBuckets are used.
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if buckets == nil {
+		buckets = DefBuckets
+	}
+	if !sort.Float64sAreSorted(buckets) {
+		panic("metrics: histogram buckets not sorted")
+	}
+	h := &HistogramVec{desc: help, labels: labels, buckets: buckets, vals: make(map[labelSet]*histogram)}
+	r.register(name, h)
+	return h
+}
+
+// NewHistogramVec registers a HistogramVec in Default.
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	return Default.NewHistogramVec(name, help, buckets, labels...)
+}
+
+// Observe records v in the histogram with the given label values.
+func (h *HistogramVec) Observe(v float64, labelValues ...string) {
+	ls := makeLabelSet(h.labels, labelValues)
+	i := sort.SearchFloat64s(h.buckets, v)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	hg := h.vals[ls]
+	if hg == nil {
+		hg = &histogram{counts: make([]uint64, len(h.buckets)+1)}
+		h.vals[ls] = hg
+	}
+	hg.counts[i]++
+	hg.sum += v
+	hg.count++
+}
+
+// countAtMost returns how many observations, across all label values,
+// were at most the largest bucket bound not above v, and how many
+// there were in all.
+func (h *HistogramVec) countAtMost(v float64) (n, total uint64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, hg := range h.vals {
+		for i, bound := range h.buckets {
+			if bound > v {
+				break
+			}
+			n += hg.counts[i]
+		}
+		total += hg.count
+	}
+	return
+}
+
+func (h *HistogramVec) kind() string { return "histogram" }
+func (h *HistogramVec) help() string { return h.desc }
+
+func (h *HistogramVec) write(w io.Writer, name string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, ls := range sortedKeys(h.vals) {
+		hg := h.vals[ls]
+		var cum uint64
+		for i, n := range hg.counts {
+			cum += n
+			le := "+Inf"
+			if i < len(h.buckets) {
+				le = formatFloat(h.buckets[i])
+			}
+			fmt.Fprintf(w, "%s_bucket%s %d\n", name, ls.format(h.labels, "le", le), cum)
+		}
+		fmt.Fprintf(w, "%s_sum%s %s\n", name, ls.format(h.labels), formatFloat(hg.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", name, ls.format(h.labels), hg.count)
+	}
+}
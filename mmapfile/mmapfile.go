@@ -0,0 +1,63 @@
+// Package mmapfile reads files by mapping them into memory, so reading
+// one copies straight out of the page cache, with no read system call
+// per buffer.
+//
+// That doesn't make serving one cheaper. http.ServeContent copies a
+// ReaderAt's contents with io.CopyN, through a buffer and a write per
+// buffer, since only an *os.File gets sendfile, which skips copying
+// through user space at all. On Linux, an unmapped file is served with
+// fewer copies; stepn's BenchmarkBlob compares the two.
+//
+// Mapping is only supported on Unix. Elsewhere Open fails with
+// errors.ErrUnsupported, and callers should read the file as usual.
+package mmapfile
+
+import (
+	"errors"
+	"io"
+)
+
+// A ReaderAt reads a memory-mapped file. Its methods are safe to call
+// at once from several goroutines, but not with or after Close.
+//
+// If the file shrinks while it's mapped, reading what was cut off
+// faults; see runtime/debug.SetPanicOnFault.
+type ReaderAt struct {
+	data   []byte // nil for an empty file, which can't be mapped
+	closed bool
+}
+
+// Len returns the length of the mapped file.
+func (r *ReaderAt) Len() int { return len(r.data) }
+
+// ReadAt implements io.ReaderAt.
+func (r *ReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if r.closed {
+		return 0, errors.New("mmapfile: closed")
+	}
+	if off < 0 {
+		return 0, errors.New("mmapfile: negative offset")
+	}
+	if off >= int64(len(r.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, r.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// Close unmaps the file. Slices handed to a Write before it must no
+// longer be in use.
+func (r *ReaderAt) Close() error {
+	if r.closed {
+		return nil
+	}
+	data := r.data
+	r.data, r.closed = nil, true
+	if data == nil {
+		return nil
+	}
+	return unmap(data)
+}
@@ -0,0 +1,20 @@
+//go:build !unix
+
+package mmapfile
+
+import (
+	"errors"
+	"os"
+)
+
+// Open fails: mapping files is only supported on Unix.
+func Open(path string) (*ReaderAt, error) {
+	return nil, errors.ErrUnsupported
+}
+
+// Map fails: mapping files is only supported on Unix.
+func Map(f *os.File) (*ReaderAt, error) {
+	return nil, errors.ErrUnsupported
+}
+
+func unmap(data []byte) error { return nil }
@@ -0,0 +1,60 @@
+package mmapfile
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestReadAt(t *testing.T) {
+	if runtime.GOOS == "windows" || runtime.GOOS == "plan9" {
+		t.Skip("no mmap")
+	}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "f")
+	if err := os.WriteFile(path, []byte("hello, world"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	r, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Len() != 12 {
+		t.Errorf("Len = %d; want 12", r.Len())
+	}
+	got, err := io.ReadAll(io.NewSectionReader(r, 7, 100))
+	if err != nil || string(got) != "world" {
+		t.Errorf("reading from 7 = %q, %v; want world", got, err)
+	}
+	buf := make([]byte, 5)
+	if n, err := r.ReadAt(buf, 10); n != 2 || err != io.EOF {
+		t.Errorf("ReadAt past the end = %d, %v; want 2, EOF", n, err)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.ReadAt(buf, 0); err == nil {
+		t.Error("ReadAt after Close succeeded")
+	}
+	if err := r.Close(); err != nil {
+		t.Errorf("second Close: %v", err)
+	}
+
+	empty := filepath.Join(dir, "empty")
+	os.WriteFile(empty, nil, 0644)
+	r, err = Open(empty)
+	if err != nil {
+		t.Fatalf("Open of an empty file: %v", err)
+	}
+	if n, err := r.ReadAt(buf, 0); n != 0 || err != io.EOF {
+		t.Errorf("ReadAt of an empty file = %d, %v", n, err)
+	}
+	r.Close()
+
+	if _, err := Open(dir); err == nil || errors.Is(err, errors.ErrUnsupported) {
+		t.Errorf("Open of a directory = %v; want an error", err)
+	}
+}
@@ -0,0 +1,45 @@
+//go:build unix
+
+package mmapfile
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// Open maps the file at path into memory, read-only.
+func Open(path string) (*ReaderAt, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close() // the mapping outlives the descriptor
+	return Map(f)
+}
+
+// Map maps f, an open regular file, into memory, read-only. f may be
+// closed afterwards.
+func Map(f *os.File) (*ReaderAt, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if !fi.Mode().IsRegular() {
+		return nil, fmt.Errorf("mmapfile: %s isn't a regular file", f.Name())
+	}
+	size := fi.Size()
+	if size == 0 {
+		return &ReaderAt{}, nil
+	}
+	if int64(int(size)) != size {
+		return nil, fmt.Errorf("mmapfile: %s is too large to map", f.Name())
+	}
+	data, err := syscall.Mmap(int(f.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, &os.PathError{Op: "mmap", Path: f.Name(), Err: err}
+	}
+	return &ReaderAt{data: data}, nil
+}
+
+func unmap(data []byte) error { return syscall.Munmap(data) }
@@ -0,0 +1,122 @@
+// Package negotiate picks a response content type for a request,
+// from its Accept header or an explicit ?format= parameter, and a
+// content coding from its Accept-Encoding header.
+package negotiate
+
+import (
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Type returns the best of offers, given in order of the server's
+// preference, for r.
+//
+// A "format" form value, such as "json", picks the offer with that
+// subtype outright, so links and curl users needn't set headers.
+// Otherwise the Accept header's media ranges and q-values decide,
+// with ties going to the earlier offer. If r has no Accept header, or
+// accepts none of the offers, Type returns offers[0].
+func Type(r *http.Request, offers ...string) string {
+	if f := r.FormValue("format"); f != "" {
+		for _, o := range offers {
+			if _, sub, _ := strings.Cut(o, "/"); strings.EqualFold(sub, f) {
+				return o
+			}
+		}
+	}
+	best, bestQ := offers[0], 0.0
+	for _, o := range offers {
+		if q := quality(r.Header.Values("Accept"), o); q > bestQ {
+			best, bestQ = o, q
+		}
+	}
+	return best
+}
+
+// quality returns how much the Accept header values accept typ: the
+// q-value of the most specific range matching it, or 0.
+func quality(accept []string, typ string) float64 {
+	q, specificity := 0.0, -1
+	for _, v := range accept {
+		for _, rng := range strings.Split(v, ",") {
+			mt, params, err := mime.ParseMediaType(strings.TrimSpace(rng))
+			if err != nil {
+				continue
+			}
+			s := matches(mt, typ)
+			if s <= specificity {
+				continue
+			}
+			rq := 1.0
+			if qs, ok := params["q"]; ok {
+				if rq, err = strconv.ParseFloat(qs, 64); err != nil {
+					continue
+				}
+			}
+			q, specificity = rq, s
+		}
+	}
+	return q
+}
+
+// matches reports how specifically media range rng matches typ:
+// 2 for an exact match, 1 for type/*, 0 for */*, and -1 for none.
+func matches(rng, typ string) int {
+	switch {
+	case rng == typ:
+		return 2
+	case rng == "*/*":
+		return 0
+	case strings.HasSuffix(rng, "/*") && strings.HasPrefix(typ, rng[:len(rng)-1]):
+		return 1
+	}
+	return -1
+}
+
+// Encoding returns the best of offers, content codings such as "gzip"
+// given in order of the server's preference, that r's Accept-Encoding
+// header accepts, with ties going to the earlier offer. It returns ""
+// if r accepts none of them, or has no Accept-Encoding, and the
+// response should be sent as is.
+func Encoding(r *http.Request, offers ...string) string {
+	best, bestQ := "", 0.0
+	for _, o := range offers {
+		if q := encodingQuality(r.Header.Values("Accept-Encoding"), o); q > bestQ {
+			best, bestQ = o, q
+		}
+	}
+	return best
+}
+
+// encodingQuality returns how much the Accept-Encoding header values
+// accept coding: the q-value of its own entry if it has one, else of
+// "*", else 0.
+func encodingQuality(acceptEncoding []string, coding string) float64 {
+	q, specificity := 0.0, -1
+	for _, v := range acceptEncoding {
+		for _, e := range strings.Split(v, ",") {
+			name, params, _ := strings.Cut(e, ";")
+			s := -1
+			switch name = strings.TrimSpace(name); {
+			case strings.EqualFold(name, coding):
+				s = 1
+			case name == "*":
+				s = 0
+			}
+			if s <= specificity {
+				continue
+			}
+			eq := 1.0
+			if k, qs, ok := strings.Cut(strings.TrimSpace(params), "="); ok && strings.TrimSpace(k) == "q" {
+				var err error
+				if eq, err = strconv.ParseFloat(strings.TrimSpace(qs), 64); err != nil {
+					continue
+				}
+			}
+			q, specificity = eq, s
+		}
+	}
+	return q
+}
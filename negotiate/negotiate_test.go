@@ -0,0 +1,68 @@
+package negotiate
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestType(t *testing.T) {
+	tests := []struct {
+		url, accept string
+		want        string
+	}{
+		{"/", "", "text/html"},
+		{"/", "application/json", "application/json"},
+		{"/", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", "text/html"},
+		{"/", "application/json, text/html;q=0.5", "application/json"},
+		{"/", "text/html;q=0.5, application/json", "application/json"},
+		{"/", "text/*, application/json", "text/html"},
+		{"/", "*/*", "text/html"},
+		{"/", "application/*;q=0.9, text/html;q=0.1", "application/json"},
+		{"/", "image/png", "text/html"},
+		{"/", "application/json;q=0, */*", "text/html"},
+		{"/", "garbage;;;, application/json", "application/json"},
+		{"/?format=json", "", "application/json"},
+		{"/?format=json", "text/html", "application/json"},
+		{"/?format=html", "application/json", "text/html"},
+		{"/?format=yaml", "application/json", "application/json"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", tt.url, nil)
+		if tt.accept != "" {
+			r.Header.Set("Accept", tt.accept)
+		}
+		if got := Type(r, "text/html", "application/json"); got != tt.want {
+			t.Errorf("Type(%s, Accept: %q) = %q; want %q", tt.url, tt.accept, got, tt.want)
+		}
+	}
+}
+
+func TestEncoding(t *testing.T) {
+	tests := []struct {
+		acceptEncoding string
+		want           string
+	}{
+		{"", ""},
+		{"gzip", "gzip"},
+		{"gzip, deflate, br", "gzip"},
+		{"br;q=1.0, gzip;q=0.8", "gzip"},
+		{"deflate", ""},
+		{"GZIP", "gzip"},
+		{"*", "gzip"},
+		{"gzip;q=0", ""},
+		{"gzip;q=0, *", ""},
+		{"*;q=0", ""},
+		{"*;q=0, gzip", "gzip"},
+		{"gzip;q=bogus", ""},
+		{"identity", ""},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		if tt.acceptEncoding != "" {
+			r.Header.Set("Accept-Encoding", tt.acceptEncoding)
+		}
+		if got := Encoding(r, "gzip"); got != tt.want {
+			t.Errorf("Encoding(Accept-Encoding: %q) = %q; want %q", tt.acceptEncoding, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+// Package notifier announces messages to people, such as "visitor
+// #10000!" in the talk's chat channel.
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/ratelimit"
+)
+
+// A Notifier delivers a message.
+type Notifier interface {
+	Notify(ctx context.Context, msg string) error
+}
+
+// Chat posts messages to a chat service's incoming webhook, in the
+// {"text": ...} form Slack and its look-alikes accept.
+type Chat struct {
+	URL    string
+	Client *http.Client // default: one with a 10s timeout
+}
+
+var defaultClient = &http.Client{Timeout: 10 * time.Second}
+
+func (c *Chat) Notify(ctx context.Context, msg string) error {
+	body, _ := json.Marshal(struct {
+		Text string `json:"text"`
+	}{msg})
+	req, err := http.NewRequestWithContext(ctx, "POST", c.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := c.Client
+	if client == nil {
+		client = defaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, res.Body)
+	res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		return errors.New("chat webhook: " + res.Status)
+	}
+	return nil
+}
+
+// ErrDropped is returned by Async.Notify for a message it won't send.
+var ErrDropped = errors.New("notifier: message dropped")
+
+// Async wraps a Notifier so that Notify never waits on it: messages
+// are queued and sent one at a time by Run. Messages beyond the rate
+// limit, or arriving when the queue is full, are dropped; a chat
+// channel flooded during a load test helps no one.
+type Async struct {
+	n       Notifier
+	limiter *ratelimit.Limiter
+	queue   chan string
+}
+
+// NewAsync returns an Async sending through n at most rate messages
+// per second, in bursts of up to burst, with room to queue queueSize.
+func NewAsync(n Notifier, rate float64, burst, queueSize int) *Async {
+	return &Async{
+		n:       n,
+		limiter: &ratelimit.Limiter{Rate: rate, Burst: burst},
+		queue:   make(chan string, queueSize),
+	}
+}
+
+// Notify queues msg, or drops it and returns ErrDropped. It ignores
+// ctx, since it doesn't wait.
+func (a *Async) Notify(ctx context.Context, msg string) error {
+	if ok, _ := a.limiter.Allow(""); !ok {
+		return ErrDropped
+	}
+	select {
+	case a.queue <- msg:
+		return nil
+	default:
+		return ErrDropped
+	}
+}
+
+// Run sends queued messages until stop is closed. Each send gets
+// 30 seconds.
+func (a *Async) Run(stop <-chan struct{}) {
+	for {
+		select {
+		case msg := <-a.queue:
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			if err := a.n.Notify(ctx, msg); err != nil {
+				log.Printf("ERROR: notifying %q: %v", msg, err)
+			}
+			cancel()
+		case <-stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestChat(t *testing.T) {
+	got := make(chan string, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct{ Text string }
+		json.NewDecoder(r.Body).Decode(&body)
+		got <- body.Text
+	}))
+	defer ts.Close()
+	if err := (&Chat{URL: ts.URL}).Notify(context.Background(), "visitor #10000!"); err != nil {
+		t.Fatal(err)
+	}
+	if msg := <-got; msg != "visitor #10000!" {
+		t.Errorf("posted %q", msg)
+	}
+
+	ts.Config.Handler = http.NotFoundHandler()
+	if err := (&Chat{URL: ts.URL}).Notify(context.Background(), "x"); err == nil {
+		t.Error("no error for a 404")
+	}
+}
+
+// blockingNotifier never returns until released.
+type blockingNotifier struct {
+	got     chan string
+	release chan struct{}
+}
+
+func (b blockingNotifier) Notify(ctx context.Context, msg string) error {
+	b.got <- msg
+	<-b.release
+	return nil
+}
+
+func TestAsyncNeverBlocks(t *testing.T) {
+	bn := blockingNotifier{make(chan string, 10), make(chan struct{})}
+	a := NewAsync(bn, 1000, 5, 2)
+	stop := make(chan struct{})
+	defer close(stop)
+	defer close(bn.release)
+	go a.Run(stop)
+
+	done := make(chan []error)
+	go func() {
+		var errs []error
+		for i := 0; i < 8; i++ {
+			errs = append(errs, a.Notify(context.Background(), "m"))
+			if i == 0 {
+				<-bn.got // the first is being sent, and stuck
+			}
+		}
+		done <- errs
+	}()
+	select {
+	case errs := <-done:
+		// One in flight and two queued; the rest find the queue
+		// full.
+		var sent int
+		for _, err := range errs {
+			if err == nil {
+				sent++
+			} else if err != ErrDropped {
+				t.Errorf("Notify: %v", err)
+			}
+		}
+		if sent != 3 {
+			t.Errorf("%d of 8 accepted with a stuck notifier; want 3", sent)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Notify blocked behind a stuck notifier")
+	}
+}
+
+func TestAsyncRateLimit(t *testing.T) {
+	bn := blockingNotifier{make(chan string, 10), make(chan struct{})}
+	close(bn.release)
+	a := NewAsync(bn, 1.0/3600, 2, 10)
+	var accepted int
+	for i := 0; i < 5; i++ {
+		if a.Notify(context.Background(), "m") == nil {
+			accepted++
+		}
+	}
+	if accepted != 2 {
+		t.Errorf("accepted %d of 5 at one an hour with burst 2; want 2", accepted)
+	}
+}
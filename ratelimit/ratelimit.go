@@ -0,0 +1,156 @@
+// Package ratelimit limits each client IP address to a steady request
+// rate with a token bucket, so one noisy client in the audience can't
+// starve everyone else.
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/errcode"
+)
+
+// A Limiter gives each client IP a bucket holding up to Burst tokens,
+// refilled at Rate tokens per second. Each request takes a token; a
+// request finding the bucket empty gets a 429.
+//
+// Buckets idle long enough to have refilled are full again anyway, so
+// Run evicts them to keep memory bounded by the number of recent
+// clients. That's after IdleTimeout, or the time an empty bucket takes
+// to fill if that's longer: evicting a bucket sooner would hand a
+// client that drained it and paused a full one.
+type Limiter struct {
+	Rate        float64       // tokens per second
+	Burst       int           // bucket size; at least 1
+	IdleTimeout time.Duration // default 1m
+
+	now func() time.Time // or time.Now, for tests
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time // when tokens was computed
+}
+
+func (l *Limiter) time() time.Time {
+	if l.now != nil {
+		return l.now()
+	}
+	return time.Now()
+}
+
+func (l *Limiter) idleTimeout() time.Duration {
+	if l.IdleTimeout == 0 {
+		return time.Minute
+	}
+	return l.IdleTimeout
+}
+
+// Allow takes a token from key's bucket. If there's none, it reports
+// how long until there will be.
+func (l *Limiter) Allow(key string) (ok bool, retryAfter time.Duration) {
+	now := l.time()
+	burst := float64(l.Burst)
+	if burst < 1 {
+		burst = 1
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.buckets == nil {
+		l.buckets = make(map[string]*bucket)
+	}
+	b := l.buckets[key]
+	if b == nil {
+		b = &bucket{tokens: burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*l.Rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	if l.Rate <= 0 {
+		return false, time.Duration(math.MaxInt64)
+	}
+	return false, time.Duration((1 - b.tokens) / l.Rate * float64(time.Second))
+}
+
+// Len returns the number of buckets held.
+func (l *Limiter) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.buckets)
+}
+
+// evictAfter returns how long a bucket must be idle before Evict
+// drops it: IdleTimeout, or the time an empty bucket takes to refill,
+// whichever is longer. With no refill, buckets are never dropped.
+func (l *Limiter) evictAfter() time.Duration {
+	if l.Rate <= 0 {
+		return time.Duration(math.MaxInt64)
+	}
+	refill := time.Duration(float64(max(l.Burst, 1)) / l.Rate * float64(time.Second))
+	return max(l.idleTimeout(), refill)
+}
+
+// Evict drops the buckets that have been idle long enough, as of now,
+// to have refilled.
+func (l *Limiter) Evict(now time.Time) {
+	after := l.evictAfter()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for k, b := range l.buckets {
+		if now.Sub(b.last) >= after {
+			delete(l.buckets, k)
+		}
+	}
+}
+
+// Run calls Evict every interval until stop is closed.
+func (l *Limiter) Run(every time.Duration, stop <-chan struct{}) {
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for {
+		select {
+		case now := <-t.C:
+			l.Evict(now)
+		case <-stop:
+			return
+		}
+	}
+}
+
+// Wrap returns a handler that serves each request with h if its
+// client IP has a token, and otherwise replies 429 with a Retry-After
+// header.
+func (l *Limiter) Wrap(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ok, wait := l.Allow(clientIP(r))
+		if !ok {
+			secs := int64(math.Ceil(wait.Seconds()))
+			w.Header().Set("Retry-After", strconv.FormatInt(secs, 10))
+			errcode.Write(w, fmt.Errorf("%w; retry after %ds", errcode.ErrRateLimited, secs))
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// clientIP returns the IP address r came from. It deliberately ignores
+// X-Forwarded-For, which any client can set.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
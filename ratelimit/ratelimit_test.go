@@ -0,0 +1,158 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/internal/benchtest"
+)
+
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time          { return c.t }
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func TestAllow(t *testing.T) {
+	clock := &fakeClock{time.Unix(1e9, 0)}
+	l := &Limiter{Rate: 2, Burst: 3, now: clock.now}
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := l.Allow("a"); !ok {
+			t.Fatalf("request %d within burst refused", i)
+		}
+	}
+	ok, wait := l.Allow("a")
+	if ok {
+		t.Fatal("request past burst allowed")
+	}
+	if wait != 500*time.Millisecond {
+		t.Errorf("retry after %v; want 500ms at 2/s", wait)
+	}
+	if ok, _ := l.Allow("b"); !ok {
+		t.Error("another client was refused")
+	}
+
+	clock.advance(500 * time.Millisecond)
+	if ok, _ := l.Allow("a"); !ok {
+		t.Error("refused after refill")
+	}
+	if ok, _ := l.Allow("a"); ok {
+		t.Error("allowed a second request after refilling one token")
+	}
+
+	// A long idle time refills no more than Burst.
+	clock.advance(time.Hour)
+	for i := 0; i < 4; i++ {
+		ok, _ := l.Allow("a")
+		if want := i < 3; ok != want {
+			t.Errorf("after idling, request %d allowed = %v; want %v", i, ok, want)
+		}
+	}
+}
+
+func TestEvict(t *testing.T) {
+	clock := &fakeClock{time.Unix(1e9, 0)}
+	l := &Limiter{Rate: 1, Burst: 1, IdleTimeout: time.Minute, now: clock.now}
+	l.Allow("old")
+	clock.advance(30 * time.Second)
+	l.Allow("new")
+	clock.advance(30 * time.Second)
+	l.Evict(clock.t)
+	if n := l.Len(); n != 1 {
+		t.Fatalf("%d buckets after eviction; want 1", n)
+	}
+	if ok, _ := l.Allow("new"); !ok {
+		t.Error("surviving bucket lost its refill")
+	}
+}
+
+func TestEvictWaitsForRefill(t *testing.T) {
+	clock := &fakeClock{time.Unix(1e9, 0)}
+	l := &Limiter{Rate: 0.01, Burst: 5, IdleTimeout: time.Minute, now: clock.now}
+	for i := 0; i < 5; i++ {
+		l.Allow("a")
+	}
+	clock.advance(2 * time.Minute) // past IdleTimeout, but 1.2 tokens back
+	l.Evict(clock.t)
+	if n := l.Len(); n != 1 {
+		t.Fatalf("%d buckets after eviction; want the drained bucket kept", n)
+	}
+	l.Allow("a")
+	if ok, _ := l.Allow("a"); ok {
+		t.Error("allowed a third request two minutes after draining; the bucket came back full")
+	}
+	clock.advance(500 * time.Second) // an empty bucket's full refill
+	l.Evict(clock.t)
+	if n := l.Len(); n != 0 {
+		t.Errorf("%d buckets after a full refill's idle time; want 0", n)
+	}
+}
+
+func TestWrap(t *testing.T) {
+	l := &Limiter{Rate: 0.5, Burst: 1}
+	h := l.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+
+	rw := httptest.NewRecorder()
+	h.ServeHTTP(rw, req)
+	if rw.Code != 200 {
+		t.Fatalf("first request: %d", rw.Code)
+	}
+	req.RemoteAddr = "192.0.2.1:5678" // same client, new connection
+	rw = httptest.NewRecorder()
+	h.ServeHTTP(rw, req)
+	if rw.Code != http.StatusTooManyRequests {
+		t.Fatalf("second request: %d; want 429", rw.Code)
+	}
+	if ra, _ := strconv.Atoi(rw.Header().Get("Retry-After")); ra < 1 || ra > 2 {
+		t.Errorf("Retry-After = %q; want 1 or 2", rw.Header().Get("Retry-After"))
+	}
+}
+
+// The benchmarks show the limiter's cost on the hot path: one
+// client, many clients in parallel (mostly lock contention), and the
+// whole middleware against the bare handler.
+
+func BenchmarkAllow(b *testing.B) {
+	l := &Limiter{Rate: 1e12, Burst: 1}
+	for benchtest.Loop(b) {
+		l.Allow("192.0.2.1")
+	}
+}
+
+func BenchmarkAllowParallel(b *testing.B) {
+	l := &Limiter{Rate: 1e12, Burst: 1}
+	keys := make([]string, 1000)
+	for i := range keys {
+		keys[i] = "192.0.2." + strconv.Itoa(i)
+	}
+	b.RunParallel(func(pb *testing.PB) {
+		for i := 0; pb.Next(); i++ {
+			l.Allow(keys[i%len(keys)])
+		}
+	})
+}
+
+func benchHandler(b *testing.B, h http.Handler) {
+	b.ReportAllocs()
+	f := benchtest.NewFixture(b, "GET / HTTP/1.1\r\nHost: x\r\n\r\n")
+	f.Req.RemoteAddr = "192.0.2.1:1234"
+	for benchtest.Loop(b) {
+		f.Reset()
+		h.ServeHTTP(f.Rec, f.Req)
+	}
+}
+
+var hello = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("hello"))
+})
+
+func BenchmarkHandlerBare(b *testing.B) { benchHandler(b, hello) }
+
+func BenchmarkHandlerLimited(b *testing.B) {
+	benchHandler(b, (&Limiter{Rate: 1e12, Burst: 1}).Wrap(hello))
+}
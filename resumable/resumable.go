@@ -0,0 +1,180 @@
+// Package resumable keeps the sessions of uploads sent in chunks, so
+// a client on a flaky connection can pick up where it left off
+// instead of starting over.
+//
+// A session holds the upload's running hash state rather than its
+// bytes: each chunk is hashed as it arrives and thrown away. Sessions
+// not touched for a while expire, like a rate limiter's idle buckets.
+package resumable
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/errcode"
+	"github.com/bradfitz/talk-yapc-asia-2015/merkle"
+)
+
+// A Session is an upload in progress.
+type Session struct {
+	ID     string
+	Alg    string  // the hash's name
+	Offset int64   // bytes received so far
+	Total  int64   // the whole upload's size, or -1 until a chunk says
+	State  []byte  // the hash's state after Offset bytes, as MarshalBinary gives it
+	Chunks []Chunk // the chunks received, in order
+
+	// Tree holds the Chunks' leaves, so their Merkle root needn't be
+	// recomputed from all of them after each chunk.
+	Tree merkle.Range
+}
+
+// A Chunk is one chunk of a session's upload.
+type Chunk struct {
+	Offset, Size int64
+	Leaf         []byte // its merkle.Leaf hash
+}
+
+// A Store holds sessions in memory. Run evicts the ones idle for TTL.
+type Store struct {
+	TTL time.Duration // default 1h
+	Max int           // most sessions held at once; 0 means no limit
+
+	now func() time.Time // or time.Now, for tests
+
+	mu       sync.Mutex
+	sessions map[string]*entry
+}
+
+type entry struct {
+	s    Session
+	last time.Time // when it was created or last released
+	busy bool      // claimed by a chunk being received
+}
+
+func (st *Store) time() time.Time {
+	if st.now != nil {
+		return st.now()
+	}
+	return time.Now()
+}
+
+func (st *Store) ttl() time.Duration {
+	if st.TTL == 0 {
+		return time.Hour
+	}
+	return st.TTL
+}
+
+// Create starts a session for an upload hashed with alg, whose hash
+// starts in state, and returns it with a new random ID. With Max
+// sessions already held, it's an ErrOverloaded instead: each holds
+// memory until it's done or expires.
+func (st *Store) Create(alg string, state []byte) (Session, error) {
+	var id [16]byte
+	rand.Read(id[:])
+	s := Session{ID: hex.EncodeToString(id[:]), Alg: alg, Total: -1, State: state}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.Max > 0 && len(st.sessions) >= st.Max {
+		return Session{}, fmt.Errorf("%w: %d resumable uploads are already in progress", errcode.ErrOverloaded, len(st.sessions))
+	}
+	if st.sessions == nil {
+		st.sessions = make(map[string]*entry)
+	}
+	st.sessions[s.ID] = &entry{s: s, last: st.time()}
+	return s, nil
+}
+
+// Restore adds s as it is, ID and all, replacing any session with its
+// ID, as when starting from a fixture. Its idle time starts now.
+func (st *Store) Restore(s Session) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.sessions == nil {
+		st.sessions = make(map[string]*entry)
+	}
+	st.sessions[s.ID] = &entry{s: s, last: st.time()}
+}
+
+// Get returns session id as it was last released.
+func (st *Store) Get(id string) (s Session, ok bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	e, ok := st.sessions[id]
+	if !ok {
+		return Session{}, false
+	}
+	return e.s, true
+}
+
+// Claim returns session id for the caller to add a chunk to, and
+// holds it until Release or Delete, so two chunks can't be added to
+// the same state at once. A session that doesn't exist is an
+// ErrUploadNotFound, and one already claimed an ErrUploadConflict.
+func (st *Store) Claim(id string) (Session, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	e, ok := st.sessions[id]
+	if !ok {
+		return Session{}, errcode.ErrUploadNotFound
+	}
+	if e.busy {
+		return Session{}, fmt.Errorf("%w: another chunk is being received", errcode.ErrUploadConflict)
+	}
+	e.busy = true
+	return e.s, nil
+}
+
+// Release saves s, claimed with Claim, and lets it be claimed again.
+// Its idle time starts over.
+func (st *Store) Release(s Session) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if e, ok := st.sessions[s.ID]; ok {
+		e.s, e.last, e.busy = s, st.time(), false
+	}
+}
+
+// Delete drops session id, as when its upload is done.
+func (st *Store) Delete(id string) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	delete(st.sessions, id)
+}
+
+// Len returns the number of sessions held.
+func (st *Store) Len() int {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return len(st.sessions)
+}
+
+// Evict drops the sessions that have been idle for TTL as of now. A
+// claimed session is receiving a chunk, so it isn't idle.
+func (st *Store) Evict(now time.Time) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	for id, e := range st.sessions {
+		if !e.busy && now.Sub(e.last) >= st.ttl() {
+			delete(st.sessions, id)
+		}
+	}
+}
+
+// Run calls Evict every interval until stop is closed.
+func (st *Store) Run(every time.Duration, stop <-chan struct{}) {
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for {
+		select {
+		case now := <-t.C:
+			st.Evict(now)
+		case <-stop:
+			return
+		}
+	}
+}
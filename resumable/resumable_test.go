@@ -0,0 +1,103 @@
+package resumable
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/errcode"
+)
+
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time          { return c.t }
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func TestClaim(t *testing.T) {
+	st := new(Store)
+	s, _ := st.Create("sha1", []byte("state0"))
+	if s.Total != -1 || s.Offset != 0 || len(s.ID) != 32 {
+		t.Fatalf("Create = %+v", s)
+	}
+	if other, _ := st.Create("sha1", nil); other.ID == s.ID {
+		t.Fatal("two sessions got the same ID")
+	}
+
+	c, err := st.Claim(s.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.Claim(s.ID); !errors.Is(err, errcode.ErrUploadConflict) {
+		t.Errorf("second Claim = %v; want ErrUploadConflict", err)
+	}
+	c.Offset, c.State = 5, []byte("state5")
+	st.Release(c)
+	if got, _ := st.Get(s.ID); got.Offset != 5 || string(got.State) != "state5" {
+		t.Errorf("after Release, Get = %+v", got)
+	}
+	if _, err := st.Claim(s.ID); err != nil {
+		t.Errorf("Claim after Release: %v", err)
+	}
+
+	st.Delete(s.ID)
+	if _, err := st.Claim(s.ID); !errors.Is(err, errcode.ErrUploadNotFound) {
+		t.Errorf("Claim after Delete = %v; want ErrUploadNotFound", err)
+	}
+	if _, ok := st.Get("nope"); ok {
+		t.Error("Get of an unknown ID succeeded")
+	}
+}
+
+func TestMax(t *testing.T) {
+	st := &Store{Max: 2}
+	a, _ := st.Create("sha1", nil)
+	st.Create("sha1", nil)
+	if _, err := st.Create("sha1", nil); !errors.Is(err, errcode.ErrOverloaded) {
+		t.Fatalf("Create past Max = %v; want ErrOverloaded", err)
+	}
+	st.Delete(a.ID)
+	if _, err := st.Create("sha1", nil); err != nil {
+		t.Errorf("Create after Delete: %v", err)
+	}
+}
+
+func TestEvict(t *testing.T) {
+	clock := &fakeClock{time.Unix(1e9, 0)}
+	st := &Store{TTL: time.Minute, now: clock.now}
+	idle, _ := st.Create("sha1", nil)
+	active, _ := st.Create("sha1", nil)
+	busy, _ := st.Create("sha1", nil)
+	st.Claim(busy.ID)
+
+	clock.advance(50 * time.Second)
+	s, _ := st.Claim(active.ID)
+	st.Release(s)
+
+	clock.advance(20 * time.Second)
+	st.Evict(clock.t)
+	if _, ok := st.Get(idle.ID); ok {
+		t.Error("idle session survived its TTL")
+	}
+	if _, ok := st.Get(active.ID); !ok {
+		t.Error("session used 20s ago evicted")
+	}
+	if _, ok := st.Get(busy.ID); !ok {
+		t.Error("session receiving a chunk evicted")
+	}
+	if n := st.Len(); n != 2 {
+		t.Errorf("Len = %d; want 2", n)
+	}
+}
+
+func TestRestore(t *testing.T) {
+	st := new(Store)
+	want := Session{ID: "fixed", Alg: "sha1", Offset: 3, Total: 9, State: []byte("state3")}
+	st.Restore(want)
+	c, err := st.Claim("fixed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Offset != 3 || c.Total != 9 || string(c.State) != "state3" {
+		t.Errorf("Claim of restored session = %+v; want %+v", c, want)
+	}
+}
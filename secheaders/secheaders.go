@@ -0,0 +1,130 @@
+// Package secheaders sets the response headers that limit what a
+// browser lets an HTML page do, so a page that echoes something it
+// shouldn't can't run scripts, be framed, or leak its URL.
+package secheaders
+
+import (
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Headers are the headers to set on an HTML response. An empty
+// field's header isn't set.
+type Headers struct {
+	CSP            string // Content-Security-Policy
+	FrameOptions   string // X-Frame-Options
+	ReferrerPolicy string // Referrer-Policy
+}
+
+// Strict allows a page only its own origin's scripts, styles, and
+// images, and no framing at all. Inline scripts don't run.
+var Strict = Headers{
+	CSP:            "default-src 'self'; object-src 'none'; base-uri 'none'; frame-ancestors 'none'",
+	FrameOptions:   "DENY",
+	ReferrerPolicy: "no-referrer",
+}
+
+// A Policy says which headers go on which routes' HTML responses.
+type Policy struct {
+	Default Headers
+
+	// Routes overrides Default by request path. A key ending in "/"
+	// matches the whole subtree under it, as with http.ServeMux, and
+	// the longest matching key wins. A route's Headers replace
+	// Default's entirely, so to loosen one header, start from a copy
+	// of Default.
+	Routes map[string]Headers
+}
+
+func (p *Policy) headers(path string) Headers {
+	h, best := p.Default, -1
+	for pat, rh := range p.Routes {
+		if pat == path || strings.HasSuffix(pat, "/") && strings.HasPrefix(path, pat) {
+			if len(pat) > best {
+				h, best = rh, len(pat)
+			}
+		}
+	}
+	return h
+}
+
+// Wrap wraps h to apply p. When a response turns out to be HTML,
+// by its Content-Type or, if h sets none, by sniffing its first write
+// as net/http would, it gets X-Content-Type-Options: nosniff and its
+// route's Headers. A header h sets itself is left alone. Other
+// responses pass through untouched.
+func (p *Policy) Wrap(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(&writer{ResponseWriter: w, p: p, path: r.URL.Path}, r)
+	})
+}
+
+type writer struct {
+	http.ResponseWriter
+	p           *Policy
+	path        string
+	wroteHeader bool
+}
+
+func (w *writer) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		w.setHeaders()
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		hdr := w.Header()
+		if _, ok := hdr["Content-Type"]; !ok && len(p) > 0 {
+			hdr.Set("Content-Type", http.DetectContentType(p))
+		}
+		w.setHeaders()
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *writer) setHeaders() {
+	hdr := w.Header()
+	if !strings.HasPrefix(strings.ToLower(hdr.Get("Content-Type")), "text/html") {
+		return
+	}
+	h := w.p.headers(w.path)
+	for _, kv := range [...][2]string{
+		{"X-Content-Type-Options", "nosniff"},
+		{"Content-Security-Policy", h.CSP},
+		{"X-Frame-Options", h.FrameOptions},
+		{"Referrer-Policy", h.ReferrerPolicy},
+	} {
+		if _, set := hdr[kv[0]]; !set && kv[1] != "" {
+			hdr.Set(kv[0], kv[1])
+		}
+	}
+}
+
+// Flush lets event streams flush through the wrapper.
+func (w *writer) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// ReadFrom lets a body copied in, as http.ServeContent copies a file,
+// reach the underlying writer's ReadFrom, which on Linux is sendfile.
+// A body whose type is yet to be sniffed goes through Write instead.
+func (w *writer) ReadFrom(src io.Reader) (int64, error) {
+	if !w.wroteHeader {
+		if _, ok := w.Header()["Content-Type"]; !ok {
+			return io.Copy(struct{ io.Writer }{w}, src)
+		}
+		w.wroteHeader = true
+		w.setHeaders()
+	}
+	return io.Copy(w.ResponseWriter, src)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *writer) Unwrap() http.ResponseWriter { return w.ResponseWriter }
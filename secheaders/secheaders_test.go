@@ -0,0 +1,79 @@
+package secheaders
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWrap(t *testing.T) {
+	framable := Strict
+	framable.FrameOptions = ""
+	p := &Policy{
+		Default: Strict,
+		Routes: map[string]Headers{
+			"/embed/":      framable,
+			"/embed/raw":   {},
+			"/embed/inner": {CSP: "default-src 'none'"},
+		},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "<html><h1>Welcome!</h1>")
+	})
+	mux.HandleFunc("/typed", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusTeapot)
+	})
+	mux.HandleFunc("/json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, "{}")
+	})
+	mux.HandleFunc("/text", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "plain")
+	})
+	mux.HandleFunc("/own", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Frame-Options", "SAMEORIGIN")
+		io.WriteString(w, "<html>")
+	})
+	h := p.Wrap(mux)
+
+	for _, tt := range []struct {
+		path     string
+		html     bool // nosniff set
+		csp      string
+		frame    string
+		referrer string
+	}{
+		{path: "/", html: true, csp: Strict.CSP, frame: "DENY", referrer: "no-referrer"},
+		{path: "/typed", html: true, csp: Strict.CSP, frame: "DENY", referrer: "no-referrer"},
+		{path: "/json"},
+		{path: "/text"},
+		{path: "/own", html: true, csp: Strict.CSP, frame: "SAMEORIGIN", referrer: "no-referrer"},
+		{path: "/embed/page", html: true, csp: Strict.CSP, referrer: "no-referrer"},
+		{path: "/embed/raw", html: true},
+		{path: "/embed/inner", html: true, csp: "default-src 'none'"},
+		{path: "/embed/inner/x", html: true, csp: Strict.CSP, referrer: "no-referrer"},
+	} {
+		t.Run(tt.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest("GET", tt.path, nil))
+			hdr := rec.Header()
+			wantNosniff := ""
+			if tt.html {
+				wantNosniff = "nosniff"
+			}
+			for _, c := range []struct{ name, want string }{
+				{"X-Content-Type-Options", wantNosniff},
+				{"Content-Security-Policy", tt.csp},
+				{"X-Frame-Options", tt.frame},
+				{"Referrer-Policy", tt.referrer},
+			} {
+				if got := hdr.Get(c.name); got != c.want {
+					t.Errorf("%s = %q; want %q", c.name, got, c.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package signedcookie
+
+import (
+	"strings"
+	"testing"
+)
+
+var codec = Codec{Key: []byte("0123456789abcdef0123456789abcdef")}
+
+func TestRoundTrip(t *testing.T) {
+	for _, v := range []string{"", "7", "hello, world", "a.b.c", "\x00\xff"} {
+		got, err := codec.Decode("visits", codec.Encode("visits", v))
+		if err != nil || got != v {
+			t.Errorf("round trip of %q = %q, %v", v, got, err)
+		}
+	}
+}
+
+func TestTampered(t *testing.T) {
+	good := codec.Encode("visits", "7")
+	v64, mac64, _ := strings.Cut(good, ".")
+	forged := codec.Encode("visits", "700")
+	forged64, _, _ := strings.Cut(forged, ".")
+
+	tests := map[string]string{
+		"changed value":       forged64 + "." + mac64,
+		"flipped mac byte":    v64 + "." + string(mac64[0]^1) + mac64[1:],
+		"truncated mac":       v64 + "." + mac64[:10],
+		"no mac":              v64,
+		"empty":               "",
+		"bad base64":          "!!!." + mac64,
+		"other key":           Codec{Key: []byte("some other key, also 32 bytes...")}.Encode("visits", "7"),
+		"other cookie's name": codec.Encode("admin", "7"),
+	}
+	for name, s := range tests {
+		if v, err := codec.Decode("visits", s); err != ErrInvalid {
+			t.Errorf("%s: Decode = %q, %v; want ErrInvalid", name, v, err)
+		}
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/internal/benchtest"
 )
 
 func TestHandleRoot(t *testing.T) {
@@ -20,12 +22,9 @@ func TestHandleRoot(t *testing.T) {
 }
 
 func BenchmarkRoot(b *testing.B) {
-	req, err := http.ReadRequest(bufio.NewReader(strings.NewReader("GET / HTTP/1.0\r\n\r\n")))
-	if err != nil {
-		b.Fatal(err)
-	}
-	for i := 0; i < b.N; i++ {
-		rw := httptest.NewRecorder()
-		handleRoot(rw, req)
+	f := benchtest.NewFixture(b, "GET / HTTP/1.0\r\n\r\n")
+	for benchtest.Loop(b) {
+		f.Reset()
+		handleRoot(f.Rec, f.Req)
 	}
 }
@@ -0,0 +1,17 @@
+//go:build amd64 && !nohexasm
+
+package main
+
+// hexBlock writes the hex encoding of src's 16 bytes to dst.
+// It's implemented in hex_amd64.s.
+//
+//go:noescape
+func hexBlock(dst *byte, src *byte)
+
+func encodeHex(dst *[40]byte, src *[20]byte) {
+	hexBlock(&dst[0], &src[0])
+	for i, v := range src[16:] {
+		dst[32+i*2] = hexDigits[v>>4]
+		dst[32+i*2+1] = hexDigits[v&0x0f]
+	}
+}
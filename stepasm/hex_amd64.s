@@ -0,0 +1,61 @@
+//go:build amd64 && !nohexasm
+
+#include "textflag.h"
+
+// Each nibble n becomes '0'+n, plus 'a'-'0'-10 = 39 more if n > 9.
+// SSE2 only, which every amd64 CPU has.
+
+DATA nibbleMask<>+0(SB)/8, $0x0f0f0f0f0f0f0f0f
+DATA nibbleMask<>+8(SB)/8, $0x0f0f0f0f0f0f0f0f
+GLOBL nibbleMask<>(SB), RODATA|NOPTR, $16
+
+DATA nines<>+0(SB)/8, $0x0909090909090909
+DATA nines<>+8(SB)/8, $0x0909090909090909
+GLOBL nines<>(SB), RODATA|NOPTR, $16
+
+DATA letterGap<>+0(SB)/8, $0x2727272727272727
+DATA letterGap<>+8(SB)/8, $0x2727272727272727
+GLOBL letterGap<>(SB), RODATA|NOPTR, $16
+
+DATA zeros<>+0(SB)/8, $0x3030303030303030
+DATA zeros<>+8(SB)/8, $0x3030303030303030
+GLOBL zeros<>(SB), RODATA|NOPTR, $16
+
+// func hexBlock(dst *byte, src *byte)
+TEXT ·hexBlock(SB), NOSPLIT, $0-16
+	MOVQ dst+0(FP), DI
+	MOVQ src+8(FP), SI
+	MOVOU (SI), X0
+	MOVOU nibbleMask<>(SB), X7
+
+	// X1 = high nibbles, X0 = low nibbles.
+	MOVOU X0, X1
+	PSRLW $4, X1
+	PAND  X7, X1
+	PAND  X7, X0
+
+	// Interleave them, high first: X2 is bytes 0-7, X3 bytes 8-15.
+	MOVOU     X1, X2
+	PUNPCKLBW X0, X2
+	MOVOU     X1, X3
+	PUNPCKHBW X0, X3
+
+	MOVOU nines<>(SB), X5
+	MOVOU letterGap<>(SB), X6
+	MOVOU zeros<>(SB), X7
+
+	MOVOU   X2, X4
+	PCMPGTB X5, X4
+	PAND    X6, X4
+	PADDB   X7, X2
+	PADDB   X4, X2
+
+	MOVOU   X3, X4
+	PCMPGTB X5, X4
+	PAND    X6, X4
+	PADDB   X7, X3
+	PADDB   X4, X3
+
+	MOVOU X2, (DI)
+	MOVOU X3, 16(DI)
+	RET
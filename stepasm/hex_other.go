@@ -0,0 +1,5 @@
+//go:build !amd64 || nohexasm
+
+package main
+
+func encodeHex(dst *[40]byte, src *[20]byte) { encodeHexGo(dst, src) }
@@ -0,0 +1,69 @@
+// Command stepasm asks whether it's worth dropping into assembly for
+// a hot function: the hex encoding of the upload digest in stepn's
+// response. encodeHex is plain Go everywhere except amd64, where an
+// SSE2 version handles 16 bytes at a time. Build with -tags=nohexasm
+// to use the Go version there too, and compare with
+//
+//	go test -bench=.
+//	go test -tags=nohexasm -bench=.
+//
+// (Not the conventional purego tag: the standard library honors that
+// too, and crypto/sha1 without its assembly makes BenchmarkPut three
+// times slower, swamping anything hex encoding does.)
+//
+// The assembly wins the micro-benchmark by a few times. It makes no
+// measurable difference to BenchmarkPut, which spends microseconds
+// hashing the body for every few nanoseconds of hex. That's the usual
+// story: assembly pays off inside loops over bulk data, as in
+// crypto/sha1 itself, not for 20 bytes per request. And it costs a
+// second implementation to test, per architecture, that the compiler
+// can no longer check, inline, or improve.
+package main
+
+import (
+	"crypto/sha1"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+const hexDigits = "0123456789abcdef"
+
+// encodeHexGo is the portable hex encoder.
+func encodeHexGo(dst *[40]byte, src *[20]byte) {
+	for i, v := range src {
+		dst[i*2] = hexDigits[v>>4]
+		dst[i*2+1] = hexDigits[v&0x0f]
+	}
+}
+
+func handlePost(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "PUT" {
+		http.Error(w, "bad method; want PUT", http.StatusMethodNotAllowed)
+		return
+	}
+	s1 := sha1.New()
+	n, err := io.Copy(s1, r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var sum [20]byte
+	s1.Sum(sum[:0])
+	buf := make([]byte, 0, 80)
+	buf = append(buf, "sha1 = "...)
+	var hex [40]byte
+	encodeHex(&hex, &sum)
+	buf = append(buf, hex[:]...)
+	buf = append(buf, " in "...)
+	buf = strconv.AppendInt(buf, n, 10)
+	buf = append(buf, " bytes"...)
+	w.Write(buf)
+}
+
+func main() {
+	log.Printf("Starting on port 8080")
+	http.HandleFunc("/upload", handlePost)
+	log.Fatal(http.ListenAndServe("127.0.0.1:8080", nil))
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/hex"
+	"math/rand"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/internal/benchtest"
+)
+
+func TestEncodeHex(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	inputs := []*[20]byte{new([20]byte), {0: 0xff, 9: 0x9a, 15: 0xa9, 16: 0x0f, 19: 0xf0}}
+	for i := 0; i < 1000; i++ {
+		var src [20]byte
+		rnd.Read(src[:])
+		inputs = append(inputs, &src)
+	}
+	for _, src := range inputs {
+		want := hex.EncodeToString(src[:])
+		var got, gotGo [40]byte
+		encodeHex(&got, src)
+		encodeHexGo(&gotGo, src)
+		if string(got[:]) != want || string(gotGo[:]) != want {
+			t.Fatalf("encoding %x: encodeHex = %s, encodeHexGo = %s", src[:], got[:], gotGo[:])
+		}
+	}
+}
+
+func TestHandlePost(t *testing.T) {
+	rw := httptest.NewRecorder()
+	handlePost(rw, httptest.NewRequest("PUT", "/upload", strings.NewReader("hello")))
+	if got, want := rw.Body.String(), "sha1 = aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d in 5 bytes"; got != want {
+		t.Errorf("got %q; want %q", got, want)
+	}
+}
+
+var (
+	src  = [20]byte{0xde, 0xad, 0xbe, 0xef, 19: 0x42}
+	dst  [40]byte
+	sink []byte
+)
+
+func BenchmarkEncodeHex(b *testing.B) {
+	for benchtest.Loop(b) {
+		encodeHex(&dst, &src)
+	}
+}
+
+func BenchmarkEncodeHexGo(b *testing.B) {
+	for benchtest.Loop(b) {
+		encodeHexGo(&dst, &src)
+	}
+}
+
+func BenchmarkEncodeHexStdlib(b *testing.B) {
+	for benchtest.Loop(b) {
+		hex.Encode(dst[:], src[:])
+	}
+}
+
+func BenchmarkPut(b *testing.B) {
+	const length = 64 << 10
+	b.SetBytes(length)
+	f := benchtest.NewFixture(b, "PUT /upload HTTP/1.1\r\nContent-Length: "+strconv.Itoa(length)+"\r\n\r\n"+strings.Repeat("a", length))
+	for benchtest.Loop(b) {
+		f.Reset()
+		handlePost(f.Rec, f.Req)
+	}
+}
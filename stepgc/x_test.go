@@ -0,0 +1,77 @@
+package main
+
+import (
+	"math"
+	"net/http/httptest"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/internal/benchtest"
+)
+
+func TestHandleAlloc(t *testing.T) {
+	rw := httptest.NewRecorder()
+	handleAlloc(rw, httptest.NewRequest("GET", "/", nil))
+	if n := strings.Count(rw.Body.String(), "\n"); n != 64 {
+		t.Errorf("got %d lines; want 64", n)
+	}
+}
+
+// benchGC serves requests with the GC configured by setup, which
+// returns a func undoing it, and reports GCs per thousand requests and
+// the 99th percentile request latency.
+func benchGC(b *testing.B, setup func() (undo func())) {
+	runtime.GC()
+	undo := setup()
+	defer func() {
+		undo()
+		runtime.GC()
+	}()
+
+	f := benchtest.NewFixture(b, "GET / HTTP/1.1\r\nHost: x\r\n\r\n")
+	// b.N isn't known until the loop ends, so lat grows as it goes.
+	lat := make([]time.Duration, 0, 1<<16)
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	for benchtest.Loop(b) {
+		f.Reset()
+		t0 := time.Now()
+		handleAlloc(f.Rec, f.Req)
+		lat = append(lat, time.Since(t0))
+	}
+	runtime.ReadMemStats(&after)
+
+	sort.Slice(lat, func(i, j int) bool { return lat[i] < lat[j] })
+	p99 := lat[int(math.Ceil(float64(len(lat))*0.99))-1]
+	b.ReportMetric(float64(after.NumGC-before.NumGC)*1000/float64(len(lat)), "GCs/1k-req")
+	b.ReportMetric(float64(p99.Nanoseconds()), "p99-ns")
+}
+
+func BenchmarkGCDefault(b *testing.B) {
+	benchGC(b, func() func() { return func() {} })
+}
+
+func BenchmarkGCBallast(b *testing.B) {
+	benchGC(b, func() func() {
+		setBallast(256)
+		return func() { setBallast(0) }
+	})
+}
+
+// BenchmarkGCMemoryLimit turns off proportional pacing (GOGC=off) and
+// lets the GC run only as the heap nears GOMEMLIMIT, the modern
+// replacement for a ballast.
+func BenchmarkGCMemoryLimit(b *testing.B) {
+	benchGC(b, func() func() {
+		oldPercent := debug.SetGCPercent(-1)
+		oldLimit := debug.SetMemoryLimit(256 << 20)
+		return func() {
+			debug.SetGCPercent(oldPercent)
+			debug.SetMemoryLimit(oldLimit)
+		}
+	})
+}
@@ -0,0 +1,21 @@
+//go:build quic
+
+package main
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+
+	"github.com/quic-go/quic-go/http3"
+)
+
+func init() {
+	serveH3 = func(pc net.PacketConn, cfg *tls.Config, h http.Handler) error {
+		srv := &http3.Server{Handler: h, TLSConfig: http3.ConfigureTLSConfig(cfg)}
+		return srv.Serve(pc)
+	}
+	newH3Transport = func(cfg *tls.Config) http.RoundTripper {
+		return &http3.Transport{TLSClientConfig: cfg}
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/internal/benchtest"
+)
+
+// startTLS starts the mux over TLS on TCP, and over HTTP/3 too when
+// built with -tags=quic. It returns the TCP server's URL, the HTTP/3
+// server's address or "" without the tag, and a client TLS config
+// that trusts them.
+func startTLS(tb testing.TB) (url string, h3Addr string, clientCfg *tls.Config) {
+	cert, err := selfSigned()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	cfg := &tls.Config{Certificates: []tls.Certificate{cert}, NextProtos: []string{"h2", "http/1.1"}}
+	ts := httptest.NewUnstartedServer(altSvc("443", newMux()))
+	ts.EnableHTTP2 = true
+	ts.TLS = cfg
+	ts.StartTLS()
+	tb.Cleanup(ts.Close)
+
+	if serveH3 != nil {
+		pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			tb.Fatal(err)
+		}
+		tb.Cleanup(func() { pc.Close() })
+		go serveH3(pc, cfg, newMux())
+		h3Addr = pc.LocalAddr().String()
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert.Leaf)
+	return ts.URL, h3Addr, &tls.Config{RootCAs: pool}
+}
+
+// clientFor returns a client speaking HTTP major version v.
+func clientFor(v int, cfg *tls.Config) *http.Client {
+	// Enabling HTTP/2 adds "h2" to the config's NextProtos, so
+	// don't let the HTTP/1.1 client see that.
+	cfg = cfg.Clone()
+	switch v {
+	case 1:
+		return &http.Client{Transport: &http.Transport{TLSClientConfig: cfg}}
+	case 2:
+		return &http.Client{Transport: &http.Transport{TLSClientConfig: cfg, ForceAttemptHTTP2: true}}
+	}
+	return &http.Client{Transport: newH3Transport(cfg)}
+}
+
+func TestProtocols(t *testing.T) {
+	url, _, cfg := startTLS(t)
+	for v, proto := range map[int]string{1: "HTTP/1.1", 2: "HTTP/2.0"} {
+		res, err := clientFor(v, cfg).Do(mustRequest(t, url+"/upload", "hello"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+		want := "sha1 = aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d in 5 bytes over " + proto
+		if string(body) != want {
+			t.Errorf("got %q; want %q", body, want)
+		}
+		if got := res.Header.Get("Alt-Svc"); got != `h3=":443"; ma=86400` {
+			t.Errorf("%s Alt-Svc = %q", proto, got)
+		}
+	}
+}
+
+func mustRequest(tb testing.TB, url, body string) *http.Request {
+	req, err := http.NewRequest("PUT", url, strings.NewReader(body))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return req
+}
+
+func TestHandlePostMethod(t *testing.T) {
+	rw := httptest.NewRecorder()
+	handlePost(rw, httptest.NewRequest("GET", "/upload", nil))
+	if rw.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET = %d; want 405", rw.Code)
+	}
+}
+
+// BenchmarkUpload PUTs 1MB bodies to the sha1 handler over each
+// protocol, one at a time over one connection.
+func BenchmarkUpload(b *testing.B) {
+	const size = 1 << 20
+	body := bytes.Repeat([]byte("a"), size)
+	url, h3Addr, cfg := startTLS(b)
+	for v := 1; v <= 3; v++ {
+		b.Run(fmt.Sprintf("HTTP%d", v), func(b *testing.B) {
+			target := url
+			if v == 3 {
+				if h3Addr == "" {
+					b.Skip("built without -tags=quic")
+				}
+				target = "https://" + h3Addr
+			}
+			c := clientFor(v, cfg)
+			defer c.CloseIdleConnections()
+			b.SetBytes(size)
+			for benchtest.Loop(b) {
+				req, _ := http.NewRequest("PUT", target+"/upload", bytes.NewReader(body))
+				res, err := c.Do(req)
+				if err != nil {
+					b.Fatal(err)
+				}
+				io.Copy(io.Discard, res.Body)
+				res.Body.Close()
+				if res.StatusCode != 200 {
+					b.Fatal(res.Status)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/internal/clock"
+)
+
+// accessLog wraps h so that each request is written to w as a line in
+// Apache's combined log format, with the start time in UTC, followed by
+// the latency in microseconds:
+//
+//	127.0.0.1 - - [15/Oct/2026:10:00:00 +0000] "GET /?id=3 HTTP/1.1" 200 45 "-" "curl/8.0" 117
+func accessLog(w io.Writer, h http.Handler) http.Handler {
+	var mu sync.Mutex // serializes writes to w
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		t0 := time.Now()
+		rec := &statusRecorder{ResponseWriter: rw}
+		h.ServeHTTP(rec, r)
+		line := formatAccess(r, rec.status(), rec.written, clock.Stamp(t0), time.Since(t0))
+		mu.Lock()
+		defer mu.Unlock()
+		io.WriteString(w, line)
+	})
+}
+
+func formatAccess(r *http.Request, status int, written int64, t0 time.Time, d time.Duration) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	user := "-"
+	if u, _, ok := r.BasicAuth(); ok && u != "" {
+		user = u
+	}
+	size := "-"
+	if written > 0 {
+		size = strconv.FormatInt(written, 10)
+	}
+	return fmt.Sprintf("%s - %s [%s] %s %d %s %s %s %d\n",
+		host, user,
+		t0.Format("02/Jan/2006:15:04:05 -0700"),
+		quote(r.Method+" "+r.URL.RequestURI()+" "+r.Proto),
+		status, size,
+		quote(r.Referer()), quote(r.UserAgent()),
+		d.Microseconds())
+}
+
+// quote quotes s for a log field, using "-" for empty values as
+// Apache does. Quotes and control characters are escaped so a client
+// can't forge log lines.
+func quote(s string) string {
+	if s == "" {
+		return `"-"`
+	}
+	return strconv.Quote(s)
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAccessLog(t *testing.T) {
+	var buf bytes.Buffer
+	h := accessLog(&buf, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, "hello, ")
+		io.WriteString(w, "world")
+	}))
+	req := httptest.NewRequest("PUT", "/upload?x=1", nil)
+	req.RemoteAddr = "10.0.0.1:5555"
+	req.Header.Set("Referer", "http://example.com/")
+	req.Header.Set("User-Agent", `evil"agent`)
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	rx := regexp.MustCompile(`^10\.0\.0\.1 - - \[\d\d/\w{3}/\d{4}:\d\d:\d\d:\d\d \+0000\] "PUT /upload\?x=1 HTTP/1\.1" 201 12 "http://example\.com/" "evil\\"agent" \d+\n$`)
+	if !rx.MatchString(buf.String()) {
+		t.Errorf("log line = %q; doesn't match %v", buf.String(), rx)
+	}
+}
+
+func TestFormatAccessDefaults(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "unix"
+	req.SetBasicAuth("brad", "secret")
+	t0 := time.Date(2015, 8, 21, 10, 0, 0, 0, time.UTC)
+	got := formatAccess(req, 304, 0, t0, 1500*time.Microsecond)
+	want := `unix - brad [21/Aug/2015:10:00:00 +0000] "GET / HTTP/1.1" 304 - "-" "-" 1500` + "\n"
+	if got != want {
+		t.Errorf("got  %q\nwant %q", got, want)
+	}
+	if strings.Contains(got, "secret") {
+		t.Errorf("log line leaks the password")
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/binding"
+	"github.com/bradfitz/talk-yapc-asia-2015/errcode"
+	"github.com/bradfitz/talk-yapc-asia-2015/store"
+)
+
+// adminMux returns the handler for the admin listener, serving
+// adminRoutes: the net/http/pprof endpoints, including profile, trace,
+// heap, and goroutine, /debug/vars, /debug/routes, /stats, and
+// /admin/reset. It checks no keys;
+// that's adminHandler's job.
+func adminMux() *http.ServeMux {
+	return routeMux(adminRoutes())
+}
+
+// startAdmin serves adminMux on addr in the background. It refuses
+// any addr that isn't a loopback address, so profiles never leak
+// beyond the machine running the demo.
+//
+// If addr is in use, startAdmin keeps trying to listen on it in the
+// background rather than failing: in a replacement started by a
+// handoff restart, the old server holds it until it exits.
+func startAdmin(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("bad -admin address %q: %v", addr, err)
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return fmt.Errorf("-admin address %q isn't localhost-only", addr)
+	}
+	ln, err := net.Listen("tcp", addr)
+	if errors.Is(err, syscall.EADDRINUSE) {
+		log.Printf("-admin address %s is in use; retrying in the background", addr)
+		go func() {
+			ln, err := listenRetry(addr, adminRetry, time.Minute)
+			if err != nil {
+				log.Printf("ERROR: admin listener: %v", err)
+				return
+			}
+			serveAdmin(ln)
+		}()
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	go serveAdmin(ln)
+	return nil
+}
+
+// adminRetry is how long startAdmin first waits to listen again on an
+// address in use. The wait doubles each time, up to 5s.
+var adminRetry = 100 * time.Millisecond
+
+// listenRetry listens on addr, retrying after delay, then twice that,
+// and so on, for as long as addr is in use, until giveUp has passed.
+func listenRetry(addr string, delay, giveUp time.Duration) (net.Listener, error) {
+	deadline := time.Now().Add(giveUp)
+	for {
+		ln, err := net.Listen("tcp", addr)
+		if !errors.Is(err, syscall.EADDRINUSE) || time.Now().After(deadline) {
+			return ln, err
+		}
+		time.Sleep(delay)
+		delay = min(2*delay, 5*time.Second)
+	}
+}
+
+func serveAdmin(ln net.Listener) {
+	log.Printf("Serving /debug/pprof, /stats, and /admin/reset on %s", ln.Addr())
+	if err := http.Serve(ln, secureHeaders(adminHandler())); err != nil {
+		log.Printf("ERROR: admin listener: %v", err)
+	}
+}
+
+// adminHandler is adminMux, behind requireAPIKey if -apikeys is set.
+// Without -apikeys, the read-only endpoints stay open to the loopback
+// clients that can reach them, but the authKey ones, such as
+// /admin/reset, are refused: nothing that changes the server's state
+// runs without a key.
+func adminHandler() http.Handler {
+	var keys []string
+	for _, k := range strings.Split(*apiKeys, ",") {
+		if k != "" {
+			keys = append(keys, k)
+		}
+	}
+	mux := adminMux()
+	if len(keys) > 0 {
+		return requireAPIKey(keys, mux)
+	}
+	needKey := map[string]bool{}
+	for _, rt := range adminRoutes() {
+		needKey[rt.pattern] = rt.auth == authKey
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, pattern := mux.Handler(r); needKey[pathPattern(pattern)] {
+			errcode.Write(w, fmt.Errorf("%w: %s needs the server started with -apikeys", errcode.ErrForbidden, pattern))
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// handleAdminReset sets the visitor counter back to zero, so a live
+// demo can be run again without restarting the server, and responds
+// with the count it had. With stats=1 it clears the route latency
+// percentiles too. It's served on the -admin listener, and only when
+// -apikeys is set:
+//
+//	curl -X POST -H "Authorization: Bearer $KEY" 'localhost:6060/admin/reset?stats=1'
+func handleAdminReset(w http.ResponseWriter, r *http.Request) {
+	b := binding.New(r)
+	resetStats := b.Int("stats", 0, 0, 1) == 1
+	if err := b.Err(); err != nil {
+		errcode.Write(w, err)
+		return
+	}
+	sw, ok := counter.(store.Swapper)
+	if !ok {
+		errcode.Write(w, fmt.Errorf("%w: counter backend can't be reset", errcode.ErrBackendUnavailable))
+		return
+	}
+	old, err := sw.Swap(r.Context(), 0)
+	if err != nil {
+		errcode.Write(w, fmt.Errorf("%w: %v", errcode.ErrBackendUnavailable, err))
+		return
+	}
+	atomic.StoreInt64(&lastVisitNum, 0)
+	visitorHub.reset()
+	if resetStats {
+		routeLatency.Reset()
+	}
+	logger(r.Context()).Info("visitor counter reset", "previous", old, "stats", resetStats)
+	respond(w, r, struct {
+		Previous   int64 `json:"previous"`
+		StatsReset bool  `json:"statsReset"`
+	}{old, resetStats})
+}
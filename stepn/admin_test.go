@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/logtail"
+	"github.com/bradfitz/talk-yapc-asia-2015/store"
+)
+
+func TestAdminMux(t *testing.T) {
+	for _, path := range []string{"/stats", "/debug/pprof/", "/debug/pprof/heap", "/debug/pprof/goroutine?debug=1", "/debug/pprof/trace?seconds=0.01"} {
+		rw := httptest.NewRecorder()
+		adminMux().ServeHTTP(rw, httptest.NewRequest("GET", path, nil))
+		if rw.Code != 200 {
+			t.Errorf("admin GET %s = %d; want 200", path, rw.Code)
+		}
+	}
+}
+
+func TestPprofNotPublic(t *testing.T) {
+	mux := newMux(logtail.NewRing(10))
+	if _, pat := mux.Handler(httptest.NewRequest("GET", "/debug/pprof/heap", nil)); pat != "GET /" {
+		t.Errorf("public mux routes /debug/pprof/heap to %q; want the root handler", pat)
+	}
+}
+
+func TestStartAdminRefusesPublic(t *testing.T) {
+	for _, addr := range []string{":0", "0.0.0.0:0", "example.com:6060", "nonsense"} {
+		if err := startAdmin(addr); err == nil {
+			t.Errorf("startAdmin(%q) succeeded; want error", addr)
+		}
+	}
+}
+
+func TestStartAdminRetriesInUse(t *testing.T) {
+	defer func(d time.Duration) { adminRetry = d }(adminRetry)
+	adminRetry = time.Millisecond
+	old, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := old.Addr().String()
+	if err := startAdmin(addr); err != nil {
+		t.Fatalf("startAdmin(%q) with the address in use: %v; want it to retry", addr, err)
+	}
+	old.Close() // as the server being replaced exits
+	waitFor(t, "the admin listener", func() bool {
+		res, err := http.Get("http://" + addr + "/stats")
+		if err != nil {
+			return false
+		}
+		res.Body.Close()
+		return res.StatusCode == 200
+	})
+}
+
+func TestAdminReset(t *testing.T) {
+	defer func(c store.Counter, h *hub, k string) { counter, visitorHub, *apiKeys = c, h, k }(counter, visitorHub, *apiKeys)
+	c := new(store.Memory)
+	c.Store(42)
+	counter, visitorHub = c, new(hub)
+	visitorHub.publish(42)
+	counts, unsubscribe := visitorHub.subscribe()
+	defer unsubscribe()
+	<-counts
+	routeLatency.Route("/").Observe(1)
+
+	reset := func(key, query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/admin/reset"+query, nil)
+		if key != "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+		rw := httptest.NewRecorder()
+		adminHandler().ServeHTTP(rw, req)
+		return rw
+	}
+	*apiKeys = ""
+	for _, key := range []string{"", "s3cret"} {
+		if rw := reset(key, ""); rw.Code != 403 {
+			t.Errorf("with no -apikeys, reset with key %q = %d; want 403", key, rw.Code)
+		}
+	}
+	*apiKeys = "s3cret"
+	if rw := reset("", ""); rw.Code != 401 || rw.Header().Get("WWW-Authenticate") == "" {
+		t.Errorf("reset with no key = %d; want 401 with WWW-Authenticate", rw.Code)
+	}
+	if rw := reset("wrong", ""); rw.Code != 403 {
+		t.Errorf("reset with a wrong key = %d; want 403", rw.Code)
+	}
+	if n, _ := c.Load(context.Background()); n != 42 {
+		t.Fatalf("refused resets changed the count to %d", n)
+	}
+
+	rw := reset("s3cret", "?stats=1")
+	if want := `{"previous":42,"statsReset":true}`; rw.Code != 200 || strings.TrimSpace(rw.Body.String()) != want {
+		t.Errorf("reset = %d %s; want 200 %s", rw.Code, rw.Body, want)
+	}
+	if n, _ := c.Load(context.Background()); n != 0 {
+		t.Errorf("count after reset = %d; want 0", n)
+	}
+	select {
+	case n := <-counts:
+		if n != 0 {
+			t.Errorf("subscriber got %d after reset; want 0", n)
+		}
+	default:
+		t.Errorf("subscriber got nothing after reset; want 0")
+	}
+	visitorHub.publish(1)
+	if n := <-counts; n != 1 {
+		t.Errorf("subscriber got %d for the first visit after reset; want 1", n)
+	}
+	if s := routeLatency.Summaries(); len(s) != 0 {
+		t.Errorf("latency after stats=1 reset = %+v; want none", s)
+	}
+}
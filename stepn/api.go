@@ -0,0 +1,100 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// The visit API is versioned by path, for clients that want JSON
+// without content negotiation. Each version counts the visit the same
+// way, with takeVisit, and differs only in what it encodes:
+//
+//	/v1/visit  rootJSON, what handleRoot sends for Accept: application/json
+//	/v2/visit  visitV2, which adds the tenant and browser session
+//
+// v1 stays for clients built against it, but its responses say it's
+// deprecated and point at v2.
+
+// v1Deprecation is when v1 was deprecated, for its Deprecation header
+// (RFC 9745): the day v2 shipped, in Unix seconds.
+const v1Deprecation = "@1792022400" // 2026-10-15
+
+// visitV2 is /v2/visit's response. Number is null when the counter
+// backend is down, and LastCounted is set instead, as in v1. Tenant is
+// the site visited, by host name, and Session the browser's session,
+// from its session cookie.
+type visitV2 struct {
+	Number      *int64 `json:"number"`
+	LastCounted int64  `json:"lastCounted,omitempty"`
+	Yours       int64  `json:"yours"`
+	Tenant      string `json:"tenant"`
+	Session     string `json:"session"`
+}
+
+// visitHandler returns a handler for one version of the visit API,
+// writing the visit with write.
+func visitHandler(write func(w http.ResponseWriter, r *http.Request, v rootJSON)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		v, _ := takeVisit(w, r)
+		write(w, r, v)
+	}
+}
+
+var (
+	handleVisitV1 = visitHandler(func(w http.ResponseWriter, r *http.Request, v rootJSON) {
+		w.Header().Set("Deprecation", v1Deprecation)
+		w.Header().Set("Link", `</v2/visit>; rel="successor-version"`)
+		writeJSON(w, v)
+	})
+	handleVisitV2 = visitHandler(func(w http.ResponseWriter, r *http.Request, v rootJSON) {
+		respond(w, r, visitV2{
+			Number:      v.Visitor,
+			LastCounted: v.LastCounted,
+			Yours:       v.YourVisits,
+			Tenant:      tenant(r),
+			Session:     session(w, r),
+		})
+	})
+)
+
+// tenant returns the site r is for: its host name, lowercased and
+// without a port.
+func tenant(r *http.Request) string {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(host)
+}
+
+const sessionCookie = "session"
+
+// session returns r's browser session ID, from its cookie, starting a
+// new session if it has none. The cookie lasts until the browser
+// closes. It must be called before the response header is written.
+func session(w http.ResponseWriter, r *http.Request) string {
+	if c, err := r.Cookie(sessionCookie); err == nil && validSessionID(c.Value) {
+		return c.Value
+	}
+	id := make([]byte, 16)
+	rand.Read(id)
+	s := hex.EncodeToString(id)
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    s,
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return s
+}
+
+// validSessionID reports whether s looks like an ID session made, so
+// a client can't put arbitrary text in the response.
+func validSessionID(s string) bool {
+	b, err := hex.DecodeString(s)
+	return err == nil && len(b) == 16
+}
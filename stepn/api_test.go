@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/logtail"
+	"github.com/bradfitz/talk-yapc-asia-2015/store"
+)
+
+func TestVisitAPI(t *testing.T) {
+	defer func(c store.Counter) { counter = c }(counter)
+	counter = new(store.Memory)
+	mux := newMux(logtail.NewRing(10))
+	get := func(path string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest("GET", path, nil)
+		req.Host = "Example.COM:8080"
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		rw := httptest.NewRecorder()
+		mux.ServeHTTP(rw, req)
+		if rw.Code != 200 {
+			t.Fatalf("GET %s = %d %s", path, rw.Code, rw.Body)
+		}
+		return rw
+	}
+
+	rw := get("/v1/visit")
+	if got, want := rw.Body.String(), `{"visitor":1,"yourVisits":1}`+"\n"; got != want {
+		t.Errorf("v1 body = %q; want %q", got, want)
+	}
+	if rw.Header().Get("Deprecation") != v1Deprecation || rw.Header().Get("Link") != `</v2/visit>; rel="successor-version"` {
+		t.Errorf("v1 headers = %v; want Deprecation and a successor Link", rw.Header())
+	}
+
+	rw = get("/v2/visit")
+	if rw.Header().Get("Deprecation") != "" {
+		t.Errorf("v2 is deprecated too")
+	}
+	var v visitV2
+	if err := json.Unmarshal(rw.Body.Bytes(), &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Number == nil || *v.Number != 2 || v.Tenant != "example.com" || !validSessionID(v.Session) {
+		t.Errorf("v2 visit = %+v; want number 2 at example.com with a session", v)
+	}
+	var sess *http.Cookie
+	for _, c := range rw.Result().Cookies() {
+		if c.Name == sessionCookie {
+			sess = c
+		}
+	}
+	if sess == nil || sess.Value != v.Session || sess.MaxAge != 0 {
+		t.Fatalf("session cookie = %v; want one for the browser session holding %q", sess, v.Session)
+	}
+
+	rw = get("/v2/visit", sess)
+	var again visitV2
+	json.Unmarshal(rw.Body.Bytes(), &again)
+	if again.Session != v.Session {
+		t.Errorf("second visit's session = %q; want %q kept", again.Session, v.Session)
+	}
+	for _, c := range rw.Result().Cookies() {
+		if c.Name == sessionCookie {
+			t.Errorf("second visit set a new session cookie %v", c)
+		}
+	}
+
+	rw = get("/v2/visit", &http.Cookie{Name: sessionCookie, Value: "<script>"})
+	json.Unmarshal(rw.Body.Bytes(), &again)
+	if !validSessionID(again.Session) || again.Session == v.Session {
+		t.Errorf("session from a forged cookie = %q; want a new one", again.Session)
+	}
+
+	counter = failingCounter{}
+	rw = get("/v2/visit")
+	if got, want := rw.Body.String(), `"number":null,"lastCounted":4,`; !json.Valid(rw.Body.Bytes()) || !strings.Contains(got, want) {
+		t.Errorf("degraded v2 body = %q; want it to contain %q", got, want)
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/internal/attacktest"
+	"github.com/bradfitz/talk-yapc-asia-2015/logtail"
+	"github.com/bradfitz/talk-yapc-asia-2015/metrics"
+	"github.com/bradfitz/talk-yapc-asia-2015/secheaders"
+	"github.com/bradfitz/talk-yapc-asia-2015/store"
+)
+
+// TestAttacks runs the attack suite against the server as runServe
+// builds it, with its parameter validation and security headers. The
+// traversals are tried on /blob/, with -blobdir set and files mapped,
+// and on /static/.
+func TestAttacks(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping in -short mode")
+	}
+	defer func(c store.Counter, u store.UploadLog, rt time.Duration) {
+		counter, uploads, *readTimeout = c, u, rt
+	}(counter, uploads, *readTimeout)
+	counter, uploads = new(store.Memory), store.NewMemoryUploads(100)
+	*readTimeout = 200 * time.Millisecond
+	blobFixture(t, 1, map[string]int{"f": 10})
+
+	sp := &secheaders.Policy{Default: secheaders.Strict}
+	ts := httptest.NewUnstartedServer(nil)
+	ts.Config = newServer(sp.Wrap(recoverPanics(metrics.InstrumentMux(newMux(logtail.NewRing(100))))))
+	ts.Start()
+	defer ts.Close()
+
+	attacktest.Run(t, ts.URL, attacktest.Target{
+		Reflect:        []string{"/?color=", "/?id=", "/history?n="},
+		Inject:         []string{"/?id=", "/history?n="},
+		FilePrefixes:   []string{"/blob/", "/static/"},
+		MaxHeaderBytes: *maxHeaderBytes,
+		Upload:         "/upload",
+		ReadTimeout:    *readTimeout,
+	})
+}
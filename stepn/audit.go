@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/auditlog"
+	"github.com/bradfitz/talk-yapc-asia-2015/binding"
+	"github.com/bradfitz/talk-yapc-asia-2015/errcode"
+)
+
+// auditRingSize is how many events the audit log keeps in memory.
+// With -auditlog, older ones are read back from the file.
+const auditRingSize = 10000
+
+// audit records visits and uploads for /export/events.ndjson.
+var audit = auditlog.New(auditRingSize)
+
+// recordEvent adds e to the audit log. A failure is logged but
+// doesn't fail the request: the visit or upload already happened.
+func recordEvent(ctx context.Context, e auditlog.Event) {
+	if _, err := audit.Append(e); err != nil {
+		logger(ctx).Error("recording audit event", "kind", e.Kind, "err", err)
+	}
+}
+
+// handleEventExport streams the audit log's events after the since
+// parameter's sequence number, oldest first, as newline-delimited
+// JSON:
+//
+//	curl -s 'localhost:8080/export/events.ndjson?since=41000' | jq .sha1
+//
+// A client resumes from the last seq it got. If that's older than
+// anything the log still has, the response is a 410.
+func handleEventExport(w http.ResponseWriter, r *http.Request) {
+	b := binding.New(r)
+	since := b.Int("since", 0, 0, math.MaxInt64)
+	if err := b.Err(); err != nil {
+		errcode.Write(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	x := newExportWriter(w)
+	err := audit.Since(r.Context(), since, func(e auditlog.Event) error {
+		return x.add(func(b []byte) []byte {
+			return append(e.AppendJSON(b), '\n')
+		})
+	})
+	if errors.Is(err, auditlog.ErrExpired) && x.n == 0 {
+		errcode.Write(w, fmt.Errorf("%w: %v", errcode.ErrCursorExpired, err))
+		return
+	}
+	x.finish(r, "event export", err)
+}
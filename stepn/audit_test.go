@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/auditlog"
+	"github.com/bradfitz/talk-yapc-asia-2015/store"
+)
+
+func TestEventExport(t *testing.T) {
+	defer func(a *auditlog.Log) { audit = a }(audit)
+	defer func(c store.Counter, u store.UploadLog) { counter, uploads = c, u }(counter, uploads)
+	audit = auditlog.New(4)
+	counter = new(store.Memory)
+	uploads = store.NewMemoryUploads(10)
+
+	mux := newMux(nil)
+	for i := 0; i < 2; i++ {
+		mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	}
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("PUT", "/upload", strings.NewReader("hello")))
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/visits/batch", strings.NewReader(`[{"count":3}]`)))
+
+	rw := httptest.NewRecorder()
+	mux.ServeHTTP(rw, httptest.NewRequest("GET", "/export/events.ndjson?since=1", nil))
+	if ct := rw.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	var got []auditlog.Event
+	sc := bufio.NewScanner(rw.Body)
+	for sc.Scan() {
+		var e auditlog.Event
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			t.Fatalf("bad line %q: %v", sc.Text(), err)
+		}
+		got = append(got, e)
+	}
+	want := []auditlog.Event{
+		{Seq: 2, Kind: auditlog.Visit, Visitor: 2, Count: 1},
+		{Seq: 3, Kind: auditlog.Upload, Size: 5, Sum: "aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d"},
+		{Seq: 4, Kind: auditlog.Visit, Visitor: 5, Count: 3},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d events; want %d:\n%s", len(got), len(want), rw.Body)
+	}
+	for i, e := range got {
+		e.Time = want[i].Time
+		if e != want[i] {
+			t.Errorf("event %d = %+v; want %+v", i, e, want[i])
+		}
+	}
+
+	// Once the ring has moved past a cursor, it can't be resumed.
+	for i := 0; i < 4; i++ {
+		mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	}
+	rw = httptest.NewRecorder()
+	mux.ServeHTTP(rw, httptest.NewRequest("GET", "/export/events.ndjson?since=2", nil))
+	if rw.Code != http.StatusGone || !strings.Contains(rw.Body.String(), "cursor_expired") {
+		t.Errorf("expired cursor: %d %s; want 410 cursor_expired", rw.Code, rw.Body)
+	}
+}
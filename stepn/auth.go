@@ -0,0 +1,49 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/errcode"
+)
+
+// requireAPIKey wraps h to serve only requests carrying one of keys,
+// either as a bearer token or in an X-API-Key header. A request with
+// no key gets a 401, and one with a wrong key a 403.
+func requireAPIKey(keys []string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, ok := requestAPIKey(r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="stepn admin"`)
+			errcode.Write(w, errcode.ErrUnauthorized)
+			return
+		}
+		if !validAPIKey(keys, key) {
+			errcode.Write(w, errcode.ErrForbidden)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+func requestAPIKey(r *http.Request) (string, bool) {
+	if k, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && k != "" {
+		return k, true
+	}
+	if k := r.Header.Get("X-API-Key"); k != "" {
+		return k, true
+	}
+	return "", false
+}
+
+// validAPIKey reports whether key is one of keys. It compares against
+// every one in constant time, so how long it takes says nothing about
+// how close key came.
+func validAPIKey(keys []string, key string) bool {
+	match := 0
+	for _, k := range keys {
+		match |= subtle.ConstantTimeCompare([]byte(k), []byte(key))
+	}
+	return match == 1
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequireAPIKey(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	h := requireAPIKey([]string{"k1", "k2"}, ok)
+	for _, tt := range []struct {
+		name, header, value string
+		want                int
+	}{
+		{"missing", "", "", http.StatusUnauthorized},
+		{"empty bearer", "Authorization", "Bearer ", http.StatusUnauthorized},
+		{"basic auth", "Authorization", "Basic azE6", http.StatusUnauthorized},
+		{"wrong bearer", "Authorization", "Bearer k3", http.StatusForbidden},
+		{"prefix of a key", "X-API-Key", "k", http.StatusForbidden},
+		{"valid bearer", "Authorization", "Bearer k1", http.StatusOK},
+		{"valid header", "X-API-Key", "k2", http.StatusOK},
+	} {
+		req := httptest.NewRequest("GET", "/stats", nil)
+		if tt.header != "" {
+			req.Header.Set(tt.header, tt.value)
+		}
+		rw := httptest.NewRecorder()
+		h.ServeHTTP(rw, req)
+		if rw.Code != tt.want {
+			t.Errorf("%s: status %d; want %d", tt.name, rw.Code, tt.want)
+		}
+		if challenged := rw.Header().Get("WWW-Authenticate") != ""; challenged != (tt.want == http.StatusUnauthorized) {
+			t.Errorf("%s: WWW-Authenticate set = %v", tt.name, challenged)
+		}
+	}
+}
+
+func TestAdminHandlerKeys(t *testing.T) {
+	defer func(k string) { *apiKeys = k }(*apiKeys)
+	get := func(path string) int {
+		rw := httptest.NewRecorder()
+		adminHandler().ServeHTTP(rw, httptest.NewRequest("GET", path, nil))
+		return rw.Code
+	}
+	for _, keys := range []string{"", ","} {
+		*apiKeys = keys
+		if code := get("/stats"); code != http.StatusOK {
+			t.Errorf("-apikeys=%q: /stats = %d; want 200 with no keys set", keys, code)
+		}
+		if code := get("/admin/reset"); code != http.StatusForbidden {
+			t.Errorf("-apikeys=%q: /admin/reset = %d; want 403 with no keys set", keys, code)
+		}
+	}
+	*apiKeys = "a,b"
+	for _, path := range []string{"/stats", "/debug/pprof/heap", "/admin/reset"} {
+		if code := get(path); code != http.StatusUnauthorized {
+			t.Errorf("-apikeys=a,b: %s without a key = %d; want 401", path, code)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/auditlog"
+	"github.com/bradfitz/talk-yapc-asia-2015/errcode"
+	"github.com/bradfitz/talk-yapc-asia-2015/store"
+)
+
+// Limits on one POST /visits/batch.
+const (
+	maxBatchBytes  = 1 << 20
+	maxBatchEvents = 1000
+	maxEventCount  = 1000
+	maxClockSkew   = time.Minute
+)
+
+// A visitEvent is one entry of a batch: Count visits (default 1)
+// recorded by a load generator or an offline client at Time.
+type visitEvent struct {
+	Time  time.Time `json:"time"`
+	Count int64     `json:"count"`
+}
+
+// A rejectedEvent is a batch entry that wasn't applied.
+type rejectedEvent struct {
+	Index int    `json:"index"`
+	Error string `json:"error"`
+}
+
+// batchJSON is the response to POST /visits/batch.
+type batchJSON struct {
+	Applied  int64           `json:"applied"` // visits added
+	Visitor  int64           `json:"visitor"` // count after adding them
+	Rejected []rejectedEvent `json:"rejected"`
+}
+
+// handleVisitBatch adds a JSON array of visitEvents to the counter.
+// Invalid events are listed in the response and skipped; the valid
+// ones are added in one IncrBy, so either all of them count or, if
+// the backend fails, none do.
+func handleVisitBatch(w http.ResponseWriter, r *http.Request) {
+	var events []visitEvent
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBatchBytes)).Decode(&events); err != nil {
+		if errcode.Lookup(err) == errcode.ErrTooLarge {
+			errcode.Write(w, err)
+		} else {
+			errcode.Write(w, fmt.Errorf("%w: body must be a JSON array of visits: %v", errcode.ErrInvalidParams, err))
+		}
+		return
+	}
+	if len(events) > maxBatchEvents {
+		errcode.Write(w, fmt.Errorf("%w: %d visits in batch; max is %d", errcode.ErrInvalidParams, len(events), maxBatchEvents))
+		return
+	}
+
+	res := batchJSON{Rejected: []rejectedEvent{}}
+	latest := time.Now().Add(maxClockSkew)
+	for i, ev := range events {
+		if ev.Count == 0 {
+			ev.Count = 1
+		}
+		switch {
+		case ev.Count < 0 || ev.Count > maxEventCount:
+			res.Rejected = append(res.Rejected, rejectedEvent{i, fmt.Sprintf("count must be from 1 to %d", maxEventCount)})
+		case ev.Time.After(latest):
+			res.Rejected = append(res.Rejected, rejectedEvent{i, "time is in the future"})
+		default:
+			res.Applied += ev.Count
+		}
+	}
+
+	ib, ok := counter.(store.IncrByer)
+	if !ok {
+		errcode.Write(w, fmt.Errorf("%w: counter backend can't apply batches", errcode.ErrBackendUnavailable))
+		return
+	}
+	n, err := ib.Load(r.Context())
+	if res.Applied > 0 {
+		n, err = ib.IncrBy(r.Context(), res.Applied)
+	}
+	if err != nil {
+		errcode.Write(w, fmt.Errorf("%w: %v", errcode.ErrBackendUnavailable, err))
+		return
+	}
+	res.Visitor = n
+	if res.Applied > 0 {
+		atomic.StoreInt64(&lastVisitNum, n)
+		visitorHub.publish(n)
+		noteVisitors(n-res.Applied, n)
+		recordEvent(r.Context(), auditlog.Event{Kind: auditlog.Visit, Visitor: n, Count: res.Applied})
+	}
+	respond(w, r, res)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/errcode"
+	"github.com/bradfitz/talk-yapc-asia-2015/internal/benchtest"
+	"github.com/bradfitz/talk-yapc-asia-2015/store"
+)
+
+func postBatch(body string) *httptest.ResponseRecorder {
+	rw := httptest.NewRecorder()
+	handleVisitBatch(rw, httptest.NewRequest("POST", "/visits/batch", strings.NewReader(body)))
+	return rw
+}
+
+func TestVisitBatch(t *testing.T) {
+	ctx := context.Background()
+	defer func(c store.Counter) { counter = c }(counter)
+	counter = new(store.Memory)
+	counter.Incr(ctx)
+
+	future := time.Now().Add(time.Hour).Format(time.RFC3339)
+	rw := postBatch(`[{}, {"count": 5, "time": "2015-08-22T10:00:00Z"}, {"count": -1}, {"time": "` + future + `"}, {"count": 2}]`)
+	if rw.Code != 200 {
+		t.Fatalf("status %d: %s", rw.Code, rw.Body)
+	}
+	var res batchJSON
+	if err := json.Unmarshal(rw.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if res.Applied != 8 || res.Visitor != 9 {
+		t.Errorf("applied %d, visitor %d; want 8 and 9", res.Applied, res.Visitor)
+	}
+	if len(res.Rejected) != 2 || res.Rejected[0].Index != 2 || res.Rejected[1].Index != 3 {
+		t.Errorf("rejected = %+v; want entries 2 and 3", res.Rejected)
+	}
+	if n, _ := counter.Load(ctx); n != 9 {
+		t.Errorf("counter = %d; want 9", n)
+	}
+}
+
+func TestVisitBatchErrors(t *testing.T) {
+	ctx := context.Background()
+	defer func(c store.Counter) { counter = c }(counter)
+	counter = new(store.Memory)
+
+	tests := []struct {
+		body string
+		code string
+	}{
+		{`{"count": 1}`, "invalid_params"},
+		{`[{"count": "lots"}]`, "invalid_params"},
+		{"[" + strings.Repeat("{},", maxBatchEvents) + "{}]", "invalid_params"},
+		{"[" + strings.Repeat(" ", maxBatchBytes) + "]", "too_large"},
+	}
+	for _, tt := range tests {
+		rw := postBatch(tt.body)
+		var res errcode.Response
+		json.Unmarshal(rw.Body.Bytes(), &res)
+		if res.Code != tt.code {
+			t.Errorf("body %.40q: code %q (%d); want %q", tt.body, res.Code, rw.Code, tt.code)
+		}
+	}
+	if n, _ := counter.Load(ctx); n != 0 {
+		t.Errorf("counter = %d after bad batches; want 0", n)
+	}
+
+	// A failing backend applies nothing.
+	counter = &store.Guarded{C: failingCounter{}}
+	if rw := postBatch(`[{}, {}]`); rw.Code != 503 {
+		t.Errorf("with failing backend: %d; want 503", rw.Code)
+	}
+}
+
+// BenchmarkVisitBatch posts batches of different sizes. Per visit,
+// larger batches amortize the request, the JSON framing, and the
+// counter update, at the cost of decoding more per request.
+func BenchmarkVisitBatch(b *testing.B) {
+	defer func(c store.Counter) { counter = c }(counter)
+	counter = new(store.Memory)
+	for _, size := range []int{1, 10, 100, 1000} {
+		b.Run(strconv.Itoa(size), func(b *testing.B) {
+			body := "[" + strings.TrimSuffix(strings.Repeat(`{"time":"2015-08-22T10:00:00Z","count":1},`, size), ",") + "]"
+			f := benchtest.NewFixture(b, "POST /visits/batch HTTP/1.1\r\nContent-Length: "+strconv.Itoa(len(body))+"\r\n\r\n"+body)
+			b.ReportAllocs()
+			for benchtest.Loop(b) {
+				f.Reset()
+				handleVisitBatch(f.Rec, f.Req)
+			}
+			b.ReportMetric(float64(size*b.N)/b.Elapsed().Seconds(), "visits/s")
+		})
+	}
+}
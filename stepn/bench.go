@@ -0,0 +1,214 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/config"
+	"github.com/bradfitz/talk-yapc-asia-2015/internal/benchtest"
+	"github.com/bradfitz/talk-yapc-asia-2015/logtail"
+	"github.com/bradfitz/talk-yapc-asia-2015/metrics"
+)
+
+// benchmarks are what "stepn bench" runs: the handlers the talk
+// optimizes, measured the way x_test.go's benchmarks measure them.
+var benchmarks = []struct {
+	name string
+	fn   func(b *testing.B)
+}{
+	{"Root", benchRoot},
+	{"Put/1K", benchPut(1 << 10)},
+	{"Put/64K", benchPut(64 << 10)},
+	{"Put/1M", benchPut(1 << 20)},
+}
+
+func benchRoot(b *testing.B) {
+	b.ReportAllocs()
+	f := benchtest.NewFixture(b, "GET / HTTP/1.1\r\nHost: demo\r\n\r\n")
+	for benchtest.Loop(b) {
+		f.Reset()
+		handleRoot(f.Rec, f.Req)
+	}
+}
+
+func benchPut(size int) func(b *testing.B) {
+	req := "PUT /upload HTTP/1.1\r\n" +
+		"Content-Length: " + strconv.Itoa(size) + "\r\n" +
+		"\r\n" + strings.Repeat("a", size)
+	return func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(size))
+		f := benchtest.NewFixture(b, req)
+		for benchtest.Loop(b) {
+			f.Reset()
+			handlePost(f.Rec, f.Req)
+		}
+	}
+}
+
+// runBench is "stepn bench". It prints results in go test -bench's
+// format, so benchstat can compare runs on different machines or
+// builds.
+func runBench(args []string) error {
+	if len(args) > 0 && args[0] == "self" {
+		return runBenchSelf(args[1:])
+	}
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	run := fs.String("run", ".", "regexp of benchmarks to run")
+	count := fs.Int("count", 1, "times to run each benchmark")
+	benchtime := fs.String("benchtime", "1s", "run each benchmark for this long, or Nx for N iterations")
+	config.ParseArgs(fs, args)
+	rx, err := regexp.Compile(*run)
+	if err != nil {
+		return fmt.Errorf("bad -run: %v", err)
+	}
+	// testing.Benchmark takes its duration from the testing package's
+	// own flag.
+	testing.Init()
+	if err := flag.Set("test.benchtime", *benchtime); err != nil {
+		return fmt.Errorf("bad -benchtime: %v", err)
+	}
+
+	printBenchHeader(os.Stdout)
+	suffix := procsSuffix()
+	for _, bm := range benchmarks {
+		if !rx.MatchString(bm.name) {
+			continue
+		}
+		for i := 0; i < *count; i++ {
+			r := testing.Benchmark(bm.fn)
+			fmt.Printf("Benchmark%s%s\t%s\t%s\n", bm.name, suffix, r, r.MemString())
+		}
+	}
+	return nil
+}
+
+// printBenchHeader prints the lines go test -bench starts with, which
+// benchstat uses to tell configurations apart.
+func printBenchHeader(w io.Writer) {
+	fmt.Fprintf(w, "goos: %s\ngoarch: %s\npkg: stepn\n", runtime.GOOS, runtime.GOARCH)
+}
+
+// procsSuffix is the -N go test adds to benchmark names when
+// GOMAXPROCS is above 1.
+func procsSuffix() string {
+	if n := runtime.GOMAXPROCS(0); n > 1 {
+		return "-" + strconv.Itoa(n)
+	}
+	return ""
+}
+
+// A selfScenario is a request "stepn bench self" sends over and over.
+type selfScenario struct {
+	name   string
+	method string
+	path   string
+	upload bool // send -size bytes of body
+}
+
+var selfScenarios = []selfScenario{
+	{"Root", "GET", "/", false},
+	{"Upload", "PUT", "/upload", true},
+}
+
+// selfServer starts the server's handler, with request logging going
+// nowhere, on a listener of the named kind: "loopback" for TCP on
+// 127.0.0.1, or "mem" for in-memory pipes. Kind "handler" has no
+// server at all; its client calls the handler directly. It returns a
+// client for it and the base URL to use.
+func selfServer(kind string, c int) (client *http.Client, base string, stop func(), err error) {
+	h := logRequests(slog.New(slog.NewTextHandler(io.Discard, nil)), recoverPanics(metrics.InstrumentMux(newMux(logtail.NewRing(100)))))
+	client = newLoadClient(c)
+	var ln net.Listener
+	switch kind {
+	case "loopback":
+		if ln, err = net.Listen("tcp", "127.0.0.1:0"); err != nil {
+			return nil, "", nil, err
+		}
+		base = "http://" + ln.Addr().String()
+	case "handler":
+		client.Transport = &benchtest.Transport{Handler: h}
+		return client, "http://handler", func() {}, nil
+	case "mem":
+		ml := newMemListener()
+		client.Transport.(*http.Transport).DialContext = ml.DialContext
+		ln, base = ml, "http://mem"
+	default:
+		return nil, "", nil, fmt.Errorf("unknown transport %q", kind)
+	}
+	srv := newServer(h)
+	go srv.Serve(ln)
+	return client, base, func() { client.CloseIdleConnections(); srv.Close() }, nil
+}
+
+// benchSelf runs each scenario over each transport count times, for d
+// each with c requests in flight, writing results to w in go test
+// -bench's format.
+func benchSelf(w io.Writer, transports []string, c int, d time.Duration, size int64, count int) error {
+	printBenchHeader(w)
+	fmt.Fprintf(w, "# %d requests in flight, %v per run, %d-byte uploads\n", c, d, size)
+	for _, kind := range transports {
+		client, base, stop, err := selfServer(kind, c)
+		if err != nil {
+			return err
+		}
+		for _, sc := range selfScenarios {
+			var bodySize int64
+			if sc.upload {
+				bodySize = size
+			}
+			for i := 0; i < count; i++ {
+				res := loadgen(client, base+sc.path, sc.method, bodySize, c, d)
+				n := len(res.Latencies)
+				if n == 0 {
+					stop()
+					return fmt.Errorf("%s over %s: no responses", sc.name, kind)
+				}
+				if bad := n - res.Statuses[http.StatusOK]; bad > 0 || res.Errors > 0 {
+					fmt.Fprintf(os.Stderr, "%s over %s: %d non-200 responses, %d errors\n", sc.name, kind, bad, res.Errors)
+				}
+				fmt.Fprintf(w, "BenchmarkSelf/%s/%s%s\t%d\t%.0f ns/op", kind, sc.name, procsSuffix(), n, float64(res.Elapsed.Nanoseconds())/float64(n))
+				if bodySize > 0 {
+					fmt.Fprintf(w, "\t%.2f MB/s", float64(bodySize)*float64(n)/res.Elapsed.Seconds()/1e6)
+				}
+				fmt.Fprintf(w, "\t%.0f req/s\t%d p50-ns\t%d p99-ns\n", float64(n)/res.Elapsed.Seconds(), res.percentile(50).Nanoseconds(), res.percentile(99).Nanoseconds())
+			}
+		}
+		stop()
+	}
+	return nil
+}
+
+// runBenchSelf is "stepn bench self": the whole server, middleware and
+// all, in-process, under stepn loadgen's load, in one command. Save
+// its output from two builds or machines and compare them with
+// benchstat.
+func runBenchSelf(args []string) error {
+	fs := flag.NewFlagSet("bench self", flag.ExitOnError)
+	conc := fs.Int("c", 10, "requests to keep in flight")
+	dur := fs.Duration("d", 5*time.Second, "how long to run each scenario")
+	size := fs.Int64("size", 64<<10, "bytes of body to send with each upload")
+	count := fs.Int("count", 1, "times to run each scenario")
+	inmem := fs.Bool("inmem", false, "also run over in-memory pipes and straight to the handler, to see what loopback TCP and HTTP itself cost")
+	config.ParseArgs(fs, args)
+	if *conc < 1 || *dur <= 0 || *size < 1 || *count < 1 {
+		return errors.New("-c, -d, -size, and -count must be positive")
+	}
+	transports := []string{"loopback"}
+	if *inmem {
+		transports = append(transports, "mem", "handler")
+	}
+	return benchSelf(os.Stdout, transports, *conc, *dur, *size, *count)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMemListener(t *testing.T) {
+	ml := newMemListener()
+	go http.Serve(ml, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "over "+r.RemoteAddr)
+	}))
+	c := &http.Client{Transport: &http.Transport{DialContext: ml.DialContext}}
+	res, err := c.Get("http://mem/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	if string(body) != "over pipe" {
+		t.Errorf("got %q", body)
+	}
+	ml.Close()
+	if _, err := ml.DialContext(context.Background(), "tcp", "mem"); err == nil {
+		t.Error("dialed a closed listener")
+	}
+}
+
+func TestBenchSelf(t *testing.T) {
+	var buf bytes.Buffer
+	if err := benchSelf(&buf, []string{"loopback", "mem", "handler"}, 2, 50*time.Millisecond, 1<<10, 1); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	rx := regexp.MustCompile(`(?m)^BenchmarkSelf/(loopback|mem|handler)/(Root|Upload)(-\d+)?\t\d+\t\d+ ns/op\t(\S+ MB/s\t)?\d+ req/s\t\d+ p50-ns\t\d+ p99-ns$`)
+	if got := len(rx.FindAllString(out, -1)); got != 6 {
+		t.Errorf("got %d result lines; want 6:\n%s", got, out)
+	}
+	if !strings.Contains(out, "Upload") || !strings.Contains(out, "MB/s") {
+		t.Errorf("no upload throughput:\n%s", out)
+	}
+}
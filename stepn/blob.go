@@ -0,0 +1,59 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"runtime/debug"
+	"strings"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/metrics"
+	"github.com/bradfitz/talk-yapc-asia-2015/mmapfile"
+)
+
+var blobReads = metrics.NewCounterVec("blob_reads_total", "Files served under /blob/, by how they were read: mmap or read.", "via")
+
+// handleBlob serves the files in -blobdir under /blob/, with ranges
+// and conditional requests as http.ServeContent does them. Files of at
+// least -mmap bytes are mapped into memory and copied out of it
+// through ServeContent's buffer; if mapping fails, or isn't supported,
+// they're read as usual, which on Linux is sendfile. BenchmarkBlob
+// compares the two.
+func handleBlob(w http.ResponseWriter, r *http.Request) {
+	if *blobDir == "" {
+		http.NotFound(w, r)
+		return
+	}
+	liftWriteDeadline(w)
+	// http.Dir keeps the name inside the directory.
+	name := strings.TrimPrefix(r.URL.Path, "/blob")
+	hf, err := http.Dir(*blobDir).Open(name)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer hf.Close()
+	fi, err := hf.Stat()
+	if err != nil || !fi.Mode().IsRegular() {
+		http.NotFound(w, r)
+		return
+	}
+	var content io.ReadSeeker = hf
+	via := "read"
+	if f, ok := hf.(*os.File); ok && *blobMmap > 0 && fi.Size() >= *blobMmap {
+		if m, err := mmapfile.Map(f); err != nil {
+			logger(r.Context()).Warn("mapping blob; reading it instead", "name", name, "err", err)
+		} else {
+			// Unmapped once ServeContent returns, as the handler's
+			// writes are all copied by then: net/http doesn't keep
+			// a slice it's given past the Write. A file cut short
+			// while it's mapped faults on the missing pages; that's
+			// a panic for recoverPanics rather than a crash.
+			defer m.Close()
+			defer debug.SetPanicOnFault(debug.SetPanicOnFault(true))
+			content, via = io.NewSectionReader(m, 0, int64(m.Len())), "mmap"
+		}
+	}
+	blobReads.Inc(via)
+	http.ServeContent(w, r, name, fi.ModTime(), content)
+}
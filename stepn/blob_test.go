@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/internal/benchtest"
+)
+
+// blobFixture sets -blobdir to a new directory holding the named files
+// of the given sizes, and -mmap to mmapMin, until the test ends.
+func blobFixture(tb testing.TB, mmapMin int64, sizes map[string]int) map[string][]byte {
+	dir := tb.TempDir()
+	old, oldMin := *blobDir, *blobMmap
+	tb.Cleanup(func() { *blobDir, *blobMmap = old, oldMin })
+	*blobDir, *blobMmap = dir, mmapMin
+	files := map[string][]byte{}
+	for name, size := range sizes {
+		b := bytes.Repeat([]byte(name[:1]), size)
+		if err := os.WriteFile(filepath.Join(dir, name), b, 0644); err != nil {
+			tb.Fatal(err)
+		}
+		files[name] = b
+	}
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0755); err != nil {
+		tb.Fatal(err)
+	}
+	return files
+}
+
+func TestBlob(t *testing.T) {
+	files := blobFixture(t, 1<<20, map[string]int{"small": 100, "big": 3 << 20, "empty": 0})
+	ts := httptest.NewServer(http.HandlerFunc(handleBlob))
+	defer ts.Close()
+
+	for _, tt := range []struct {
+		name, rng string
+		via       string
+		code      int
+		want      []byte
+	}{
+		{"small", "", "read", 200, files["small"]},
+		{"big", "", "mmap", 200, files["big"]},
+		{"big", "bytes=1048570-1048579", "mmap", 206, files["big"][1048570:1048580]},
+		{"empty", "", "read", 200, nil},
+		{"sub", "", "", 404, nil},
+		{"nope", "", "", 404, nil},
+		{"../blob_test.go", "", "", 404, nil},
+	} {
+		before := blobReads.Value(tt.via)
+		req, _ := http.NewRequest("GET", ts.URL+"/blob/"+tt.name, nil)
+		if tt.rng != "" {
+			req.Header.Set("Range", tt.rng)
+		}
+		res, err := ts.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+		if res.StatusCode != tt.code {
+			t.Errorf("%s %s: status %d; want %d", tt.name, tt.rng, res.StatusCode, tt.code)
+			continue
+		}
+		if tt.code >= 300 {
+			continue
+		}
+		if !bytes.Equal(got, tt.want) {
+			t.Errorf("%s %s: got %d bytes; want %d", tt.name, tt.rng, len(got), len(tt.want))
+		}
+		if d := blobReads.Value(tt.via) - before; d != 1 {
+			t.Errorf("%s: blob_reads_total{via=%q} went up by %v; want 1", tt.name, tt.via, d)
+		}
+	}
+}
+
+// BenchmarkBlob compares serving a file by reading it, which net/http
+// turns into sendfile on Linux, with mapping it, over loopback,
+// through the public listener's whole pipeline:
+//
+//	go test -run=^$ -bench=Blob -benchmem ./stepn
+//
+// The file is in the page cache after the first iteration, so this is
+// the warm case. To see the cold one, drop the cache between runs with
+// "sync; echo 3 > /proc/sys/vm/drop_caches" as root and -benchtime=1x.
+func BenchmarkBlob(b *testing.B) {
+	for _, size := range []int{64 << 10, 4 << 20, 64 << 20} {
+		for _, via := range []string{"read", "mmap"} {
+			b.Run(via+"/"+strconv.Itoa(size), func(b *testing.B) {
+				mmapMin := int64(0)
+				if via == "mmap" {
+					mmapMin = 1
+				}
+				blobFixture(b, mmapMin, map[string]int{"f": size})
+				ts := httptest.NewServer(publicHandler())
+				defer ts.Close()
+				b.SetBytes(int64(size))
+				b.ReportAllocs()
+				for benchtest.Loop(b) {
+					res, err := ts.Client().Get(ts.URL + "/blob/f")
+					if err != nil {
+						b.Fatal(err)
+					}
+					io.Copy(io.Discard, res.Body)
+					res.Body.Close()
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Buffer pool statistics, published in /debug/vars.
+var (
+	bufPoolGets int64 // must be accessed atomically
+	bufPoolNews int64 // must be accessed atomically
+)
+
+// bufPool holds buffers of -bufsize bytes.
+var bufPool = sync.Pool{
+	New: func() interface{} { return newBuf(*bufSize) },
+}
+
+// bufClasses are the sizes -sizedbufs picks among, smallest first,
+// each with its own pool. A buffer bigger than the body is wasted
+// memory, and one much smaller costs a read and a hash call per
+// chunk; BenchmarkPut measures the tradeoff.
+var bufClasses = [...]int{4 << 10, 32 << 10, 256 << 10}
+
+var classPools [len(bufClasses)]sync.Pool
+
+func init() {
+	for i, size := range bufClasses {
+		classPools[i].New = func() interface{} { return newBuf(size) }
+	}
+}
+
+func newBuf(size int) *[]byte {
+	atomic.AddInt64(&bufPoolNews, 1)
+	b := make([]byte, size)
+	return &b
+}
+
+// bufClass returns the index in bufClasses of the buffer for a body of
+// contentLength bytes: the smallest that holds it all, or the biggest.
+// A body of unknown length, -1, gets 32 KiB, the default -bufsize.
+func bufClass(contentLength int64) int {
+	if contentLength < 0 {
+		return 1
+	}
+	for i, size := range bufClasses {
+		if contentLength <= int64(size) {
+			return i
+		}
+	}
+	return len(bufClasses) - 1
+}
+
+// getBuf returns a pooled buffer to copy a body of contentLength
+// bytes, or -1 if unknown, through. The caller must give it back with
+// putBuf.
+func getBuf(contentLength int64) *[]byte {
+	atomic.AddInt64(&bufPoolGets, 1)
+	if *sizedBufs {
+		return classPools[bufClass(contentLength)].Get().(*[]byte)
+	}
+	bufp := bufPool.Get().(*[]byte)
+	if len(*bufp) != *bufSize {
+		// From before -bufsize changed, as it does in benchmarks.
+		bufp = newBuf(*bufSize)
+	}
+	return bufp
+}
+
+// putBuf returns a buffer from getBuf to its pool.
+func putBuf(bufp *[]byte) {
+	if *sizedBufs {
+		for i, size := range bufClasses {
+			if len(*bufp) == size {
+				classPools[i].Put(bufp)
+				return
+			}
+		}
+	}
+	bufPool.Put(bufp)
+}
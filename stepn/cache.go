@@ -0,0 +1,73 @@
+package main
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/cachecontrol"
+)
+
+// cachePolicy is every public route's Cache-Control, in one place. A
+// new route belongs here too; TestCachePolicy checks each one.
+var cachePolicy = &cachecontrol.Policy{
+	Default: cachecontrol.NoStore,
+	Routes: map[string]string{
+		// The welcome page counts the visit and reads the visitor's
+		// cookie, so it's only the visitor's own.
+		"/":         cachecontrol.Private,
+		"/static/":  cachecontrol.Immutable,
+		"/v1/visit": cachecontrol.Private,
+		"/v2/visit": cachecontrol.Private,
+
+		// Files from -blobdir may change in place; their
+		// Last-Modified makes the revalidation cheap.
+		"/blob/": cachecontrol.Revalidate,
+
+		// The generated file is the same for the same -filesize.
+		"/file": cachecontrol.Revalidate,
+
+		// The sha1 pins what a /fetch URL can return: a body that
+		// doesn't match is cut short, never served whole.
+		"/fetch": cachecontrol.Immutable,
+
+		// Live numbers and streams.
+		"/stats":                cachecontrol.NoStore,
+		"/live":                 cachecontrol.NoStore,
+		"/events":               cachecontrol.NoStore,
+		"/metrics":              cachecontrol.NoStore,
+		"/history":              cachecontrol.NoStore,
+		"/history/export":       cachecontrol.NoStore,
+		"/export/events.ndjson": cachecontrol.NoStore,
+
+		// Writes.
+		"/upload":            cachecontrol.NoStore,
+		"/upload/multipart":  cachecontrol.NoStore,
+		"/upload/resumable":  cachecontrol.NoStore,
+		"/upload/resumable/": cachecontrol.NoStore,
+		"/visits/batch":      cachecontrol.NoStore,
+
+		// Changes only with a new build, which a restart serves;
+		// their ETags make the revalidation cheap.
+		"/version":      cachecontrol.Revalidate,
+		"/openapi.json": cachecontrol.Revalidate,
+
+		// A log stream; logtail.Ring sets this itself, and a value
+		// the handler sets wins.
+		"/debug/logtail": cachecontrol.Revalidate,
+	},
+}
+
+//go:embed static
+var staticFiles embed.FS
+
+// staticHandler serves the files in the static directory under
+// /static/. They're cached as immutable, so a file that changes must
+// get a new name.
+func staticHandler() http.Handler {
+	sub, err := fs.Sub(staticFiles, "static")
+	if err != nil {
+		panic(err)
+	}
+	return http.StripPrefix("/static/", http.FileServerFS(sub))
+}
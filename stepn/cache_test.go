@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/auditlog"
+	"github.com/bradfitz/talk-yapc-asia-2015/cachecontrol"
+	"github.com/bradfitz/talk-yapc-asia-2015/logtail"
+	"github.com/bradfitz/talk-yapc-asia-2015/metrics"
+	"github.com/bradfitz/talk-yapc-asia-2015/store"
+)
+
+// TestCachePolicy requests every public route and checks that each
+// has an entry in cachePolicy and gets its Cache-Control.
+func TestCachePolicy(t *testing.T) {
+	defer func(c store.Counter, u store.UploadLog, a *auditlog.Log) {
+		counter, uploads, audit = c, u, a
+	}(counter, uploads, audit)
+	counter, uploads, audit = new(store.Memory), store.NewMemoryUploads(100), auditlog.New(100)
+
+	mux := newMux(logtail.NewRing(100))
+	ts := httptest.NewServer(cachePolicy.Wrap(secureHeaders(metrics.InstrumentMux(mux))))
+	defer ts.Close()
+
+	covered := map[string]bool{}
+	for _, tt := range []struct {
+		method, path, body string
+		ok                 bool // whether it succeeds, getting its route's value
+	}{
+		{"GET", "/", "", true},
+		{"GET", "/?format=json", "", true},
+		{"GET", "/?id=x", "", false},
+		{"GET", "/no/such/page", "", true}, // the welcome page
+		{"GET", "/v1/visit", "", true},
+		{"GET", "/v2/visit", "", true},
+		{"PUT", "/upload", "hello", true},
+		{"POST", "/upload/multipart", "", false}, // not multipart
+		{"POST", "/upload/resumable", "", true},
+		{"GET", "/upload/resumable/nope", "", false},
+		{"GET", "/history", "", true},
+		{"POST", "/visits/batch", `[{"n":1}]`, true},
+		{"GET", "/stats", "", true},
+		{"GET", "/version", "", true},
+		{"GET", "/static/style.css", "", true},
+		{"GET", "/static/nope.css", "", false},
+		{"GET", "/blob/nope", "", false},
+		{"GET", "/fetch", "", false},
+		{"HEAD", "/file", "", true},
+		{"GET", "/live", "", false}, // not a WebSocket handshake
+		{"GET", "/events", "", true},
+		{"GET", "/history/export", "", true},
+		{"GET", "/export/events.ndjson", "", true},
+		{"GET", "/debug/logtail", "", true},
+		{"GET", "/openapi.json", "", true},
+		{"GET", "/metrics", "", true},
+	} {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		_, pattern := mux.Handler(req)
+		pattern = pathPattern(pattern)
+		want, ok := cachePolicy.Routes[pattern]
+		if !ok {
+			t.Errorf("%s %s: route %q has no cache policy", tt.method, tt.path, pattern)
+			continue
+		}
+		covered[pattern] = true
+		if !tt.ok {
+			want = cachecontrol.NoStore
+		}
+
+		// Streams never end, so each request is canceled once its
+		// headers are in.
+		ctx, cancel := context.WithCancel(context.Background())
+		creq, err := http.NewRequestWithContext(ctx, tt.method, ts.URL+tt.path, strings.NewReader(tt.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := http.DefaultTransport.RoundTrip(creq)
+		if err != nil {
+			cancel()
+			t.Errorf("%s %s: %v", tt.method, tt.path, err)
+			continue
+		}
+		cancel()
+		res.Body.Close()
+		if succeeded := res.StatusCode < 300 || res.StatusCode == http.StatusNotModified; succeeded != tt.ok {
+			t.Errorf("%s %s: status %d; want success = %v", tt.method, tt.path, res.StatusCode, tt.ok)
+		}
+		if got := res.Header.Get("Cache-Control"); got != want {
+			t.Errorf("%s %s: Cache-Control = %q; want %q", tt.method, tt.path, got, want)
+		}
+	}
+	for pattern := range cachePolicy.Routes {
+		if !covered[pattern] {
+			t.Errorf("cachePolicy has %q, which no request here reaches", pattern)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/internal/steps/step0"
+	"github.com/bradfitz/talk-yapc-asia-2015/internal/steps/step1"
+	"github.com/bradfitz/talk-yapc-asia-2015/metrics"
+)
+
+// compareSteps returns a handler serving step0 under /step0/, step1
+// under /step1/, and stepn, the server's usual handler, under /stepn/
+// and everywhere else, for -compare. Pointing the load generator at
+// /step0/hi, /step1/, and /stepn/ in turn shows the steps' difference
+// live on /stats and /metrics: each prefix is timed as a route of its
+// own, and the two old steps are counted in http_requests_total.
+func compareSteps(stepn http.Handler) http.Handler {
+	mux := http.NewServeMux()
+	for _, s := range []struct {
+		prefix string
+		h      http.Handler
+	}{
+		{"/step0/", metrics.Instrument("/step0/", step0.Handler())},
+		{"/step1/", metrics.Instrument("/step1/", step1.Handler())},
+		{"/stepn/", stepn}, // already instrumented by route
+	} {
+		h := http.StripPrefix(s.prefix[:len(s.prefix)-1], s.h)
+		mux.Handle(s.prefix, timed(s.prefix, h.ServeHTTP))
+	}
+	mux.Handle("/", stepn)
+	return mux
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/logtail"
+	"github.com/bradfitz/talk-yapc-asia-2015/metrics"
+	"github.com/bradfitz/talk-yapc-asia-2015/store"
+)
+
+func TestCompareSteps(t *testing.T) {
+	defer func(c store.Counter) { counter = c }(counter)
+	counter = new(store.Memory)
+	routeLatency.Reset()
+	defer routeLatency.Reset()
+
+	ts := httptest.NewServer(compareSteps(metrics.InstrumentMux(newMux(logtail.NewRing(100)))))
+	defer ts.Close()
+
+	for _, tt := range []struct {
+		path, want string
+	}{
+		{"/step0/hi?color=red", "You are visitor number 1!"},
+		{"/step1/", "You are visitor number 1!"},
+		{"/stepn/version", "go"},
+		{"/version", "go"},
+	} {
+		res, err := ts.Client().Get(ts.URL + tt.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+		if res.StatusCode != 200 || !strings.Contains(string(body), tt.want) {
+			t.Errorf("GET %s = %d %q; want 200 containing %q", tt.path, res.StatusCode, body, tt.want)
+		}
+	}
+
+	seen := map[string]uint64{}
+	for _, s := range routeLatency.Summaries() {
+		seen[s.Route] = s.Requests
+	}
+	for _, route := range []string{"/step0/", "/step1/", "/stepn/"} {
+		if seen[route] != 1 {
+			t.Errorf("route %s timed %d requests; want 1", route, seen[route])
+		}
+	}
+}
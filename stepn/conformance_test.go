@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/logtail"
+	"github.com/bradfitz/talk-yapc-asia-2015/metrics"
+	"github.com/bradfitz/talk-yapc-asia-2015/store"
+)
+
+// An httpFixture is a raw HTTP/1.1 byte stream from testdata/http1,
+// and what the server must answer it with.
+//
+// A fixture file starts with "# " lines. Those of the form "# key:
+// value" set its expectations:
+//
+//	want:     the status of each response, in order
+//	contains: text the last response's body must contain
+//	then:     "close" if the server must then close the connection
+//	eol:      "lf" to send the request's lines as they are, instead of
+//	          ending each with CRLF
+//
+// The rest of the file is the request bytes.
+type httpFixture struct {
+	raw      []byte
+	want     []int
+	contains string
+	close    bool
+}
+
+func readHTTPFixture(t *testing.T, path string) *httpFixture {
+	slurp, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fx := new(httpFixture)
+	crlf := true
+	for bytes.HasPrefix(slurp, []byte("#")) {
+		line, rest, _ := bytes.Cut(slurp, []byte("\n"))
+		slurp = rest
+		k, v, ok := strings.Cut(strings.TrimPrefix(string(line), "#"), ":")
+		v = strings.TrimSpace(v)
+		if !ok {
+			continue
+		}
+		switch strings.TrimSpace(k) {
+		case "want":
+			for _, f := range strings.Fields(v) {
+				code, err := strconv.Atoi(f)
+				if err != nil {
+					t.Fatalf("%s: bad want %q", path, v)
+				}
+				fx.want = append(fx.want, code)
+			}
+		case "contains":
+			fx.contains = v
+		case "then":
+			fx.close = v == "close"
+		case "eol":
+			crlf = v != "lf"
+		}
+	}
+	if len(fx.want) == 0 {
+		t.Fatalf("%s: no want line", path)
+	}
+	if crlf {
+		slurp = bytes.ReplaceAll(slurp, []byte("\n"), []byte("\r\n"))
+	}
+	fx.raw = slurp
+	return fx
+}
+
+// TestHTTPFixtures replays each fixture in testdata/http1 on its own
+// connection to the whole server stack, through net.Pipe, and checks
+// the responses byte stream by byte stream. Unlike tests that build
+// requests with http.ReadRequest, they exercise the server's framing:
+// header parsing, chunked bodies, pipelining, and when it must give up
+// on a connection.
+func TestHTTPFixtures(t *testing.T) {
+	defer func(c store.Counter, u store.UploadLog) { counter, uploads = c, u }(counter, uploads)
+	counter, uploads = new(store.Memory), store.NewMemoryUploads(100)
+
+	ln := newMemListener()
+	srv := newServer(recoverPanics(metrics.InstrumentMux(newMux(logtail.NewRing(100)))))
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	paths, err := filepath.Glob(filepath.Join("testdata", "http1", "*.txt"))
+	if err != nil || len(paths) == 0 {
+		t.Fatalf("no fixtures: %v", err)
+	}
+	for _, path := range paths {
+		t.Run(strings.TrimSuffix(filepath.Base(path), ".txt"), func(t *testing.T) {
+			fx := readHTTPFixture(t, path)
+			c, err := ln.DialContext(context.Background(), "", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Close()
+			c.SetDeadline(time.Now().Add(5 * time.Second))
+			// The server may stop reading partway, after a 400, so the
+			// write's error doesn't matter.
+			go c.Write(fx.raw)
+
+			br := bufio.NewReader(c)
+			var body []byte
+			for i, want := range fx.want {
+				res, err := http.ReadResponse(br, nil)
+				if err != nil {
+					t.Fatalf("reading response %d: %v", i+1, err)
+				}
+				body, err = io.ReadAll(res.Body)
+				res.Body.Close()
+				if err != nil {
+					t.Fatalf("reading response %d's body: %v", i+1, err)
+				}
+				if res.StatusCode != want {
+					t.Errorf("response %d: status %d; want %d; body: %s", i+1, res.StatusCode, want, body)
+				}
+			}
+			if !bytes.Contains(body, []byte(fx.contains)) {
+				t.Errorf("last body = %q; want it to contain %q", body, fx.contains)
+			}
+			if fx.close {
+				if b, err := br.ReadByte(); err != io.EOF {
+					t.Errorf("after the responses, read %q, %v; want the connection closed", b, err)
+				}
+			}
+		})
+	}
+}
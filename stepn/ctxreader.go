@@ -0,0 +1,23 @@
+package main
+
+import (
+	"context"
+	"io"
+)
+
+// A ctxReader reads from r until ctx is done. A request body only
+// fails once the connection does, which can be long after the client
+// gave up, or never, for an HTTP/2 stream reset with the body already
+// buffered; reading through a ctxReader stops soon after the
+// request's context is canceled instead.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (cr ctxReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.r.Read(p)
+}
@@ -0,0 +1,28 @@
+//go:build bolt
+
+package main
+
+import (
+	"flag"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/store"
+)
+
+var dbFile = flag.String("db", "", "if non-empty, bbolt database file to keep the visitor count and upload history in")
+
+func init() {
+	registerPlugin(plugin{Name: "bolt", Setup: setupBolt})
+}
+
+func setupBolt() error {
+	if *dbFile == "" {
+		return nil
+	}
+	db, err := store.OpenBolt(*dbFile)
+	if err != nil {
+		return err
+	}
+	counter = db
+	uploads = db
+	return nil
+}
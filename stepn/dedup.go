@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/internal/singleflight"
+	"github.com/bradfitz/talk-yapc-asia-2015/metrics"
+)
+
+// uploadFlight collapses concurrent uploads of the same content.
+var uploadFlight singleflight.Group
+
+var uploadDedup = metrics.NewCounterVec("upload_dedup_total", "Uploads with an X-Content-Key, by whether another's hashing answered them (hit) or they hashed their own body (miss).", "result")
+
+// hashUploadOnce is hashUpload for an upload whose client names its
+// content with an X-Content-Key header, such as a build artifact's
+// path and version. While an upload with the same key and ?alg= is
+// being hashed, another isn't: it waits, and gets the same sums,
+// leaving its own body unread, unless its client goes away first. So
+// a thundering herd of identical uploads costs one hash.
+//
+// The key is the client's word for the content. Uploads that ask for
+// their own bodies to be checked, with an expected digest, or that
+// want progress reported, are hashed as usual.
+func hashUploadOnce(w http.ResponseWriter, r *http.Request, key string, ds []digester, fanout bool) (sums []string, n int64, err error) {
+	algs := make([]string, len(ds))
+	for i, d := range ds {
+		algs[i] = d.alg
+	}
+	type result struct {
+		sums []string
+		n    int64
+	}
+	leader := false
+	v, err, _ := uploadFlight.DoContext(r.Context(), strings.Join(algs, ",")+"\x00"+key, func() (interface{}, error) {
+		leader = true
+		sums, n, err := hashUpload(w, r, ds, nil, nil, fanout)
+		return result{sums, n}, err
+	})
+	if leader {
+		uploadDedup.Inc("miss")
+		res, _ := v.(result)
+		return res.sums, res.n, err
+	}
+	if err != nil && errors.Is(err, r.Context().Err()) {
+		// This client went away while waiting.
+		return nil, 0, err
+	}
+	if err != nil {
+		// The failure was the other upload's, such as its client
+		// going away, not necessarily this one's.
+		uploadDedup.Inc("miss")
+		return hashUpload(w, r, ds, nil, nil, fanout)
+	}
+	uploadDedup.Inc("hit")
+	res := v.(result)
+	return res.sums, res.n, nil
+}
+
+// dedupCounts returns the hits and misses of hashUploadOnce, for
+// /stats.
+func dedupCounts() (hits, misses int64) {
+	return int64(uploadDedup.Value("hit")), int64(uploadDedup.Value("miss"))
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/store"
+)
+
+// TestUploadDedup holds one upload's body open while more with the
+// same X-Content-Key arrive, and checks that they all get its sum
+// without their own bodies being hashed.
+func TestUploadDedup(t *testing.T) {
+	defer func(u store.UploadLog) { uploads = u }(uploads)
+	uploads = store.NewMemoryUploads(100)
+	const n = 8
+	body := strings.Repeat("a", 100<<10)
+	want := fmt.Sprintf("sha256 = %x in %d bytes", sha256.Sum256([]byte(body)), len(body))
+	hits0, misses0 := dedupCounts()
+	hashed0 := bytesHashed.Value()
+
+	put := func(body io.Reader) string {
+		req := httptest.NewRequest("PUT", "/upload?alg=sha256", body)
+		req.Header.Set("X-Content-Key", "artifact-v1")
+		rw := httptest.NewRecorder()
+		handlePost(rw, req)
+		if rw.Code != 200 {
+			return fmt.Sprintf("%d %s", rw.Code, rw.Body)
+		}
+		return rw.Body.String()
+	}
+	pr, pw := io.Pipe()
+	got := make(chan string, n)
+	go func() { got <- put(pr) }()
+	io.WriteString(pw, body[:1]) // the first upload is hashing
+	var wg sync.WaitGroup
+	for i := 1; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got <- put(strings.NewReader(body))
+		}()
+	}
+	for atomic.LoadInt64(&activeUploads) < n {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond) // for the last to join the flight
+	io.WriteString(pw, body[1:])
+	pw.Close()
+	wg.Wait()
+	for i := 0; i < n; i++ {
+		if g := <-got; g != want {
+			t.Errorf("upload got %q; want %q", g, want)
+		}
+	}
+
+	hits, misses := dedupCounts()
+	if hits-hits0 != n-1 || misses-misses0 != 1 {
+		t.Errorf("dedup hits, misses = %d, %d; want %d, 1", hits-hits0, misses-misses0, n-1)
+	}
+	if hashed := bytesHashed.Value() - hashed0; hashed != float64(len(body)) {
+		t.Errorf("hashed %v bytes; want %d, one body's worth", hashed, len(body))
+	}
+
+	// Without a key, or with an expected digest, each upload is its
+	// own.
+	for _, hdr := range []http.Header{
+		{},
+		{"X-Content-Key": {"artifact-v1"}, "X-Expected-Sha1": {strings.Repeat("0", 40)}},
+	} {
+		req := httptest.NewRequest("PUT", "/upload", strings.NewReader("hello"))
+		req.Header = hdr
+		handlePost(httptest.NewRecorder(), req)
+	}
+	if h, m := dedupCounts(); h != hits || m != misses {
+		t.Errorf("uploads without dedup counted: hits, misses went from %d, %d to %d, %d", hits, misses, h, m)
+	}
+}
+
+// TestUploadDedupClientGone checks that an upload waiting on another
+// with the same key stops waiting when its own client goes away.
+func TestUploadDedupClientGone(t *testing.T) {
+	defer func(u store.UploadLog) { uploads = u }(uploads)
+	uploads = store.NewMemoryUploads(100)
+	pr, pw := io.Pipe()
+	leader := httptest.NewRequest("PUT", "/upload", pr)
+	leader.Header.Set("X-Content-Key", "artifact-gone")
+	leaderDone := make(chan struct{})
+	go func() {
+		handlePost(httptest.NewRecorder(), leader)
+		close(leaderDone)
+	}()
+	io.WriteString(pw, "a") // the leader is hashing
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest("PUT", "/upload", strings.NewReader("a")).WithContext(ctx)
+	req.Header.Set("X-Content-Key", "artifact-gone")
+	done := make(chan struct{})
+	go func() {
+		handlePost(httptest.NewRecorder(), req)
+		close(done)
+	}()
+	time.Sleep(20 * time.Millisecond) // for it to join the flight
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Error("waiting upload still blocked after its client went away")
+	}
+	pw.Close()
+	<-leaderDone
+}
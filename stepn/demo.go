@@ -0,0 +1,106 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/internal/benchtest"
+)
+
+// A demoLoad is one stream of requests loadgen sends during a phase.
+type demoLoad struct {
+	method, path string
+	size         int64 // bytes of request body
+	c            int   // requests in flight
+	rate         int   // most requests per second, if positive
+}
+
+// A demoPhase is a workload "stepn serve -demo" runs for a while, to
+// show one thing about the server, such as how it behaves in a burst.
+type demoPhase struct {
+	name  string
+	loads []demoLoad // run together
+}
+
+// demoPhases are what -demo cycles through, in order. Chaos is every
+// kind of request a client can get wrong, each getting a 4xx.
+var demoPhases = []demoPhase{
+	{"low", []demoLoad{{"GET", "/", 0, 2, 20}}},
+	{"burst", []demoLoad{{"GET", "/", 0, 64, 0}}},
+	{"uploads", []demoLoad{{"PUT", "/upload", 4 << 20, 4, 0}}},
+	{"chaos", []demoLoad{
+		{"GET", "/", 0, 4, 0},
+		{"GET", "/?id=bad", 0, 2, 0},
+		{"DELETE", "/upload", 0, 1, 0},
+		{"PUT", "/upload?alg=md4", 1 << 10, 1, 0},
+		{"POST", "/upload/multipart", 1 << 10, 1, 0},
+		{"POST", "/visits/batch", 1 << 10, 1, 0},
+	}},
+}
+
+// currentDemoPhase is the name of the phase -demo is running, or
+// nil. The status screen marks where it changes.
+var currentDemoPhase atomic.Pointer[string]
+
+// demoPhaseName returns the name of the phase -demo is running, or
+// "" if it isn't.
+func demoPhaseName() string {
+	if p := currentDemoPhase.Load(); p != nil {
+		return *p
+	}
+	return ""
+}
+
+// pacedTransport sends requests no faster than its ticker ticks.
+type pacedTransport struct {
+	http.RoundTripper
+	tick <-chan time.Time
+}
+
+func (t pacedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	<-t.tick
+	return t.RoundTripper.RoundTrip(req)
+}
+
+// runDemo sends h each of phases' loads in turn, for every each,
+// starting over after the last, until stop is closed. The requests go
+// straight to h, which should be the server's whole handler, so the
+// metrics, logs, and status screen all see them.
+func runDemo(h http.Handler, phases []demoPhase, every time.Duration, stop <-chan struct{}) {
+	defer currentDemoPhase.Store(nil)
+	for {
+		for _, p := range phases {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			currentDemoPhase.Store(&p.name)
+			slog.Info("demo phase", "phase", p.name, "for", every)
+			runDemoPhase(h, p, every)
+		}
+	}
+}
+
+// runDemoPhase runs p's loads at h together for d.
+func runDemoPhase(h http.Handler, p demoPhase, d time.Duration) {
+	var wg sync.WaitGroup
+	for _, l := range p.loads {
+		var rt http.RoundTripper = &benchtest.Transport{Handler: h}
+		if l.rate > 0 {
+			t := time.NewTicker(time.Second / time.Duration(l.rate))
+			defer t.Stop()
+			rt = pacedTransport{rt, t.C}
+		}
+		client := &http.Client{Transport: rt, Timeout: time.Minute}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			loadgen(client, "http://demo"+l.path, l.method, l.size, l.c, d)
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/logtail"
+	"github.com/bradfitz/talk-yapc-asia-2015/metrics"
+	"github.com/bradfitz/talk-yapc-asia-2015/store"
+)
+
+func TestRunDemo(t *testing.T) {
+	var mu sync.Mutex
+	seen := map[string]int{} // phase and path
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		seen[demoPhaseName()+" "+r.Method+" "+r.URL.Path]++
+	})
+	phases := []demoPhase{
+		{"slow", []demoLoad{{"GET", "/slow", 0, 4, 100}}},
+		{"fast", []demoLoad{{"GET", "/a", 0, 1, 0}, {"PUT", "/b", 10, 1, 0}}},
+	}
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		runDemo(h, phases, 100*time.Millisecond, stop)
+		close(done)
+	}()
+	time.Sleep(250 * time.Millisecond) // into the second round
+	close(stop)
+	<-done
+
+	mu.Lock()
+	defer mu.Unlock()
+	if n := seen["slow GET /slow"]; n == 0 || n > 40 {
+		t.Errorf("slow phase sent %d requests in two rounds of 100ms at 100/s; want 1 to 40", n)
+	}
+	if seen["fast GET /a"] == 0 || seen["fast PUT /b"] == 0 {
+		t.Errorf("fast phase didn't send both its loads: %v", seen)
+	}
+	if len(seen) != 3 {
+		t.Errorf("requests seen by phase: %v; want only each phase's own", seen)
+	}
+	if p := demoPhaseName(); p != "" {
+		t.Errorf("phase after stopping = %q; want none", p)
+	}
+}
+
+// TestDemoChaos checks that the chaos phase's requests, other than
+// its welcome-page load, are ones the server refuses.
+func TestDemoChaos(t *testing.T) {
+	defer func(c store.Counter, u store.UploadLog) { counter, uploads = c, u }(counter, uploads)
+	counter, uploads = new(store.Memory), store.NewMemoryUploads(10)
+	h := metrics.InstrumentMux(newMux(logtail.NewRing(10)))
+	for _, p := range demoPhases {
+		if p.name != "chaos" {
+			continue
+		}
+		for _, l := range p.loads {
+			if l.path == "/" {
+				continue
+			}
+			rw := httptest.NewRecorder()
+			h.ServeHTTP(rw, httptest.NewRequest(l.method, l.path, strings.NewReader(strings.Repeat("a", int(l.size)))))
+			if rw.Code < 400 || rw.Code >= 500 {
+				t.Errorf("%s %s = %d; want a 4xx", l.method, l.path, rw.Code)
+			}
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/errcode"
+)
+
+// An expectedDigest is a digest a client sent with its upload, for
+// handlePost to check the body against.
+type expectedDigest struct {
+	header string
+	h      hash.Hash
+	want   []byte
+}
+
+// expectedDigests returns the digests r's headers say its body has:
+// Content-MD5, in base64 as RFC 1864 has it, and X-Expected-SHA1, in
+// hex. A header that isn't a digest of the right size is an
+// ErrBadDigest.
+func expectedDigests(r *http.Request) ([]expectedDigest, error) {
+	var ds []expectedDigest
+	if v := r.Header.Get("Content-MD5"); v != "" {
+		want, err := base64.StdEncoding.DecodeString(v)
+		if err != nil || len(want) != md5.Size {
+			return nil, fmt.Errorf("%w: Content-MD5 must be %d bytes in base64", errcode.ErrBadDigest, md5.Size)
+		}
+		ds = append(ds, expectedDigest{"Content-MD5", md5.New(), want})
+	}
+	if v := r.Header.Get("X-Expected-SHA1"); v != "" {
+		want, err := hex.DecodeString(v)
+		if err != nil || len(want) != sha1.Size {
+			return nil, fmt.Errorf("%w: X-Expected-SHA1 must be %d bytes in hex", errcode.ErrBadDigest, sha1.Size)
+		}
+		ds = append(ds, expectedDigest{"X-Expected-SHA1", sha1.New(), want})
+	}
+	return ds, nil
+}
+
+// withDigests returns w, writing to the hashes of ds too.
+func withDigests(w io.Writer, ds []expectedDigest) io.Writer {
+	if len(ds) == 0 {
+		return w
+	}
+	ws := []io.Writer{w}
+	for _, d := range ds {
+		ws = append(ws, d.h)
+	}
+	return io.MultiWriter(ws...)
+}
+
+// checkDigests returns an ErrDigestMismatch naming the first of ds
+// whose hash didn't come out as the client said.
+func checkDigests(ds []expectedDigest) error {
+	for _, d := range ds {
+		if got := d.h.Sum(nil); !bytes.Equal(got, d.want) {
+			return fmt.Errorf("%w: %s is %x, but the body's is %x", errcode.ErrDigestMismatch, d.header, d.want, got)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/errcode"
+	"github.com/bradfitz/talk-yapc-asia-2015/store"
+)
+
+func TestUploadDigests(t *testing.T) {
+	defer func(u store.UploadLog) { uploads = u }(uploads)
+	uploads = store.NewMemoryUploads(10)
+	const (
+		md5Hello  = "XUFAKrxLKna5cZ2REBfFkg==" // of "hello"
+		sha1Hello = "aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d"
+	)
+	for _, tt := range []struct {
+		name    string
+		headers map[string]string
+		status  int
+		code    string
+	}{
+		{"none", nil, 200, ""},
+		{"md5", map[string]string{"Content-MD5": md5Hello}, 200, ""},
+		{"sha1", map[string]string{"X-Expected-SHA1": sha1Hello}, 200, ""},
+		{"both", map[string]string{"Content-MD5": md5Hello, "X-Expected-SHA1": strings.ToUpper(sha1Hello)}, 200, ""},
+		{"md5 mismatch", map[string]string{"Content-MD5": "1B2M2Y8AsgTpgAmY7PhCfg=="}, 422, "digest_mismatch"},
+		{"sha1 mismatch", map[string]string{"Content-MD5": md5Hello, "X-Expected-SHA1": strings.Repeat("0", 40)}, 422, "digest_mismatch"},
+		{"md5 not base64", map[string]string{"Content-MD5": "hello!"}, 400, "bad_digest"},
+		{"sha1 too short", map[string]string{"X-Expected-SHA1": sha1Hello[:38]}, 400, "bad_digest"},
+	} {
+		req := httptest.NewRequest("PUT", "/upload", strings.NewReader("hello"))
+		for k, v := range tt.headers {
+			req.Header.Set(k, v)
+		}
+		rw := httptest.NewRecorder()
+		handlePost(rw, req)
+		if rw.Code != tt.status {
+			t.Errorf("%s: status %d %q; want %d", tt.name, rw.Code, rw.Body, tt.status)
+			continue
+		}
+		if tt.code == "" {
+			continue
+		}
+		var res errcode.Response
+		if err := json.Unmarshal(rw.Body.Bytes(), &res); err != nil || res.Code != tt.code {
+			t.Errorf("%s: body %q; want code %q", tt.name, rw.Body, tt.code)
+		}
+	}
+	if got, _ := uploads.Recent(context.Background(), 10); len(got) != 4 {
+		t.Errorf("recorded %d uploads; want only the 4 that matched", len(got))
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/internal/benchtest"
+	"github.com/bradfitz/talk-yapc-asia-2015/store"
+)
+
+func TestETags(t *testing.T) {
+	mux := newMux(nil)
+	get := func(path, inm string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		if inm != "" {
+			req.Header.Set("If-None-Match", inm)
+		}
+		rw := httptest.NewRecorder()
+		mux.ServeHTTP(rw, req)
+		return rw
+	}
+
+	for _, path := range []string{"/openapi.json", "/version"} {
+		first := get(path, "")
+		tag := first.Header().Get("ETag")
+		if first.Code != 200 || len(tag) < 4 || tag[:3] != `W/"` {
+			t.Fatalf("first GET %s = %d with ETag %q; want 200 with a weak tag", path, first.Code, tag)
+		}
+		for _, inm := range []string{tag, `"x", ` + tag, tag[2:], "*"} {
+			rw := get(path, inm)
+			if rw.Code != http.StatusNotModified || rw.Body.Len() != 0 {
+				t.Errorf("%s with If-None-Match %s: %d with %d-byte body; want a bodiless 304", path, inm, rw.Code, rw.Body.Len())
+			}
+			if got := rw.Header().Get("ETag"); got != tag {
+				t.Errorf("%s with If-None-Match %s: ETag = %q; want %q", path, inm, got, tag)
+			}
+		}
+		if rw := get(path, `W/"0"`); rw.Code != 200 || rw.Body.String() != first.Body.String() {
+			t.Errorf("%s with another tag = %d; want 200 with the same body", path, rw.Code)
+		}
+	}
+
+	// The welcome page is different every time, so it isn't tagged.
+	defer func(c store.Counter) { counter = c }(counter)
+	counter = new(store.Memory)
+	if tag := get("/", "").Header().Get("ETag"); tag != "" {
+		t.Errorf("/ has ETag %q; want none", tag)
+	}
+}
+
+// sizeWriter is a ResponseWriter that only counts what's written.
+type sizeWriter struct {
+	h http.Header
+	n int64
+}
+
+func (w *sizeWriter) Header() http.Header         { return w.h }
+func (w *sizeWriter) WriteHeader(int)             {}
+func (w *sizeWriter) Write(p []byte) (int, error) { w.n += int64(len(p)); return len(p), nil }
+
+// BenchmarkWriteTagged compares writing /openapi.json with and without
+// an ETag, and with a matching If-None-Match. Its sent-B/op
+// metric is the body bytes a 304 saves; the ns/op difference, what
+// the hashing costs to find out:
+//
+//	go test -run=^$ -bench=WriteTagged -benchmem
+func BenchmarkWriteTagged(b *testing.B) {
+	doc, err := json.Marshal(openAPI(publicRoutes(nil)))
+	if err != nil {
+		b.Fatal(err)
+	}
+	render := func(b []byte) []byte { return append(b, doc...) }
+	tag := weakETag(render(nil))
+	for _, bc := range []struct {
+		name string
+		inm  string // If-None-Match
+		tag  bool
+	}{
+		{name: "Untagged"},
+		{name: "Tagged", tag: true},
+		{name: "NotModified", inm: tag, tag: true},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			b.ReportAllocs()
+			req := httptest.NewRequest("GET", "/", nil)
+			if bc.inm != "" {
+				req.Header.Set("If-None-Match", bc.inm)
+			}
+			w := &sizeWriter{h: make(http.Header)}
+			for benchtest.Loop(b) {
+				if bc.tag {
+					writeTagged(w, req, render)
+				} else {
+					bufp := jsonBufPool.Get().(*[]byte)
+					*bufp = render((*bufp)[:0])
+					w.Write(*bufp)
+					jsonBufPool.Put(bufp)
+				}
+			}
+			b.ReportMetric(float64(w.n)/float64(b.N), "sent-B/op")
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// handleEvents streams the visitor count as Server-Sent Events, one
+// "data: <count>" event each time it changes, for browsers without a
+// WebSocket client. It shares visitorHub with /live.
+func handleEvents(w http.ResponseWriter, r *http.Request) {
+	f, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	// The stream outlives the server's WriteTimeout.
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	counts, unsubscribe := visitorHub.subscribe()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	for {
+		select {
+		case n := <-counts:
+			if _, err := fmt.Fprintf(w, "data: %d\n\n", n); err != nil {
+				return
+			}
+			f.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/logtail"
+	"github.com/bradfitz/talk-yapc-asia-2015/metrics"
+	"github.com/bradfitz/talk-yapc-asia-2015/store"
+)
+
+func TestEvents(t *testing.T) {
+	defer func(c store.Counter, h *hub) { counter, visitorHub = c, h }(counter, visitorHub)
+	counter, visitorHub = new(store.Memory), new(hub)
+
+	ts := httptest.NewServer(logRequests(slog.Default(), recoverPanics(metrics.InstrumentMux(newMux(logtail.NewRing(10))))))
+	defer ts.Close()
+
+	type client struct {
+		cancel func()
+		br     *bufio.Reader
+	}
+	var clients []client
+	for i := 0; i < 2; i++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		req, _ := http.NewRequestWithContext(ctx, "GET", ts.URL+"/events", nil)
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		if ct := res.Header.Get("Content-Type"); ct != "text/event-stream" {
+			t.Fatalf("Content-Type = %q", ct)
+		}
+		clients = append(clients, client{cancel, bufio.NewReader(res.Body)})
+	}
+	// nextData returns the next "data:" line, skipping blank separators.
+	nextData := func(c client) string {
+		for {
+			line, err := c.br.ReadString('\n')
+			if err != nil {
+				t.Fatalf("reading event: %v", err)
+			}
+			if line != "\n" {
+				return line
+			}
+		}
+	}
+	for _, c := range clients {
+		if got := nextData(c); got != "data: 0\n" {
+			t.Errorf("first event = %q; want data: 0", got)
+		}
+	}
+	waitFor(t, "2 subscribers", func() bool { return visitorHub.numSubscribers() == 2 })
+
+	handleRoot(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	for i, c := range clients {
+		if got := nextData(c); got != "data: 1\n" {
+			t.Errorf("client %d: event = %q; want data: 1", i, got)
+		}
+	}
+
+	clients[0].cancel()
+	waitFor(t, "the disconnected client's subscription to go", func() bool { return visitorHub.numSubscribers() == 1 })
+	handleRoot(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if got := nextData(clients[1]); got != "data: 2\n" {
+		t.Errorf("remaining client: event = %q; want data: 2", got)
+	}
+	clients[1].cancel()
+	waitFor(t, "no subscribers", func() bool { return visitorHub.numSubscribers() == 0 })
+}
+
+func TestEventsOutliveWriteTimeout(t *testing.T) {
+	defer func(c store.Counter, h *hub) { counter, visitorHub = c, h }(counter, visitorHub)
+	counter, visitorHub = new(store.Memory), new(hub)
+
+	ts := httptest.NewUnstartedServer(logRequests(slog.Default(), recoverPanics(metrics.InstrumentMux(newMux(logtail.NewRing(10))))))
+	ts.Config.WriteTimeout = 50 * time.Millisecond
+	ts.Start()
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	br := bufio.NewReader(res.Body)
+	if line, err := br.ReadString('\n'); err != nil || line != "data: 0\n" {
+		t.Fatalf("first event = %q, %v", line, err)
+	}
+	time.Sleep(3 * ts.Config.WriteTimeout)
+	handleRoot(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	br.ReadString('\n') // blank separator
+	if line, err := br.ReadString('\n'); err != nil || line != "data: 1\n" {
+		t.Errorf("event after the write timeout = %q, %v; want data: 1", line, err)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/errcode"
+	"github.com/bradfitz/talk-yapc-asia-2015/internal/jsonenc"
+	"github.com/bradfitz/talk-yapc-asia-2015/store"
+)
+
+// exportFlushEvery is how many elements an export writes between
+// flushes, so a client sees it arrive steadily.
+const exportFlushEvery = 256
+
+// An exportWriter streams a response one element at a time. Only the
+// element being encoded and the bufio buffer are held in memory,
+// however long the export.
+type exportWriter struct {
+	w   http.ResponseWriter
+	bw  *bufio.Writer
+	buf []byte
+	n   int // elements written
+}
+
+func newExportWriter(w http.ResponseWriter) *exportWriter {
+	return &exportWriter{w: w, bw: bufio.NewWriterSize(w, 32<<10)}
+}
+
+// add writes the element appendElem appends to its argument, along
+// with any separator.
+func (x *exportWriter) add(appendElem func(b []byte) []byte) error {
+	x.buf = appendElem(x.buf[:0])
+	x.n++
+	if _, err := x.bw.Write(x.buf); err != nil {
+		return err
+	}
+	if x.n%exportFlushEvery == 0 {
+		if err := x.bw.Flush(); err != nil {
+			return err
+		}
+		return http.NewResponseController(x.w).Flush()
+	}
+	return nil
+}
+
+// finish reports how an export ended. Once some of it has been
+// written, an error aborts the response, so a client can't take what
+// it got for the whole export. If the client went away, it's just
+// logged.
+func (x *exportWriter) finish(r *http.Request, what string, err error) {
+	if err == nil {
+		err = x.bw.Flush()
+	}
+	ctx := r.Context()
+	switch {
+	case err == nil:
+	case ctx.Err() != nil:
+		logger(ctx).Info(what+" abandoned by client", "sent", x.n)
+	case x.n == 0:
+		errcode.Write(x.w, fmt.Errorf("%w: %v", errcode.ErrBackendUnavailable, err))
+	default:
+		logger(ctx).Error(what+" failed", "err", err, "sent", x.n)
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// handleHistoryExport streams every upload the log holds, newest
+// first, as one JSON array, for logs too big for /history's 100.
+// If the client goes away, the walk stops at its next upload.
+func handleHistoryExport(w http.ResponseWriter, r *http.Request) {
+	walker, ok := uploads.(store.UploadWalker)
+	if !ok {
+		errcode.Write(w, fmt.Errorf("%w: upload log can't be exported", errcode.ErrBackendUnavailable))
+		return
+	}
+	liftWriteDeadline(w)
+	w.Header().Set("Content-Type", "application/json")
+	x := newExportWriter(w)
+	err := walker.Walk(r.Context(), func(u store.Upload) error {
+		return x.add(func(b []byte) []byte {
+			if x.n == 0 {
+				b = append(b, '[')
+			} else {
+				b = append(b, ',')
+			}
+			return appendUpload(b, u)
+		})
+	})
+	if err == nil {
+		if x.n == 0 {
+			x.bw.WriteByte('[')
+		}
+		x.bw.WriteString("]\n")
+	}
+	x.finish(r, "upload export", err)
+}
+
+func appendUpload(b []byte, u store.Upload) []byte {
+	b = append(b, `{"time":`...)
+	b = jsonenc.Time(b, u.Time)
+	b = append(b, `,"size":`...)
+	b = jsonenc.Int(b, u.Size)
+	if u.Alg != "" {
+		b = append(b, `,"alg":`...)
+		b = jsonenc.String(b, u.Alg)
+	}
+	b = append(b, `,"sum":`...)
+	b = jsonenc.String(b, u.Sum)
+	return append(b, '}')
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/store"
+)
+
+// walkWatcher counts the uploads its walks visit, and fails them
+// after failAfter if that's set.
+type walkWatcher struct {
+	*store.MemoryUploads
+	failAfter int64
+	visited   int64 // atomic
+}
+
+func (w *walkWatcher) Walk(ctx context.Context, fn func(store.Upload) error) error {
+	return w.MemoryUploads.Walk(ctx, func(u store.Upload) error {
+		if n := atomic.AddInt64(&w.visited, 1); w.failAfter > 0 && n > w.failAfter {
+			return errors.New("disk on fire")
+		}
+		return fn(u)
+	})
+}
+
+func fillUploads(n int) *store.MemoryUploads {
+	m := store.NewMemoryUploads(n)
+	for i := 1; i <= n; i++ {
+		m.Add(context.Background(), store.Upload{Time: time.Unix(int64(i), 0).UTC(), Size: int64(i), Sum: "x"})
+	}
+	return m
+}
+
+func TestHistoryExport(t *testing.T) {
+	defer func(u store.UploadLog) { uploads = u }(uploads)
+	for _, n := range []int{0, 1, 1000} {
+		uploads = fillUploads(n)
+		rw := httptest.NewRecorder()
+		handleHistoryExport(rw, httptest.NewRequest("GET", "/history/export", nil))
+		var got []store.Upload
+		if err := json.Unmarshal(rw.Body.Bytes(), &got); err != nil {
+			t.Fatalf("%d uploads: bad JSON: %v", n, err)
+		}
+		if len(got) != n {
+			t.Fatalf("exported %d uploads; want %d", len(got), n)
+		}
+		if n > 0 && (got[0].Size != int64(n) || got[n-1].Size != 1) {
+			t.Errorf("exported sizes %d..%d; want %d..1", got[0].Size, got[n-1].Size, n)
+		}
+	}
+}
+
+func TestHistoryExportClientGone(t *testing.T) {
+	defer func(u store.UploadLog) { uploads = u }(uploads)
+	const total = 200000
+	ww := &walkWatcher{MemoryUploads: fillUploads(total)}
+	uploads = ww
+	done := make(chan bool)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer close(done)
+		handleHistoryExport(w, r)
+	}))
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	head := make([]byte, 4096)
+	if _, err := io.ReadFull(res.Body, head); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(head), `[{"time":"1970-01-03T07:33:20Z","size":200000,`) {
+		t.Errorf("export starts %.60q", head)
+	}
+	res.Body.Close()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("handler still exporting after the client left")
+	}
+	if n := atomic.LoadInt64(&ww.visited); n >= total {
+		t.Errorf("walk visited all %d uploads; want it stopped early", n)
+	}
+}
+
+func TestHistoryExportBackendFails(t *testing.T) {
+	defer func(u store.UploadLog) { uploads = u }(uploads)
+	ts := httptest.NewServer(http.HandlerFunc(handleHistoryExport))
+	defer ts.Close()
+
+	// Failing after some uploads were sent cuts the response off, so
+	// the client can't mistake it for the whole log.
+	uploads = &walkWatcher{MemoryUploads: fillUploads(2000), failAfter: 1000}
+	res, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = io.ReadAll(res.Body)
+	res.Body.Close()
+	if err == nil {
+		t.Error("reading a failed export succeeded; want it cut off")
+	}
+
+	// Failing before any were sent is an ordinary error response.
+	uploads = failingWalker{}
+	rw := httptest.NewRecorder()
+	handleHistoryExport(rw, httptest.NewRequest("GET", "/history/export", nil))
+	if rw.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d; want 503", rw.Code)
+	}
+}
+
+type failingWalker struct{ failingUploads }
+
+func (failingWalker) Walk(context.Context, func(store.Upload) error) error {
+	return errors.New("disk on fire")
+}
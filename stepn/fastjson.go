@@ -0,0 +1,171 @@
+package main
+
+import (
+	"io"
+	"strconv"
+	"sync"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/internal/jsonenc"
+	"github.com/bradfitz/talk-yapc-asia-2015/metrics"
+)
+
+// A jsonAppender appends its JSON encoding to b, exactly as
+// encoding/json would write it. BenchmarkWriteJSON compares the two:
+// for a /stats body with one alert, about 230ns and one allocation (the
+// interface conversion) against 890ns and two for encoding/json.
+type jsonAppender interface {
+	appendJSON(b []byte) []byte
+}
+
+var jsonBufPool = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, 0, 256)
+		return &b
+	},
+}
+
+// maxPooledJSON keeps one huge batch response from pinning its
+// buffer in the pool.
+const maxPooledJSON = 64 << 10
+
+// writeAppended writes a's JSON and a newline, as json.Encoder does,
+// from a pooled buffer.
+func writeAppended(w io.Writer, a jsonAppender) {
+	bufp := jsonBufPool.Get().(*[]byte)
+	b := append(a.appendJSON((*bufp)[:0]), '\n')
+	w.Write(b)
+	if cap(b) <= maxPooledJSON {
+		*bufp = b
+		jsonBufPool.Put(bufp)
+	}
+}
+
+func (v rootJSON) appendJSON(b []byte) []byte {
+	b = append(b, `{"visitor":`...)
+	if v.Visitor == nil {
+		b = append(b, "null"...)
+	} else {
+		b = jsonenc.Int(b, *v.Visitor)
+	}
+	if v.Approximate {
+		b = append(b, `,"approximate":true`...)
+	}
+	if v.LastCounted != 0 {
+		b = append(b, `,"lastCounted":`...)
+		b = jsonenc.Int(b, v.LastCounted)
+	}
+	b = append(b, `,"yourVisits":`...)
+	b = jsonenc.Int(b, v.YourVisits)
+	return append(b, '}')
+}
+
+func (v visitV2) appendJSON(b []byte) []byte {
+	b = append(b, `{"number":`...)
+	if v.Number == nil {
+		b = append(b, "null"...)
+	} else {
+		b = jsonenc.Int(b, *v.Number)
+	}
+	if v.LastCounted != 0 {
+		b = append(b, `,"lastCounted":`...)
+		b = jsonenc.Int(b, v.LastCounted)
+	}
+	b = append(b, `,"yours":`...)
+	b = jsonenc.Int(b, v.Yours)
+	b = append(b, `,"tenant":`...)
+	b = jsonenc.String(b, v.Tenant)
+	b = append(b, `,"session":`...)
+	b = jsonenc.String(b, v.Session)
+	return append(b, '}')
+}
+
+func (s stats) appendJSON(b []byte) []byte {
+	b = append(b, `{"uptimeSeconds":`...)
+	b = jsonenc.Float(b, s.Uptime)
+	b = append(b, `,"visitors":`...)
+	b = jsonenc.Int(b, s.Visitors)
+	b = append(b, `,"inFlight":`...)
+	b = jsonenc.Int(b, s.InFlight)
+	b = append(b, `,"activeUploads":`...)
+	b = jsonenc.Int(b, s.ActiveUploads)
+	b = append(b, `,"dedupHits":`...)
+	b = jsonenc.Int(b, s.DedupHits)
+	b = append(b, `,"dedupMisses":`...)
+	b = jsonenc.Int(b, s.DedupMisses)
+	b = append(b, `,"alerts":`...)
+	if s.Alerts == nil {
+		b = append(b, "null"...)
+	} else {
+		b = append(b, '[')
+		for i, a := range s.Alerts {
+			if i > 0 {
+				b = append(b, ',')
+			}
+			b = appendAlert(b, a)
+		}
+		b = append(b, ']')
+	}
+	b = append(b, `,"routes":`...)
+	if s.Routes == nil {
+		b = append(b, "null"...)
+	} else {
+		b = append(b, '[')
+		for i, r := range s.Routes {
+			if i > 0 {
+				b = append(b, ',')
+			}
+			b = appendRouteSummary(b, r)
+		}
+		b = append(b, ']')
+	}
+	return append(b, '}')
+}
+
+func appendRouteSummary(b []byte, r metrics.RouteSummary) []byte {
+	b = append(b, `{"route":`...)
+	b = jsonenc.String(b, r.Route)
+	b = append(b, `,"requests":`...)
+	b = strconv.AppendUint(b, r.Requests, 10)
+	b = append(b, `,"p50":`...)
+	b = jsonenc.Float(b, r.P50)
+	b = append(b, `,"p95":`...)
+	b = jsonenc.Float(b, r.P95)
+	b = append(b, `,"p99":`...)
+	b = jsonenc.Float(b, r.P99)
+	return append(b, '}')
+}
+
+func appendAlert(b []byte, a metrics.Alert) []byte {
+	b = append(b, `{"slo":`...)
+	b = jsonenc.String(b, a.SLO)
+	b = append(b, `,"burnRate":`...)
+	b = jsonenc.Float(b, a.BurnRate)
+	b = append(b, `,"since":`...)
+	b = jsonenc.Time(b, a.Since)
+	return append(b, '}')
+}
+
+func (res batchJSON) appendJSON(b []byte) []byte {
+	b = append(b, `{"applied":`...)
+	b = jsonenc.Int(b, res.Applied)
+	b = append(b, `,"visitor":`...)
+	b = jsonenc.Int(b, res.Visitor)
+	b = append(b, `,"rejected":`...)
+	if res.Rejected == nil {
+		b = append(b, "null"...)
+	} else {
+		b = append(b, '[')
+		for i, r := range res.Rejected {
+			if i > 0 {
+				b = append(b, ',')
+			}
+			b = append(b, `{"index":`...)
+			b = jsonenc.Int(b, int64(r.Index))
+			b = append(b, `,"error":`...)
+			b = jsonenc.String(b, r.Error)
+			b = append(b, '}')
+		}
+		b = append(b, ']')
+	}
+	return append(b, '}')
+}
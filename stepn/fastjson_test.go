@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/internal/benchtest"
+	"github.com/bradfitz/talk-yapc-asia-2015/metrics"
+)
+
+func TestAppendJSONMatchesEncodingJSON(t *testing.T) {
+	n := int64(42)
+	since := time.Date(2015, 8, 22, 10, 0, 0, 500, time.UTC)
+	for _, v := range []jsonAppender{
+		rootJSON{Visitor: &n, YourVisits: 3},
+		rootJSON{Visitor: &n, Approximate: true, YourVisits: 2},
+		rootJSON{LastCounted: 41, YourVisits: 1},
+		visitV2{Number: &n, Yours: 3, Tenant: "example.com", Session: "0123456789abcdef0123456789abcdef"},
+		visitV2{LastCounted: 41, Yours: 1, Tenant: "<odd>"},
+		stats{Visitors: 42, InFlight: 2, ActiveUploads: 1, DedupHits: 9, DedupMisses: 3, Alerts: []metrics.Alert{}},
+		stats{Alerts: []metrics.Alert{{SLO: "latency", BurnRate: 14.4, Since: since}, {SLO: "<errors>", BurnRate: 1e-9}}},
+		stats{Uptime: 3600.25, Routes: []metrics.RouteSummary{{Route: "/", Requests: 7, P50: 0.00012, P95: 0.0009, P99: 0.25}}},
+		stats{},
+		batchJSON{Applied: 9, Visitor: 51, Rejected: []rejectedEvent{}},
+		batchJSON{Rejected: []rejectedEvent{{0, "count must be from 1 to 1000"}, {3, "time is in the \"future\""}}},
+	} {
+		var want bytes.Buffer
+		json.NewEncoder(&want).Encode(v)
+		var got bytes.Buffer
+		writeAppended(&got, v)
+		if got.String() != want.String() {
+			t.Errorf("%T:\n got %s\nwant %s", v, got.Bytes(), want.Bytes())
+		}
+	}
+}
+
+// BenchmarkWriteJSON compares encoding/json with the hand-written
+// appenders for the /stats body:
+//
+//	go test -run=^$ -bench=WriteJSON -benchmem
+func BenchmarkWriteJSON(b *testing.B) {
+	v := stats{Visitors: 123456, InFlight: 3, ActiveUploads: 1, Alerts: []metrics.Alert{
+		{SLO: "latency", BurnRate: 15.2, Since: time.Date(2015, 8, 22, 10, 0, 0, 0, time.UTC)},
+	}}
+	b.Run("EncodingJSON", func(b *testing.B) {
+		b.ReportAllocs()
+		for benchtest.Loop(b) {
+			json.NewEncoder(io.Discard).Encode(v)
+		}
+	})
+	b.Run("Appender", func(b *testing.B) {
+		b.ReportAllocs()
+		for benchtest.Loop(b) {
+			writeAppended(io.Discard, v)
+		}
+	})
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/binding"
+	"github.com/bradfitz/talk-yapc-asia-2015/errcode"
+	"github.com/bradfitz/talk-yapc-asia-2015/metrics"
+)
+
+var fetchResults = metrics.NewCounterVec("fetch_results_total", "Resources streamed by /fetch, by outcome: ok, mismatch, or error.", "result")
+
+// fetchClient is /fetch's outbound client. It has no overall Timeout,
+// which would cut off a large resource mid-stream; instead each step
+// before the body is bounded, and the body is bounded by the client's
+// own request, whose context the fetch uses. The body is relayed
+// byte for byte, so the Transport mustn't decompress it.
+var fetchClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   5 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		TLSHandshakeTimeout:   5 * time.Second,
+		ResponseHeaderTimeout: 10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   16,
+		IdleConnTimeout:       90 * time.Second,
+		DisableCompression:    true,
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 5 {
+			return errors.New("stopped after 5 redirects")
+		}
+		return checkFetchHost(req.URL)
+	},
+}
+
+// checkFetchHost returns an ErrForbidden unless u is an http or https
+// URL of a host in -fetchhosts. An entry matches either the whole
+// host:port or just the host.
+func checkFetchHost(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%w: can only fetch http and https URLs", errcode.ErrForbidden)
+	}
+	for _, h := range strings.Split(*fetchHosts, ",") {
+		if h = strings.TrimSpace(h); h != "" && (strings.EqualFold(h, u.Host) || strings.EqualFold(h, u.Hostname())) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: host %q isn't in -fetchhosts", errcode.ErrForbidden, u.Host)
+}
+
+var rxSHA1 = regexp.MustCompile(`^[0-9a-fA-F]{40}$`)
+
+// handleFetch streams the resource at ?url= to the client, hashing it
+// on the way through with a TeeReader, and checks it against ?sha1=.
+// The response has begun long before the last byte is hashed, so a
+// mismatch can't become an error status; instead the response is
+// aborted, and the client sees it cut short rather than complete.
+// There's no Content-Length, so even a mismatch in the last few bytes
+// leaves the response missing its end.
+func handleFetch(w http.ResponseWriter, r *http.Request) {
+	b := binding.New(r)
+	rawURL := r.FormValue("url")
+	u, err := url.Parse(rawURL)
+	b.Check("url", rawURL != "" && err == nil && u.IsAbs(), errors.New("must be an absolute URL"))
+	wantHex := b.Match("sha1", rxSHA1, errors.New("must be 40 hex digits"))
+	if err := b.Err(); err != nil {
+		errcode.Write(w, err)
+		return
+	}
+	if err := checkFetchHost(u); err != nil {
+		errcode.Write(w, err)
+		return
+	}
+	liftWriteDeadline(w)
+	want, _ := hex.DecodeString(wantHex)
+
+	ctx, endSpan := startSpan(r.Context(), "handleFetch")
+	defer endSpan(nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		errcode.Write(w, fmt.Errorf("%w: %v", errcode.ErrInvalidParams, err))
+		return
+	}
+	res, err := fetchClient.Do(req)
+	if err != nil {
+		fetchResults.Inc("error")
+		if errcode.Lookup(err) == errcode.ErrForbidden {
+			errcode.Write(w, err) // a redirect off the allowlist
+			return
+		}
+		errcode.Write(w, fmt.Errorf("%w: %v", errcode.ErrBadGateway, err))
+		return
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		fetchResults.Inc("error")
+		errcode.Write(w, fmt.Errorf("%w: %s returned %s", errcode.ErrBadGateway, u.Host, res.Status))
+		return
+	}
+	if ct := res.Header.Get("Content-Type"); ct != "" {
+		w.Header().Set("Content-Type", ct)
+	}
+	if r.Method == "HEAD" {
+		return
+	}
+
+	h := sha1.New()
+	bufp := getBuf(res.ContentLength)
+	defer putBuf(bufp)
+	n, err := io.CopyBuffer(w, io.TeeReader(res.Body, h), *bufp)
+	if err != nil {
+		fetchResults.Inc("error")
+		logger(ctx).Warn("fetch cut short", "url", u.Redacted(), "relayed", n, "err", err)
+		panic(http.ErrAbortHandler)
+	}
+	if got := h.Sum((*bufp)[:0]); !bytes.Equal(got, want) {
+		fetchResults.Inc("mismatch")
+		logger(ctx).Warn("fetched resource doesn't match its sha1", "url", u.Redacted(), "relayed", n, "want", wantHex, "got", fmt.Sprintf("%x", got))
+		panic(http.ErrAbortHandler)
+	}
+	fetchResults.Inc("ok")
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestFetch(t *testing.T) {
+	const body = "hello, world\n"
+	const sum = "cd50d19784897085a8d0e3e413f8612b097c03f1" // of body
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/hello":
+			w.Header().Set("Content-Type", "text/plain")
+			io.WriteString(w, body)
+		case "/moved":
+			http.Redirect(w, r, "/hello", http.StatusFound)
+		case "/away":
+			http.Redirect(w, r, "http://elsewhere.example/", http.StatusFound)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer upstream.Close()
+	defer func(h string) { *fetchHosts = h }(*fetchHosts)
+	*fetchHosts = "example.com, " + upstream.Listener.Addr().String()
+
+	ts := httptest.NewServer(recoverPanics(http.HandlerFunc(handleFetch)))
+	defer ts.Close()
+	// Without keep-alives, so a response cut short isn't retried on
+	// a new connection.
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+
+	for _, tt := range []struct {
+		name     string
+		url, sum string
+		code     int // 0 for a response cut short
+	}{
+		{"ok", upstream.URL + "/hello", sum, 200},
+		{"upper-case sum", upstream.URL + "/hello", strings.ToUpper(sum), 200},
+		{"redirect", upstream.URL + "/moved", sum, 200},
+		{"mismatch", upstream.URL + "/hello", strings.Repeat("0", 40), 0},
+		{"missing", upstream.URL + "/nope", sum, 502},
+		{"redirect off the list", upstream.URL + "/away", sum, 403},
+		{"host not on the list", "http://elsewhere.example/hello", sum, 403},
+		{"scheme", "file:///etc/passwd", sum, 403},
+		{"relative", "/hello", sum, 400},
+		{"bad sum", upstream.URL + "/hello", "abc", 400},
+	} {
+		before := fetchResults.Value("mismatch")
+		res, err := client.Get(ts.URL + "/fetch?" + url.Values{"url": {tt.url}, "sha1": {tt.sum}}.Encode())
+		var got []byte
+		if err == nil {
+			got, err = io.ReadAll(res.Body)
+			res.Body.Close()
+		}
+		if tt.code == 0 {
+			if err == nil {
+				t.Errorf("%s: got a whole %d response; want it cut short", tt.name, res.StatusCode)
+			}
+			if d := fetchResults.Value("mismatch") - before; d != 1 {
+				t.Errorf("%s: fetch_results_total{result=mismatch} went up by %v; want 1", tt.name, d)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if res.StatusCode != tt.code {
+			t.Errorf("%s: status %d; want %d: %s", tt.name, res.StatusCode, tt.code, got)
+			continue
+		}
+		if tt.code == 200 {
+			if string(got) != body {
+				t.Errorf("%s: body %q; want %q", tt.name, got, body)
+			}
+			if ct := res.Header.Get("Content-Type"); ct != "text/plain" {
+				t.Errorf("%s: Content-Type %q; want the upstream's text/plain", tt.name, ct)
+			}
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/binding"
+	"github.com/bradfitz/talk-yapc-asia-2015/errcode"
+	"github.com/bradfitz/talk-yapc-asia-2015/metrics"
+)
+
+var fileServes = metrics.NewCounterVec("file_serves_total", "Responses from /file, by how they were written: servecontent or naive.", "via")
+
+// handleFile serves a generated file of -filesize bytes two ways. By
+// default it's http.ServeContent from an *os.File, with ranges and
+// conditional requests, and the body goes out through the
+// ResponseWriter's ReadFrom, which on Linux is sendfile: the bytes
+// never leave the kernel. With ?naive=1 it's io.Copy into the
+// ResponseWriter with ReadFrom hidden, as a handler copying through
+// some wrapper ends up doing: every byte is read into a buffer and
+// written back out, and there are no ranges. BenchmarkFile compares
+// the two.
+func handleFile(w http.ResponseWriter, r *http.Request) {
+	b := binding.New(r)
+	naive := b.Int("naive", 0, 0, 1) == 1
+	if err := b.Err(); err != nil {
+		errcode.Write(w, err)
+		return
+	}
+	if *fileSize <= 0 {
+		http.NotFound(w, r)
+		return
+	}
+	liftWriteDeadline(w)
+	path, err := generatedFile(*fileSize)
+	if err != nil {
+		errcode.Write(w, err)
+		return
+	}
+	// Opened per request, as each needs its own offset.
+	f, err := os.Open(path)
+	if err != nil {
+		errcode.Write(w, err)
+		return
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		errcode.Write(w, err)
+		return
+	}
+	if !naive {
+		fileServes.Inc("servecontent")
+		http.ServeContent(w, r, "file.bin", fi.ModTime(), f)
+		return
+	}
+	fileServes.Inc("naive")
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", fmt.Sprint(fi.Size()))
+	if r.Method == "HEAD" {
+		return
+	}
+	io.Copy(struct{ io.Writer }{w}, struct{ io.Reader }{f})
+}
+
+// generatedFiles are the files generatedFile has made, by size, in
+// dir.
+var generatedFiles struct {
+	sync.Mutex
+	dir   string
+	paths map[int64]string
+}
+
+// generatedFile returns the path of a file of size bytes for /file,
+// making it the first time it's asked for. The file is kept in
+// generatedDir, and a later run that finds it there uses it as is, so
+// a restart doesn't write it all again.
+func generatedFile(size int64) (string, error) {
+	generatedFiles.Lock()
+	defer generatedFiles.Unlock()
+	if path, ok := generatedFiles.paths[size]; ok {
+		return path, nil
+	}
+	if generatedFiles.dir == "" {
+		dir, err := generatedDir()
+		if err != nil {
+			return "", err
+		}
+		generatedFiles.dir = dir
+	}
+	path := filepath.Join(generatedFiles.dir, fmt.Sprintf("file-%d.bin", size))
+	if fi, err := os.Stat(path); err != nil || fi.Size() != size {
+		if err := writeGenerated(path, size); err != nil {
+			return "", err
+		}
+	}
+	if generatedFiles.paths == nil {
+		generatedFiles.paths = make(map[int64]string)
+	}
+	generatedFiles.paths[size] = path
+	return path, nil
+}
+
+// generatedDir returns a directory for generated files that only this
+// user can write to, so no one else can plant a file of the right
+// size for /file to serve: stepn's in the user's cache directory, or
+// failing that, a new temporary directory.
+func generatedDir() (string, error) {
+	if cache, err := os.UserCacheDir(); err == nil {
+		dir := filepath.Join(cache, "stepn")
+		if err := os.MkdirAll(dir, 0700); err == nil {
+			return dir, nil
+		}
+	}
+	return os.MkdirTemp("", "stepn-file-")
+}
+
+// writeGenerated writes size bytes of fileByte to path, through a
+// temporary file, so a run interrupted part way doesn't leave a short
+// file for the next to find.
+func writeGenerated(path string, size int64) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	bw := bufio.NewWriter(tmp)
+	for i := int64(0); i < size; i++ {
+		bw.WriteByte(fileByte(i))
+	}
+	if err := bw.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// fileByte returns the byte at offset i of a generated file. The
+// pattern's period is prime, so a range read from the wrong offset
+// is unlikely to look right.
+func fileByte(i int64) byte {
+	return byte(i % 251)
+}
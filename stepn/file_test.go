@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/internal/benchtest"
+	"github.com/bradfitz/talk-yapc-asia-2015/logtail"
+	"github.com/bradfitz/talk-yapc-asia-2015/metrics"
+)
+
+func TestFile(t *testing.T) {
+	defer func(size int64) { *fileSize = size }(*fileSize)
+	*fileSize = 100 << 10
+	want := make([]byte, *fileSize)
+	for i := range want {
+		want[i] = fileByte(int64(i))
+	}
+	ts := httptest.NewServer(http.HandlerFunc(handleFile))
+	defer ts.Close()
+
+	res, err := ts.Client().Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	lastModified := res.Header.Get("Last-Modified")
+	modTime, err := http.ParseTime(lastModified)
+	if err != nil {
+		t.Fatalf("Last-Modified %q: %v", lastModified, err)
+	}
+
+	for _, tt := range []struct {
+		name, query string
+		header      http.Header
+		code        int
+		want        []byte
+	}{
+		{"whole", "", nil, 200, want},
+		{"range", "", http.Header{"Range": {"bytes=1000-1999"}}, 206, want[1000:2000]},
+		{"suffix range", "", http.Header{"Range": {"bytes=-10"}}, 206, want[len(want)-10:]},
+		{"unsatisfiable range", "", http.Header{"Range": {"bytes=200000-"}}, 416, nil},
+		{"not modified", "", http.Header{"If-Modified-Since": {lastModified}}, 304, nil},
+		{"modified since", "", http.Header{"If-Modified-Since": {modTime.Add(-time.Hour).UTC().Format(http.TimeFormat)}}, 200, want},
+		{"naive", "?naive=1", nil, 200, want},
+		{"naive ignores range", "?naive=1", http.Header{"Range": {"bytes=1000-1999"}}, 200, want},
+		{"bad naive", "?naive=yes", nil, 400, nil},
+	} {
+		req, _ := http.NewRequest("GET", ts.URL+tt.query, nil)
+		for k, v := range tt.header {
+			req.Header[k] = v
+		}
+		res, err := ts.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+		if res.StatusCode != tt.code {
+			t.Errorf("%s: status %d; want %d", tt.name, res.StatusCode, tt.code)
+			continue
+		}
+		if tt.code < 300 && !bytes.Equal(got, tt.want) {
+			t.Errorf("%s: got %d bytes; want %d", tt.name, len(got), len(tt.want))
+		}
+	}
+
+	*fileSize = 0
+	if res, err := ts.Client().Get(ts.URL); err != nil || res.StatusCode != 404 {
+		t.Errorf("with -filesize=0, GET = %v, %v; want a 404", res, err)
+	}
+}
+
+// publicHandler returns the public listener's handler, as runServe
+// puts it behind publicPipeline, with its request log discarded.
+func publicHandler() http.Handler {
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	return publicPipeline(nil).then(metrics.InstrumentMux(newMux(logtail.NewRing(10))))
+}
+
+// A readFromRecorder is a ResponseRecorder with a ReadFrom, as
+// net/http's ResponseWriter has, that keeps what it was handed.
+type readFromRecorder struct {
+	*httptest.ResponseRecorder
+	src io.Reader
+}
+
+func (rw *readFromRecorder) ReadFrom(src io.Reader) (int64, error) {
+	rw.src = src
+	return io.Copy(struct{ io.Writer }{rw.ResponseRecorder}, src)
+}
+
+// TestSendfileThroughPipeline checks that the bodies of /file and
+// /blob/ reach the ResponseWriter's ReadFrom as files, which net/http
+// can sendfile, through every stage of the public pipeline, gzip
+// included.
+func TestSendfileThroughPipeline(t *testing.T) {
+	defer func(size int64) { *fileSize = size }(*fileSize)
+	*fileSize = 100 << 10
+	blobFixture(t, 0, map[string]int{"f": 100 << 10})
+	h := publicHandler()
+
+	for _, tt := range []struct {
+		path, rng string
+		code      int
+		size      int
+		sendfile  bool
+	}{
+		{"/file", "", 200, 100 << 10, true},
+		{"/file", "bytes=1000-1999", 206, 1000, true},
+		{"/blob/f", "", 200, 100 << 10, true},
+		{"/file?naive=1", "", 200, 100 << 10, false},
+	} {
+		req := httptest.NewRequest("GET", tt.path, nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		if tt.rng != "" {
+			req.Header.Set("Range", tt.rng)
+		}
+		rw := &readFromRecorder{ResponseRecorder: httptest.NewRecorder()}
+		h.ServeHTTP(rw, req)
+		if rw.Code != tt.code || rw.Body.Len() != tt.size || rw.Header().Get("Content-Encoding") != "" {
+			t.Errorf("GET %s %s = %d, %d bytes, Content-Encoding %q; want %d, %d bytes, plain",
+				tt.path, tt.rng, rw.Code, rw.Body.Len(), rw.Header().Get("Content-Encoding"), tt.code, tt.size)
+		}
+		if rw.Header().Get("Cache-Control") == "" || rw.Header().Get("X-Request-ID") == "" {
+			t.Errorf("GET %s %s: headers %v missing the pipeline's", tt.path, tt.rng, rw.Header())
+		}
+		src := rw.src
+		if lr, ok := src.(*io.LimitedReader); ok {
+			src = lr.R
+		}
+		if _, isFile := src.(*os.File); isFile != tt.sendfile {
+			t.Errorf("GET %s %s: ReadFrom got %T; want a file: %v", tt.path, tt.rng, rw.src, tt.sendfile)
+		}
+	}
+}
+
+// BenchmarkFile compares serving the generated file with
+// http.ServeContent, which on Linux writes it with sendfile, and with
+// ?naive=1, copying it through a buffer, over loopback, through the
+// public listener's whole pipeline:
+//
+//	go test -run=^$ -bench=File -benchmem ./stepn
+func BenchmarkFile(b *testing.B) {
+	defer func(size int64) { *fileSize = size }(*fileSize)
+	for _, size := range []int64{64 << 10, 4 << 20, 64 << 20} {
+		*fileSize = size
+		for _, via := range []string{"ServeContent", "Naive"} {
+			b.Run(via+"/"+strconv.FormatInt(size, 10), func(b *testing.B) {
+				url := "/file"
+				if via == "Naive" {
+					url += "?naive=1"
+				}
+				ts := httptest.NewServer(publicHandler())
+				defer ts.Close()
+				if _, err := generatedFile(size); err != nil {
+					b.Fatal(err)
+				}
+				b.SetBytes(size)
+				b.ReportAllocs()
+				for benchtest.Loop(b) {
+					res, err := ts.Client().Get(ts.URL + url)
+					if err != nil {
+						b.Fatal(err)
+					}
+					io.Copy(io.Discard, res.Body)
+					res.Body.Close()
+				}
+			})
+		}
+	}
+}
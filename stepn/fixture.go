@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"encoding"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/fixture"
+	"github.com/bradfitz/talk-yapc-asia-2015/merkle"
+	"github.com/bradfitz/talk-yapc-asia-2015/resumable"
+	"github.com/bradfitz/talk-yapc-asia-2015/store"
+)
+
+// loadFixture starts the server from the state in the fixture file at
+// path: it sets the visitor count, adds the uploads to the history,
+// restores the resumable uploads with their chunks hashed as if
+// they'd been sent, and writes the blobs into -blobdir, or a new
+// temporary directory if there's none. A file already in -blobdir is
+// never overwritten: one with a blob's name must hold that blob.
+//
+// The caller calls cleanup on shutdown, to remove the temporary
+// directory, if any. On an error, loadFixture has removed it already.
+func loadFixture(path string) (cleanup func(), err error) {
+	cleanup = func() {}
+	defer func() {
+		if err != nil {
+			cleanup()
+		}
+	}()
+	f, err := os.Open(path)
+	if err != nil {
+		return cleanup, err
+	}
+	fx, err := fixture.Read(f)
+	f.Close()
+	if err != nil {
+		return cleanup, fmt.Errorf("%s: %v", path, err)
+	}
+
+	ctx := context.Background()
+	sw, ok := counter.(store.Swapper)
+	if !ok {
+		return cleanup, fmt.Errorf("-fixture: counter backend %T can't be set", counter)
+	}
+	if _, err := sw.Swap(ctx, fx.Visitors); err != nil {
+		return cleanup, fmt.Errorf("-fixture: setting visitor count: %v", err)
+	}
+	atomic.StoreInt64(&lastVisitNum, fx.Visitors)
+	for _, u := range fx.Uploads {
+		if err := uploads.Add(ctx, u); err != nil {
+			return cleanup, fmt.Errorf("-fixture: adding upload: %v", err)
+		}
+	}
+	for _, fs := range fx.Sessions {
+		s, err := restoreSession(fs)
+		if err != nil {
+			return cleanup, fmt.Errorf("-fixture: session %s: %v", fs.ID, err)
+		}
+		resumables.Restore(s)
+	}
+	if len(fx.Blobs) > 0 {
+		if *blobDir == "" {
+			dir, err := os.MkdirTemp("", "stepn-fixture-")
+			if err != nil {
+				return cleanup, err
+			}
+			*blobDir = dir
+			cleanup = func() { os.RemoveAll(dir) }
+		}
+		for _, b := range fx.Blobs {
+			if err := writeBlob(*blobDir, b.Name, b.Data); err != nil {
+				return cleanup, fmt.Errorf("-fixture: %v", err)
+			}
+		}
+	}
+	log.Printf("Loaded fixture %s: %d visitors, %d uploads, %d resumable uploads, %d blobs in %s",
+		path, fx.Visitors, len(fx.Uploads), len(fx.Sessions), len(fx.Blobs), *blobDir)
+	return cleanup, nil
+}
+
+// writeBlob writes data to a new file name in dir, which fixture.Read
+// has checked is a plain file name. If the file is there already, it
+// must hold data; it's left as it is.
+func writeBlob(dir, name, data string) error {
+	path := filepath.Join(dir, name)
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if errors.Is(err, fs.ErrExist) {
+		old, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if string(old) != data {
+			return fmt.Errorf("%s already exists, and isn't the fixture's blob; not overwriting it", path)
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(f, data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// restoreSession returns the resumable session fs describes, with
+// its chunks hashed into its state and leaves as handleResumableChunk
+// would have.
+func restoreSession(fs fixture.Session) (resumable.Session, error) {
+	newHash, ok := hashes[fs.Alg]
+	if !ok {
+		return resumable.Session{}, fmt.Errorf("alg must be one of %s", hashNames())
+	}
+	h := newHash()
+	m, ok := h.(encoding.BinaryMarshaler)
+	if !ok {
+		return resumable.Session{}, fmt.Errorf("%s uploads can't be resumed", fs.Alg)
+	}
+	s := resumable.Session{ID: fs.ID, Alg: fs.Alg, Total: fs.Total}
+	for _, c := range fs.Chunks {
+		h.Write([]byte(c))
+		leaf := merkle.Leaf([]byte(c))
+		s.Chunks = append(s.Chunks, resumable.Chunk{Offset: s.Offset, Size: int64(len(c)), Leaf: leaf})
+		s.Tree = s.Tree.Append(leaf)
+		s.Offset += int64(len(c))
+	}
+	var err error
+	s.State, err = m.MarshalBinary()
+	return s, err
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/fixture"
+	"github.com/bradfitz/talk-yapc-asia-2015/logtail"
+	"github.com/bradfitz/talk-yapc-asia-2015/resumable"
+	"github.com/bradfitz/talk-yapc-asia-2015/store"
+)
+
+// TestLoadFixture loads the workshop fixture and checks that the
+// server's state reads back as the fixture: the count, the history,
+// the resumable uploads, which finish with the whole upload's sum, and
+// the blobs.
+func TestLoadFixture(t *testing.T) {
+	defer func(c store.Counter, u store.UploadLog, rs *resumable.Store, dir string, last int64) {
+		counter, uploads, resumables, *blobDir = c, u, rs, dir
+		atomic.StoreInt64(&lastVisitNum, last)
+	}(counter, uploads, resumables, *blobDir, atomic.LoadInt64(&lastVisitNum))
+	counter, uploads, resumables = new(store.Memory), store.NewMemoryUploads(100), new(resumable.Store)
+	*blobDir = t.TempDir()
+
+	want := fixture.Generate(fixture.Workshop)
+	path := filepath.Join(t.TempDir(), "workshop.json")
+	out, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := want.Write(out); err != nil {
+		t.Fatal(err)
+	}
+	out.Close()
+	cleanup, err := loadFixture(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	ctx := context.Background()
+	if n, _ := counter.Load(ctx); n != want.Visitors || atomic.LoadInt64(&lastVisitNum) != want.Visitors {
+		t.Errorf("visitor count %d, last seen %d; want %d", n, atomic.LoadInt64(&lastVisitNum), want.Visitors)
+	}
+	recent, _ := uploads.Recent(ctx, 100)
+	var history []store.Upload
+	for i := len(recent) - 1; i >= 0; i-- {
+		history = append(history, recent[i])
+	}
+	if !reflect.DeepEqual(history, want.Uploads) {
+		t.Errorf("upload history, oldest first = %+v; want %+v", history, want.Uploads)
+	}
+
+	mux := newMux(logtail.NewRing(10))
+	for _, s := range want.Sessions {
+		rw := httptest.NewRecorder()
+		mux.ServeHTTP(rw, httptest.NewRequest("GET", "/upload/resumable/"+s.ID, nil))
+		if got, want := rw.Header().Get("Range"), fmt.Sprintf("bytes=0-%d", s.Received()-1); got != want {
+			t.Errorf("session %s: Range %q; want %q", s.ID, got, want)
+		}
+
+		// Finish it; the sum covers the fixture's chunks too.
+		last := strings.Repeat("z", int(s.Total-s.Received()))
+		req := httptest.NewRequest("PUT", "/upload/resumable/"+s.ID, strings.NewReader(last))
+		req.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", s.Received(), s.Total-1, s.Total))
+		rw = httptest.NewRecorder()
+		mux.ServeHTTP(rw, req)
+		whole := []byte(strings.Join(s.Chunks, "") + last)
+		sum := fmt.Sprintf("%x", sha1.Sum(whole))
+		if s.Alg == "sha256" {
+			sum = fmt.Sprintf("%x", sha256.Sum256(whole))
+		}
+		if got, want := rw.Body.String(), fmt.Sprintf("%s = %s in %d bytes", s.Alg, sum, s.Total); got != want {
+			t.Errorf("session %s: last chunk got %d %q; want %q", s.ID, rw.Code, got, want)
+		}
+	}
+
+	for _, b := range want.Blobs {
+		rw := httptest.NewRecorder()
+		mux.ServeHTTP(rw, httptest.NewRequest("GET", "/blob/"+b.Name, nil))
+		if rw.Code != 200 || rw.Body.String() != b.Data {
+			t.Errorf("/blob/%s = %d, %d bytes; want the fixture's %d", b.Name, rw.Code, rw.Body.Len(), len(b.Data))
+		}
+	}
+}
+
+// TestLoadFixtureBlobDir checks that loading a fixture leaves files
+// already in -blobdir alone, and that without one, cleanup removes
+// the temporary directory its blobs went in.
+func TestLoadFixtureBlobDir(t *testing.T) {
+	defer func(c store.Counter, u store.UploadLog, dir string, last int64) {
+		counter, uploads, *blobDir = c, u, dir
+		atomic.StoreInt64(&lastVisitNum, last)
+	}(counter, uploads, *blobDir, atomic.LoadInt64(&lastVisitNum))
+	counter, uploads = new(store.Memory), store.NewMemoryUploads(100)
+	fx := &fixture.Fixture{Blobs: []fixture.Blob{{Name: "a.txt", Data: "fixture"}}}
+	path := filepath.Join(t.TempDir(), "fixture.json")
+	out, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fx.Write(out); err != nil {
+		t.Fatal(err)
+	}
+	out.Close()
+
+	*blobDir = t.TempDir()
+	existing := filepath.Join(*blobDir, "a.txt")
+	os.WriteFile(existing, []byte("mine"), 0644)
+	if _, err := loadFixture(path); err == nil {
+		t.Error("loading over a different a.txt succeeded")
+	}
+	if b, _ := os.ReadFile(existing); string(b) != "mine" {
+		t.Errorf("a.txt = %q after loading; want it left as it was", b)
+	}
+	os.WriteFile(existing, []byte("fixture"), 0644)
+	if _, err := loadFixture(path); err != nil {
+		t.Errorf("loading over the same a.txt: %v", err)
+	}
+
+	*blobDir = ""
+	cleanup, err := loadFixture(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := *blobDir
+	if b, err := os.ReadFile(filepath.Join(dir, "a.txt")); err != nil || string(b) != "fixture" {
+		t.Fatalf("temporary blob dir's a.txt = %q, %v", b, err)
+	}
+	cleanup()
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("after cleanup, %s: %v; want it gone", dir, err)
+	}
+}
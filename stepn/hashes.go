@@ -0,0 +1,44 @@
+package main
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"hash"
+	"hash/crc32"
+	"sort"
+	"strings"
+)
+
+// hashes are the digests a PUT to /upload can ask for with ?alg=, by
+// name. sha1 is the default, as it was before there was a choice.
+// crc32 is no digest, but a cheap check against accidents.
+// Plugins add to it with registerHash; see plugin_blake2b.go.
+var hashes = map[string]func() hash.Hash{
+	"crc32":  func() hash.Hash { return crc32.NewIEEE() },
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+const defaultHash = "sha1"
+
+// registerHash makes newHash available to uploads as ?alg=name. It's
+// for plugins' init funcs, and isn't safe once the server is running.
+func registerHash(name string, newHash func() hash.Hash) {
+	if _, dup := hashes[name]; dup {
+		panic("duplicate hash " + name)
+	}
+	hashes[name] = newHash
+}
+
+// hashNames returns the names of the registered hashes, sorted and
+// joined for an error message.
+func hashNames() string {
+	names := make([]string, 0, len(hashes))
+	for name := range hashes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
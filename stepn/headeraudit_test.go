@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/gziphttp"
+	"github.com/bradfitz/talk-yapc-asia-2015/logtail"
+	"github.com/bradfitz/talk-yapc-asia-2015/metrics"
+	"github.com/bradfitz/talk-yapc-asia-2015/store"
+)
+
+// TestHeaderPolicy requests every endpoint on both listeners with
+// -headeraudit=fail and checks that none violates headerPolicy.
+func TestHeaderPolicy(t *testing.T) {
+	defer func(c store.Counter, u store.UploadLog, a string) {
+		counter, uploads, *headerAudit = c, u, a
+	}(counter, uploads, *headerAudit)
+	counter, uploads = new(store.Memory), store.NewMemoryUploads(100)
+	*headerAudit = "fail"
+
+	public := httptest.NewServer(new(gziphttp.Compressor).Wrap(secureHeaders(recoverPanics(metrics.InstrumentMux(newMux(logtail.NewRing(100)))))))
+	defer public.Close()
+	admin := httptest.NewServer(secureHeaders(adminHandler()))
+	defer admin.Close()
+
+	for _, tt := range []struct {
+		base         *httptest.Server
+		method, path string
+		body         string
+	}{
+		{public, "GET", "/", ""},
+		{public, "GET", "/?format=json", ""},
+		{public, "GET", "/?id=x", ""},
+		{public, "POST", "/", ""},
+		{public, "GET", "/no/such/page", ""},
+		{public, "GET", "/v1/visit", ""},
+		{public, "GET", "/v2/visit", ""},
+		{public, "PUT", "/upload", "hello"},
+		{public, "GET", "/upload", ""},
+		{public, "POST", "/upload/multipart", ""},
+		{public, "POST", "/upload/resumable", ""},
+		{public, "GET", "/upload/resumable/nope", ""},
+		{public, "GET", "/history", ""},
+		{public, "GET", "/history?n=0", ""},
+		{public, "POST", "/visits/batch", `[{"n":1}]`},
+		{public, "GET", "/stats", ""},
+		{public, "GET", "/version", ""},
+		{public, "GET", "/live", ""},
+		{public, "GET", "/events", ""},
+		{public, "GET", "/history/export", ""},
+		{public, "GET", "/export/events.ndjson", ""},
+		{public, "GET", "/debug/logtail", ""},
+		{public, "GET", "/blob/nope", ""},
+		{public, "GET", "/fetch?url=http://example.com/&sha1=da39a3ee5e6b4b0d3255bfef95601890afd80709", ""},
+		{public, "HEAD", "/file", ""},
+		{public, "GET", "/file?naive=2", ""},
+		{public, "GET", "/openapi.json", ""},
+		{public, "GET", "/metrics", ""},
+		{admin, "GET", "/debug/pprof/", ""},
+		{admin, "GET", "/debug/pprof/cmdline", ""},
+		{admin, "GET", "/debug/pprof/goroutine?debug=1", ""},
+		{admin, "GET", "/stats", ""},
+		{admin, "GET", "/debug/vars", ""},
+		{admin, "GET", "/debug/routes", ""},
+		{admin, "GET", "/admin/reset", ""},
+	} {
+		// Streams never end, so each request is canceled once its
+		// headers are in. Only a violation's body matters.
+		ctx, cancel := context.WithCancel(context.Background())
+		req, err := http.NewRequestWithContext(ctx, tt.method, tt.base.URL+tt.path, strings.NewReader(tt.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Accept-Encoding", "gzip")
+		res, err := http.DefaultTransport.RoundTrip(req)
+		if err != nil {
+			cancel()
+			t.Errorf("%s %s: %v", tt.method, tt.path, err)
+			continue
+		}
+		if res.StatusCode == http.StatusInternalServerError {
+			slurp, _ := io.ReadAll(res.Body)
+			if strings.Contains(string(slurp), "violate policy") {
+				t.Errorf("%s %s: %s", tt.method, tt.path, slurp)
+			}
+		}
+		cancel()
+		res.Body.Close()
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/websocket"
+)
+
+// A hub fans visitor counts out to live subscribers.
+//
+// Each subscriber has a one-slot channel. Only the newest count
+// matters, so publish never blocks on a slow subscriber: it replaces
+// whatever count the subscriber hasn't picked up yet.
+type hub struct {
+	mu   sync.Mutex
+	subs map[chan int64]bool
+	last int64
+}
+
+var visitorHub = new(hub)
+
+// subscribe returns a channel of counts, primed with the latest one,
+// and a func to unsubscribe. The channel is never closed.
+func (h *hub) subscribe() (<-chan int64, func()) {
+	ch := make(chan int64, 1)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subs == nil {
+		h.subs = make(map[chan int64]bool)
+	}
+	h.subs[ch] = true
+	ch <- h.last
+	return ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		delete(h.subs, ch)
+	}
+}
+
+func (h *hub) publish(n int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if n <= h.last {
+		return // an older count that lost a race; don't go backwards
+	}
+	h.last = n
+	h.sendLocked(n)
+}
+
+// reset sets the count back to zero and sends that to subscribers,
+// for /admin/reset: publish alone would drop it as stale.
+func (h *hub) reset() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.last = 0
+	h.sendLocked(0)
+}
+
+// sendLocked replaces any count subscribers have yet to receive with
+// n. h.mu must be held.
+func (h *hub) sendLocked(n int64) {
+	for ch := range h.subs {
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- n
+	}
+}
+
+func (h *hub) numSubscribers() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subs)
+}
+
+// handleLive upgrades to a WebSocket and sends the visitor count as a
+// text message each time it changes, until the client goes away or
+// the request's context is done.
+func handleLive(w http.ResponseWriter, r *http.Request) {
+	c, err := websocket.Upgrade(w, r)
+	if err != nil {
+		return
+	}
+	defer c.Close()
+	counts, unsubscribe := visitorHub.subscribe()
+	defer unsubscribe()
+
+	// The client sends nothing but control frames; reading is how we
+	// notice it closing or vanishing.
+	gone := make(chan struct{})
+	go func() {
+		defer close(gone)
+		for {
+			if _, err := c.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+	for {
+		select {
+		case n := <-counts:
+			if err := c.WriteText(strconv.FormatInt(n, 10)); err != nil {
+				return
+			}
+		case <-gone:
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
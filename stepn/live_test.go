@@ -0,0 +1,84 @@
+package main
+
+import (
+	"log/slog"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/logtail"
+	"github.com/bradfitz/talk-yapc-asia-2015/metrics"
+	"github.com/bradfitz/talk-yapc-asia-2015/store"
+	"github.com/bradfitz/talk-yapc-asia-2015/websocket"
+)
+
+func TestHubKeepsLatest(t *testing.T) {
+	h := new(hub)
+	counts, unsubscribe := h.subscribe()
+	defer unsubscribe()
+	if n := <-counts; n != 0 {
+		t.Errorf("primed count = %d; want 0", n)
+	}
+	for i := int64(1); i <= 5; i++ {
+		h.publish(i)
+	}
+	h.publish(3) // stale
+	if n := <-counts; n != 5 {
+		t.Errorf("slow subscriber got %d; want only the latest, 5", n)
+	}
+	select {
+	case n := <-counts:
+		t.Errorf("got extra count %d", n)
+	default:
+	}
+}
+
+// waitFor polls cond for up to a second.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); !cond(); {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestLive(t *testing.T) {
+	defer func(c store.Counter, h *hub) { counter, visitorHub = c, h }(counter, visitorHub)
+	counter, visitorHub = new(store.Memory), new(hub)
+
+	// Through the same wrappers as main, which must let the hijack by.
+	ts := httptest.NewServer(logRequests(slog.Default(), recoverPanics(metrics.InstrumentMux(newMux(logtail.NewRing(10))))))
+	defer ts.Close()
+	wsURL := "ws" + strings.TrimPrefix(ts.URL, "http") + "/live"
+
+	var clients []*websocket.Conn
+	for i := 0; i < 3; i++ {
+		c, err := websocket.Dial(wsURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		clients = append(clients, c)
+		if msg, err := c.ReadMessage(); err != nil || msg != "0" {
+			t.Fatalf("first message = %q, %v; want 0", msg, err)
+		}
+	}
+	waitFor(t, "3 subscribers", func() bool { return visitorHub.numSubscribers() == 3 })
+
+	for want := 1; want <= 2; want++ {
+		handleRoot(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+		for i, c := range clients {
+			if msg, err := c.ReadMessage(); err != nil || msg != strconv.Itoa(want) {
+				t.Errorf("client %d got %q, %v; want %d", i, msg, err, want)
+			}
+		}
+	}
+
+	for _, c := range clients {
+		c.Close()
+	}
+	waitFor(t, "subscribers to go away", func() bool { return visitorHub.numSubscribers() == 0 })
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/config"
+)
+
+// A loadResult is what a loadgen run saw.
+type loadResult struct {
+	Elapsed   time.Duration
+	Latencies []time.Duration // of requests that got a response, sorted
+	Statuses  map[int]int
+	Errors    int
+}
+
+// newLoadClient returns a client for loadgen that keeps a connection
+// per goroutine.
+func newLoadClient(c int) *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{MaxIdleConnsPerHost: c},
+		Timeout:   time.Minute,
+	}
+}
+
+// loadgen sends requests to url with client from c goroutines for d.
+// Each request has a body of size bytes, if size is positive.
+func loadgen(client *http.Client, url, method string, size int64, c int, d time.Duration) *loadResult {
+	body := bytes.Repeat([]byte("a"), int(size))
+	res := &loadResult{Statuses: map[int]int{}}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	t0 := time.Now()
+	deadline := t0.Add(d)
+	for i := 0; i < c; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var lat []time.Duration
+			statuses := map[int]int{}
+			errs := 0
+			for time.Now().Before(deadline) {
+				req, err := http.NewRequest(method, url, bytes.NewReader(body))
+				if err != nil {
+					errs++
+					break
+				}
+				start := time.Now()
+				r, err := client.Do(req)
+				if err != nil {
+					errs++
+					continue
+				}
+				io.Copy(io.Discard, r.Body)
+				r.Body.Close()
+				lat = append(lat, time.Since(start))
+				statuses[r.StatusCode]++
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			res.Latencies = append(res.Latencies, lat...)
+			for code, n := range statuses {
+				res.Statuses[code] += n
+			}
+			res.Errors += errs
+		}()
+	}
+	wg.Wait()
+	res.Elapsed = time.Since(t0)
+	sort.Slice(res.Latencies, func(i, j int) bool { return res.Latencies[i] < res.Latencies[j] })
+	return res
+}
+
+// percentile returns the latency p percent of responses were at least
+// as fast as.
+func (r *loadResult) percentile(p float64) time.Duration {
+	if len(r.Latencies) == 0 {
+		return 0
+	}
+	i := int(float64(len(r.Latencies))*p/100+0.5) - 1
+	if i < 0 {
+		i = 0
+	}
+	return r.Latencies[i]
+}
+
+func (r *loadResult) String() string {
+	var sb strings.Builder
+	n := len(r.Latencies)
+	fmt.Fprintf(&sb, "%d responses in %v (%.1f/s), %d errors\n", n, r.Elapsed.Round(time.Millisecond), float64(n)/r.Elapsed.Seconds(), r.Errors)
+	var codes []int
+	for code := range r.Statuses {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	for _, code := range codes {
+		fmt.Fprintf(&sb, "  %d: %d\n", code, r.Statuses[code])
+	}
+	if n > 0 {
+		fmt.Fprintf(&sb, "latency p50 %v, p90 %v, p99 %v, max %v\n", r.percentile(50), r.percentile(90), r.percentile(99), r.Latencies[n-1])
+	}
+	return sb.String()
+}
+
+// runLoadgen is "stepn loadgen", a small load generator for watching
+// the server's /metrics and profiles under load without another tool.
+func runLoadgen(args []string) error {
+	fs := flag.NewFlagSet("loadgen", flag.ExitOnError)
+	url := fs.String("url", "http://127.0.0.1:8080/", "URL to send requests to")
+	method := fs.String("method", "GET", "request method; PUT to /upload to load the hashing")
+	size := fs.Int64("size", 0, "bytes of request body to send")
+	conc := fs.Int("c", 10, "requests to keep in flight")
+	dur := fs.Duration("d", 10*time.Second, "how long to send requests for")
+	config.ParseArgs(fs, args)
+	if *conc < 1 || *dur <= 0 || *size < 0 {
+		return errors.New("-c and -d must be positive, and -size not negative")
+	}
+	fmt.Printf("%s %s with %d in flight for %v\n", *method, *url, *conc, *dur)
+	res := loadgen(newLoadClient(*conc), *url, *method, *size, *conc, *dur)
+	fmt.Print(res)
+	if len(res.Latencies) == 0 {
+		return errors.New("no responses")
+	}
+	return nil
+}
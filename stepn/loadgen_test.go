@@ -0,0 +1,53 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLoadgen(t *testing.T) {
+	var n, bodyBytes int64
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		atomic.AddInt64(&bodyBytes, int64(len(b)))
+		if atomic.AddInt64(&n, 1)%2 == 0 {
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+		}
+	}))
+	defer ts.Close()
+
+	res := loadgen(newLoadClient(4), ts.URL, "PUT", 10, 4, 100*time.Millisecond)
+	got := len(res.Latencies)
+	if got == 0 || int64(got) != atomic.LoadInt64(&n) || res.Errors != 0 {
+		t.Fatalf("%d responses, %d errors; server saw %d requests", got, res.Errors, n)
+	}
+	if res.Statuses[200]+res.Statuses[503] != got || res.Statuses[503] == 0 {
+		t.Errorf("statuses = %v; want both 200s and 503s adding to %d", res.Statuses, got)
+	}
+	if bodyBytes != 10*n {
+		t.Errorf("server read %d body bytes over %d requests; want 10 each", bodyBytes, n)
+	}
+	if p := res.percentile(50); p <= 0 || p > res.Latencies[got-1] {
+		t.Errorf("p50 = %v; max %v", p, res.Latencies[got-1])
+	}
+	if s := res.String(); !strings.Contains(s, "503: ") || !strings.Contains(s, "p99") {
+		t.Errorf("report missing statuses or percentiles:\n%s", s)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	r := &loadResult{}
+	for i := 1; i <= 100; i++ {
+		r.Latencies = append(r.Latencies, time.Duration(i))
+	}
+	for p, want := range map[float64]time.Duration{50: 50, 99: 99, 100: 100, 0: 1} {
+		if got := r.percentile(p); got != want {
+			t.Errorf("p%v = %v; want %v", p, got, want)
+		}
+	}
+}
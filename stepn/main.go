@@ -0,0 +1,83 @@
+// Stepn is the demo server at the talk's last step, along with the
+// tools for driving it through the workshop, in one binary:
+//
+//	stepn serve [flags]       run the server
+//	stepn bench [flags]       benchmark the handlers in-process
+//	stepn bench self [flags]  benchmark the whole server under load
+//	stepn loadgen [flags]     send load to a running server
+//	stepn migrate [flags]     copy the visitor count between backends
+//	stepn profile [flags]     fetch a profile from a server's -admin listener
+//	stepn proxy [flags]       run as a reverse proxy in front of another instance
+//
+// serve is the default, so "stepn -listen=:8080" still works. Every
+// command's flags may also be set in the environment; see package
+// config.
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+)
+
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) error
+}
+
+var commands []command
+
+func init() {
+	// Set in init, as usage refers to commands.
+	commands = []command{
+		{"serve", "run the server (the default)", runServe},
+		{"bench", `benchmark the handlers in-process, or with "self", the whole server`, runBench},
+		{"loadgen", "send load to a running server", runLoadgen},
+		{"migrate", "copy the visitor count between backends", runMigrate},
+		{"profile", "fetch a profile from a server's -admin listener", runProfile},
+		{"proxy", "run as a reverse proxy in front of another instance", runProxy},
+	}
+}
+
+// lookupCommand returns the command args name, and the arguments
+// after its name. Arguments that don't start with a command's name
+// are serve's.
+func lookupCommand(args []string) (cmd *command, rest []string, err error) {
+	name := "serve"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	for i := range commands {
+		if commands[i].name == name {
+			return &commands[i], args, nil
+		}
+	}
+	return nil, nil, fmt.Errorf("unknown command %q", name)
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintf(w, "usage: stepn <command> [flags]\n\nCommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-8s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintf(w, "\nRun \"stepn <command> -h\" for a command's flags.\n")
+}
+
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "help" {
+		usage(os.Stdout)
+		return
+	}
+	cmd, args, err := lookupCommand(os.Args[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "stepn: %v\n\n", err)
+		usage(os.Stderr)
+		os.Exit(2)
+	}
+	if err := cmd.run(args); err != nil {
+		log.Fatalf("stepn %s: %v", cmd.name, err)
+	}
+}
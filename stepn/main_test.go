@@ -0,0 +1,29 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLookupCommand(t *testing.T) {
+	for _, tt := range []struct {
+		args     []string
+		name     string
+		wantRest []string
+	}{
+		{nil, "serve", nil},
+		{[]string{"-listen=:80"}, "serve", []string{"-listen=:80"}},
+		{[]string{"serve", "-listen=:80"}, "serve", []string{"-listen=:80"}},
+		{[]string{"loadgen", "-c=5"}, "loadgen", []string{"-c=5"}},
+		{[]string{"migrate"}, "migrate", []string{}},
+		{[]string{"proxy", "-upstream=http://127.0.0.1:8080"}, "proxy", []string{"-upstream=http://127.0.0.1:8080"}},
+	} {
+		cmd, rest, err := lookupCommand(tt.args)
+		if err != nil || cmd.name != tt.name || len(rest)+len(tt.wantRest) > 0 && !reflect.DeepEqual(rest, tt.wantRest) {
+			t.Errorf("lookupCommand(%q) = %v, %q, %v; want %s, %q", tt.args, cmd, rest, err, tt.name, tt.wantRest)
+		}
+	}
+	if _, _, err := lookupCommand([]string{"bogus"}); err == nil {
+		t.Error("unknown command found")
+	}
+}
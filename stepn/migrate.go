@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/config"
+	"github.com/bradfitz/talk-yapc-asia-2015/internal/migrate"
+)
+
+// runMigrate is "stepn migrate". See package migrate for the backends
+// it knows. Stop the server first; a count that's still moving won't
+// verify.
+func runMigrate(args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	from := fs.String("from", "", "backend to copy from, as kind:arg")
+	to := fs.String("to", "", "backend to copy to, as kind:arg")
+	maxUploads := fs.Int("uploads", 1000, "most recent uploads to copy, when both backends keep an upload history")
+	force := fs.Bool("force", false, "overwrite a destination whose count is already higher than the source's")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: stepn migrate -from=kind:arg -to=kind:arg")
+		fs.PrintDefaults()
+	}
+	config.ParseArgs(fs, args)
+	if *from == "" || *to == "" || fs.NArg() != 0 {
+		fs.Usage()
+		return errors.New("need -from and -to, and no arguments")
+	}
+	src, err := migrate.Open(*from)
+	if err != nil {
+		return err
+	}
+	dst, err := migrate.Open(*to)
+	if err != nil {
+		return err
+	}
+	n, err := migrate.Copy(context.Background(), src, dst, *maxUploads, *force)
+	if err != nil {
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return fmt.Errorf("closing %s: %v", *to, err)
+	}
+	src.Close()
+	log.Printf("Copied visitor count %d from %s to %s", n, *from, *to)
+	return nil
+}
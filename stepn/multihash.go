@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/errcode"
+)
+
+// A digester is one of the digests an upload asked for.
+type digester struct {
+	alg string
+	h   hash.Hash
+}
+
+// newDigesters returns the digesters for ?alg=: a hash's name, or
+// several separated by commas, such as "sha1,sha256,crc32", all
+// computed from the one read of the body. Empty means defaultHash.
+func newDigesters(algs string) ([]digester, error) {
+	if algs == "" {
+		algs = defaultHash
+	}
+	var ds []digester
+	for _, alg := range strings.Split(algs, ",") {
+		newHash, ok := hashes[alg]
+		if !ok {
+			return nil, fmt.Errorf("%w: alg must be one of %s, or several separated by commas", errcode.ErrInvalidParams, hashNames())
+		}
+		for _, d := range ds {
+			if d.alg == alg {
+				return nil, fmt.Errorf("%w: alg %s is listed twice", errcode.ErrInvalidParams, alg)
+			}
+		}
+		ds = append(ds, digester{alg, newHash()})
+	}
+	return ds, nil
+}
+
+// digestWriter returns a writer to all of ds's hashes: an
+// io.MultiWriter, which runs them one after another, or with fanout, a
+// fanoutWriter, which runs them at once. The caller must call close
+// when it's done writing.
+func digestWriter(ds []digester, fanout bool) (w io.Writer, close func()) {
+	ws := make([]io.Writer, len(ds))
+	for i, d := range ds {
+		ws[i] = d.h
+	}
+	if len(ws) == 1 {
+		return ws[0], func() {}
+	}
+	if fanout {
+		f := newFanoutWriter(ws...)
+		return f, f.Close
+	}
+	return io.MultiWriter(ws...), func() {}
+}
+
+// sumLine returns handlePost's reply for an upload of n bytes with
+// the given sums of ds, such as "sha1 = aaf4... in 5 bytes", or with
+// several digests, "sha1 = aaf4..., crc32 = 3610a686 in 5 bytes".
+func sumLine(ds []digester, sums []string, n int64) string {
+	var sb strings.Builder
+	for i, d := range ds {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		fmt.Fprintf(&sb, "%s = %s", d.alg, sums[i])
+	}
+	fmt.Fprintf(&sb, " in %d bytes", n)
+	return sb.String()
+}
+
+// A fanoutWriter writes each chunk to all of its writers at once, one
+// goroutine apiece, and returns once they've all written it, so that
+// the chunk needn't be copied. The handoffs cost a little per chunk,
+// which pays only when the writers are slow and the cores are free;
+// BenchmarkPutDigests compares it with io.MultiWriter.
+type fanoutWriter struct {
+	chunks []chan []byte
+	errs   chan error
+}
+
+func newFanoutWriter(ws ...io.Writer) *fanoutWriter {
+	f := &fanoutWriter{errs: make(chan error, len(ws))}
+	for _, w := range ws {
+		c := make(chan []byte)
+		f.chunks = append(f.chunks, c)
+		go func() {
+			for b := range c {
+				_, err := w.Write(b)
+				f.errs <- err
+			}
+		}()
+	}
+	return f
+}
+
+func (f *fanoutWriter) Write(b []byte) (int, error) {
+	for _, c := range f.chunks {
+		c <- b
+	}
+	var first error
+	for range f.chunks {
+		if err := <-f.errs; err != nil && first == nil {
+			first = err
+		}
+	}
+	if first != nil {
+		return 0, first
+	}
+	return len(b), nil
+}
+
+// Close stops f's goroutines. f mustn't be written to after.
+func (f *fanoutWriter) Close() {
+	for _, c := range f.chunks {
+		close(c)
+	}
+}
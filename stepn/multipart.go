@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/auditlog"
+	"github.com/bradfitz/talk-yapc-asia-2015/errcode"
+	"github.com/bradfitz/talk-yapc-asia-2015/internal/clock"
+	"github.com/bradfitz/talk-yapc-asia-2015/store"
+)
+
+// A partDigest is what handleMultipart says about one uploaded file.
+type partDigest struct {
+	Filename string `json:"filename"`
+	Size     int64  `json:"size"`
+	SHA1     string `json:"sha1"`
+}
+
+// handleMultipart hashes each file in a multipart/form-data POST, as
+// an HTML form with <input type=file multiple> sends them, and
+// returns their digests in order. Parts are streamed through the
+// pooled buffer one at a time, never held whole, so the only limit on
+// their size is -maxupload, which applies to the whole body. Parts
+// that aren't files, the form's other fields, are skipped.
+func handleMultipart(w http.ResponseWriter, r *http.Request) {
+	liftWriteDeadline(w)
+	r.Body = http.MaxBytesReader(w, r.Body, *maxUpload)
+	mr, err := r.MultipartReader()
+	if err != nil {
+		errcode.Write(w, fmt.Errorf("%w: %v", errcode.ErrBadBody, err))
+		return
+	}
+	ctx, endSpan := startSpan(r.Context(), "handleMultipart")
+	defer endSpan(nil)
+	atomic.AddInt64(&activeUploads, 1)
+	defer atomic.AddInt64(&activeUploads, -1)
+
+	bufp := getBuf(r.ContentLength)
+	defer putBuf(bufp)
+	h := hashes[defaultHash]()
+	digests := []partDigest{}
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err == nil && p.FileName() != "" {
+			h.Reset()
+			_, endCopy := startSpan(ctx, "hash.copy")
+			var n int64
+			n, err = io.CopyBuffer(h, p, *bufp)
+			endCopy(err)
+			bytesHashed.Add(float64(n))
+			if err == nil {
+				digests = append(digests, partDigest{p.FileName(), n, fmt.Sprintf("%x", h.Sum((*bufp)[:0]))})
+			}
+		}
+		if err != nil {
+			noteUploadError()
+			if errcode.Lookup(err) != errcode.ErrTooLarge {
+				err = fmt.Errorf("%w: %v", errcode.ErrBadBody, err)
+			}
+			errcode.Write(w, err)
+			return
+		}
+	}
+	for _, d := range digests {
+		if err := uploads.Add(ctx, store.Upload{Time: clock.Now(), Size: d.Size, Sum: d.SHA1}); err != nil {
+			noteUploadError()
+			logger(ctx).Error("recording upload", "err", err)
+		}
+		recordEvent(ctx, auditlog.Event{Kind: auditlog.Upload, Size: d.Size, Sum: d.SHA1})
+	}
+	respond(w, r, digests)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"mime/multipart"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/internal/benchtest"
+	"github.com/bradfitz/talk-yapc-asia-2015/store"
+)
+
+// multipartBody returns a multipart/form-data body with a file part
+// for each of files, named by the keys, plus a field that isn't a
+// file, and its Content-Type.
+func multipartBody(t testing.TB, names []string, files map[string]string) (body, contentType string) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	mw.WriteField("comment", "not a file")
+	for _, name := range names {
+		fw, err := mw.CreateFormFile("files", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write([]byte(files[name]))
+	}
+	mw.Close()
+	return buf.String(), mw.FormDataContentType()
+}
+
+func TestMultipart(t *testing.T) {
+	defer func(u store.UploadLog, max int64) { uploads, *maxUpload = u, max }(uploads, *maxUpload)
+	uploads = store.NewMemoryUploads(10)
+
+	names := []string{"hello.txt", "empty.txt", "big.txt"}
+	body, ct := multipartBody(t, names, map[string]string{
+		"hello.txt": "hello",
+		"big.txt":   strings.Repeat("a", 100<<10), // more than a pooled buffer
+	})
+	req := httptest.NewRequest("POST", "/upload/multipart", strings.NewReader(body))
+	req.Header.Set("Content-Type", ct)
+	rw := httptest.NewRecorder()
+	handleMultipart(rw, req)
+	if rw.Code != 200 {
+		t.Fatalf("status = %d %q; want 200", rw.Code, rw.Body)
+	}
+	var got []partDigest
+	if err := json.Unmarshal(rw.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := []partDigest{
+		{"hello.txt", 5, "aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d"},
+		{"empty.txt", 0, "da39a3ee5e6b4b0d3255bfef95601890afd80709"},
+		{"big.txt", 100 << 10, "4ed709b0a3c8dd3d3d14d93e9680e789682167ca"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %+v; want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("part %d = %+v; want %+v", i, got[i], want[i])
+		}
+	}
+	if recent, _ := uploads.Recent(context.Background(), 10); len(recent) != 3 || recent[2].Sum != want[0].SHA1 {
+		t.Errorf("recorded uploads %+v; want the three parts", recent)
+	}
+
+	for _, tt := range []struct {
+		name, method, ct, body string
+		max                    int64 // for -maxupload, if non-zero
+		code                   int
+	}{
+		{"get", "GET", ct, "", 0, 405},
+		{"not multipart", "POST", "text/plain", "hello", 0, 400},
+		{"truncated", "POST", ct, body[:len(body)/2], 0, 400},
+		{"too large", "POST", ct, body, 1 << 10, 413},
+	} {
+		if tt.max != 0 {
+			*maxUpload = tt.max
+		}
+		req := httptest.NewRequest(tt.method, "/upload/multipart", strings.NewReader(tt.body))
+		req.Header.Set("Content-Type", tt.ct)
+		rw := httptest.NewRecorder()
+		newMux(nil).ServeHTTP(rw, req)
+		if rw.Code != tt.code {
+			t.Errorf("%s: status = %d %q; want %d", tt.name, rw.Code, rw.Body, tt.code)
+		}
+	}
+}
+
+// BenchmarkMultipart hashes four 1MB files in one form post. Its
+// hashed-B/op should match its bytes per op: every part is read
+// through, and nothing else is.
+func BenchmarkMultipart(b *testing.B) {
+	const parts, partLength = 4, 1 << 20
+	var names []string
+	files := map[string]string{}
+	for i := 0; i < parts; i++ {
+		name := "part" + strconv.Itoa(i)
+		names = append(names, name)
+		files[name] = strings.Repeat(string(rune('a'+i)), partLength)
+	}
+	body, ct := multipartBody(b, names, files)
+	b.ReportAllocs()
+	b.SetBytes(parts * partLength)
+	f := benchtest.NewFixture(b, "POST /upload/multipart HTTP/1.1\r\n"+
+		"Content-Type: "+ct+"\r\n"+
+		"Content-Length: "+strconv.Itoa(len(body))+"\r\n"+
+		"\r\n"+body)
+	defer hashedPerOp(b)()
+	for benchtest.Loop(b) {
+		f.Reset()
+		handleMultipart(f.Rec, f.Req)
+	}
+}
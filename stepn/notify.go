@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/notifier"
+	"github.com/bradfitz/talk-yapc-asia-2015/webhook"
+)
+
+// milestoneEvery is how many visitors apart milestone events are, and
+// announceEvery how far apart the ones announced in chat are.
+const (
+	milestoneEvery = 1000
+	announceEvery  = 10000
+)
+
+// announcer posts announcements to -chat's webhook. It's nil without
+// the flag.
+var announcer notifier.Notifier
+
+// hooks sends milestone events to -webhook's URLs. It's nil without
+// the flag.
+var hooks *webhook.Sender
+
+func notify(typ string, data interface{}) {
+	if hooks != nil {
+		hooks.Send(webhook.Event{Type: typ, Data: data})
+	}
+}
+
+// noteVisitors sends a visitor.milestone event for each multiple of
+// milestoneEvery in (from, to], the counts before and after some
+// visits were counted.
+func noteVisitors(from, to int64) {
+	for m := (from/milestoneEvery + 1) * milestoneEvery; m <= to; m += milestoneEvery {
+		notify("visitor.milestone", map[string]int64{"visitor": m})
+		if announcer != nil && m%announceEvery == 0 {
+			announcer.Notify(context.Background(), fmt.Sprintf("visitor #%d!", m))
+		}
+	}
+}
+
+// uploadErrors watches for a spike in failed uploads.
+var uploadErrors = &spikeDetector{Window: time.Minute, Threshold: 10}
+
+func noteUploadError() {
+	if n, ok := uploadErrors.add(time.Now()); ok {
+		notify("uploads.errors", map[string]interface{}{"errors": n, "window": uploadErrors.Window.String()})
+	}
+}
+
+// A spikeDetector counts events in fixed windows and reports when a
+// window's count reaches Threshold, once per window.
+type spikeDetector struct {
+	Window    time.Duration
+	Threshold int
+
+	mu    sync.Mutex
+	start time.Time // of the current window
+	n     int
+}
+
+// add records an event at now. It returns the count so far in the
+// current window, and whether this event brought it to Threshold.
+func (d *spikeDetector) add(now time.Time) (int, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if now.Sub(d.start) >= d.Window {
+		d.start, d.n = now, 0
+	}
+	d.n++
+	return d.n, d.n == d.Threshold
+}
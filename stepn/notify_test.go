@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/notifier"
+	"github.com/bradfitz/talk-yapc-asia-2015/store"
+	"github.com/bradfitz/talk-yapc-asia-2015/webhook"
+)
+
+func TestSpikeDetector(t *testing.T) {
+	d := &spikeDetector{Window: time.Minute, Threshold: 3}
+	t0 := time.Unix(1e9, 0)
+	var fired []int
+	for i, at := range []time.Duration{0, 10, 20, 30, 40, 61, 62, 63} {
+		if _, ok := d.add(t0.Add(at * time.Second)); ok {
+			fired = append(fired, i)
+		}
+	}
+	// The third event of each window fires: 2 in the first, and the
+	// window restarting at 61s fires on event 7.
+	if len(fired) != 2 || fired[0] != 2 || fired[1] != 7 {
+		t.Errorf("fired on events %v; want [2 7]", fired)
+	}
+}
+
+func TestMilestoneWebhook(t *testing.T) {
+	defer func(c store.Counter, h *webhook.Sender) { counter, hooks = c, h }(counter, hooks)
+	counter = new(store.Memory)
+
+	got := make(chan webhook.Event, 10)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ev, err := webhook.Receive([]byte("k"), r)
+		if err != nil {
+			t.Error(err)
+		}
+		got <- ev
+	}))
+	defer ts.Close()
+	hooks = &webhook.Sender{URLs: []string{ts.URL}, Secret: []byte("k")}
+	stop := make(chan struct{})
+	defer close(stop)
+	go hooks.Run(stop)
+
+	counter.(*store.Memory).Store(milestoneEvery - 2)
+	for i := 0; i < 3; i++ {
+		handleRoot(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	}
+	// A batch crossing two milestones announces both.
+	postBatch(`[{"count": 1000}, {"count": 1000}]`)
+
+	for _, want := range []float64{1000, 2000, 3000} {
+		select {
+		case ev := <-got:
+			if v, _ := ev.Data.(map[string]interface{})["visitor"].(float64); ev.Type != "visitor.milestone" || v != want {
+				t.Errorf("event %+v; want visitor.milestone for %v", ev, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no event for visitor %v", want)
+		}
+	}
+	select {
+	case ev := <-got:
+		t.Errorf("unexpected event %+v", ev)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+type recordingNotifier chan string
+
+func (r recordingNotifier) Notify(ctx context.Context, msg string) error {
+	r <- msg
+	return nil
+}
+
+func TestAnnounce(t *testing.T) {
+	defer func(n notifier.Notifier) { announcer = n }(announcer)
+	got := make(recordingNotifier, 10)
+	announcer = got
+	noteVisitors(announceEvery-1, 2*announceEvery+5)
+	close(got)
+	var msgs []string
+	for m := range got {
+		msgs = append(msgs, m)
+	}
+	if len(msgs) != 2 || msgs[0] != "visitor #10000!" || msgs[1] != "visitor #20000!" {
+		t.Errorf("announced %q; want visitors #10000 and #20000", msgs)
+	}
+}
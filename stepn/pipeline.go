@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/gziphttp"
+	"github.com/bradfitz/talk-yapc-asia-2015/negotiate"
+)
+
+// A response leaves a handler as a value, is encoded, say as JSON,
+// compressed, say with gzip, and written, with its bytes counted for
+// the access log. Each step is a stage of a pipeline, declared in
+// order rather than nested by hand, and each kind of step takes
+// plugins: an encoder for another media type, such as protobuf, or a
+// compressor for another coding, such as brotli.
+//
+// A stage is one step: wrap puts it in front of the handler after it.
+// Stages are wrapped once, when the server starts, so a pipeline costs
+// a request nothing that nesting the same wrappers by hand wouldn't;
+// TestPipelineAllocs checks.
+type stage struct {
+	name string
+	wrap func(http.Handler) http.Handler
+}
+
+// A pipeline is stages, outermost first: a request passes through them
+// in order on its way to the handler, and the response in reverse.
+type pipeline []stage
+
+// then returns h behind p's stages.
+func (p pipeline) then(h http.Handler) http.Handler {
+	for i := len(p) - 1; i >= 0; i-- {
+		h = p[i].wrap(h)
+	}
+	return h
+}
+
+// String lists p's stages, outermost first, for the startup log.
+func (p pipeline) String() string {
+	names := make([]string, len(p))
+	for i, s := range p {
+		names[i] = s.name
+	}
+	return strings.Join(names, " → ")
+}
+
+// An encoder writes values of the types it knows as its media type.
+// encode returns errNotEncodable, having written nothing, for a value
+// of any other type, and respond falls back to JSON.
+type encoder struct {
+	mediaType string
+	encode    func(w io.Writer, v interface{}) error
+}
+
+var errNotEncodable = errors.New("value not encodable as this media type")
+
+// encoders are the media types respond can answer in, the default
+// first. Plugins add to them with registerEncoder.
+var encoders = []encoder{
+	{"application/json", encodeJSON},
+}
+
+// registerEncoder makes e available to clients that Accept its media
+// type. It's for plugins' init funcs, and isn't safe once the server
+// is running.
+func registerEncoder(e encoder) {
+	for _, o := range encoders {
+		if o.mediaType == e.mediaType {
+			panic("duplicate encoder " + e.mediaType)
+		}
+	}
+	encoders = append(encoders, e)
+}
+
+// encodeJSON writes v as JSON. Types on the hot path implement
+// jsonAppender and skip encoding/json's reflection.
+func encodeJSON(w io.Writer, v interface{}) error {
+	if a, ok := v.(jsonAppender); ok {
+		writeAppended(w, a)
+		return nil
+	}
+	return json.NewEncoder(w).Encode(v)
+}
+
+// respond writes v as the response body, in the media type r's Accept
+// header prefers among encoders. With only JSON compiled in, that's
+// JSON, as writeJSON would write it.
+func respond(w http.ResponseWriter, r *http.Request, v interface{}) {
+	if len(encoders) == 1 {
+		writeJSON(w, v)
+		return
+	}
+	w.Header().Add("Vary", "Accept")
+	offers := make([]string, len(encoders))
+	for i, e := range encoders {
+		offers[i] = e.mediaType
+	}
+	mt := negotiate.Type(r, offers...)
+	for _, e := range encoders[1:] {
+		if e.mediaType != mt {
+			continue
+		}
+		w.Header().Set("Content-Type", e.mediaType)
+		if err := e.encode(w, v); !errors.Is(err, errNotEncodable) {
+			return
+		}
+	}
+	writeJSON(w, v)
+}
+
+// A compressor compresses the responses of the handlers it wraps with
+// one content coding, for clients whose Accept-Encoding takes it.
+type compressor struct {
+	coding string
+	wrap   func(http.Handler) http.Handler
+}
+
+// compressors are the content codings responses may be compressed
+// with, the most preferred first. Plugins add to them with
+// registerCompressor.
+var compressors = []compressor{
+	{"gzip", new(gziphttp.Compressor).Wrap},
+}
+
+// registerCompressor makes c available to clients whose
+// Accept-Encoding takes its coding, preferring it to those before it.
+// It's for plugins' init funcs, and isn't safe once the server is
+// running.
+func registerCompressor(c compressor) {
+	for _, o := range compressors {
+		if o.coding == c.coding {
+			panic("duplicate compressor " + c.coding)
+		}
+	}
+	compressors = append([]compressor{c}, compressors...)
+}
+
+// compressStage compresses responses with the best of compressors the
+// client accepts. With only gzip compiled in, that's gziphttp's
+// Compressor as is.
+func compressStage() stage {
+	return stage{"compress", func(h http.Handler) http.Handler {
+		if len(compressors) == 1 {
+			return compressors[0].wrap(h)
+		}
+		codings := make([]string, len(compressors))
+		wrapped := make(map[string]http.Handler, len(compressors))
+		for i, c := range compressors {
+			codings[i] = c.coding
+			wrapped[c.coding] = c.wrap(h)
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if c, ok := wrapped[negotiate.Encoding(r, codings...)]; ok {
+				c.ServeHTTP(w, r)
+				return
+			}
+			w.Header().Add("Vary", "Accept-Encoding")
+			h.ServeHTTP(w, r)
+		})
+	}}
+}
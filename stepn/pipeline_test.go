@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/internal/benchtest"
+	"github.com/bradfitz/talk-yapc-asia-2015/metrics"
+)
+
+// tagStage returns a stage that appends its name to the X-Stages
+// header on the way in.
+func tagStage(name string) stage {
+	return stage{name, func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("X-Stages", name)
+			h.ServeHTTP(w, r)
+		})
+	}}
+}
+
+func TestPipelineOrder(t *testing.T) {
+	p := pipeline{tagStage("a"), tagStage("b"), tagStage("c")}
+	if got, want := p.String(), "a → b → c"; got != want {
+		t.Errorf("String = %q; want %q", got, want)
+	}
+	rw := httptest.NewRecorder()
+	p.then(http.NotFoundHandler()).ServeHTTP(rw, httptest.NewRequest("GET", "/", nil))
+	if got := strings.Join(rw.Header().Values("X-Stages"), " "); got != "a b c" {
+		t.Errorf("stages ran in order %q; want a b c, outermost first", got)
+	}
+}
+
+func TestRespondEncoders(t *testing.T) {
+	defer func(es []encoder) { encoders = es }(encoders)
+	registerEncoder(encoder{"text/x-stats", func(w io.Writer, v interface{}) error {
+		s, ok := v.(stats)
+		if !ok {
+			return errNotEncodable
+		}
+		_, err := fmt.Fprintf(w, "visitors %d\n", s.Visitors)
+		return err
+	}})
+	for _, tt := range []struct {
+		accept  string
+		handler http.HandlerFunc
+		ct      string
+		body    string // prefix
+	}{
+		{"", handleStats, "application/json", `{"uptimeSeconds":`},
+		{"text/x-stats", handleStats, "text/x-stats", "visitors "},
+		{"application/json;q=0.5, text/x-stats", handleStats, "text/x-stats", "visitors "},
+		{"text/x-stats", handleVersion, "application/json", `{"go":`}, // not a stats
+	} {
+		req := httptest.NewRequest("GET", "/", nil)
+		if tt.accept != "" {
+			req.Header.Set("Accept", tt.accept)
+		}
+		rw := httptest.NewRecorder()
+		tt.handler(rw, req)
+		if ct := rw.Header().Get("Content-Type"); ct != tt.ct || !strings.HasPrefix(rw.Body.String(), tt.body) {
+			t.Errorf("Accept %q: %s %q; want %s starting %q", tt.accept, ct, rw.Body, tt.ct, tt.body)
+		}
+		if v := rw.Header().Get("Vary"); v != "Accept" {
+			t.Errorf("Accept %q: Vary = %q; want Accept", tt.accept, v)
+		}
+	}
+}
+
+func TestCompressStage(t *testing.T) {
+	defer func(cs []compressor) { compressors = cs }(compressors)
+	registerCompressor(compressor{"x-test", func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Accept-Encoding")
+			w.Header().Set("Content-Encoding", "x-test")
+			h.ServeHTTP(w, r)
+		})
+	}})
+	h := compressStage().wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, strings.Repeat("compress me ", 200))
+	}))
+	for _, tt := range []struct {
+		acceptEncoding, want string
+	}{
+		{"gzip, x-test", "x-test"}, // the newest is preferred
+		{"gzip", "gzip"},
+		{"gzip, x-test;q=0.5", "gzip"},
+		{"", ""},
+		{"br", ""},
+	} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+		rw := httptest.NewRecorder()
+		h.ServeHTTP(rw, req)
+		if got := rw.Header().Get("Content-Encoding"); got != tt.want {
+			t.Errorf("Accept-Encoding %q: Content-Encoding %q; want %q", tt.acceptEncoding, got, tt.want)
+		}
+		if v := rw.Header().Values("Vary"); len(v) != 1 || v[0] != "Accept-Encoding" {
+			t.Errorf("Accept-Encoding %q: Vary = %q; want Accept-Encoding once", tt.acceptEncoding, v)
+		}
+	}
+}
+
+// versionMux returns an instrumented mux serving /version.
+func versionMux() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/version", handleVersion)
+	return metrics.InstrumentMux(mux)
+}
+
+// nestedByHand is the public handler as it was built before
+// publicPipeline, with the same stages, for comparison.
+func nestedByHand(h http.Handler) http.Handler {
+	return recoverPanics(compressors[0].wrap(cachePolicy.Wrap(secureHeaders(h))))
+}
+
+func pipelined(h http.Handler) http.Handler {
+	return pipeline{
+		{"recover", recoverPanics},
+		compressStage(),
+		{"cache", cachePolicy.Wrap},
+		{"secure", secureHeaders},
+	}.then(h)
+}
+
+// TestPipelineAllocs checks that serving through a pipeline allocates
+// no more than serving through the same wrappers nested by hand.
+func TestPipelineAllocs(t *testing.T) {
+	mux := versionMux()
+	req := httptest.NewRequest("GET", "/version", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	allocs := func(h http.Handler) float64 {
+		return testing.AllocsPerRun(100, func() {
+			h.ServeHTTP(httptest.NewRecorder(), req)
+		})
+	}
+	nested, piped := allocs(nestedByHand(mux)), allocs(pipelined(mux))
+	if piped > nested {
+		t.Errorf("pipeline: %v allocs per request; nested by hand: %v", piped, nested)
+	}
+}
+
+// BenchmarkPipeline compares serving /version through the public
+// stages nested by hand and as a pipeline:
+//
+//	go test -run=^$ -bench=Pipeline -benchmem ./stepn
+func BenchmarkPipeline(b *testing.B) {
+	mux := versionMux()
+	for _, bb := range []struct {
+		name string
+		h    http.Handler
+	}{
+		{"Nested", nestedByHand(mux)},
+		{"Pipeline", pipelined(mux)},
+	} {
+		b.Run(bb.name, func(b *testing.B) {
+			b.ReportAllocs()
+			req := httptest.NewRequest("GET", "/version", nil)
+			req.Header.Set("Accept-Encoding", "gzip")
+			for benchtest.Loop(b) {
+				bb.h.ServeHTTP(httptest.NewRecorder(), req)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+)
+
+// A plugin is an optional subsystem compiled in with a build tag, so
+// the default binary carries none of them and their dependencies. Each
+// lives in its own file that registers it from an init func:
+//
+//	//go:build geoip
+//
+//	func init() { registerPlugin(plugin{Name: "geoip", ...}) }
+//
+// and "go build -tags=bolt,geoip" builds a server with both. /version
+// lists the plugins a binary has.
+type plugin struct {
+	Name string
+
+	// Setup, if non-nil, runs after flag parsing, before the server
+	// picks its counter backend or starts listening. A plugin that
+	// wasn't asked for by its flags should do nothing.
+	Setup func() error
+
+	// Routes are the plugin's handlers, served on the public
+	// listener after publicRoutes' own.
+	Routes []route
+
+	// Wrap, if non-nil, wraps the public handler. It runs inside
+	// request logging and panic recovery.
+	Wrap func(http.Handler) http.Handler
+}
+
+// plugins is every compiled-in plugin, sorted by name.
+var plugins []plugin
+
+func registerPlugin(p plugin) {
+	for _, q := range plugins {
+		if q.Name == p.Name {
+			panic("duplicate plugin " + p.Name)
+		}
+	}
+	plugins = append(plugins, p)
+	sort.Slice(plugins, func(i, j int) bool { return plugins[i].Name < plugins[j].Name })
+}
+
+func pluginNames() []string {
+	names := []string{}
+	for _, p := range plugins {
+		names = append(names, p.Name)
+	}
+	return names
+}
+
+// setupPlugins runs each plugin's Setup, stopping at the first error.
+func setupPlugins() error {
+	for _, p := range plugins {
+		if p.Setup == nil {
+			continue
+		}
+		if err := p.Setup(); err != nil {
+			return fmt.Errorf("plugin %s: %w", p.Name, err)
+		}
+	}
+	return nil
+}
+
+// wrapPlugins wraps h with each plugin's Wrap, the first plugin's
+// outermost.
+func wrapPlugins(h http.Handler) http.Handler {
+	for i := len(plugins) - 1; i >= 0; i-- {
+		if w := plugins[i].Wrap; w != nil {
+			h = w(h)
+		}
+	}
+	return h
+}
@@ -0,0 +1,24 @@
+//go:build autocert
+
+package main
+
+import (
+	"crypto/tls"
+	"net/http"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+func init() {
+	registerPlugin(plugin{Name: "autocert"})
+	newAutocert = func(domains []string, cacheDir string) (*tls.Config, func(http.Handler) http.Handler) {
+		m := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(domains...),
+			Cache:      autocert.DirCache(cacheDir),
+		}
+		// TLSConfig answers tls-alpn-01 challenges on the HTTPS
+		// listener; HTTPHandler answers http-01 ones on port 80.
+		return m.TLSConfig(), m.HTTPHandler
+	}
+}
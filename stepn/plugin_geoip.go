@@ -0,0 +1,72 @@
+//go:build geoip
+
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"net/netip"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/geoip"
+	"github.com/bradfitz/talk-yapc-asia-2015/metrics"
+)
+
+var geoipFile = flag.String("geoipdb", "", "if non-empty, CSV file of first,last,country IP ranges to count requests by country with")
+
+var (
+	geoDB             *geoip.DB
+	requestsByCountry = metrics.NewCounterVec("http_requests_by_country_total", "Requests by the client's country, per -geoipdb.", "country")
+)
+
+func init() {
+	registerPlugin(plugin{
+		Name:   "geoip",
+		Setup:  setupGeoIP,
+		Routes: []route{{getOnly, "/geoip", "the client's country, per -geoipdb", authNone, limitNone, false, http.HandlerFunc(handleGeoIP)}},
+		Wrap:   countCountries,
+	})
+}
+
+func setupGeoIP() error {
+	if *geoipFile == "" {
+		return nil
+	}
+	db, err := geoip.Open(*geoipFile)
+	if err != nil {
+		return err
+	}
+	log.Printf("Loaded %d GeoIP ranges from %s", db.Len(), *geoipFile)
+	geoDB = db
+	return nil
+}
+
+// country returns the country code of r's client, or "unknown".
+func country(r *http.Request) string {
+	if geoDB == nil {
+		return "unknown"
+	}
+	ap, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil {
+		return "unknown"
+	}
+	if cc := geoDB.Lookup(ap.Addr()); cc != "" {
+		return cc
+	}
+	return "unknown"
+}
+
+func countCountries(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestsByCountry.Inc(country(r))
+		h.ServeHTTP(w, r)
+	})
+}
+
+// handleGeoIP tells the client which country it appears to be in.
+func handleGeoIP(w http.ResponseWriter, r *http.Request) {
+	respond(w, r, struct {
+		Addr    string `json:"addr"`
+		Country string `json:"country"`
+	}{r.RemoteAddr, country(r)})
+}
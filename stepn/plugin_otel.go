@@ -0,0 +1,71 @@
+//go:build otel
+
+package main
+
+import (
+	"context"
+	"flag"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+var otlpEndpoint = flag.String("otlp-endpoint", "", "if non-empty, host:port of an OTLP/HTTP collector to send handler traces to")
+
+func init() {
+	registerPlugin(plugin{
+		Name:  "otel",
+		Setup: setupOTel,
+		Wrap:  extractTraceParent,
+	})
+}
+
+// setupOTel points startSpan at a tracer that batches spans to
+// -otlp-endpoint. Spans still batched when the server exits are lost.
+func setupOTel() error {
+	if *otlpEndpoint == "" {
+		return nil
+	}
+	exp, err := otlptracehttp.New(context.Background(),
+		otlptracehttp.WithEndpoint(*otlpEndpoint),
+		otlptracehttp.WithInsecure())
+	if err != nil {
+		return err
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName("stepn"))))
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	tracer := tp.Tracer("github.com/bradfitz/talk-yapc-asia-2015/stepn")
+	startSpan = func(ctx context.Context, name string) (context.Context, func(error)) {
+		ctx, span := tracer.Start(ctx, name)
+		return ctx, func(err error) {
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			}
+			span.End()
+		}
+	}
+	tracing = true
+	return nil
+}
+
+// extractTraceParent makes a request's traceparent header, if it has
+// one, the parent of the spans its handler starts.
+func extractTraceParent(h http.Handler) http.Handler {
+	if *otlpEndpoint == "" {
+		return h
+	}
+	prop := otel.GetTextMapPropagator()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(w, r.WithContext(prop.Extract(r.Context(), propagation.HeaderCarrier(r.Header))))
+	})
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestPlugins(t *testing.T) {
+	defer func(p []plugin) { plugins = p }(plugins)
+	plugins = nil
+
+	var order []string
+	wrap := func(name string) func(http.Handler) http.Handler {
+		return func(h http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				order = append(order, name)
+				h.ServeHTTP(w, r)
+			})
+		}
+	}
+	registerPlugin(plugin{Name: "zeta", Wrap: wrap("zeta")})
+	registerPlugin(plugin{
+		Name: "alpha",
+		Routes: []route{{getOnly, "/alpha", "says hi", authNone, limitNone, false, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("hi"))
+		})}},
+		Wrap: wrap("alpha"),
+	})
+	if got, want := pluginNames(), []string{"alpha", "zeta"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("pluginNames = %q; want %q", got, want)
+	}
+
+	rw := httptest.NewRecorder()
+	wrapPlugins(newMux(nil)).ServeHTTP(rw, httptest.NewRequest("GET", "/alpha", nil))
+	if rw.Body.String() != "hi" {
+		t.Errorf("/alpha = %d %q; want the plugin's handler", rw.Code, rw.Body)
+	}
+	if want := []string{"alpha", "zeta"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("wrappers ran in order %q; want %q", order, want)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("registering a duplicate name didn't panic")
+		}
+	}()
+	registerPlugin(plugin{Name: "zeta"})
+}
+
+func TestSetupPluginsError(t *testing.T) {
+	defer func(p []plugin) { plugins = p }(plugins)
+	plugins = nil
+	errBoom := errors.New("boom")
+	ran := false
+	registerPlugin(plugin{Name: "a", Setup: func() error { return errBoom }})
+	registerPlugin(plugin{Name: "b", Setup: func() error { ran = true; return nil }})
+	if err := setupPlugins(); !errors.Is(err, errBoom) || err.Error() != "plugin a: boom" {
+		t.Errorf("setupPlugins = %v; want plugin a's error", err)
+	}
+	if ran {
+		t.Error("setup continued past a failing plugin")
+	}
+}
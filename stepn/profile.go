@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/config"
+)
+
+// profilePaths maps "stepn profile -type" values to their path under
+// the admin listener's /debug/pprof/.
+var profilePaths = map[string]string{
+	"cpu":       "profile",
+	"trace":     "trace",
+	"heap":      "heap",
+	"allocs":    "allocs",
+	"goroutine": "goroutine",
+	"block":     "block",
+	"mutex":     "mutex",
+}
+
+// fetchProfile copies a profile of the given type from the admin
+// listener at addr to w, sending apiKey if it's non-empty. CPU
+// profiles and traces take secs seconds to record.
+func fetchProfile(w io.Writer, addr, apiKey, typ string, secs int) error {
+	path, ok := profilePaths[typ]
+	if !ok {
+		return fmt.Errorf("unknown profile type %q", typ)
+	}
+	url := "http://" + addr + "/debug/pprof/" + path
+	if typ == "cpu" || typ == "trace" {
+		url += fmt.Sprintf("?seconds=%d", secs)
+	}
+	client := &http.Client{Timeout: time.Duration(secs)*time.Second + time.Minute}
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+	if apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 1<<10))
+		return fmt.Errorf("%s: %s: %s", url, res.Status, msg)
+	}
+	_, err = io.Copy(w, res.Body)
+	return err
+}
+
+// runProfile is "stepn profile". It saves a profile from a running
+// server started with -admin, to view with go tool pprof, as bin/profcpu
+// does for benchmark profiles.
+func runProfile(args []string) error {
+	fs := flag.NewFlagSet("profile", flag.ExitOnError)
+	admin := fs.String("admin", "localhost:6060", "host:port of the server's -admin listener")
+	apiKey := fs.String("apikey", "", "API key to send, if the server has -apikeys")
+	typ := fs.String("type", "cpu", "profile to fetch: cpu, heap, allocs, goroutine, block, mutex, or trace")
+	secs := fs.Int("seconds", 30, "how long to record cpu profiles and traces for")
+	out := fs.String("o", "", `file to write, default "prof.<type>"`)
+	config.ParseArgs(fs, args)
+	if *secs < 1 {
+		return errors.New("-seconds must be positive")
+	}
+	if *out == "" {
+		*out = "prof." + *typ
+	}
+	f, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	if err := fetchProfile(f, *admin, *apiKey, *typ, *secs); err != nil {
+		f.Close()
+		os.Remove(*out)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if *typ == "trace" {
+		fmt.Printf("Wrote %s; view it with: go tool trace %s\n", *out, *out)
+	} else {
+		fmt.Printf("Wrote %s; view it with: go tool pprof %s\n", *out, *out)
+	}
+	return nil
+}
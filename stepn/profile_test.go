@@ -0,0 +1,36 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestFetchProfile(t *testing.T) {
+	ts := httptest.NewServer(requireAPIKey([]string{"k"}, adminMux()))
+	defer ts.Close()
+	addr := strings.TrimPrefix(ts.URL, "http://")
+
+	var buf bytes.Buffer
+	if err := fetchProfile(&buf, addr, "", "heap", 1); err == nil {
+		t.Error("fetched a profile without the API key")
+	}
+	if err := fetchProfile(&buf, addr, "k", "heap", 1); err != nil {
+		t.Fatal(err)
+	}
+	// Profiles are gzipped protobufs.
+	zr, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatalf("heap profile isn't gzipped: %v", err)
+	}
+	if _, err := io.ReadAll(zr); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := fetchProfile(io.Discard, addr, "k", "bogus", 1); err == nil {
+		t.Error("fetched an unknown profile type")
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/errcode"
+)
+
+// progressEvery is how often, in bytes hashed, a ?progress=1 upload's
+// response reports progress. It's a variable for tests.
+var progressEvery int64 = 16 << 20
+
+// An uploadProgress is handlePost's response with ?progress=1 or
+// ?trailer=1, for uploads big enough that a client wants to see them
+// moving. It starts as soon as the upload does, gets a line such as
+// "hashed 128 MiB..." for every progressEvery bytes, each flushed as
+// it's written, and ends with the line a plain upload would get:
+//
+//	curl -T big.iso --no-buffer 'localhost:8080/upload?progress=1'
+//
+// With ?trailer=1 each digest is also sent in a trailer, such as
+// X-Content-SHA1, as a response can't have a header that depends on a
+// body it's sent while still reading. A failure after the start gets
+// an error line, and its errcode code in the X-Upload-Error trailer.
+type uploadProgress struct {
+	w        http.ResponseWriter
+	rc       *http.ResponseController
+	trailers []string // each digest's trailer, with ?trailer=1
+	n, next  int64    // bytes hashed, and when to report next
+}
+
+func startProgress(w http.ResponseWriter, ds []digester, withTrailer bool) *uploadProgress {
+	p := &uploadProgress{
+		w:    w,
+		rc:   http.NewResponseController(w),
+		next: progressEvery,
+	}
+	if withTrailer {
+		for _, d := range ds {
+			p.trailers = append(p.trailers, "X-Content-"+strings.ToUpper(d.alg))
+		}
+	}
+	trailers := strings.Join(append(p.trailers, "X-Upload-Error"), ", ")
+	// HTTP/1 servers otherwise stop reading the request once the
+	// response starts. HTTP/2 is always full duplex.
+	p.rc.EnableFullDuplex()
+	w.Header().Set("Trailer", trailers)
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	p.rc.Flush()
+	return p
+}
+
+// Write counts b as hashed, reporting each progressEvery bytes.
+func (p *uploadProgress) Write(b []byte) (int, error) {
+	p.n += int64(len(b))
+	if p.n >= p.next {
+		for ; p.n >= p.next; p.next += progressEvery {
+			fmt.Fprintf(p.w, "hashed %d MiB...\n", p.next>>20)
+		}
+		p.rc.Flush()
+	}
+	return len(b), nil
+}
+
+func (p *uploadProgress) fail(err error) {
+	fmt.Fprintf(p.w, "error: %v\n", err)
+	p.w.Header().Set("X-Upload-Error", errcode.Lookup(err).Code)
+}
+
+func (p *uploadProgress) finish(ds []digester, sums []string, n int64) {
+	fmt.Fprintln(p.w, sumLine(ds, sums, n))
+	for i, t := range p.trailers {
+		p.w.Header().Set(t, sums[i])
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"crypto/sha256"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/gziphttp"
+	"github.com/bradfitz/talk-yapc-asia-2015/logtail"
+	"github.com/bradfitz/talk-yapc-asia-2015/metrics"
+	"github.com/bradfitz/talk-yapc-asia-2015/store"
+)
+
+// TestUploadTrailer uploads with ?trailer=1 through a real server and
+// client, and reads the digest from the response's trailer.
+func TestUploadTrailer(t *testing.T) {
+	defer func(u store.UploadLog, every int64) { uploads, progressEvery = u, every }(uploads, progressEvery)
+	uploads, progressEvery = store.NewMemoryUploads(10), 1<<20
+	ts := httptest.NewServer(secureHeaders(metrics.InstrumentMux(newMux(logtail.NewRing(10)))))
+	defer ts.Close()
+
+	body := strings.Repeat("a", 2<<20+10)
+	for _, tt := range []struct {
+		query   string
+		header  map[string]string
+		trailer string
+		want    string
+	}{
+		{"?trailer=1", nil, "X-Content-Sha1", fmt.Sprintf("%x", sha1.Sum([]byte(body)))},
+		{"?trailer=1&alg=sha256", nil, "X-Content-Sha256", fmt.Sprintf("%x", sha256.Sum256([]byte(body)))},
+		{"?trailer=1&alg=sha256,crc32", nil, "X-Content-Crc32", fmt.Sprintf("%08x", crc32.ChecksumIEEE([]byte(body)))},
+		{"?trailer=1", map[string]string{"X-Expected-SHA1": strings.Repeat("0", 40)}, "X-Upload-Error", "digest_mismatch"},
+	} {
+		req, err := http.NewRequest("PUT", ts.URL+"/upload"+tt.query, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for k, v := range tt.header {
+			req.Header.Set(k, v)
+		}
+		res, err := ts.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.StatusCode != 200 {
+			t.Errorf("%s: status %d; want 200, sent before the body is read", tt.query, res.StatusCode)
+		}
+		if _, ok := res.Trailer[tt.trailer]; !ok {
+			t.Errorf("%s: trailers declared %v; want %s", tt.query, res.Trailer, tt.trailer)
+		}
+		got, err := io.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v := res.Trailer.Get(tt.trailer); v != tt.want {
+			t.Errorf("%s: trailer %s = %q; want %q\nbody: %s", tt.query, tt.trailer, v, tt.want, got)
+		}
+		if !strings.Contains(string(got), "hashed 1 MiB...\nhashed 2 MiB...\n") {
+			t.Errorf("%s: body %q; want a progress line per MB", tt.query, got)
+		}
+	}
+}
+
+// TestUploadProgressFlushes holds an upload open after its first MiB
+// and checks that the progress line for it arrives meanwhile, through
+// the compressing middleware, rather than with the rest at the end.
+func TestUploadProgressFlushes(t *testing.T) {
+	defer func(u store.UploadLog, every int64) { uploads, progressEvery = u, every }(uploads, progressEvery)
+	uploads, progressEvery = store.NewMemoryUploads(10), 1<<20
+	ts := httptest.NewServer(new(gziphttp.Compressor).Wrap(secureHeaders(metrics.InstrumentMux(newMux(logtail.NewRing(10))))))
+	defer ts.Close()
+
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	go pw.Write(make([]byte, 1<<20+1))
+	req, err := http.NewRequest("PUT", ts.URL+"/upload?progress=1", pr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	lines := make(chan string)
+	go func() {
+		br := bufio.NewReader(res.Body)
+		for {
+			line, err := br.ReadString('\n')
+			if err != nil {
+				close(lines)
+				return
+			}
+			lines <- line
+		}
+	}()
+	select {
+	case line := <-lines:
+		if line != "hashed 1 MiB...\n" {
+			t.Fatalf("first line = %q; want hashed 1 MiB", line)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("no progress line while the upload was held open")
+	}
+
+	pw.Write(make([]byte, 9))
+	pw.Close()
+	var last string
+	for line := range lines {
+		last = line
+	}
+	if want := fmt.Sprintf("sha1 = %x in %d bytes\n", sha1.Sum(make([]byte, 1<<20+10)), 1<<20+10); last != want {
+		t.Errorf("last line = %q; want %q", last, want)
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/config"
+	"github.com/bradfitz/talk-yapc-asia-2015/errcode"
+	"github.com/bradfitz/talk-yapc-asia-2015/metrics"
+)
+
+var proxyErrors = metrics.NewCounterVec("proxy_errors_total", "Requests the proxy couldn't get a response from upstream for.")
+
+// runProxy is "stepn proxy": a reverse proxy in front of another
+// instance, for the talk's "where did my latency go" part. Each
+// response says how long upstream took in a Server-Timing header, and
+// BenchmarkProxy shows what the hop costs, and what it costs with
+// http.Transport's default of two idle connections per host.
+func runProxy(args []string) error {
+	fs := flag.NewFlagSet("proxy", flag.ExitOnError)
+	listen := fs.String("listen", "127.0.0.1:8081", "host:port to listen on")
+	upstream := fs.String("upstream", "http://127.0.0.1:8080", "base URL of the instance to proxy to")
+	maxIdle := fs.Int("maxidle", 100, "idle connections to keep open to upstream; http.Transport's default is 2")
+	drain := fs.Duration("drain", 10*time.Second, "on SIGINT or SIGTERM, how long to wait for in-flight requests")
+	config.ParseArgs(fs, args)
+	if fs.NArg() != 0 {
+		return errors.New("no arguments allowed")
+	}
+	target, err := url.Parse(*upstream)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return fmt.Errorf("bad -upstream %q; want an http or https URL", *upstream)
+	}
+	ln, err := net.Listen("tcp", *listen)
+	if err != nil {
+		return err
+	}
+	log.Printf("Proxying %s to %s", ln.Addr(), target)
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, os.Interrupt, syscall.SIGTERM)
+	// No read or write timeouts: they're upstream's to enforce, and
+	// would cut off its streams.
+	srv := &http.Server{Handler: newProxy(target, proxyTransport(*maxIdle)), ReadHeaderTimeout: 10 * time.Second}
+	if code := serve(srv, ln, sigc, *drain, nil); code != 0 {
+		return errors.New("proxy didn't drain cleanly")
+	}
+	return nil
+}
+
+// proxyTransport returns the proxy's Transport, keeping up to maxIdle
+// connections to upstream open between requests. With the default
+// two, a proxy under concurrent load closes and redials connections
+// all the time. Upstream's compression is passed through as it is.
+func proxyTransport(maxIdle int) *http.Transport {
+	return &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout:   5 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		TLSHandshakeTimeout:   5 * time.Second,
+		ExpectContinueTimeout: time.Second,
+		MaxIdleConns:          maxIdle,
+		MaxIdleConnsPerHost:   maxIdle,
+		IdleConnTimeout:       90 * time.Second,
+		DisableCompression:    true,
+	}
+}
+
+// newProxy returns a reverse proxy to target through rt.
+//
+// The X-Forwarded-For, -Host, and -Proto headers upstream gets are the
+// proxy's own account of the client; any the client sent are dropped,
+// as anyone can send them. Upstream's errors, and a proxy that can't
+// reach upstream, are errcode's JSON.
+func newProxy(target *url.URL, rt http.RoundTripper) *httputil.ReverseProxy {
+	return &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(target)
+			pr.SetXForwarded()
+		},
+		Transport: upstreamTimer{rt},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			proxyErrors.Inc()
+			log.Printf("proxy: %s %s: %v", r.Method, r.URL, err)
+			errcode.Write(w, fmt.Errorf("%w: %v", errcode.ErrBadGateway, err))
+		},
+	}
+}
+
+// upstreamTimer adds a Server-Timing header to each response saying
+// how long upstream took to send its headers, so a client comparing
+// it with its own measurement sees what the proxy added.
+type upstreamTimer struct{ rt http.RoundTripper }
+
+func (t upstreamTimer) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	res, err := t.rt.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	res.Header.Add("Server-Timing", fmt.Sprintf("upstream;dur=%.3f", float64(time.Since(start))/float64(time.Millisecond)))
+	return res, nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestProxy(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"path":  r.URL.RequestURI(),
+			"for":   r.Header.Get("X-Forwarded-For"),
+			"host":  r.Header.Get("X-Forwarded-Host"),
+			"proto": r.Header.Get("X-Forwarded-Proto"),
+		})
+	}))
+	defer upstream.Close()
+	target, _ := url.Parse(upstream.URL)
+	ts := httptest.NewServer(newProxy(target, proxyTransport(10)))
+	defer ts.Close()
+
+	req, _ := http.NewRequest("GET", ts.URL+"/stats?x=1", nil)
+	req.Host = "talk.example"
+	req.Header.Set("X-Forwarded-For", "6.6.6.6") // not to be believed
+	res, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]string
+	json.NewDecoder(res.Body).Decode(&got)
+	res.Body.Close()
+	want := map[string]string{"path": "/stats?x=1", "for": "127.0.0.1", "host": "talk.example", "proto": "http"}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("upstream saw %s %q; want %q", k, got[k], v)
+		}
+	}
+	if st := res.Header.Get("Server-Timing"); !strings.HasPrefix(st, "upstream;dur=") {
+		t.Errorf("Server-Timing = %q; want upstream's duration", st)
+	}
+
+	upstream.Close()
+	before := proxyErrors.Value()
+	res, err = ts.Client().Get(ts.URL + "/stats")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	if res.StatusCode != 502 || !strings.Contains(string(body), `"bad_gateway"`) {
+		t.Errorf("with upstream down, got %d %s; want a 502 bad_gateway", res.StatusCode, body)
+	}
+	if d := proxyErrors.Value() - before; d != 1 {
+		t.Errorf("proxy_errors_total went up by %v; want 1", d)
+	}
+}
+
+// BenchmarkProxy requests /version from an instance directly and
+// through the proxy, keeping 100 idle connections to it and keeping
+// http.Transport's default 2, from parallel clients over loopback:
+//
+//	go test -run=^$ -bench=Proxy -benchmem -cpu=8 ./stepn
+//
+// dials/op counts the connections the proxy opened to upstream.
+func BenchmarkProxy(b *testing.B) {
+	var dials int64
+	upstream := httptest.NewUnstartedServer(versionMux())
+	upstream.Config.ConnState = func(_ net.Conn, s http.ConnState) {
+		if s == http.StateNew {
+			atomic.AddInt64(&dials, 1)
+		}
+	}
+	upstream.Start()
+	defer upstream.Close()
+	target, _ := url.Parse(upstream.URL)
+	for _, bb := range []struct {
+		name    string
+		maxIdle int // 0 for no proxy
+	}{
+		{"Direct", 0},
+		{"Proxy", 100},
+		{"ProxyDefaultIdle", 2},
+	} {
+		b.Run(bb.name, func(b *testing.B) {
+			url := upstream.URL
+			if bb.maxIdle > 0 {
+				ts := httptest.NewServer(newProxy(target, proxyTransport(bb.maxIdle)))
+				defer ts.Close()
+				url = ts.URL
+			}
+			client := &http.Client{Transport: &http.Transport{MaxIdleConnsPerHost: 100}}
+			defer client.CloseIdleConnections()
+			dials0 := atomic.LoadInt64(&dials)
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					res, err := client.Get(url + "/version")
+					if err != nil {
+						b.Error(err)
+						return
+					}
+					io.Copy(io.Discard, res.Body)
+					res.Body.Close()
+				}
+			})
+			b.ReportMetric(float64(atomic.LoadInt64(&dials)-dials0)/float64(b.N), "dials/op")
+		})
+	}
+}
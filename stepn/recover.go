@@ -0,0 +1,45 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/errcode"
+	"github.com/bradfitz/talk-yapc-asia-2015/metrics"
+)
+
+var panicsTotal = metrics.NewCounterVec("http_panics_total", "Handler panics recovered.")
+
+// recoverPanics wraps h so that a panic becomes a 500 response and a
+// logged stack trace instead of a dropped connection. If the handler
+// had already started its response, it's too late for a 500, and
+// finishing the response normally would pass off what was written as
+// all of it; the panic is logged and rethrown as http.ErrAbortHandler,
+// so net/http cuts the connection and the client sees the response
+// fail.
+//
+// http.ErrAbortHandler is left alone; it's how a handler asks
+// net/http to abort the response.
+func recoverPanics(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w}
+		defer func() {
+			e := recover()
+			if e == nil {
+				return
+			}
+			if err, ok := e.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+				panic(e)
+			}
+			panicsTotal.Inc()
+			logger(r.Context()).Error("handler panic", "panic", fmt.Sprint(e), "stack", string(debug.Stack()))
+			if rec.code != 0 {
+				panic(http.ErrAbortHandler)
+			}
+			errcode.Write(w, errors.New("internal error"))
+		}()
+		h.ServeHTTP(rec, r)
+	})
+}
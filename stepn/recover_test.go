@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/errcode"
+)
+
+func panicky(w http.ResponseWriter, r *http.Request) {
+	var byID map[string]int
+	byID["boom"]++ // deliberate: assignment to entry in nil map
+}
+
+func TestRecoverPanics(t *testing.T) {
+	var buf bytes.Buffer
+	h := logRequests(slog.New(slog.NewTextHandler(&buf, nil)), recoverPanics(http.HandlerFunc(panicky)))
+	before := panicsTotal.Value()
+
+	rw := httptest.NewRecorder()
+	h.ServeHTTP(rw, httptest.NewRequest("GET", "/", nil))
+	if rw.Code != 500 {
+		t.Errorf("status = %d; want 500", rw.Code)
+	}
+	var res errcode.Response
+	if err := json.Unmarshal(rw.Body.Bytes(), &res); err != nil || res.Code != "internal" {
+		t.Errorf("body = %q; want internal error JSON", rw.Body)
+	}
+	if d := panicsTotal.Value() - before; d != 1 {
+		t.Errorf("panics counted = %v; want 1", d)
+	}
+	log := buf.String()
+	for _, want := range []string{`msg="handler panic"`, "assignment to entry in nil map", "stepn.panicky", "status=500"} {
+		if !strings.Contains(log, want) {
+			t.Errorf("log missing %q:\n%s", want, log)
+		}
+	}
+}
+
+func TestRecoverPanicsAfterWrite(t *testing.T) {
+	defer func() {
+		if e := recover(); e != http.ErrAbortHandler {
+			t.Errorf("recovered %v; want http.ErrAbortHandler, to cut the partial response off", e)
+		}
+	}()
+	h := recoverPanics(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("partial"))
+		panic("late")
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+}
+
+func TestRecoverPanicsAfterWriteServed(t *testing.T) {
+	ts := httptest.NewServer(publicPipeline(nil).then(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("partial"))
+		panic("late")
+	})))
+	defer ts.Close()
+	res, err := http.Get(ts.URL)
+	if err == nil {
+		_, err = io.ReadAll(res.Body)
+		res.Body.Close()
+	}
+	if err == nil {
+		t.Errorf("GET succeeded with status %d; want the response to fail", res.StatusCode)
+	}
+}
+
+func TestRecoverPanicsAbort(t *testing.T) {
+	defer func() {
+		if e := recover(); e != http.ErrAbortHandler {
+			t.Errorf("recovered %v; want http.ErrAbortHandler to pass through", e)
+		}
+	}()
+	recoverPanics(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	})).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+type ctxKey int
+
+const (
+	loggerKey ctxKey = iota
+	requestIDKey
+)
+
+// logRequests wraps h so that each request gets a random ID, sent
+// back in the X-Request-ID header, and a logger carrying that ID in
+// its context. When the request finishes, one line with its method,
+// path, status, and latency is logged to l.
+func logRequests(l *slog.Logger, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := newRequestID()
+		rl := l.With("req", id)
+		ctx := context.WithValue(r.Context(), requestIDKey, id)
+		ctx = context.WithValue(ctx, loggerKey, rl)
+		w.Header().Set("X-Request-ID", id)
+
+		t0 := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		h.ServeHTTP(rec, r.WithContext(ctx))
+		rl.Info("request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", rec.status(),
+			"latency", time.Since(t0))
+	})
+}
+
+func newRequestID() string {
+	var b [8]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// logger returns the request's logger, or the default logger outside
+// of logRequests.
+func logger(ctx context.Context) *slog.Logger {
+	if l, ok := ctx.Value(loggerKey).(*slog.Logger); ok {
+		return l
+	}
+	return slog.Default()
+}
+
+// requestID returns the ID logRequests gave the request, or "".
+func requestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// statusRecorder records the status code and body size written
+// through it.
+type statusRecorder struct {
+	http.ResponseWriter
+	code    int
+	written int64
+}
+
+func (w *statusRecorder) WriteHeader(code int) {
+	if w.code == 0 {
+		w.code = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusRecorder) Write(p []byte) (int, error) {
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.written += int64(n)
+	return n, err
+}
+
+func (w *statusRecorder) status() int {
+	if w.code == 0 {
+		return http.StatusOK
+	}
+	return w.code
+}
+
+// Flush lets /debug/logtail's event stream flush through the wrapper.
+func (w *statusRecorder) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// ReadFrom lets /file and /blob/ reach the underlying writer's
+// ReadFrom, which on Linux is sendfile.
+func (w *statusRecorder) ReadFrom(src io.Reader) (int64, error) {
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	n, err := io.Copy(w.ResponseWriter, src)
+	w.written += n
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer,
+// for /live's WebSocket hijack.
+func (w *statusRecorder) Unwrap() http.ResponseWriter { return w.ResponseWriter }
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLogRequests(t *testing.T) {
+	var buf bytes.Buffer
+	l := slog.New(slog.NewTextHandler(&buf, nil))
+	var seenID string
+	h := logRequests(l, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seenID = requestID(r.Context())
+		logger(r.Context()).Warn("from handler")
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	rw := httptest.NewRecorder()
+	h.ServeHTTP(rw, httptest.NewRequest("GET", "/tea?x=1", nil))
+
+	if len(seenID) != 16 || rw.Header().Get("X-Request-ID") != seenID {
+		t.Fatalf("handler saw ID %q, header has %q; want the same 16 hex digits", seenID, rw.Header().Get("X-Request-ID"))
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("logged %d lines; want 2:\n%s", len(lines), buf.String())
+	}
+	if want := `level=WARN msg="from handler" req=` + seenID; !strings.Contains(lines[0], want) {
+		t.Errorf("handler line = %q; want it to contain %q", lines[0], want)
+	}
+	for _, want := range []string{"msg=request", "req=" + seenID, "method=GET", "path=/tea", "status=418", "latency="} {
+		if !strings.Contains(lines[1], want) {
+			t.Errorf("request line = %q; missing %q", lines[1], want)
+		}
+	}
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if seenID == rw.Header().Get("X-Request-ID") {
+		t.Errorf("two requests got the same ID %q", seenID)
+	}
+}
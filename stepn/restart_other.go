@@ -0,0 +1,9 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// restartSignal is nil where there's no SIGUSR2 and no restarting
+// without downtime.
+var restartSignal os.Signal
@@ -0,0 +1,12 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// restartSignal asks the server to hand its listener to a new copy of
+// itself and exit; see config.StartReplacement.
+var restartSignal os.Signal = syscall.SIGUSR2
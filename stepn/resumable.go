@@ -0,0 +1,255 @@
+package main
+
+import (
+	"encoding"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/auditlog"
+	"github.com/bradfitz/talk-yapc-asia-2015/errcode"
+	"github.com/bradfitz/talk-yapc-asia-2015/internal/clock"
+	"github.com/bradfitz/talk-yapc-asia-2015/merkle"
+	"github.com/bradfitz/talk-yapc-asia-2015/negotiate"
+	"github.com/bradfitz/talk-yapc-asia-2015/resumable"
+	"github.com/bradfitz/talk-yapc-asia-2015/store"
+)
+
+// resumables are the uploads in progress at /upload/resumable/.
+var resumables = new(resumable.Store)
+
+// maxChunks is the most chunks a resumable upload may be sent in. Each
+// is kept, with its leaf hash, until the upload is done.
+var maxChunks = 1 << 14
+
+// handleResumableCreate starts a resumable upload. That's a POST to
+// /upload/resumable, optionally with ?alg= as for /upload, answered
+// 201 with the session's URL in Location, or with -maxresumable in
+// progress already, 503. Each chunk is then a PUT to that URL with a
+// Content-Range header such as "bytes 0-65535/1048576"; the total may
+// be "*" until the last chunk. A
+// chunk that doesn't start where the last one ended gets a 409, and a
+// retry of one already received a 202 as if it were new. Either way,
+// and on GET or HEAD of the URL, the Range header says what's been
+// received, so the client knows where to resume. An upload may be
+// sent in at most maxChunks chunks.
+//
+// Each chunk is also a leaf of a Merkle tree, whose root over the
+// chunks so far is in the X-Merkle-Root header of those responses. A
+// client that keeps its own chunks' leaf hashes can check what the
+// server received as it goes, rather than only once the whole digest
+// is in. The chunk that completes the upload gets what a PUT to
+// /upload would, or asking for JSON, a chunkManifest.
+func handleResumableCreate(w http.ResponseWriter, r *http.Request) {
+	alg := r.URL.Query().Get("alg")
+	if alg == "" {
+		alg = defaultHash
+	}
+	newHash, ok := hashes[alg]
+	if !ok {
+		errcode.Write(w, fmt.Errorf("%w: alg must be one of %s", errcode.ErrInvalidParams, hashNames()))
+		return
+	}
+	m, ok := newHash().(encoding.BinaryMarshaler)
+	if !ok {
+		errcode.Write(w, fmt.Errorf("%w: %s uploads can't be resumed", errcode.ErrInvalidParams, alg))
+		return
+	}
+	state, err := m.MarshalBinary()
+	if err != nil {
+		errcode.Write(w, err)
+		return
+	}
+	s, err := resumables.Create(alg, state)
+	if err != nil {
+		w.Header().Set("Retry-After", "60")
+		errcode.Write(w, err)
+		return
+	}
+	loc := "/upload/resumable/" + s.ID
+	w.Header().Set("Location", loc)
+	w.WriteHeader(http.StatusCreated)
+	io.WriteString(w, loc+"\n")
+}
+
+func handleResumableChunk(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/upload/resumable/")
+	liftWriteDeadline(w)
+	if r.Method != "PUT" {
+		// A GET or HEAD, asking what's been received.
+		s, ok := resumables.Get(id)
+		if !ok {
+			errcode.Write(w, errcode.ErrUploadNotFound)
+			return
+		}
+		setReceived(w, s)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	start, end, total, err := parseContentRange(r.Header.Get("Content-Range"))
+	if err != nil {
+		errcode.Write(w, err)
+		return
+	}
+	if total > *maxUpload || end >= *maxUpload {
+		errcode.Write(w, fmt.Errorf("%w: uploads are limited to %d bytes", errcode.ErrTooLarge, *maxUpload))
+		return
+	}
+	s, err := resumables.Claim(id)
+	if err != nil {
+		errcode.Write(w, err)
+		return
+	}
+	done := false
+	defer func() {
+		if !done {
+			resumables.Release(s)
+		}
+	}()
+	switch {
+	case total >= 0 && s.Total >= 0 && total != s.Total:
+		errcode.Write(w, fmt.Errorf("%w: the upload is %d bytes, not %d", errcode.ErrUploadConflict, s.Total, total))
+		return
+	case end < s.Offset:
+		// A retry of a chunk whose answer the client didn't get.
+		setReceived(w, s)
+		w.WriteHeader(http.StatusAccepted)
+		return
+	case start != s.Offset:
+		setReceived(w, s)
+		errcode.Write(w, fmt.Errorf("%w: chunk starts at byte %d, but %d are in", errcode.ErrUploadConflict, start, s.Offset))
+		return
+	}
+	if total >= 0 {
+		s.Total = total
+	}
+	if len(s.Chunks) >= maxChunks-1 && end+1 != s.Total {
+		errcode.Write(w, fmt.Errorf("%w: an upload may be sent in at most %d chunks, the last completing it", errcode.ErrTooLarge, maxChunks))
+		return
+	}
+
+	h := hashes[s.Alg]()
+	if err := h.(encoding.BinaryUnmarshaler).UnmarshalBinary(s.State); err != nil {
+		errcode.Write(w, err)
+		return
+	}
+	atomic.AddInt64(&activeUploads, 1)
+	defer atomic.AddInt64(&activeUploads, -1)
+	want := end - start + 1
+	bufp := getBuf(want)
+	defer putBuf(bufp)
+	leaf := merkle.NewLeaf()
+	n, err := io.CopyBuffer(io.MultiWriter(h, leaf), http.MaxBytesReader(w, r.Body, want), *bufp)
+	bytesHashed.Add(float64(n))
+	if err == nil && n != want {
+		err = fmt.Errorf("got %d bytes of a %d-byte chunk", n, want)
+	}
+	if err != nil {
+		// The session keeps its state from before the chunk, so the
+		// client can send it again.
+		noteUploadError()
+		errcode.Write(w, fmt.Errorf("%w: %v", errcode.ErrBadBody, err))
+		return
+	}
+	if s.State, err = h.(encoding.BinaryMarshaler).MarshalBinary(); err != nil {
+		errcode.Write(w, err)
+		return
+	}
+	s.Chunks = append(s.Chunks, resumable.Chunk{Offset: start, Size: n, Leaf: leaf.Sum(nil)})
+	s.Tree = s.Tree.Append(s.Chunks[len(s.Chunks)-1].Leaf)
+	s.Offset += n
+	if s.Offset != s.Total {
+		setReceived(w, s)
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	done = true
+	resumables.Delete(s.ID)
+	sum := fmt.Sprintf("%x", h.Sum((*bufp)[:0]))
+	recAlg := s.Alg
+	if recAlg == defaultHash {
+		recAlg = ""
+	}
+	if err := uploads.Add(r.Context(), store.Upload{Time: clock.Now(), Size: s.Total, Alg: recAlg, Sum: sum}); err != nil {
+		noteUploadError()
+		logger(r.Context()).Error("recording upload", "err", err)
+	}
+	recordEvent(r.Context(), auditlog.Event{Kind: auditlog.Upload, Size: s.Total, Alg: recAlg, Sum: sum})
+	root := merkleRoot(s)
+	w.Header().Set("X-Merkle-Root", root)
+	if negotiate.Type(r, "text/plain", "application/json") == "application/json" {
+		m := chunkManifest{Alg: s.Alg, Sum: sum, Size: s.Total, Root: root, Chunks: make([]manifestChunk, len(s.Chunks))}
+		for i, c := range s.Chunks {
+			m.Chunks[i] = manifestChunk{c.Offset, c.Size, hex.EncodeToString(c.Leaf)}
+		}
+		writeJSON(w, m)
+		return
+	}
+	fmt.Fprintf(w, "%s = %s in %d bytes", s.Alg, sum, s.Total)
+}
+
+// A chunkManifest is the JSON reply to a resumable upload's last
+// chunk: the upload's digest, and each chunk's leaf hash, with the
+// Merkle root over them all.
+type chunkManifest struct {
+	Alg    string          `json:"alg"`
+	Sum    string          `json:"sum"`
+	Size   int64           `json:"size"`
+	Root   string          `json:"merkleRoot"`
+	Chunks []manifestChunk `json:"chunks"`
+}
+
+type manifestChunk struct {
+	Offset int64  `json:"offset"`
+	Size   int64  `json:"size"`
+	Leaf   string `json:"leaf"`
+}
+
+// merkleRoot returns the Merkle root over s's chunks, in hex.
+func merkleRoot(s resumable.Session) string {
+	return hex.EncodeToString(s.Tree.Root())
+}
+
+// setReceived sets the Range header to the bytes of s received so
+// far, and X-Merkle-Root to the root over their chunks, if any.
+func setReceived(w http.ResponseWriter, s resumable.Session) {
+	if s.Offset > 0 {
+		w.Header().Set("Range", fmt.Sprintf("bytes=0-%d", s.Offset-1))
+		w.Header().Set("X-Merkle-Root", merkleRoot(s))
+	}
+}
+
+// parseContentRange parses a chunk's Content-Range, "bytes
+// start-end/total", where total may be "*" if it isn't known yet, in
+// which case it returns -1 for it.
+func parseContentRange(v string) (start, end, total int64, err error) {
+	bad := fmt.Errorf("%w: Content-Range %q isn't bytes start-end/total", errcode.ErrInvalidParams, v)
+	rng, ok := strings.CutPrefix(v, "bytes ")
+	if !ok {
+		return 0, 0, 0, bad
+	}
+	rng, size, ok := strings.Cut(rng, "/")
+	if !ok {
+		return 0, 0, 0, bad
+	}
+	first, last, ok := strings.Cut(rng, "-")
+	if !ok {
+		return 0, 0, 0, bad
+	}
+	start, err1 := strconv.ParseInt(first, 10, 64)
+	end, err2 := strconv.ParseInt(last, 10, 64)
+	total = -1
+	var err3 error
+	if size != "*" {
+		total, err3 = strconv.ParseInt(size, 10, 64)
+	}
+	if err1 != nil || err2 != nil || err3 != nil || start < 0 || end < start || (total >= 0 && end >= total) {
+		return 0, 0, 0, bad
+	}
+	return start, end, total, nil
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/internal/benchtest"
+	"github.com/bradfitz/talk-yapc-asia-2015/logtail"
+	"github.com/bradfitz/talk-yapc-asia-2015/merkle"
+	"github.com/bradfitz/talk-yapc-asia-2015/resumable"
+	"github.com/bradfitz/talk-yapc-asia-2015/store"
+)
+
+func TestResumableUpload(t *testing.T) {
+	defer func(u store.UploadLog, rs *resumable.Store) { uploads, resumables = u, rs }(uploads, resumables)
+	uploads, resumables = store.NewMemoryUploads(10), new(resumable.Store)
+	mux := newMux(logtail.NewRing(10))
+	do := func(method, path, contentRange, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if contentRange != "" {
+			req.Header.Set("Content-Range", contentRange)
+		}
+		rw := httptest.NewRecorder()
+		mux.ServeHTTP(rw, req)
+		return rw
+	}
+
+	rw := do("POST", "/upload/resumable?alg=sha256", "", "")
+	loc := rw.Header().Get("Location")
+	if rw.Code != 201 || !strings.HasPrefix(loc, "/upload/resumable/") {
+		t.Fatalf("create = %d, Location %q", rw.Code, loc)
+	}
+	data := strings.Repeat("0123456789", 10)
+	chunk := func(start, end int, total string) (string, string) {
+		return fmt.Sprintf("bytes %d-%d/%s", start, end, total), data[start : end+1]
+	}
+
+	for _, tt := range []struct {
+		name       string
+		start, end int
+		total      string
+		code       int
+		received   string // Range header
+	}{
+		{"second chunk first", 40, 79, "*", 409, ""},
+		{"first chunk", 0, 39, "*", 202, "bytes=0-39"},
+		{"first chunk again", 0, 39, "*", 202, "bytes=0-39"},
+		{"overlapping chunk", 20, 59, "*", 409, "bytes=0-39"},
+		{"skipping ahead", 80, 99, "100", 409, "bytes=0-39"},
+		{"second chunk", 40, 79, "*", 202, "bytes=0-79"},
+	} {
+		cr, body := chunk(tt.start, tt.end, tt.total)
+		rw := do("PUT", loc, cr, body)
+		if rw.Code != tt.code || rw.Header().Get("Range") != tt.received {
+			t.Errorf("%s: %s = %d, Range %q; want %d, %q (%s)", tt.name, cr, rw.Code, rw.Header().Get("Range"), tt.code, tt.received, rw.Body)
+		}
+	}
+
+	rw = do("HEAD", loc, "", "")
+	if rw.Code != 204 || rw.Header().Get("Range") != "bytes=0-79" {
+		t.Errorf("HEAD = %d, Range %q; want 204, bytes=0-79", rw.Code, rw.Header().Get("Range"))
+	}
+	if got, want := rw.Header().Get("X-Merkle-Root"), rootOf(data, 40, 80); got != want {
+		t.Errorf("HEAD: X-Merkle-Root = %q; want %q, over the two chunks received", got, want)
+	}
+
+	cr, body := chunk(80, 89, "100")
+	if rw := do("PUT", loc, cr, body[:5]); rw.Code != 400 {
+		t.Errorf("short chunk = %d; want 400", rw.Code)
+	}
+	if rw := do("PUT", loc, cr, body); rw.Code != 202 {
+		t.Errorf("short chunk resent = %d %s; want 202", rw.Code, rw.Body)
+	}
+	if rw := do("PUT", loc, "bytes 90-99/200", data[90:]); rw.Code != 409 {
+		t.Errorf("changed total = %d; want 409", rw.Code)
+	}
+	cr, body = chunk(90, 99, "100")
+	rw = do("PUT", loc, cr, body)
+	want := fmt.Sprintf("sha256 = %x in 100 bytes", sha256.Sum256([]byte(data)))
+	if rw.Code != 200 || rw.Body.String() != want {
+		t.Errorf("last chunk = %d %q; want %q", rw.Code, rw.Body, want)
+	}
+	if got, want := rw.Header().Get("X-Merkle-Root"), rootOf(data, 40, 80, 90, 100); got != want {
+		t.Errorf("last chunk: X-Merkle-Root = %q; want %q, without the short chunk", got, want)
+	}
+	if rw := do("PUT", loc, cr, body); rw.Code != 404 {
+		t.Errorf("chunk after the upload completed = %d; want 404", rw.Code)
+	}
+	if recent, _ := uploads.Recent(context.Background(), 1); len(recent) != 1 || recent[0].Size != 100 || recent[0].Alg != "sha256" {
+		t.Errorf("recorded %+v", recent)
+	}
+
+	// An abandoned upload expires.
+	loc = do("POST", "/upload/resumable", "", "").Header().Get("Location")
+	resumables.Evict(time.Now().Add(2 * time.Hour))
+	if rw := do("GET", loc, "", ""); rw.Code != http.StatusNotFound {
+		t.Errorf("GET of expired upload = %d; want 404", rw.Code)
+	}
+
+	// Past the most sessions held at once, creating one is refused.
+	resumables.Max = resumables.Len() + 1
+	do("POST", "/upload/resumable", "", "")
+	if rw := do("POST", "/upload/resumable", "", ""); rw.Code != http.StatusServiceUnavailable || rw.Header().Get("Location") != "" {
+		t.Errorf("create past -maxresumable = %d, Location %q; want 503", rw.Code, rw.Header().Get("Location"))
+	}
+}
+
+// rootOf returns the Merkle root, in hex, of data's chunks ending at
+// each of ends.
+func rootOf(data string, ends ...int) string {
+	var leaves [][]byte
+	start := 0
+	for _, end := range ends {
+		leaves = append(leaves, merkle.Leaf([]byte(data[start:end])))
+		start = end
+	}
+	return hex.EncodeToString(merkle.Root(leaves))
+}
+
+func TestResumableManifest(t *testing.T) {
+	defer func(u store.UploadLog, rs *resumable.Store) { uploads, resumables = u, rs }(uploads, resumables)
+	uploads, resumables = store.NewMemoryUploads(10), new(resumable.Store)
+	mux := newMux(logtail.NewRing(10))
+
+	rw := httptest.NewRecorder()
+	mux.ServeHTTP(rw, httptest.NewRequest("POST", "/upload/resumable", nil))
+	loc := rw.Header().Get("Location")
+	data := "hello, world"
+	for _, c := range []struct{ start, end int }{{0, 4}, {5, 11}} {
+		req := httptest.NewRequest("PUT", loc, strings.NewReader(data[c.start:c.end+1]))
+		req.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", c.start, c.end, len(data)))
+		req.Header.Set("Accept", "application/json")
+		rw = httptest.NewRecorder()
+		mux.ServeHTTP(rw, req)
+	}
+	var got chunkManifest
+	if err := json.Unmarshal(rw.Body.Bytes(), &got); err != nil {
+		t.Fatalf("last chunk = %d %q: %v", rw.Code, rw.Body, err)
+	}
+	want := chunkManifest{
+		Alg:  "sha1",
+		Sum:  fmt.Sprintf("%x", sha1.Sum([]byte(data))),
+		Size: 12,
+		Root: rootOf(data, 5, 12),
+		Chunks: []manifestChunk{
+			{0, 5, hex.EncodeToString(merkle.Leaf([]byte("hello")))},
+			{5, 7, hex.EncodeToString(merkle.Leaf([]byte(", world")))},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("manifest = %+v; want %+v", got, want)
+	}
+}
+
+func TestResumableMaxChunks(t *testing.T) {
+	defer func(u store.UploadLog, rs *resumable.Store, n int) { uploads, resumables, maxChunks = u, rs, n }(uploads, resumables, maxChunks)
+	uploads, resumables, maxChunks = store.NewMemoryUploads(10), new(resumable.Store), 3
+	mux := newMux(logtail.NewRing(10))
+
+	rw := httptest.NewRecorder()
+	mux.ServeHTTP(rw, httptest.NewRequest("POST", "/upload/resumable", nil))
+	loc := rw.Header().Get("Location")
+	put := func(start, end int) int {
+		req := httptest.NewRequest("PUT", loc, strings.NewReader(strings.Repeat("x", end-start+1)))
+		req.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/10", start, end))
+		rw := httptest.NewRecorder()
+		mux.ServeHTTP(rw, req)
+		return rw.Code
+	}
+	put(0, 1)
+	put(2, 3)
+	// The third and last chunk allowed must complete the upload.
+	if code := put(4, 5); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("third chunk, not the last = %d; want 413", code)
+	}
+	if code := put(4, 9); code != http.StatusOK {
+		t.Errorf("third chunk, completing the upload = %d; want 200", code)
+	}
+}
+
+// BenchmarkResumableChunkSize uploads 4 MiB in chunks of each size.
+// Smaller chunks lose less to a dropped connection and give the
+// Merkle tree more leaves to verify by, at the cost of a request, and
+// a node or two of the tree, apiece:
+//
+//	go test -run=^$ -bench=ResumableChunkSize -benchmem ./stepn
+func BenchmarkResumableChunkSize(b *testing.B) {
+	defer func(u store.UploadLog, rs *resumable.Store) { uploads, resumables = u, rs }(uploads, resumables)
+	uploads, resumables = store.NewMemoryUploads(10), new(resumable.Store)
+	const total = 4 << 20
+	data := bytes.Repeat([]byte("a"), total)
+	for _, size := range []int{64 << 10, 256 << 10, 1 << 20, 4 << 20} {
+		b.Run(fmt.Sprintf("chunk=%dK", size>>10), func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(total)
+			for benchtest.Loop(b) {
+				rw := httptest.NewRecorder()
+				handleResumableCreate(rw, httptest.NewRequest("POST", "/upload/resumable", nil))
+				loc := rw.Header().Get("Location")
+				for start := 0; start < total; start += size {
+					req := httptest.NewRequest("PUT", loc, bytes.NewReader(data[start:start+size]))
+					req.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, start+size-1, total))
+					rw = httptest.NewRecorder()
+					handleResumableChunk(rw, req)
+				}
+				if rw.Code != 200 {
+					b.Fatalf("last chunk = %d %s", rw.Code, rw.Body)
+				}
+			}
+		})
+	}
+}
+
+func TestParseContentRange(t *testing.T) {
+	for _, tt := range []struct {
+		in                string
+		start, end, total int64
+		ok                bool
+	}{
+		{"bytes 0-9/10", 0, 9, 10, true},
+		{"bytes 10-19/*", 10, 19, -1, true},
+		{"bytes 0-9", 0, 0, 0, false},
+		{"bytes 0-10/10", 0, 0, 0, false},
+		{"bytes 5-4/10", 0, 0, 0, false},
+		{"bytes -1-4/10", 0, 0, 0, false},
+		{"bytes */10", 0, 0, 0, false},
+		{"items 0-9/10", 0, 0, 0, false},
+		{"", 0, 0, 0, false},
+	} {
+		start, end, total, err := parseContentRange(tt.in)
+		if (err == nil) != tt.ok || start != tt.start || end != tt.end || total != tt.total {
+			t.Errorf("parseContentRange(%q) = %d, %d, %d, %v", tt.in, start, end, total, err)
+		}
+	}
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"expvar"
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"slices"
+	"strings"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/errcode"
+	"github.com/bradfitz/talk-yapc-asia-2015/logtail"
+	"github.com/bradfitz/talk-yapc-asia-2015/metrics"
+)
+
+// A route is one endpoint. The tables of them below are the one place
+// endpoints are declared: newMux and adminMux serve them, /openapi.json
+// documents them, and /debug/routes lists them, so the three can't
+// disagree. TestRoutesAgree checks that they don't.
+type route struct {
+	methods []string // the only ones the mux lets through; others get a 405
+	pattern string   // a ServeMux pattern, without a method
+	summary string
+	auth    routeAuth
+	limit   routeLimit
+	timed   bool // for /stats' latency percentiles
+	handler http.Handler
+}
+
+// A routeAuth is what a route needs of its client.
+type routeAuth int
+
+const (
+	authNone     routeAuth = iota
+	authKeyIfSet           // a key from -apikeys, if it's set
+	authKey                // a key from -apikeys; refused without it
+)
+
+func (a routeAuth) String() string {
+	return [...]string{"none", "apikey if set", "apikey"}[a]
+}
+
+// A routeLimit is how a route's handler is held back under load, on
+// top of -ratelimit's per-client limit.
+type routeLimit int
+
+const (
+	limitNone    routeLimit = iota
+	limitUploads            // at most -uploadlimit at once; more get a 503
+	limitStream             // lasts as long as the client, until shutdown
+)
+
+func (l routeLimit) String() string {
+	return [...]string{"none", "uploads", "stream"}[l]
+}
+
+// pipeline returns the stages rt's limit and timing put in front of
+// its handler. A limitUploads route takes a slot of uploads, which
+// every such route on its mux shares.
+func (rt route) pipeline(uploads chan struct{}) pipeline {
+	var p pipeline
+	if rt.timed {
+		p = append(p, stage{"timed", func(h http.Handler) http.Handler { return timed(rt.pattern, h.ServeHTTP) }})
+	}
+	switch rt.limit {
+	case limitUploads:
+		p = append(p, stage{"uploads", func(h http.Handler) http.Handler { return limitConcurrency(uploads, h.ServeHTTP) }})
+	case limitStream:
+		// Streams end when the server shuts down rather than hold
+		// up its drain.
+		p = append(p, stage{"stream", endOnShutdown})
+	}
+	return p
+}
+
+// build returns rt's handler behind its pipeline.
+func (rt route) build(uploads chan struct{}) http.Handler {
+	return rt.pipeline(uploads).then(rt.handler)
+}
+
+var getOnly = []string{"GET", "HEAD"}
+
+// publicRoutes returns the public listener's routes, followed by the
+// plugins'. Streams aren't timed, as they'd only swamp the
+// percentiles.
+func publicRoutes(logRing *logtail.Ring) (rs []route) {
+	rs = []route{
+		{getOnly, "/", "welcome page; counts a visit, as HTML or JSON", authNone, limitNone, true, http.HandlerFunc(handleRoot)},
+		{[]string{"PUT"}, "/upload", "hash the body, with ?alg=, or several comma-separated, in parallel with ?fanout=1; ?progress=1 streams progress, and ?trailer=1 the digest in a trailer too", authNone, limitUploads, true, http.HandlerFunc(handlePost)},
+		{[]string{"POST"}, "/upload/multipart", "hash each file of a multipart form", authNone, limitUploads, true, http.HandlerFunc(handleMultipart)},
+		{[]string{"POST"}, "/upload/resumable", "start a resumable upload", authNone, limitUploads, false, http.HandlerFunc(handleResumableCreate)},
+		{[]string{"GET", "HEAD", "PUT"}, "/upload/resumable/", "add a chunk to a resumable upload, or see what's been received", authNone, limitUploads, true, http.HandlerFunc(handleResumableChunk)},
+		{getOnly, "/history", "recent uploads", authNone, limitNone, true, http.HandlerFunc(handleHistory)},
+		{getOnly, "/v1/visit", "count a visit (deprecated; see /v2/visit)", authNone, limitNone, true, handleVisitV1},
+		{getOnly, "/v2/visit", "count a visit, with its tenant and session", authNone, limitNone, true, handleVisitV2},
+		{[]string{"POST"}, "/visits/batch", "apply a batch of visits", authNone, limitNone, true, http.HandlerFunc(handleVisitBatch)},
+		{getOnly, "/stats", "live numbers, as JSON", authNone, limitNone, true, http.HandlerFunc(handleStats)},
+		{getOnly, "/version", "build and CPU information", authNone, limitNone, false, http.HandlerFunc(handleVersion)},
+		{getOnly, "/static/", "static files, cached forever", authNone, limitNone, false, staticHandler()},
+		{getOnly, "/fetch", "stream ?url= from a -fetchhosts host, checking it against ?sha1=", authNone, limitNone, true, http.HandlerFunc(handleFetch)},
+		{getOnly, "/blob/", "files from -blobdir, memory-mapped per -mmap", authNone, limitNone, false, http.HandlerFunc(handleBlob)},
+		{getOnly, "/file", "a generated -filesize file, with ranges and sendfile, or with ?naive=1, copied by hand", authNone, limitNone, false, http.HandlerFunc(handleFile)},
+		{getOnly, "/live", "the visitor count over a WebSocket", authNone, limitStream, false, http.HandlerFunc(handleLive)},
+		{getOnly, "/events", "the visitor count as server-sent events", authNone, limitStream, false, http.HandlerFunc(handleEvents)},
+		{getOnly, "/history/export", "every upload, as CSV or NDJSON", authNone, limitNone, false, http.HandlerFunc(handleHistoryExport)},
+		{getOnly, "/export/events.ndjson", "the audit log, from a cursor", authNone, limitNone, false, http.HandlerFunc(handleEventExport)},
+		{getOnly, "/debug/logtail", "the log, streamed", authNone, limitStream, false, logRing},
+		{getOnly, "/metrics", "Prometheus metrics", authNone, limitNone, false, metrics.Default},
+		{getOnly, "/openapi.json", "OpenAPI description of these routes", authNone, limitNone, false, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			writeTaggedJSON(w, r, openAPI(rs))
+		})},
+	}
+	for _, p := range plugins {
+		rs = append(rs, p.Routes...)
+	}
+	return rs
+}
+
+// adminRoutes returns the admin listener's routes.
+func adminRoutes() []route {
+	return []route{
+		{[]string{"POST"}, "/admin/reset", "reset the visitor count, and with ?stats=1 the percentiles", authKey, limitNone, false, http.HandlerFunc(handleAdminReset)},
+		{getOnly, "/stats", "live numbers, as JSON", authKeyIfSet, limitNone, false, http.HandlerFunc(handleStats)},
+		{getOnly, "/debug/vars", "expvar, including the command line", authKeyIfSet, limitNone, false, expvar.Handler()},
+		{getOnly, "/debug/routes", "this table of routes, for both listeners", authKeyIfSet, limitNone, false, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			writeTaggedJSON(w, r, routeList(publicRoutes(nil), adminRoutes()))
+		})},
+		{getOnly, "/debug/pprof/", "profiles: heap, goroutine, block, ...", authKeyIfSet, limitNone, false, http.HandlerFunc(pprof.Index)},
+		{getOnly, "/debug/pprof/cmdline", "the command line", authKeyIfSet, limitNone, false, http.HandlerFunc(pprof.Cmdline)},
+		{getOnly, "/debug/pprof/profile", "a CPU profile", authKeyIfSet, limitNone, false, http.HandlerFunc(pprof.Profile)},
+		{[]string{"GET", "POST"}, "/debug/pprof/symbol", "look up program counters", authKeyIfSet, limitNone, false, http.HandlerFunc(pprof.Symbol)},
+		{getOnly, "/debug/pprof/trace", "an execution trace", authKeyIfSet, limitNone, false, http.HandlerFunc(pprof.Trace)},
+	}
+}
+
+// routeMux returns a mux serving rs. Each route is registered once
+// per method, as "PUT /upload", so handlers needn't check the method;
+// a GET pattern takes HEAD too. Each is registered as well for the
+// other common methods, answering them with a 405 in errcode's JSON:
+// a bare pattern would be outranked by "GET /" on a GET, and
+// ServeMux's own 405 is plain text. Any other method still gets that.
+// The limitUploads routes share -uploadlimit between them.
+func routeMux(rs []route) *http.ServeMux {
+	mux := http.NewServeMux()
+	uploads := make(chan struct{}, *uploadLimit)
+	for _, rt := range rs {
+		h := rt.build(uploads)
+		for _, m := range rt.methods {
+			if m == "HEAD" && slices.Contains(rt.methods, "GET") {
+				continue
+			}
+			mux.Handle(m+" "+rt.pattern, h)
+		}
+		for _, m := range commonMethods {
+			if !slices.Contains(rt.methods, m) && !(m == "HEAD" && slices.Contains(rt.methods, "GET")) {
+				mux.Handle(m+" "+rt.pattern, methodNotAllowed(rt.methods))
+			}
+		}
+	}
+	return mux
+}
+
+// commonMethods are the methods routeMux answers with a 405 of its own
+// on routes that don't take them.
+var commonMethods = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE"}
+
+// methodNotAllowed returns a handler answering with a 405 that lists
+// methods in its Allow header.
+func methodNotAllowed(methods []string) http.Handler {
+	allow := strings.Join(methods, ", ")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Allow", allow)
+		errcode.Write(w, fmt.Errorf("%w; want %s", errcode.ErrBadMethod, strings.Join(methods, " or ")))
+	})
+}
+
+// pathPattern returns pattern, as a routeMux reports the one a request
+// matched, without its method: the route's pattern in its table.
+func pathPattern(pattern string) string {
+	if _, path, ok := strings.Cut(pattern, " "); ok {
+		return path
+	}
+	return pattern
+}
+
+// A routeInfo is a route as /debug/routes lists it.
+type routeInfo struct {
+	Listener string   `json:"listener"`
+	Methods  []string `json:"methods"`
+	Pattern  string   `json:"pattern"`
+	Summary  string   `json:"summary"`
+	Auth     string   `json:"auth"`
+	Limit    string   `json:"limit"`
+	Timed    bool     `json:"timed"`
+}
+
+func routeList(public, admin []route) []routeInfo {
+	var list []routeInfo
+	for _, l := range []struct {
+		name string
+		rs   []route
+	}{{"public", public}, {"admin", admin}} {
+		for _, rt := range l.rs {
+			list = append(list, routeInfo{l.name, rt.methods, rt.pattern, rt.summary, rt.auth.String(), rt.limit.String(), rt.timed})
+		}
+	}
+	return list
+}
+
+// openAPIPath returns pattern as an OpenAPI path. A pattern for a
+// subtree, such as "/static/", gets a {path} parameter for the rest.
+func openAPIPath(pattern string) string {
+	if pattern != "/" && strings.HasSuffix(pattern, "/") {
+		return pattern + "{path}"
+	}
+	return pattern
+}
+
+type openAPIDoc struct {
+	OpenAPI string                                 `json:"openapi"`
+	Info    openAPIInfo                            `json:"info"`
+	Paths   map[string]map[string]openAPIOperation `json:"paths"`
+}
+
+type openAPIInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type openAPIOperation struct {
+	Summary    string                     `json:"summary"`
+	Parameters []openAPIParameter         `json:"parameters,omitempty"`
+	Responses  map[string]openAPIResponse `json:"responses"`
+	Limit      string                     `json:"x-limit,omitempty"`
+}
+
+type openAPIParameter struct {
+	Name     string            `json:"name"`
+	In       string            `json:"in"`
+	Required bool              `json:"required"`
+	Schema   map[string]string `json:"schema"`
+}
+
+type openAPIResponse struct {
+	Description string `json:"description"`
+}
+
+// openAPI returns an OpenAPI 3 description of rs, the public routes.
+// It has each route's methods and summary; the details are in the
+// handlers' docs.
+func openAPI(rs []route) openAPIDoc {
+	doc := openAPIDoc{
+		OpenAPI: "3.0.3",
+		Info:    openAPIInfo{Title: "stepn", Version: "1"},
+		Paths:   map[string]map[string]openAPIOperation{},
+	}
+	for _, rt := range rs {
+		path := openAPIPath(rt.pattern)
+		op := openAPIOperation{
+			Summary:   rt.summary,
+			Responses: map[string]openAPIResponse{"default": {"the response, or an error as errcode JSON"}},
+		}
+		if path != rt.pattern {
+			op.Parameters = []openAPIParameter{{"path", "path", true, map[string]string{"type": "string"}}}
+		}
+		if rt.limit != limitNone {
+			op.Limit = rt.limit.String()
+		}
+		ops := map[string]openAPIOperation{}
+		for _, m := range rt.methods {
+			ops[strings.ToLower(m)] = op
+		}
+		doc.Paths[path] = ops
+	}
+	return doc
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/errcode"
+	"github.com/bradfitz/talk-yapc-asia-2015/logtail"
+)
+
+// TestRoutesAgree checks that the muxes, /openapi.json, and
+// /debug/routes all have exactly the routes in the tables.
+func TestRoutesAgree(t *testing.T) {
+	public, admin := publicRoutes(logtail.NewRing(10)), adminRoutes()
+	get := func(mux http.Handler, path string, v interface{}) {
+		t.Helper()
+		rw := httptest.NewRecorder()
+		mux.ServeHTTP(rw, httptest.NewRequest("GET", path, nil))
+		if err := json.Unmarshal(rw.Body.Bytes(), v); err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+	}
+	var doc openAPIDoc
+	get(newMux(logtail.NewRing(10)), "/openapi.json", &doc)
+	var list []routeInfo
+	get(adminMux(), "/debug/routes", &list)
+
+	for _, l := range []struct {
+		name   string
+		rs     []route
+		serves func(method, path string) (pattern string)
+	}{
+		{"public", public, func(method, path string) string {
+			_, pattern := newMux(nil).Handler(httptest.NewRequest(method, path, nil))
+			return pattern
+		}},
+		{"admin", admin, func(method, path string) string {
+			_, pattern := adminMux().Handler(httptest.NewRequest(method, path, nil))
+			return pattern
+		}},
+	} {
+		for _, rt := range l.rs {
+			path := rt.pattern
+			if strings.HasSuffix(path, "/") {
+				path += "x"
+			}
+			for _, m := range rt.methods {
+				if got, want := l.serves(m, path), m+" "+rt.pattern; got != want && !(m == "HEAD" && got == "GET "+rt.pattern) {
+					t.Errorf("%s mux serves %s %s with %q; want %q", l.name, m, path, got, want)
+				}
+			}
+			i := slices.IndexFunc(list, func(ri routeInfo) bool { return ri.Listener == l.name && ri.Pattern == rt.pattern })
+			if i < 0 || !slices.Equal(list[i].Methods, rt.methods) || list[i].Auth != rt.auth.String() || list[i].Limit != rt.limit.String() {
+				t.Errorf("/debug/routes doesn't list %s %s %v as in its table", l.name, rt.pattern, rt.methods)
+			}
+			if l.name != "public" {
+				continue
+			}
+			ops := doc.Paths[openAPIPath(rt.pattern)]
+			var methods []string
+			for m := range ops {
+				methods = append(methods, strings.ToUpper(m))
+			}
+			slices.Sort(methods)
+			want := slices.Clone(rt.methods)
+			slices.Sort(want)
+			if !slices.Equal(methods, want) {
+				t.Errorf("/openapi.json has %s with methods %v; want %v", rt.pattern, methods, want)
+			}
+		}
+	}
+	if len(doc.Paths) != len(public) {
+		t.Errorf("/openapi.json has %d paths; want the %d public routes", len(doc.Paths), len(public))
+	}
+	if len(list) != len(public)+len(admin) {
+		t.Errorf("/debug/routes lists %d routes; want %d", len(list), len(public)+len(admin))
+	}
+
+	// A path in no table gets the welcome page's catch-all.
+	if _, pattern := newMux(nil).Handler(httptest.NewRequest("GET", "/no/such/route", nil)); pattern != "GET /" {
+		t.Errorf("unknown path served by %q", pattern)
+	}
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	for _, tt := range []struct {
+		mux    http.Handler
+		method string
+		path   string
+		status int
+		allow  string
+	}{
+		{newMux(nil), "GET", "/upload", 405, "PUT"},
+		{newMux(nil), "DELETE", "/history", 405, "GET, HEAD"},
+		{newMux(nil), "POST", "/no/such/route", 405, "GET, HEAD"},
+		{adminMux(), "GET", "/admin/reset", 405, "POST"},
+		{adminMux(), "GET", "/no/such/route", 404, ""},
+	} {
+		rw := httptest.NewRecorder()
+		tt.mux.ServeHTTP(rw, httptest.NewRequest(tt.method, tt.path, nil))
+		if rw.Code != tt.status || rw.Header().Get("Allow") != tt.allow {
+			t.Errorf("%s %s = %d, Allow %q; want %d, Allow %q", tt.method, tt.path, rw.Code, rw.Header().Get("Allow"), tt.status, tt.allow)
+		}
+		if tt.status != 405 {
+			continue
+		}
+		var res errcode.Response
+		if err := json.Unmarshal(rw.Body.Bytes(), &res); err != nil || res.Code != "bad_method" {
+			t.Errorf("%s %s: body %q; want errcode bad_method", tt.method, tt.path, rw.Body)
+		}
+	}
+}
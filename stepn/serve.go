@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// newServer returns a server for h with the timeouts and header limit
+// from the flags. The zero http.Server has none, so one slow or
+// malicious client can hold a connection, and its goroutine, forever.
+func newServer(h http.Handler) *http.Server {
+	return &http.Server{
+		Handler:           h,
+		ReadHeaderTimeout: *readHeaderTimeout,
+		ReadTimeout:       *readTimeout,
+		WriteTimeout:      *writeTimeout,
+		IdleTimeout:       *idleTimeout,
+		MaxHeaderBytes:    *maxHeaderBytes,
+	}
+}
+
+// liftWriteDeadline exempts the rest of w's response from
+// -writetimeout, for handlers whose requests or responses rightly run
+// longer: uploads, whose deadline is counted from the end of the
+// request header, so a slow body eats into it, and big downloads.
+// -readtimeout still bounds an upload's body.
+func liftWriteDeadline(w http.ResponseWriter) {
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+}
+
+// serve runs srv on ln until a signal arrives on sigc, then stops
+// accepting connections and waits up to drain for in-flight requests,
+// such as uploads, to finish. It returns the process exit code: 0 for
+// a clean drain, 1 if requests had to be cut off or serving failed.
+//
+// If the signal is restartSignal, serve first calls restart to start
+// the server's replacement, and keeps serving if that fails.
+func serve(srv *http.Server, ln net.Listener, sigc <-chan os.Signal, drain time.Duration, restart func() error) int {
+	stopping, stop := context.WithCancel(context.Background())
+	defer stop()
+	srv.BaseContext = func(net.Listener) context.Context {
+		return context.WithValue(context.Background(), stoppingKey{}, stopping)
+	}
+	srv.RegisterOnShutdown(stop)
+
+	errc := make(chan error, 1)
+	go func() { errc <- srv.Serve(ln) }()
+
+	for {
+		select {
+		case err := <-errc:
+			log.Printf("ERROR: serving: %v", err)
+			return 1
+		case sig := <-sigc:
+			if sig == restartSignal && restart != nil {
+				if err := restart(); err != nil {
+					log.Printf("ERROR: restart: %v; still serving", err)
+					continue
+				}
+				log.Printf("Got %v; started a replacement", sig)
+			}
+			log.Printf("Got %v; draining for up to %v (%d uploads in flight)", sig, drain, atomic.LoadInt64(&activeUploads))
+		}
+		break
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), drain)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("ERROR: drain incomplete (%v; %d uploads in flight); closing connections", err, atomic.LoadInt64(&activeUploads))
+		srv.Close()
+		return 1
+	}
+	log.Printf("Drained cleanly.")
+	return 0
+}
+
+// stoppingKey is the context key for the context serve cancels when
+// its server starts shutting down.
+type stoppingKey struct{}
+
+// endOnShutdown wraps h, a stream that lasts as long as its client
+// stays, to cancel the request's context once the server starts
+// shutting down. Shutdown waits for every request to finish, so an
+// unwrapped stream would hold it for the whole drain and then get
+// in-flight uploads cut off along with it.
+func endOnShutdown(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stopping, ok := r.Context().Value(stoppingKey{}).(context.Context)
+		if !ok {
+			h.ServeHTTP(w, r)
+			return
+		}
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+		defer context.AfterFunc(stopping, cancel)()
+		h.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// startServe runs serve on a fresh localhost listener and returns its
+// URL, the signal channel, and the channel serve's exit code arrives on.
+func startServe(t *testing.T, drain time.Duration, restart func() error) (string, chan os.Signal, chan int) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/upload", handlePost)
+	sigc := make(chan os.Signal, 1)
+	codec := make(chan int, 1)
+	go func() { codec <- serve(&http.Server{Handler: mux}, ln, sigc, drain, restart) }()
+	return "http://" + ln.Addr().String(), sigc, codec
+}
+
+// startUpload begins a PUT whose body the caller finishes through the
+// returned pipe. It waits until the handler is running.
+func startUpload(t *testing.T, url string) (*io.PipeWriter, chan *http.Response) {
+	before := atomic.LoadInt64(&activeUploads)
+	pr, pw := io.Pipe()
+	req, _ := http.NewRequest("PUT", url+"/upload", pr)
+	resc := make(chan *http.Response, 1)
+	go func() {
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			resc <- nil
+			return
+		}
+		resc <- res
+	}()
+	pw.Write([]byte("hello "))
+	for atomic.LoadInt64(&activeUploads) == before {
+		time.Sleep(time.Millisecond)
+	}
+	return pw, resc
+}
+
+func TestServeDrainsUploads(t *testing.T) {
+	url, sigc, codec := startServe(t, 5*time.Second, nil)
+	pw, resc := startUpload(t, url)
+
+	sigc <- os.Interrupt
+	time.Sleep(50 * time.Millisecond) // let Shutdown begin
+	pw.Write([]byte("world"))
+	pw.Close()
+
+	res := <-resc
+	if res == nil {
+		t.Fatal("in-flight upload failed during drain")
+	}
+	slurp, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if !strings.Contains(string(slurp), "in 11 bytes") {
+		t.Errorf("upload response = %q", slurp)
+	}
+	if code := <-codec; code != 0 {
+		t.Errorf("exit code = %d; want 0", code)
+	}
+}
+
+func TestServeForcedShutdown(t *testing.T) {
+	url, sigc, codec := startServe(t, 50*time.Millisecond, nil)
+	pw, _ := startUpload(t, url)
+	defer pw.Close()
+
+	sigc <- os.Interrupt
+	select {
+	case code := <-codec:
+		if code != 1 {
+			t.Errorf("exit code = %d; want 1", code)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("serve didn't give up on the hung upload")
+	}
+}
+
+// TestReadTimeout shows the server's read timeouts cutting off slow
+// clients: one that never finishes its headers, and one that stalls
+// partway through an upload's body.
+func TestReadTimeout(t *testing.T) {
+	defer func(h, r time.Duration) { *readHeaderTimeout, *readTimeout = h, r }(*readHeaderTimeout, *readTimeout)
+	*readHeaderTimeout = 100 * time.Millisecond
+	*readTimeout = 300 * time.Millisecond
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/upload", handlePost)
+	srv := newServer(mux)
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	for _, tt := range []struct {
+		name, sent string
+		within     time.Duration
+	}{
+		{"slow headers", "PUT /upload HTTP/1.1\r\nHost: x\r\n", *readHeaderTimeout},
+		{"slow body", "PUT /upload HTTP/1.1\r\nHost: x\r\nContent-Length: 100\r\n\r\nonly ten b", *readTimeout},
+	} {
+		c, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(c, tt.sent)
+		t0 := time.Now()
+		c.SetReadDeadline(t0.Add(5 * time.Second))
+		// The server replies with an error or just hangs up; either
+		// way the connection is done.
+		_, err = io.Copy(ioutil.Discard, c)
+		if d := time.Since(t0); err != nil || d > tt.within+time.Second {
+			t.Errorf("%s: connection still open after %v (%v); want it closed after about %v", tt.name, d, err, tt.within)
+		}
+		c.Close()
+	}
+}
+
+func TestWriteTimeoutSparesUploads(t *testing.T) {
+	defer func(w time.Duration) { *writeTimeout = w }(*writeTimeout)
+	*writeTimeout = 100 * time.Millisecond
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/upload", handlePost)
+	srv := newServer(mux)
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	c, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	io.WriteString(c, "PUT /upload HTTP/1.1\r\nHost: x\r\nContent-Length: 5\r\nConnection: close\r\n\r\nhe")
+	time.Sleep(3 * *writeTimeout)
+	io.WriteString(c, "llo")
+	c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	res, err := io.ReadAll(c)
+	if !strings.HasPrefix(string(res), "HTTP/1.1 200") || !strings.Contains(string(res), "aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d") {
+		t.Errorf("upload outlasting -writetimeout got %q (%v); want its digest", res, err)
+	}
+}
+
+func TestServeRestart(t *testing.T) {
+	if restartSignal == nil {
+		t.Skip("no restart signal on " + runtime.GOOS)
+	}
+	fail := true
+	restarts := 0
+	url, sigc, codec := startServe(t, 5*time.Second, func() error {
+		restarts++
+		if fail {
+			return errors.New("exec failed")
+		}
+		return nil
+	})
+
+	// A failed restart leaves the server serving.
+	sigc <- restartSignal
+	time.Sleep(50 * time.Millisecond)
+	// Without keep-alives, so the upload below doesn't race a spare
+	// connection that would hold up the drain.
+	c := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	res, err := c.Get(url + "/upload")
+	if err != nil {
+		t.Fatalf("after a failed restart: %v", err)
+	}
+	res.Body.Close()
+
+	fail = false
+	pw, resc := startUpload(t, url)
+	sigc <- restartSignal
+	time.Sleep(50 * time.Millisecond)
+	pw.Write([]byte("world"))
+	pw.Close()
+	if res := <-resc; res == nil {
+		t.Fatal("in-flight upload failed during restart")
+	}
+	if code := <-codec; code != 0 || restarts != 2 {
+		t.Errorf("exit code %d after %d restarts; want 0 after 2", code, restarts)
+	}
+}
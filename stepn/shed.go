@@ -0,0 +1,30 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/errcode"
+	"github.com/bradfitz/talk-yapc-asia-2015/metrics"
+)
+
+var requestsShed = metrics.NewCounterVec("http_requests_shed_total", "Requests refused with a 503 because their handler was at its concurrency limit.")
+
+// limitConcurrency returns a handler running h only while holding one
+// of sem's slots, so handlers sharing sem run at most cap(sem) calls
+// at once between them. A request arriving when all are busy gets an
+// immediate 503 instead of waiting: queueing would only hold its
+// connection and memory while the ones ahead of it got slower.
+func limitConcurrency(sem chan struct{}, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case sem <- struct{}{}:
+		default:
+			requestsShed.Inc()
+			w.Header().Set("Retry-After", "1")
+			errcode.Write(w, errcode.ErrOverloaded)
+			return
+		}
+		defer func() { <-sem }()
+		h(w, r)
+	}
+}
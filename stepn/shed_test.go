@@ -0,0 +1,106 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestLimitConcurrency(t *testing.T) {
+	const limit, clients = 3, 20
+	var running, peak int64
+	release := make(chan struct{})
+	started := make(chan struct{}, clients)
+	h := limitConcurrency(make(chan struct{}, limit), func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt64(&running, 1)
+		defer atomic.AddInt64(&running, -1)
+		for {
+			p := atomic.LoadInt64(&peak)
+			if n <= p || atomic.CompareAndSwapInt64(&peak, p, n) {
+				break
+			}
+		}
+		started <- struct{}{}
+		<-release
+	})
+
+	codes := make(chan int, clients)
+	var wg sync.WaitGroup
+	for i := 0; i < clients; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rw := httptest.NewRecorder()
+			h(rw, httptest.NewRequest("PUT", "/upload", nil))
+			codes <- rw.Code
+		}()
+	}
+	// The first limit requests hold their slots until released, so
+	// the other requests must all be shed.
+	for i := 0; i < limit; i++ {
+		<-started
+	}
+	shed := 0
+	for shed < clients-limit {
+		if code := <-codes; code != http.StatusServiceUnavailable {
+			t.Fatalf("got %d while at the limit; want 503", code)
+		}
+		shed++
+	}
+	close(release)
+	wg.Wait()
+	close(codes)
+	for code := range codes {
+		if code != http.StatusOK {
+			t.Errorf("admitted request got %d", code)
+		}
+	}
+	if peak != limit {
+		t.Errorf("peak concurrency %d; want %d", peak, limit)
+	}
+
+	// With the slots free again, requests are admitted.
+	release = make(chan struct{})
+	close(release)
+	rw := httptest.NewRecorder()
+	h(rw, httptest.NewRequest("PUT", "/upload", nil))
+	<-started
+	if rw.Code != http.StatusOK {
+		t.Errorf("after load: %d", rw.Code)
+	}
+}
+
+func TestUploadLimitShared(t *testing.T) {
+	defer func(n int) { *uploadLimit = n }(*uploadLimit)
+	*uploadLimit = 1
+	release := make(chan struct{})
+	started := make(chan struct{})
+	block := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+	})
+	mux := routeMux([]route{
+		{[]string{"PUT"}, "/a", "", authNone, limitUploads, false, block},
+		{[]string{"PUT"}, "/b", "", authNone, limitUploads, false, block},
+	})
+
+	done := make(chan int)
+	go func() {
+		rw := httptest.NewRecorder()
+		mux.ServeHTTP(rw, httptest.NewRequest("PUT", "/a", nil))
+		done <- rw.Code
+	}()
+	<-started
+	// /a holds the only slot, so /b, another route, is shed too.
+	rw := httptest.NewRecorder()
+	mux.ServeHTTP(rw, httptest.NewRequest("PUT", "/b", nil))
+	if rw.Code != http.StatusServiceUnavailable {
+		t.Errorf("PUT /b while /a held the slot: %d; want 503", rw.Code)
+	}
+	close(release)
+	if code := <-done; code != http.StatusOK {
+		t.Errorf("PUT /a: %d", code)
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/logtail"
+	"github.com/bradfitz/talk-yapc-asia-2015/metrics"
+	"github.com/bradfitz/talk-yapc-asia-2015/store"
+)
+
+// TestShutdownUnderLoad shuts the whole server down mid-load: uploads
+// half sent, SSE clients connected, visits arriving, and the snapshot
+// and SLO jobs running. Every request that reached a handler must
+// complete, every goroutine must exit, and the final snapshot must
+// hold every visit a client was told about.
+func TestShutdownUnderLoad(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping in -short mode")
+	}
+	defer func(c store.Counter, u store.UploadLog, every time.Duration) {
+		counter, uploads, *snapshotEvery = c, u, every
+	}(counter, uploads, *snapshotEvery)
+	n, _ := visitors.Load(context.Background())
+	defer visitors.Store(n)
+	visitors.Store(0)
+	counter, uploads = &visitors, store.NewMemoryUploads(100)
+	*snapshotEvery = 5 * time.Millisecond
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+
+	baseline := runtime.NumGoroutine()
+
+	statePath := filepath.Join(t.TempDir(), "visitors")
+	flush := persist(statePath)
+	stopSLO := make(chan struct{})
+	sloDone := make(chan bool)
+	go func() {
+		sloEval.Run(5*time.Millisecond, stopSLO)
+		close(sloDone)
+	}()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := "http://" + ln.Addr().String()
+	sigc := make(chan os.Signal, 1)
+	codec := make(chan int, 1)
+	srv := newServer(recoverPanics(metrics.InstrumentMux(newMux(logtail.NewRing(100)))))
+	go func() { codec <- serve(srv, ln, sigc, 10*time.Second, nil) }()
+
+	// SSE clients read until the server ends their streams.
+	const streams = 8
+	var wg sync.WaitGroup
+	streamErrs := make(chan error, streams)
+	subs := visitorHub.numSubscribers()
+	for i := 0; i < streams; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := client.Get(url + "/events")
+			if err != nil {
+				streamErrs <- err
+				return
+			}
+			defer res.Body.Close()
+			br := bufio.NewReader(res.Body)
+			for {
+				if _, err := br.ReadString('\n'); err != nil {
+					if err != io.EOF {
+						streamErrs <- err
+					}
+					return
+				}
+			}
+		}()
+	}
+	for visitorHub.numSubscribers() < subs+streams {
+		time.Sleep(time.Millisecond)
+	}
+
+	// Uploads wait half sent until shutdown has begun.
+	const numUploads = 8
+	var pipes []*io.PipeWriter
+	var uploadResults []chan *http.Response
+	for i := 0; i < numUploads; i++ {
+		pw, resc := startUpload(t, url)
+		pipes = append(pipes, pw)
+		uploadResults = append(uploadResults, resc)
+	}
+
+	// Visitors keep coming until the listener closes.
+	var told int64 // visits a client got a response for
+	var visitErrs int64
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				res, err := client.Get(url + "/")
+				if err != nil {
+					return // the listener has closed
+				}
+				io.Copy(io.Discard, res.Body)
+				res.Body.Close()
+				if res.StatusCode == http.StatusOK {
+					atomic.AddInt64(&told, 1)
+				} else {
+					atomic.AddInt64(&visitErrs, 1)
+				}
+			}
+		}()
+	}
+	for atomic.LoadInt64(&told) < 100 {
+		time.Sleep(time.Millisecond)
+	}
+
+	sigc <- os.Interrupt
+	for {
+		c, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			break
+		}
+		c.Close()
+		time.Sleep(time.Millisecond)
+	}
+	for _, pw := range pipes {
+		pw.Write([]byte("world"))
+		pw.Close()
+	}
+	for i, resc := range uploadResults {
+		res := <-resc
+		if res == nil {
+			t.Errorf("upload %d failed during shutdown", i)
+			continue
+		}
+		slurp, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+		if res.StatusCode != http.StatusOK || !strings.Contains(string(slurp), "in 11 bytes") {
+			t.Errorf("upload %d = %d %q", i, res.StatusCode, slurp)
+		}
+	}
+	select {
+	case code := <-codec:
+		if code != 0 {
+			t.Errorf("exit code = %d; want a clean drain", code)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("serve still draining after 10s")
+	}
+	wg.Wait()
+	close(streamErrs)
+	for err := range streamErrs {
+		t.Errorf("SSE client: %v", err)
+	}
+	if n := atomic.LoadInt64(&visitErrs); n > 0 {
+		t.Errorf("%d visits got an error status", n)
+	}
+
+	close(stopSLO)
+	<-sloDone
+	if err := flush(); err != nil {
+		t.Fatal(err)
+	}
+	slurp, err := os.ReadFile(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(bytes.TrimSpace(slurp)), strconv.FormatInt(atomic.LoadInt64(&told), 10); got != want {
+		t.Errorf("final snapshot = %s; want %s, the visits clients were told about", got, want)
+	}
+
+	http.DefaultTransport.(*http.Transport).CloseIdleConnections()
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > baseline {
+		if time.Now().After(deadline) {
+			buf := make([]byte, 1<<20)
+			t.Fatalf("%d goroutines left; started with %d:\n%s", runtime.NumGoroutine(), baseline, buf[:runtime.Stack(buf, true)])
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
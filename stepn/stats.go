@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/metrics"
+)
+
+// sloEval watches the request metrics. Its windows are far shorter
+// than a production service would use, so an alert can fire and
+// clear while the audience watches.
+var sloEval = &metrics.Evaluator{
+	SLOs: []metrics.SLO{
+		{Name: "latency", Objective: 0.99, Latency: 100 * time.Millisecond},
+		{Name: "errors", Objective: 0.999},
+	},
+	Short: 30 * time.Second,
+	Long:  5 * time.Minute,
+}
+
+// routeLatency times the routes newMux wraps with timed, for
+// /metrics and the per-route percentiles in /stats.
+var routeLatency = metrics.NewRouteLatencies("http_route_latency_seconds", "HTTP response latency percentiles, by route.")
+
+// timed wraps h, the handler for pattern, to record its latency in
+// routeLatency.
+func timed(pattern string, h http.HandlerFunc) http.Handler {
+	return routeLatency.Handler(pattern, h)
+}
+
+// startTime is when the process started, for the uptime in /stats.
+var startTime = time.Now()
+
+// stats is the JSON body of /stats.
+type stats struct {
+	Uptime        float64                `json:"uptimeSeconds"`
+	Visitors      int64                  `json:"visitors"`
+	InFlight      int64                  `json:"inFlight"`
+	ActiveUploads int64                  `json:"activeUploads"`
+	DedupHits     int64                  `json:"dedupHits"`   // uploads answered by another's hashing
+	DedupMisses   int64                  `json:"dedupMisses"` // uploads with X-Content-Key hashed themselves
+	Alerts        []metrics.Alert        `json:"alerts"`
+	Routes        []metrics.RouteSummary `json:"routes"` // latencies in seconds
+}
+
+func handleStats(w http.ResponseWriter, r *http.Request) {
+	hits, misses := dedupCounts()
+	respond(w, r, stats{
+		Uptime:        time.Since(startTime).Seconds(),
+		Visitors:      atomic.LoadInt64(&lastVisitNum),
+		InFlight:      metrics.InFlight(),
+		ActiveUploads: atomic.LoadInt64(&activeUploads),
+		DedupHits:     hits,
+		DedupMisses:   misses,
+		Alerts:        sloEval.Alerts(),
+		Routes:        routeLatency.Summaries(),
+	})
+}
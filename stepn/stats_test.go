@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/logtail"
+	"github.com/bradfitz/talk-yapc-asia-2015/metrics"
+	"github.com/bradfitz/talk-yapc-asia-2015/store"
+)
+
+type failingUploads struct{}
+
+func (failingUploads) Add(context.Context, store.Upload) error { return errors.New("disk on fire") }
+func (failingUploads) Recent(context.Context, int) ([]store.Upload, error) {
+	return nil, errors.New("disk on fire")
+}
+
+func TestStatsAlerts(t *testing.T) {
+	defer func(e *metrics.Evaluator) { sloEval = e }(sloEval)
+	defer func(u store.UploadLog) { uploads = u }(uploads)
+	uploads = failingUploads{}
+	sloEval = &metrics.Evaluator{
+		SLOs:  []metrics.SLO{{Name: "errors", Objective: 0.99}},
+		Short: time.Minute,
+		Long:  time.Minute,
+	}
+	h := metrics.InstrumentMux(newMux(logtail.NewRing(10)))
+	t0 := time.Now()
+	sloEval.Evaluate(t0)
+	for i := 0; i < 5; i++ {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/history", nil))
+	}
+	sloEval.Evaluate(t0.Add(time.Second))
+
+	rw := httptest.NewRecorder()
+	h.ServeHTTP(rw, httptest.NewRequest("GET", "/stats", nil))
+	var got stats
+	if err := json.Unmarshal(rw.Body.Bytes(), &got); err != nil {
+		t.Fatalf("bad /stats JSON %q: %v", rw.Body, err)
+	}
+	if len(got.Alerts) != 1 || got.Alerts[0].SLO != "errors" {
+		t.Errorf("alerts after failing /history requests = %+v; want the errors SLO", got.Alerts)
+	}
+}
+
+func TestStatsRoutes(t *testing.T) {
+	h := metrics.InstrumentMux(newMux(logtail.NewRing(10)))
+	for i := 0; i < 3; i++ {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/history", nil))
+	}
+	rw := httptest.NewRecorder()
+	h.ServeHTTP(rw, httptest.NewRequest("GET", "/stats", nil))
+	var got stats
+	if err := json.Unmarshal(rw.Body.Bytes(), &got); err != nil {
+		t.Fatalf("bad /stats JSON %q: %v", rw.Body, err)
+	}
+	if got.Uptime <= 0 {
+		t.Errorf("uptime = %v; want positive", got.Uptime)
+	}
+	for _, r := range got.Routes {
+		if r.Route == "/history" {
+			if r.Requests < 3 || r.P50 <= 0 || r.P95 < r.P50 || r.P99 < r.P95 {
+				t.Errorf("/history = %+v; want at least 3 requests and ordered positive percentiles", r)
+			}
+			return
+		}
+	}
+	t.Errorf("/stats routes = %+v; want a /history entry", got.Routes)
+}
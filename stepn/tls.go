@@ -0,0 +1,119 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/config"
+)
+
+// newAutocert is set by plugin_autocert.go, built with -tags=autocert,
+// as the ACME client needs golang.org/x/crypto. It returns the TLS
+// config for domains, with certificates cached in cacheDir, and a
+// wrapper for the plain HTTP handler that answers ACME's http-01
+// challenges itself.
+var newAutocert func(domains []string, cacheDir string) (cfg *tls.Config, httpHandler func(fallback http.Handler) http.Handler)
+
+// tlsConfig returns the TLS config the flags ask for, or nil if TLS is
+// off. acme, if non-nil, wraps the plain HTTP handler.
+func tlsConfig() (cfg *tls.Config, acme func(http.Handler) http.Handler, err error) {
+	switch {
+	case *autocertDomain != "" && (*tlsCert != "" || *tlsKey != ""):
+		return nil, nil, errors.New("-autocert-domain and -tls-cert can't be used together")
+	case *autocertDomain != "":
+		if newAutocert == nil {
+			return nil, nil, errors.New("-autocert-domain needs a binary built with -tags=autocert")
+		}
+		cfg, acme := newAutocert(strings.Split(*autocertDomain, ","), *autocertCache)
+		return cfg, acme, nil
+	case *tlsCert != "" || *tlsKey != "":
+		if *tlsCert == "" || *tlsKey == "" {
+			return nil, nil, errors.New("-tls-cert and -tls-key go together")
+		}
+		cert, err := tls.LoadX509KeyPair(*tlsCert, *tlsKey)
+		if err != nil {
+			return nil, nil, err
+		}
+		return &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			NextProtos:   []string{"h2", "http/1.1"},
+		}, nil, nil
+	}
+	return nil, nil, nil
+}
+
+// listen opens the listener to serve the site on, wrapped in TLS if
+// the flags ask for it. With TLS on and -tls-listen set, the site is
+// served there instead of on -listen, and listen also returns a
+// listener on -listen and the handler for it, which sends plain HTTP
+// clients to HTTPS.
+func listen() (ln, httpLn net.Listener, httpHandler http.Handler, err error) {
+	cfg, acme, err := tlsConfig()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if cfg == nil || *tlsListen == "" {
+		ln, err = config.Listener(*config.Listen)
+	} else {
+		if httpLn, err = config.Listener(*config.Listen); err != nil {
+			return nil, nil, nil, err
+		}
+		if ln, err = config.Listener(*tlsListen); err != nil {
+			httpLn.Close()
+			return nil, nil, nil, err
+		}
+		httpHandler = redirectHTTPS(ln.Addr())
+		if acme != nil {
+			httpHandler = acme(httpHandler)
+		}
+	}
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if cfg != nil {
+		ln = tlsListener{tls.NewListener(ln, cfg), ln}
+	}
+	return ln, httpLn, httpHandler, nil
+}
+
+// A tlsListener is a TLS listener whose underlying socket can still
+// be handed to a new process on restart.
+type tlsListener struct {
+	net.Listener
+	raw net.Listener
+}
+
+func (l tlsListener) File() (*os.File, error) {
+	fl, ok := l.raw.(interface{ File() (*os.File, error) })
+	if !ok {
+		return nil, fmt.Errorf("%T has no file", l.raw)
+	}
+	return fl.File()
+}
+
+// redirectHTTPS returns a handler sending GET and HEAD requests to the
+// same URL over HTTPS on addr's port. Other methods get a 400, as
+// their bodies would already have gone out in the clear. The redirect
+// isn't permanent, so browsers don't remember it past the demo.
+func redirectHTTPS(addr net.Addr) http.Handler {
+	_, port, _ := net.SplitHostPort(addr.String())
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" && r.Method != "HEAD" {
+			http.Error(w, "Use HTTPS", http.StatusBadRequest)
+			return
+		}
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusFound)
+	})
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/config"
+)
+
+// writeCert writes a self-signed certificate for 127.0.0.1 and its key
+// to dir, returning the certificate's pool and the files' paths.
+func writeCert(t *testing.T, dir string) (pool *x509.CertPool, certFile, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	pool = x509.NewCertPool()
+	pool.AddCert(cert)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	return pool, certFile, keyFile
+}
+
+func TestTLSWithRedirect(t *testing.T) {
+	pool, certFile, keyFile := writeCert(t, t.TempDir())
+	defer func(c, k, l, tl string) {
+		*tlsCert, *tlsKey, *config.Listen, *tlsListen = c, k, l, tl
+	}(*tlsCert, *tlsKey, *config.Listen, *tlsListen)
+	*tlsCert, *tlsKey = certFile, keyFile
+	*config.Listen, *tlsListen = "127.0.0.1:0", "127.0.0.1:0"
+
+	ln, httpLn, redirect, err := listen()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if httpLn == nil {
+		t.Fatal("no HTTP listener with -tls-listen set")
+	}
+	go newServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.TLS.NegotiatedProtocol)
+	})).Serve(ln)
+	defer ln.Close()
+	go newServer(redirect).Serve(httpLn)
+	defer httpLn.Close()
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig:   &tls.Config{RootCAs: pool},
+			ForceAttemptHTTP2: true,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	res, err := client.Get("http://" + httpLn.Addr().String() + "/history?n=3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	want := "https://" + ln.Addr().String() + "/history?n=3"
+	if loc := res.Header.Get("Location"); res.StatusCode != http.StatusFound || loc != want {
+		t.Fatalf("plain HTTP got %v to %q; want a redirect to %q", res.Status, loc, want)
+	}
+
+	res, err = client.Get(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	if string(body) != "h2" {
+		t.Errorf("negotiated %q over HTTPS; want h2", body)
+	}
+}
+
+func TestRedirectHTTPS(t *testing.T) {
+	for _, tt := range []struct {
+		addr, method, host, want string
+		code                     int
+	}{
+		{"0.0.0.0:443", "GET", "demo.example:80", "https://demo.example/a?b=c", http.StatusFound},
+		{"0.0.0.0:8443", "HEAD", "demo.example", "https://demo.example:8443/a?b=c", http.StatusFound},
+		{"0.0.0.0:443", "PUT", "demo.example", "", http.StatusBadRequest},
+	} {
+		addr, _ := net.ResolveTCPAddr("tcp", tt.addr)
+		req := httptest.NewRequest(tt.method, "/a?b=c", nil)
+		req.Host = tt.host
+		rw := httptest.NewRecorder()
+		redirectHTTPS(addr).ServeHTTP(rw, req)
+		if rw.Code != tt.code || rw.Header().Get("Location") != tt.want {
+			t.Errorf("%s on %s = %d to %q; want %d to %q", tt.method, tt.addr, rw.Code, rw.Header().Get("Location"), tt.code, tt.want)
+		}
+	}
+}
+
+func TestTLSConfigErrors(t *testing.T) {
+	defer func(c, k, d string) { *tlsCert, *tlsKey, *autocertDomain = c, k, d }(*tlsCert, *tlsKey, *autocertDomain)
+	for _, tt := range []struct{ cert, key, domain, want string }{
+		{"cert.pem", "", "", "go together"},
+		{"cert.pem", "key.pem", "demo.example", "together"},
+		{"", "", "demo.example", "-tags=autocert"},
+	} {
+		if tt.domain != "" && newAutocert != nil && !strings.Contains(tt.want, "together") {
+			continue // this binary has autocert
+		}
+		*tlsCert, *tlsKey, *autocertDomain = tt.cert, tt.key, tt.domain
+		if _, _, err := tlsConfig(); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("tlsConfig with %+v = %v; want error containing %q", tt, err, tt.want)
+		}
+	}
+}
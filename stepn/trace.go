@@ -0,0 +1,32 @@
+package main
+
+import (
+	"context"
+	"net/http"
+)
+
+// startSpan starts a tracing span called name, a child of any span in
+// ctx, and returns a context carrying it and a func that ends it,
+// recording err if it's non-nil. It does nothing unless replaced by
+// plugin_otel.go, built with -tags=otel, as OpenTelemetry's SDK is a
+// large dependency for a demo.
+var startSpan = func(ctx context.Context, name string) (context.Context, func(err error)) {
+	return ctx, noSpan
+}
+
+// tracing is set when startSpan has been replaced by a real tracer.
+var tracing bool
+
+func noSpan(error) {}
+
+// startRequestSpan is startSpan for a handler's request, returning r
+// with the span's context. Without a tracer it returns r itself, as
+// r.WithContext's copy of the request is an allocation the untraced
+// hot path shouldn't pay for.
+func startRequestSpan(r *http.Request, name string) (*http.Request, func(err error)) {
+	if !tracing {
+		return r, noSpan
+	}
+	ctx, endSpan := startSpan(r.Context(), name)
+	return r.WithContext(ctx), endSpan
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/store"
+)
+
+type spanKey struct{}
+
+func TestHandlerSpans(t *testing.T) {
+	defer func(f func(context.Context, string) (context.Context, func(error)), on bool) {
+		startSpan, tracing = f, on
+	}(startSpan, tracing)
+	defer func(c store.Counter, v int64) { counter, *maxUpload = c, v }(counter, *maxUpload)
+	var got []string // "parent>child", in the order they end, with "!" if failed
+	startSpan = func(ctx context.Context, name string) (context.Context, func(error)) {
+		parent, _ := ctx.Value(spanKey{}).(string)
+		return context.WithValue(ctx, spanKey{}, name), func(err error) {
+			if err != nil {
+				name += "!"
+			}
+			got = append(got, parent+">"+name)
+		}
+	}
+	tracing = true
+
+	handleRoot(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	handlePost(httptest.NewRecorder(), httptest.NewRequest("PUT", "/upload", strings.NewReader("hello")))
+	counter, *maxUpload = failingCounter{}, 4
+	handleRoot(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	handlePost(httptest.NewRecorder(), httptest.NewRequest("PUT", "/upload", strings.NewReader("too long")))
+	want := []string{">handleRoot", "handlePost>hash.copy", ">handlePost", ">handleRoot!", "handlePost>hash.copy!", ">handlePost!"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("spans = %q; want %q", got, want)
+	}
+}
+
+func TestNoTracerKeepsRequest(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	if r, _ := startRequestSpan(req, "handleRoot"); r != req {
+		t.Error("startRequestSpan copied the request with no tracer installed")
+	}
+}
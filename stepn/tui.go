@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/logtail"
+	"github.com/bradfitz/talk-yapc-asia-2015/metrics"
+)
+
+// A tuiSample is the numbers the status screen shows, read once per
+// redraw.
+type tuiSample struct {
+	t          time.Time
+	latencies  metrics.Latencies
+	visitors   int64
+	inFlight   int64
+	uploads    int64
+	numGC      uint32
+	lastPause  time.Duration
+	heapAlloc  uint64
+	goroutines int
+	alerts     []metrics.Alert
+	phase      string // -demo's, if it's running
+}
+
+func takeTUISample() tuiSample {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	s := tuiSample{
+		t:          time.Now(),
+		latencies:  metrics.RequestLatencies(),
+		visitors:   atomic.LoadInt64(&lastVisitNum),
+		inFlight:   metrics.InFlight(),
+		uploads:    atomic.LoadInt64(&activeUploads),
+		numGC:      ms.NumGC,
+		heapAlloc:  ms.HeapAlloc,
+		goroutines: runtime.NumGoroutine(),
+		alerts:     sloEval.Alerts(),
+		phase:      demoPhaseName(),
+	}
+	if ms.NumGC > 0 {
+		s.lastPause = time.Duration(ms.PauseNs[(ms.NumGC+255)%256])
+	}
+	return s
+}
+
+// A tui draws the status screen "stepn serve -tui" shows instead of
+// its log: a terminal alternative to the browser dashboard for
+// projector demos, with plain ANSI escapes and no network needed.
+type tui struct {
+	w    io.Writer
+	addr string
+	logs *logtail.Ring
+
+	prev   tuiSample
+	rps    []float64 // newest last, at most sparkWidth
+	phases []string  // -demo's phase at each of rps
+}
+
+const sparkWidth = 40
+
+var sparkBars = []rune("▁▂▃▄▅▆▇█")
+
+// draw redraws the screen with s, comparing it with the previous
+// sample for rates.
+func (u *tui) draw(s tuiSample) {
+	secs := s.t.Sub(u.prev.t).Seconds()
+	interval := s.latencies.Sub(u.prev.latencies)
+	rps := float64(interval.Count()) / secs
+	u.rps = append(u.rps, rps)
+	u.phases = append(u.phases, s.phase)
+	if len(u.rps) > sparkWidth {
+		u.rps, u.phases = u.rps[1:], u.phases[1:]
+	}
+
+	var b strings.Builder
+	b.WriteString("\x1b[H\x1b[2J") // home, clear
+	fmt.Fprintf(&b, "\x1b[1mstepn\x1b[0m on %s    %s\n\n", u.addr, s.t.Format("15:04:05"))
+	row := func(label, format string, args ...interface{}) {
+		fmt.Fprintf(&b, "\x1b[1m%-11s\x1b[0m "+format+"\n", append([]interface{}{label}, args...)...)
+	}
+	row("Visitors", "%d", s.visitors)
+	row("Requests", "%8.1f/s  %s", rps, sparkline(u.rps))
+	if s.phase != "" {
+		row("Demo", "%-12s%s", s.phase, phaseMarks(u.phases))
+	}
+	row("Latency", "p50 %s  p90 %s  p99 %s",
+		fmtSeconds(interval.Quantile(0.5)), fmtSeconds(interval.Quantile(0.9)), fmtSeconds(interval.Quantile(0.99)))
+	row("In flight", "%d requests, %d uploads", s.inFlight, s.uploads)
+	row("GC", "%d (%.1f/s), last pause %v, heap %.1f MB, %d goroutines",
+		s.numGC, float64(s.numGC-u.prev.numGC)/secs, s.lastPause, float64(s.heapAlloc)/(1<<20), s.goroutines)
+	if len(s.alerts) == 0 {
+		row("Alerts", "none")
+	}
+	for _, a := range s.alerts {
+		row("Alerts", "\x1b[31m%s burning %.1fx since %s\x1b[0m", a.SLO, a.BurnRate, a.Since.Local().Format("15:04:05"))
+	}
+	if u.logs != nil {
+		b.WriteString("\n")
+		for _, line := range u.logs.Last(8) {
+			if len(line) > 120 {
+				line = line[:120]
+			}
+			b.WriteString(line + "\n")
+		}
+	}
+	io.WriteString(u.w, b.String())
+	u.prev = s
+}
+
+// sparkline draws vs as bars scaled to their maximum.
+func sparkline(vs []float64) string {
+	max := 0.0
+	for _, v := range vs {
+		max = math.Max(max, v)
+	}
+	var b strings.Builder
+	for _, v := range vs {
+		i := 0
+		if max > 0 {
+			i = int(v / max * float64(len(sparkBars)-1))
+		}
+		b.WriteRune(sparkBars[i])
+	}
+	return b.String()
+}
+
+// phaseMarks draws, under a sparkline of the same samples, the first
+// letter of each phase where it began.
+func phaseMarks(phases []string) string {
+	var b strings.Builder
+	for i, p := range phases {
+		if p != "" && (i == 0 || p != phases[i-1]) {
+			b.WriteByte(p[0])
+		} else {
+			b.WriteByte(' ')
+		}
+	}
+	return strings.TrimRight(b.String(), " ")
+}
+
+// fmtSeconds formats a latency quantile, which is NaN when there were
+// no requests.
+func fmtSeconds(s float64) string {
+	if math.IsNaN(s) {
+		return "-"
+	}
+	return time.Duration(s * float64(time.Second)).Round(time.Microsecond).String()
+}
+
+// runTUI redraws the status screen on w every interval until stop is
+// closed.
+func runTUI(w io.Writer, addr string, logs *logtail.Ring, every time.Duration, stop <-chan struct{}) {
+	u := &tui{w: w, addr: addr, logs: logs, prev: takeTUISample()}
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			u.draw(takeTUISample())
+		case <-stop:
+			return
+		}
+	}
+}
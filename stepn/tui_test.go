@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/logtail"
+	"github.com/bradfitz/talk-yapc-asia-2015/metrics"
+)
+
+func TestTUIDraw(t *testing.T) {
+	bounds := []float64{.001, .01}
+	t0 := time.Date(2015, 8, 21, 10, 0, 0, 0, time.UTC)
+	logs := logtail.NewRing(10)
+	logs.Write([]byte("level=INFO msg=starting\n"))
+
+	var buf bytes.Buffer
+	u := &tui{w: &buf, addr: "127.0.0.1:8080", logs: logs, prev: tuiSample{
+		t:         t0,
+		latencies: metrics.Latencies{Bounds: bounds, Counts: []uint64{100, 0, 0}},
+		numGC:     10,
+	}}
+	u.draw(tuiSample{
+		t:         t0.Add(2 * time.Second),
+		latencies: metrics.Latencies{Bounds: bounds, Counts: []uint64{200, 100, 0}},
+		visitors:  12345,
+		numGC:     14,
+		lastPause: 120 * time.Microsecond,
+		alerts:    []metrics.Alert{{SLO: "latency", BurnRate: 15.5, Since: t0}},
+		phase:     "burst",
+	})
+	out := buf.String()
+	for _, want := range []string{
+		"12345",
+		"100.0/s", // 200 requests in 2s
+		"p50 1ms", // the 100th of 200
+		"14 (2.0/s), last pause 120µs",
+		"latency burning 15.5x",
+		"msg=starting",
+		"burst       b", // under the sparkline's one bar
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("screen missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestSparkline(t *testing.T) {
+	if got := sparkline([]float64{0, 1, 2, 4}); got != "▁▂▄█" {
+		t.Errorf("sparkline = %q", got)
+	}
+	if got := sparkline([]float64{0, 0}); got != "▁▁" {
+		t.Errorf("sparkline of zeros = %q", got)
+	}
+}
+
+func TestPhaseMarks(t *testing.T) {
+	if got := phaseMarks([]string{"", "low", "low", "burst", "burst", "low"}); got != " l b l" {
+		t.Errorf("phaseMarks = %q", got)
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"expvar"
+	"sync/atomic"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/metrics"
+)
+
+// adminMux serves expvar at /debug/vars, which includes the runtime's
+// memstats and cmdline; these add the demo's own state. The cmdline
+// has the secrets in -apikeys, -webhooksecret, -cookiekey, and -chat,
+// so it's never served on the public listener.
+func init() {
+	expvar.Publish("visitors", expvar.Func(func() interface{} {
+		return atomic.LoadInt64(&lastVisitNum)
+	}))
+	expvar.Publish("in_flight_requests", expvar.Func(func() interface{} {
+		return metrics.InFlight()
+	}))
+	expvar.Publish("active_uploads", expvar.Func(func() interface{} {
+		return atomic.LoadInt64(&activeUploads)
+	}))
+	expvar.Publish("bufpool", expvar.Func(func() interface{} {
+		gets, news := atomic.LoadInt64(&bufPoolGets), atomic.LoadInt64(&bufPoolNews)
+		return map[string]int64{
+			"gets":   gets,
+			"news":   news,
+			"reused": gets - news,
+		}
+	}))
+}
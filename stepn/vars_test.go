@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDebugVars(t *testing.T) {
+	handlePost(httptest.NewRecorder(), httptest.NewRequest("PUT", "/upload", strings.NewReader("hello")))
+
+	ts := httptest.NewServer(adminMux())
+	defer ts.Close()
+	res, err := http.Get(ts.URL + "/debug/vars")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	var vars map[string]json.RawMessage
+	if err := json.NewDecoder(res.Body).Decode(&vars); err != nil {
+		t.Fatalf("decoding /debug/vars: %v", err)
+	}
+	for _, key := range []string{"visitors", "in_flight_requests", "active_uploads", "bufpool", "memstats"} {
+		if _, ok := vars[key]; !ok {
+			t.Errorf("/debug/vars missing %q", key)
+		}
+	}
+	var pool struct{ Gets, News int64 }
+	if err := json.Unmarshal(vars["bufpool"], &pool); err != nil {
+		t.Fatalf("decoding bufpool: %v", err)
+	}
+	if pool.Gets < 1 || pool.News < 1 {
+		t.Errorf("bufpool = %+v; want at least one get and one new after an upload", pool)
+	}
+}
+
+// TestDebugVarsNotPublic checks that the public listener doesn't serve
+// expvar, whose cmdline would give away the flags' secrets.
+func TestDebugVarsNotPublic(t *testing.T) {
+	for _, path := range []string{"/debug/vars", "/debug/routes"} {
+		if _, pattern := newMux(nil).Handler(httptest.NewRequest("GET", path, nil)); pattern != "GET /" {
+			t.Errorf("public mux serves %s with %q; want only the catch-all", path, pattern)
+		}
+	}
+}
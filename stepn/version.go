@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/http"
+	"runtime"
+	"runtime/debug"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/cpufeat"
+)
+
+// cpuInfo is detected once at startup; it can't change while we run.
+var cpuInfo = cpufeat.Detect()
+
+// version is the JSON body of /version.
+type version struct {
+	Go       string       `json:"go"`
+	OS       string       `json:"os"`
+	Revision string       `json:"revision,omitempty"` // VCS revision, if built from a checkout
+	CPU      cpufeat.Info `json:"cpu"`
+	Plugins  []string     `json:"plugins"` // compiled in with build tags
+}
+
+// handleVersion reports what the server was built with, plugins
+// included, and which hashing implementation it's using, so benchmark
+// numbers from different machines can be put in context. As JSON, it's
+// tagged, being the same until a restart.
+func handleVersion(w http.ResponseWriter, r *http.Request) {
+	v := version{Go: runtime.Version(), OS: runtime.GOOS, CPU: cpuInfo, Plugins: pluginNames()}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range bi.Settings {
+			if s.Key == "vcs.revision" {
+				v.Revision = s.Value
+			}
+		}
+	}
+	if len(encoders) == 1 {
+		writeTaggedJSON(w, r, v)
+		return
+	}
+	respond(w, r, v)
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+)
+
+func TestHandleVersion(t *testing.T) {
+	rw := httptest.NewRecorder()
+	handleVersion(rw, httptest.NewRequest("GET", "/version", nil))
+	var v version
+	if err := json.Unmarshal(rw.Body.Bytes(), &v); err != nil {
+		t.Fatalf("%v in %q", err, rw.Body)
+	}
+	if v.Go != runtime.Version() || v.CPU.Arch != runtime.GOARCH {
+		t.Errorf("got %+v; want Go %s on %s", v, runtime.Version(), runtime.GOARCH)
+	}
+	if v.CPU.SHA1 == "" || v.CPU.SHA256 == "" {
+		t.Errorf("hash implementations missing: %+v", v.CPU)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/signedcookie"
+)
+
+const visitsCookie = "visits"
+
+// visitCookies signs the per-browser visit count. Its key is random
+// unless -cookiekey is set, so without the flag every browser's count
+// starts over when the server restarts.
+var visitCookies = signedcookie.Codec{Key: randomKey()}
+
+func randomKey() []byte {
+	k := make([]byte, 32)
+	rand.Read(k)
+	return k
+}
+
+// setCookieKey installs -cookiekey, given in hex.
+func setCookieKey(s string) error {
+	k, err := hex.DecodeString(s)
+	if err != nil {
+		return errors.New("-cookiekey must be hex")
+	}
+	if len(k) < 32 {
+		return errors.New("-cookiekey must be at least 32 bytes")
+	}
+	visitCookies.Key = k
+	return nil
+}
+
+// countVisit returns how many times, including this one, r's browser
+// has visited, and sets its cookie to match. A missing or tampered
+// cookie counts from 1. It must be called before the response header
+// is written.
+func countVisit(w http.ResponseWriter, r *http.Request) int64 {
+	var n int64
+	if c, err := r.Cookie(visitsCookie); err == nil {
+		v, err := visitCookies.Decode(visitsCookie, c.Value)
+		if err != nil {
+			logger(r.Context()).Warn("rejected visits cookie", "err", err)
+		} else {
+			n, _ = strconv.ParseInt(v, 10, 64)
+		}
+	}
+	n++
+	http.SetCookie(w, &http.Cookie{
+		Name:     visitsCookie,
+		Value:    visitCookies.Encode(visitsCookie, strconv.FormatInt(n, 10)),
+		Path:     "/",
+		MaxAge:   365 * 24 * 60 * 60,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return n
+}
+
+// ordinal returns n as an English ordinal: 1st, 2nd, 3rd, 4th, 11th.
+func ordinal(n int64) string {
+	suffix := "th"
+	switch n % 10 {
+	case 1:
+		suffix = "st"
+	case 2:
+		suffix = "nd"
+	case 3:
+		suffix = "rd"
+	}
+	if n%100 >= 11 && n%100 <= 13 {
+		suffix = "th"
+	}
+	return strconv.FormatInt(n, 10) + suffix
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/store"
+)
+
+func TestCountVisit(t *testing.T) {
+	defer func(c store.Counter) { counter = c }(counter)
+	counter = new(store.Memory)
+
+	var cookie *http.Cookie
+	get := func() string {
+		req := httptest.NewRequest("GET", "/", nil)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		rw := httptest.NewRecorder()
+		handleRoot(rw, req)
+		cs := rw.Result().Cookies()
+		if len(cs) != 1 || cs[0].Name != visitsCookie {
+			t.Fatalf("cookies = %v; want one %q", cs, visitsCookie)
+		}
+		cookie = cs[0]
+		return rw.Body.String()
+	}
+	for _, want := range []string{"your 1st visit", "your 2nd visit", "your 3rd visit"} {
+		if body := get(); !strings.Contains(body, want) {
+			t.Errorf("body = %q; want %q", body, want)
+		}
+	}
+
+	// Change the count but keep the signature.
+	_, mac, _ := strings.Cut(cookie.Value, ".")
+	forged, _, _ := strings.Cut(visitCookies.Encode(visitsCookie, "1000"), ".")
+	cookie.Value = forged + "." + mac
+	if body := get(); !strings.Contains(body, "your 1st visit") {
+		t.Errorf("after tampering, body = %q; want the count to start over", body)
+	}
+}
+
+func TestOrdinal(t *testing.T) {
+	for n, want := range map[int64]string{
+		1: "1st", 2: "2nd", 3: "3rd", 4: "4th", 11: "11th", 12: "12th", 13: "13th",
+		21: "21st", 22: "22nd", 101: "101st", 111: "111th", 112: "112th",
+	} {
+		if got := ordinal(n); got != want {
+			t.Errorf("ordinal(%d) = %q; want %q", n, got, want)
+		}
+	}
+}
@@ -1,64 +1,561 @@
 package main
 
 import (
-	"crypto/sha1"
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
 	"regexp"
-	"sync"
+	"strings"
 	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/auditlog"
+	"github.com/bradfitz/talk-yapc-asia-2015/binding"
+	"github.com/bradfitz/talk-yapc-asia-2015/config"
+	"github.com/bradfitz/talk-yapc-asia-2015/cors"
+	"github.com/bradfitz/talk-yapc-asia-2015/errcode"
+	"github.com/bradfitz/talk-yapc-asia-2015/headeraudit"
+	"github.com/bradfitz/talk-yapc-asia-2015/internal/clock"
+	"github.com/bradfitz/talk-yapc-asia-2015/logtail"
+	"github.com/bradfitz/talk-yapc-asia-2015/metrics"
+	"github.com/bradfitz/talk-yapc-asia-2015/negotiate"
+	"github.com/bradfitz/talk-yapc-asia-2015/notifier"
+	"github.com/bradfitz/talk-yapc-asia-2015/ratelimit"
+	"github.com/bradfitz/talk-yapc-asia-2015/secheaders"
+	"github.com/bradfitz/talk-yapc-asia-2015/store"
+	"github.com/bradfitz/talk-yapc-asia-2015/store/fakeredis"
+	"github.com/bradfitz/talk-yapc-asia-2015/webhook"
+)
+
+var (
+	stateFile         = flag.String("state", "", "if non-empty, file to persist the visitor count in")
+	snapshotEvery     = flag.Duration("snapshot", 5*time.Second, "how often to snapshot the visitor count to -state")
+	redisAddr         = flag.String("redis", "", `if non-empty, host:port of a Redis server to share the visitor count through, or "fake" for an in-process fake`)
+	readHeaderTimeout = flag.Duration("readheadertimeout", 10*time.Second, "how long a client may take to send request headers")
+	readTimeout       = flag.Duration("readtimeout", 5*time.Minute, "how long a client may take to send a whole request, including an upload's body")
+	writeTimeout      = flag.Duration("writetimeout", time.Minute, "how long writing a response may take; uploads, /file, /blob/, /fetch, /history/export, and streams on /events, /live, and /debug/logtail are exempt")
+	idleTimeout       = flag.Duration("idletimeout", 2*time.Minute, "how long to keep an idle keep-alive connection open")
+	maxHeaderBytes    = flag.Int("maxheaderbytes", 64<<10, "largest request header to accept, in bytes")
+	drainTimeout      = flag.Duration("drain", 10*time.Second, "on SIGINT or SIGTERM, how long to wait for in-flight requests before giving up on them")
+	sharded           = flag.Bool("sharded", false, "use a sharded in-memory visitor counter, whose visitor numbers are approximate: concurrent visitors may share one")
+	bufSize           = flag.Int("bufsize", 32<<10, "size of the pooled buffers uploads are copied through, in bytes")
+	sizedBufs         = flag.Bool("sizedbufs", false, "pick each upload's pooled buffer by its Content-Length, from 4, 32, and 256 KiB, instead of always -bufsize")
+	maxUpload         = flag.Int64("maxupload", 1<<30, "largest upload body to accept, in bytes")
+	uploadLimit       = flag.Int("uploadlimit", 64, "most uploads to hash at once, across /upload, /upload/multipart and resumable chunks; more get a 503")
+	accessLogFile     = flag.String("accesslog", "", `if non-empty, file to append an access log to in combined log format, or "-" for stderr`)
+	adminAddr         = flag.String("admin", "", "if non-empty, localhost host:port of a second listener serving /debug/pprof, /debug/vars, and /debug/routes")
+	apiKeys           = flag.String("apikeys", "", "if non-empty, comma-separated API keys the -admin listener requires, as a bearer token or X-API-Key header; without them, /admin/reset is disabled")
+	rateLimit         = flag.Float64("ratelimit", 0, "if non-zero, requests per second allowed from each client IP, beyond -burst")
+	rateBurst         = flag.Int("burst", 20, "requests a client IP may make at once before -ratelimit applies")
+	corsOrigins       = flag.String("cors-origins", "", `if non-empty, comma-separated origins, or "*" for any, whose browser apps may call the API`)
+	corsMethods       = flag.String("cors-methods", "GET,HEAD,POST,PUT", "comma-separated methods -cors-origins may use")
+	corsHeaders       = flag.String("cors-headers", "Content-Type,Accept", "comma-separated request headers -cors-origins may send")
+	corsMaxAge        = flag.Duration("cors-maxage", 10*time.Minute, "how long browsers may cache a CORS preflight")
+	gzipResponses     = flag.Bool("gzip", true, "gzip responses for clients that accept it")
+	csp               = flag.String("csp", secheaders.Strict.CSP, "Content-Security-Policy for HTML pages; empty for none")
+	headerAudit       = flag.String("headeraudit", "", `if "log" or "fail", check every response's headers against headerPolicy, logging violations or, for development, replacing them with a 500`)
+	webhookURLs       = flag.String("webhook", "", "if non-empty, comma-separated URLs to POST milestone events to")
+	webhookSecret     = flag.String("webhooksecret", "", "secret to sign -webhook requests with")
+	chatWebhook       = flag.String("chat", "", "if non-empty, URL of a Slack-style incoming webhook to announce every 10000th visitor to")
+	cookieKey         = flag.String("cookiekey", "", "if non-empty, hex key of at least 32 bytes to sign visit cookies with, so they survive restarts")
+	tlsCert           = flag.String("tls-cert", "", "if non-empty, PEM certificate file to serve HTTPS with; needs -tls-key")
+	tlsKey            = flag.String("tls-key", "", "PEM private key file for -tls-cert")
+	autocertDomain    = flag.String("autocert-domain", "", "if non-empty, comma-separated domains to serve HTTPS for with certificates from Let's Encrypt (needs -tags=autocert)")
+	autocertCache     = flag.String("autocert-cache", "autocert-cache", "directory to cache -autocert-domain certificates in")
+	showTUI           = flag.Bool("tui", false, "show a live status screen on the terminal instead of logging to stderr")
+	auditLogFile      = flag.String("auditlog", "", "if non-empty, file to append visit and upload events to as NDJSON, so /export/events.ndjson can serve ones older than memory holds")
+	tlsListen         = flag.String("tls-listen", "", "if non-empty and HTTPS is on, host:port to serve HTTPS on, while -listen redirects plain HTTP to it")
+	compare           = flag.Bool("compare", false, "also serve the step0 and step1 handlers under /step0/ and /step1/, and this server's under /stepn/, to compare them under load")
+	demoEvery         = flag.Duration("demo", 0, "if positive, send the server a cycle of workloads (low, burst, uploads, chaos), each for this long, so a live demo needs no typing; -tui marks each phase")
+	resumeTTL         = flag.Duration("resumettl", time.Hour, "how long a resumable upload is kept after its last chunk before it expires")
+	maxResumable      = flag.Int("maxresumable", 10000, "most resumable uploads to keep in progress at once; more get a 503")
+	blobDir           = flag.String("blobdir", "", "if non-empty, directory of files to serve under /blob/")
+	blobMmap          = flag.Int64("mmap", 0, "if positive, serve /blob/ files of at least this many bytes by mapping them into memory instead of reading them")
+	fileSize          = flag.Int64("filesize", 64<<20, "size of the generated file /file serves, in bytes; 0 for none")
+	fetchHosts        = flag.String("fetchhosts", "", "if non-empty, comma-separated hosts, or host:ports, that /fetch may stream resources from")
+	fixtureFile       = flag.String("fixture", "", "if non-empty, fixture file, as cmd/fixture writes, to preload the visitor count, upload history, resumable uploads, and -blobdir files from")
+)
+
+var (
+	visitors store.Memory
+	counter  store.Counter   = &visitors
+	uploads  store.UploadLog = store.NewMemoryUploads(100)
+
+	// approxCount is set when counter's Incr results may repeat or
+	// skip, as store.Sharded's do, so pages don't present them as
+	// each visitor's own.
+	approxCount bool
 )
 
-var visitors int64 // must be accessed atomically
+// When the counter backend fails, handleRoot still serves the page,
+// showing the last count it saw instead of failing the request.
+var (
+	lastVisitNum     int64 // must be accessed atomically
+	degradedRequests int64 // must be accessed atomically
+)
+
+var activeUploads int64 // must be accessed atomically
+
+var bytesHashed = metrics.NewCounterVec("upload_bytes_hashed_total", "Bytes of PUT bodies hashed.")
+
+func init() {
+	metrics.NewGaugeFunc("visitors_total", "Visitor count, as last seen by handleRoot.", func() float64 {
+		return float64(atomic.LoadInt64(&lastVisitNum))
+	})
+	metrics.NewGaugeFunc("degraded_requests_total", "Requests served without a visitor number because the counter backend failed.", func() float64 {
+		return float64(atomic.LoadInt64(&degradedRequests))
+	})
+}
 
 var rxOptionalID = regexp.MustCompile(`^\d*$`)
 
 func handleRoot(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "GET" && r.Method != "HEAD" {
-		http.Error(w, "Bad method.", http.StatusBadRequest)
+	b := binding.New(r)
+	b.Match("id", rxOptionalID, errcode.ErrInvalidID)
+	if err := b.Err(); err != nil {
+		errcode.Write(w, err)
 		return
 	}
-	if !rxOptionalID.MatchString(r.FormValue("id")) {
-		http.Error(w, "Optional numeric id is invalid", http.StatusBadRequest)
+	r, endSpan := startRequestSpan(r, "handleRoot")
+	asJSON := negotiate.Type(r, "text/html", "application/json") == "application/json"
+	w.Header().Add("Vary", "Accept")
+	v, err := takeVisit(w, r)
+	defer endSpan(err)
+	if asJSON {
+		writeJSON(w, v)
+		return
+	}
+	if v.Visitor == nil {
+		fmt.Fprintf(w, "<html><h1>Welcome!</h1>Your visitor number is unavailable right now. (We last counted %d.) This is your %s visit.", v.LastCounted, ordinal(v.YourVisits))
 		return
 	}
-	visitNum := atomic.AddInt64(&visitors, 1)
 	//io.WriteString(w, "<html><h1>Welcome!</h1>You are visitor number")
 	//fmt.Fprint(w, visitNum)
 	//io.WriteString(w, "!")
-	fmt.Fprintf(w, "<html><h1>Welcome!</h1>You are visitor number %d!", visitNum)
+	if v.Approximate {
+		fmt.Fprintf(w, "<html><h1>Welcome!</h1>You are roughly visitor number %d! This is your %s visit.", *v.Visitor, ordinal(v.YourVisits))
+		return
+	}
+	fmt.Fprintf(w, "<html><h1>Welcome!</h1>You are visitor number %d! This is your %s visit.", *v.Visitor, ordinal(v.YourVisits))
 }
 
-var bufPool = sync.Pool{
-	New: func() interface{} {
-		b := make([]byte, 32<<10)
-		return &b
-	},
+// takeVisit counts r's visit, both overall and in its browser's
+// cookie, and returns the counts. If the counter is down, the visit
+// isn't counted overall, and the last count seen is returned instead,
+// with the counter's error. It must be called before the response
+// header is written.
+func takeVisit(w http.ResponseWriter, r *http.Request) (rootJSON, error) {
+	yours := countVisit(w, r)
+	visitNum, err := counter.Incr(r.Context())
+	if err != nil {
+		atomic.AddInt64(&degradedRequests, 1)
+		logger(r.Context()).Warn("visitor counter unavailable", "err", err)
+		return rootJSON{LastCounted: atomic.LoadInt64(&lastVisitNum), YourVisits: yours}, err
+	}
+	atomic.StoreInt64(&lastVisitNum, visitNum)
+	visitorHub.publish(visitNum)
+	noteVisitors(visitNum-1, visitNum)
+	recordEvent(r.Context(), auditlog.Event{Kind: auditlog.Visit, Visitor: visitNum, Count: 1})
+	return rootJSON{Visitor: &visitNum, Approximate: approxCount, YourVisits: yours}, nil
+}
+
+// rootJSON is handleRoot's JSON response. Visitor is null when the
+// counter backend is down, and LastCounted is set instead. Approximate
+// says Visitor may be shared with other visitors, as with -sharded.
+// YourVisits is this browser's own count, from its cookie.
+type rootJSON struct {
+	Visitor     *int64 `json:"visitor"`
+	Approximate bool   `json:"approximate,omitempty"`
+	LastCounted int64  `json:"lastCounted,omitempty"`
+	YourVisits  int64  `json:"yourVisits"`
+}
+
+// writeJSON writes v as the response body in JSON, whatever the
+// client accepts; respond negotiates. Types on the hot path implement
+// jsonAppender and skip encoding/json's reflection.
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	encodeJSON(w, v)
 }
 
 func handlePost(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "PUT" {
-		http.Error(w, "Bad method; want PUT", http.StatusBadRequest)
+	liftWriteDeadline(w)
+	// Not r.FormValue, which would read a form-encoded body.
+	q := r.URL.Query()
+	ds, err := newDigesters(q.Get("alg"))
+	if err != nil {
+		errcode.Write(w, err)
+		return
+	}
+	expected, err := expectedDigests(r)
+	if err != nil {
+		errcode.Write(w, err)
+		return
+	}
+	r, endSpan := startRequestSpan(r, "handlePost")
+	defer func() { endSpan(err) }()
+	ctx := r.Context()
+	atomic.AddInt64(&activeUploads, 1)
+	defer atomic.AddInt64(&activeUploads, -1)
+	fanout := q.Get("fanout") == "1"
+	var progress *uploadProgress
+	if q.Get("progress") == "1" || q.Get("trailer") == "1" {
+		progress = startProgress(w, ds, q.Get("trailer") == "1")
+	}
+	var sums []string
+	var n int64
+	if key := r.Header.Get("X-Content-Key"); key != "" && expected == nil && progress == nil {
+		sums, n, err = hashUploadOnce(w, r, key, ds, fanout)
+	} else {
+		sums, n, err = hashUpload(w, r, ds, expected, progress, fanout)
+	}
+	if err != nil && errors.Is(err, ctx.Err()) {
+		// There's no one left to answer. A body that timed out, by
+		// contrast, still gets its error below.
+		logger(ctx).Info("upload abandoned by client", "hashed", n)
 		return
 	}
-	s1 := sha1.New()
+	if err != nil {
+		noteUploadError()
+		if progress != nil {
+			progress.fail(err)
+			return
+		}
+		errcode.Write(w, err)
+		return
+	}
+	// Only the first digest is recorded.
+	recAlg, sum := ds[0].alg, sums[0]
+	if recAlg == defaultHash {
+		recAlg = "" // as uploads were recorded before there was a choice
+	}
+	if err := uploads.Add(r.Context(), store.Upload{Time: clock.Now(), Size: n, Alg: recAlg, Sum: sum}); err != nil {
+		noteUploadError()
+		logger(r.Context()).Error("recording upload", "err", err)
+	}
+	recordEvent(r.Context(), auditlog.Event{Kind: auditlog.Upload, Size: n, Alg: recAlg, Sum: sum})
+	if progress != nil {
+		progress.finish(ds, sums, n)
+		return
+	}
+	io.WriteString(w, sumLine(ds, sums, n))
+}
+
+// hashUpload copies r's body through ds, checking it against the
+// expected digests and reporting to progress, if non-nil, and returns
+// ds's sums, in hex, with the body's size. A body cut short by the
+// client going away returns ctx.Err().
+func hashUpload(w http.ResponseWriter, r *http.Request, ds []digester, expected []expectedDigest, progress *uploadProgress, fanout bool) (sums []string, n int64, err error) {
+	ctx := r.Context()
+	h, closeDigests := digestWriter(ds, fanout)
+	defer closeDigests()
+	dst := withDigests(h, expected)
+	if progress != nil {
+		dst = io.MultiWriter(dst, progress)
+	}
+
+	//n, err := io.Copy(h, r.Body)
 
-	//n, err := io.Copy(s1, r.Body)
+	bufp := getBuf(r.ContentLength)
+	defer putBuf(bufp)
+	_, endCopy := startSpan(ctx, "hash.copy")
+	n, err = io.CopyBuffer(dst, ctxReader{ctx, http.MaxBytesReader(w, r.Body, *maxUpload)}, *bufp)
+	endCopy(err)
+	bytesHashed.Add(float64(n))
+	if err != nil && errors.Is(err, ctx.Err()) {
+		return nil, n, err
+	}
+	if err != nil {
+		if errcode.Lookup(err) != errcode.ErrTooLarge {
+			// Bad chunk framing, a truncated body, or a client too
+			// slow to send it: the client's fault, not ours.
+			err = fmt.Errorf("%w: %v", errcode.ErrBadBody, err)
+		}
+		return nil, n, err
+	}
+	if err := checkDigests(expected); err != nil {
+		return nil, n, err
+	}
+	sums = make([]string, len(ds))
+	for i, d := range ds {
+		sums[i] = fmt.Sprintf("%x", d.h.Sum((*bufp)[:0]))
+	}
+	return sums, n, nil
+}
 
-	bufp := bufPool.Get().(*[]byte)
-	defer bufPool.Put(bufp)
-	n, err := io.CopyBuffer(s1, r.Body, *bufp)
+func handleHistory(w http.ResponseWriter, r *http.Request) {
+	b := binding.New(r)
+	n := b.Int("n", 50, 1, 100)
+	if err := b.Err(); err != nil {
+		errcode.Write(w, err)
+		return
+	}
+	recent, err := uploads.Recent(r.Context(), int(n))
 	if err != nil {
-		http.Error(w, err.Error(), 500)
+		errcode.Write(w, fmt.Errorf("%w: %v", errcode.ErrBackendUnavailable, err))
 		return
 	}
-	fmt.Fprintf(w, "sha1 = %x in %d bytes", s1.Sum((*bufp)[:0]), n)
+	respond(w, r, recent)
+}
+
+// runServe is "stepn serve": it runs the server until SIGINT or
+// SIGTERM. Its flags are the command line's, so plugins can add to
+// them.
+func runServe(args []string) error {
+	config.ParseArgs(flag.CommandLine, args)
+	// If we're replacing a server that got restartSignal, wait for it
+	// to finish with the count and the database.
+	config.WaitHandoff()
+	if *bufSize <= 0 {
+		log.Fatal("-bufsize must be positive")
+	}
+	if a := *headerAudit; a != "" && a != "log" && a != "fail" {
+		log.Fatalf("-headeraudit must be log or fail, not %q", a)
+	}
+	if err := setupPlugins(); err != nil {
+		log.Fatal(err)
+	}
+	logRing := logtail.NewRing(1000)
+	logOut := io.Writer(os.Stderr)
+	if *showTUI {
+		// The log would scroll the status screen away; it's still
+		// on /debug/logtail, and the screen shows the last lines.
+		logOut = io.Discard
+	}
+	// This also sends the log package's output through slog.
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.MultiWriter(logOut, logRing), nil)))
+	var flush func() error
+	if *redisAddr == "fake" {
+		fake, err := fakeredis.Start()
+		if err != nil {
+			log.Fatal(err)
+		}
+		*redisAddr = fake.Addr()
+		log.Printf("Using fake Redis on %s", *redisAddr)
+	}
+	if *redisAddr != "" {
+		counter = &store.Guarded{
+			C:           &store.Redis{Addr: *redisAddr},
+			Timeout:     250 * time.Millisecond,
+			MaxInFlight: 100,
+			Retries:     1,
+		}
+	} else if *sharded {
+		counter = new(store.Sharded)
+		approxCount = true
+	} else if *stateFile != "" {
+		flush = persist(*stateFile)
+	}
+	cleanupFixture := func() {}
+	if *fixtureFile != "" {
+		cleanup, err := loadFixture(*fixtureFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		cleanupFixture = cleanup
+	}
+	if *auditLogFile != "" {
+		a, err := auditlog.Open(*auditLogFile, auditRingSize)
+		if err != nil {
+			log.Fatal(err)
+		}
+		audit = a
+	}
+	if *cookieKey != "" {
+		if err := setCookieKey(*cookieKey); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *webhookURLs != "" {
+		if *webhookSecret == "" {
+			log.Fatal("-webhook needs -webhooksecret")
+		}
+		hooks = &webhook.Sender{URLs: strings.Split(*webhookURLs, ","), Secret: []byte(*webhookSecret)}
+		go hooks.Run(nil)
+	}
+	if *chatWebhook != "" {
+		a := notifier.NewAsync(&notifier.Chat{URL: *chatWebhook}, 1.0/60, 3, 10)
+		go a.Run(nil)
+		announcer = a
+	}
+	if *adminAddr != "" {
+		if err := startAdmin(*adminAddr); err != nil {
+			log.Fatal(err)
+		}
+	}
+	ln, httpLn, redirect, err := listen()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if httpLn != nil {
+		log.Printf("Redirecting HTTP on %s to HTTPS", httpLn.Addr())
+		go func() {
+			if err := newServer(redirect).Serve(httpLn); err != nil {
+				log.Printf("ERROR: HTTP listener: %v", err)
+			}
+		}()
+	}
+	slog.Info("starting", "addr", ln.Addr().String(), "tls", *tlsCert != "" || *autocertDomain != "", "sha1", cpuInfo.SHA1, "sha256", cpuInfo.SHA256)
+	go sloEval.Run(5*time.Second, nil)
+	resumables.TTL, resumables.Max = *resumeTTL, *maxResumable
+	go resumables.Run(time.Minute, nil)
+	if *showTUI {
+		go runTUI(os.Stdout, ln.Addr().String(), logRing, time.Second, nil)
+	}
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, os.Interrupt, syscall.SIGTERM)
+	if restartSignal != nil {
+		signal.Notify(sigc, restartSignal)
+	}
+	var release func()
+	restart := func() error {
+		if httpLn != nil {
+			return errors.New("can't hand off two listeners; drop -tls-listen")
+		}
+		var err error
+		release, err = config.StartReplacement(ln)
+		return err
+	}
+	handler := wrapPlugins(metrics.InstrumentMux(newMux(logRing)))
+	if *compare {
+		handler = compareSteps(handler)
+	}
+	var accessW io.Writer
+	if *accessLogFile != "" {
+		accessW = os.Stderr
+		if *accessLogFile != "-" {
+			f, err := os.OpenFile(*accessLogFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+			if err != nil {
+				log.Fatal(err)
+			}
+			accessW = f
+		}
+	}
+	p := publicPipeline(accessW)
+	slog.Info("response pipeline", "stages", p.String())
+	handler = p.then(handler)
+	if *demoEvery > 0 {
+		go runDemo(handler, demoPhases, *demoEvery, nil)
+	}
+	code := serve(newServer(handler), ln, sigc, *drainTimeout, restart)
+	if flush != nil {
+		if err := flush(); err != nil {
+			log.Printf("ERROR: final snapshot: %v", err)
+			code = 1
+		}
+	}
+	if err := audit.Close(); err != nil {
+		log.Printf("ERROR: closing audit log: %v", err)
+		code = 1
+	}
+	if release != nil {
+		// The snapshot's written and the audit log closed; the
+		// replacement can pick them up.
+		release()
+	}
+	cleanupFixture()
+	if code != 0 {
+		os.Exit(code)
+	}
+	return nil
 }
 
-func main() {
-	log.Printf("Starting on port 8080")
-	http.HandleFunc("/", handleRoot)
-	log.Fatal(http.ListenAndServe("127.0.0.1:8080", nil))
+// newMux returns the handler for the public listener, serving
+// publicRoutes.
+//
+// It's deliberately not http.DefaultServeMux: net/http/pprof registers
+// itself there, and profiling belongs on the admin listener only.
+func newMux(logRing *logtail.Ring) *http.ServeMux {
+	return routeMux(publicRoutes(logRing))
+}
+
+// publicPipeline returns the stages between the public listener and
+// its mux, as the flags configure them, outermost first. Access
+// logging, if accessW is non-nil, sees every request as the client
+// sent it; panic recovery covers the rest; CORS preflights are
+// answered outside the rate limiter, so they don't spend a client's
+// tokens; and compression sees the response with every header set.
+func publicPipeline(accessW io.Writer) pipeline {
+	var p pipeline
+	if accessW != nil {
+		p = append(p, stage{"accesslog", func(h http.Handler) http.Handler { return accessLog(accessW, h) }})
+	}
+	p = append(p,
+		stage{"log", func(h http.Handler) http.Handler { return logRequests(slog.Default(), h) }},
+		stage{"recover", recoverPanics},
+	)
+	if *corsOrigins != "" {
+		cp := &cors.Policy{
+			Origins: strings.Split(*corsOrigins, ","),
+			Methods: strings.Split(*corsMethods, ","),
+			Headers: strings.Split(*corsHeaders, ","),
+			MaxAge:  *corsMaxAge,
+		}
+		p = append(p, stage{"cors", cp.Wrap})
+	}
+	if *rateLimit > 0 {
+		limiter := &ratelimit.Limiter{Rate: *rateLimit, Burst: *rateBurst}
+		go limiter.Run(time.Minute, nil)
+		p = append(p, stage{"ratelimit", limiter.Wrap})
+	}
+	if *gzipResponses {
+		p = append(p, compressStage())
+	}
+	return append(p,
+		stage{"cache", cachePolicy.Wrap},
+		stage{"secure", secureHeaders},
+	)
+}
+
+// headerPolicy is what -headeraudit holds responses' headers to.
+var headerPolicy = headeraudit.Policy{
+	RequiredHTML: []string{"Content-Security-Policy", "X-Content-Type-Options", "X-Frame-Options", "Referrer-Policy"},
+	Forbidden:    []string{"Server", "X-Powered-By"},
+	MaxBytes:     4 << 10,
+}
+
+// secureHeaders wraps h to add security headers to its HTML pages and,
+// with -headeraudit, to check every response's headers against
+// headerPolicy. Both listeners' handlers go through it.
+func secureHeaders(h http.Handler) http.Handler {
+	sp := &secheaders.Policy{Default: secheaders.Strict}
+	sp.Default.CSP = *csp
+	h = sp.Wrap(h)
+	if *headerAudit == "" {
+		return h
+	}
+	p := headerPolicy
+	p.Fail = *headerAudit == "fail"
+	p.Report = func(r *http.Request, problems []string) {
+		logger(r.Context()).Warn("response headers violate policy", "path", r.URL.Path, "problems", problems)
+	}
+	return p.Wrap(h)
+}
+
+// persist restores the visitor count from path and starts snapshotting
+// it back there. The returned func stops snapshotting and takes a
+// final snapshot.
+func persist(path string) (flush func() error) {
+	snap := &store.Snapshotter{Path: path, C: &visitors}
+	if err := snap.Restore(); err != nil {
+		log.Fatal(err)
+	}
+	n, _ := visitors.Load(context.Background())
+	log.Printf("Restored visitor count %d from %s", n, path)
+
+	stop := make(chan struct{})
+	errc := make(chan error, 1)
+	go func() { errc <- snap.Run(*snapshotEvery, stop) }()
+	return func() error {
+		close(stop)
+		return <-errc
+	}
 }
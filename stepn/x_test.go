@@ -2,13 +2,25 @@ package main
 
 import (
 	"bufio"
-	"io"
-	"io/ioutil"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"sort"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/errcode"
+	"github.com/bradfitz/talk-yapc-asia-2015/internal/benchtest"
+	"github.com/bradfitz/talk-yapc-asia-2015/store"
+	"github.com/bradfitz/talk-yapc-asia-2015/store/fakeredis"
 )
 
 func TestHandleRoot(t *testing.T) {
@@ -22,6 +34,68 @@ func TestHandleRoot(t *testing.T) {
 	t.Logf("Out: %s", rw.Body)
 }
 
+type failingCounter struct{}
+
+func (failingCounter) Incr(context.Context) (int64, error) { return 0, errors.New("backend down") }
+func (failingCounter) Load(context.Context) (int64, error) { return 0, errors.New("backend down") }
+
+func TestHandleRootApproximate(t *testing.T) {
+	defer func(c store.Counter, a bool) { counter, approxCount = c, a }(counter, approxCount)
+	counter, approxCount = new(store.Sharded), true
+	rw := httptest.NewRecorder()
+	handleRoot(rw, httptest.NewRequest("GET", "/", nil))
+	if body := rw.Body.String(); !strings.Contains(body, "roughly visitor number 1!") {
+		t.Errorf("body = %q; want the number marked as rough", body)
+	}
+}
+
+func TestHandleRootDegraded(t *testing.T) {
+	defer func(c store.Counter) { counter = c }(counter)
+	counter = new(store.Memory)
+	for i := 0; i < 3; i++ {
+		handleRoot(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	}
+
+	counter = failingCounter{}
+	before := atomic.LoadInt64(&degradedRequests)
+	rw := httptest.NewRecorder()
+	handleRoot(rw, httptest.NewRequest("GET", "/", nil))
+	if rw.Code != 200 {
+		t.Errorf("status = %d; want 200", rw.Code)
+	}
+	if body := rw.Body.String(); !strings.Contains(body, "unavailable") || !strings.Contains(body, "last counted 3") {
+		t.Errorf("body = %q; want unavailable notice with stale count 3", body)
+	}
+	if d := atomic.LoadInt64(&degradedRequests) - before; d != 1 {
+		t.Errorf("degradedRequests went up by %d; want 1", d)
+	}
+}
+
+func TestHandleRootCanceled(t *testing.T) {
+	defer func(c store.Counter) { counter = c }(counter)
+	s, err := fakeredis.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	s.Stall()
+	r := &store.Redis{Addr: s.Addr(), Timeout: time.Minute}
+	defer r.Close()
+	counter = &store.Guarded{C: r, Timeout: time.Minute}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	rw := httptest.NewRecorder()
+	t0 := time.Now()
+	handleRoot(rw, httptest.NewRequest("GET", "/", nil).WithContext(ctx))
+	if d := time.Since(t0); d > time.Second {
+		t.Errorf("handler took %v to give up after its request was canceled", d)
+	}
+	if body := rw.Body.String(); !strings.Contains(body, "unavailable") {
+		t.Errorf("body = %q; want unavailable notice", body)
+	}
+}
+
 type neverEnding byte
 
 func (b neverEnding) Read(p []byte) (n int, err error) {
@@ -39,29 +113,299 @@ func (b neverEnding) Read(p []byte) (n int, err error) {
 func BenchmarkNeverending(b *testing.B) {
 	buf := make([]byte, 4096)
 	A := neverEnding('A')
-	for i := 0; i < b.N; i++ {
+	for benchtest.Loop(b) {
 		A.Read(buf)
 	}
 }
 
+const putLength = 64 << 10
+
+var putRequest = "PUT / HTTP/1.1\r\n" +
+	"Content-Type: application/x-something\r\n" +
+	"Content-Length: " + strconv.Itoa(putLength) + "\r\n" +
+	"\r\n" + strings.Repeat("a", putLength)
+
+// hashedPerOp reports the upload bytes handlePost hashed per iteration,
+// which is the body's length unless the benchmark is broken.
+func hashedPerOp(b *testing.B) func() {
+	before := bytesHashed.Value()
+	return func() {
+		b.ReportMetric((bytesHashed.Value()-before)/float64(b.N), "hashed-B/op")
+	}
+}
+
+// BenchmarkPut uploads bodies of several sizes through buffers of
+// several sizes, each from -bufsize, and with -sizedbufs, through the
+// buffer it picks by Content-Length:
+//
+//	go test -run=^$ -bench=Put/ -benchmem ./stepn
 func BenchmarkPut(b *testing.B) {
+	defer func(size int, sized bool) { *bufSize, *sizedBufs = size, sized }(*bufSize, *sizedBufs)
+	for _, body := range []int{1 << 10, putLength, 1 << 20} {
+		req := strings.Replace(putRequest, strconv.Itoa(putLength), strconv.Itoa(body), 1)
+		req = req[:len(req)-putLength] + strings.Repeat("a", body)
+		for _, buf := range []int{4 << 10, 32 << 10, 256 << 10, 0} {
+			name := fmt.Sprintf("body=%dK/buf=%dK", body>>10, buf>>10)
+			if buf == 0 {
+				name = fmt.Sprintf("body=%dK/buf=sized", body>>10)
+			}
+			b.Run(name, func(b *testing.B) {
+				*bufSize, *sizedBufs = buf, buf == 0
+				b.ReportAllocs()
+				b.SetBytes(int64(body))
+				f := benchtest.NewFixture(b, req)
+				defer hashedPerOp(b)()
+				for benchtest.Loop(b) {
+					f.Reset()
+					handlePost(f.Rec, f.Req)
+				}
+			})
+		}
+	}
+}
+
+// BenchmarkPutStaleBody is BenchmarkPut with the bug benchtest.Fixture
+// exists to prevent: only the recorder's body is reset, so every
+// iteration after the first hashes an already-read, empty request body
+// and looks absurdly fast. Its hashed-B/op metric gives it away.
+func BenchmarkPutStaleBody(b *testing.B) {
 	b.ReportAllocs()
-	const length = 64 << 10
-	b.SetBytes(length)
-	req, err := http.ReadRequest(bufio.NewReader(strings.NewReader("PUT / HTTP/1.1\r\n" +
-		"Content-Type: application/x-something\r\n" +
-		"Content-Length: " + strconv.Itoa(length) + "\r\n" +
-		"\r\n")))
+	b.SetBytes(putLength)
+	f := benchtest.NewFixture(b, putRequest)
+	rw, req := f.Rec, f.Req
+	defer hashedPerOp(b)()
+	for benchtest.Loop(b) {
+		rw.Body.Reset()
+		handlePost(rw, req)
+	}
+}
+
+func TestUploadAlg(t *testing.T) {
+	defer func(u store.UploadLog) { uploads = u }(uploads)
+	uploads = store.NewMemoryUploads(10)
+	for _, tt := range []struct {
+		query, want string
+	}{
+		{"", "sha1 = aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d in 5 bytes"},
+		{"?alg=sha1", "sha1 = aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d in 5 bytes"},
+		{"?alg=crc32", "crc32 = 3610a686 in 5 bytes"},
+		{"?alg=sha1,crc32", "sha1 = aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d, crc32 = 3610a686 in 5 bytes"},
+		{"?alg=crc32,sha256,sha1&fanout=1", "crc32 = 3610a686, sha256 = 2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824, sha1 = aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d in 5 bytes"},
+		{"?alg=sha256", "sha256 = 2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824 in 5 bytes"},
+		{"?alg=sha512", "sha512 = 9b71d224bd62f3785d96d46ad3ea3d73319bfbc2890caadae2dff72519673ca72323c3d99ba5c11d7c7acc6e14b8c5da0c4663475c2e5c3adef46f73bcdec043 in 5 bytes"},
+	} {
+		rw := httptest.NewRecorder()
+		handlePost(rw, httptest.NewRequest("PUT", "/upload"+tt.query, strings.NewReader("hello")))
+		if rw.Code != 200 || rw.Body.String() != tt.want {
+			t.Errorf("PUT /upload%s = %d %q; want %q", tt.query, rw.Code, rw.Body, tt.want)
+		}
+	}
+	recent, _ := uploads.Recent(context.Background(), 2)
+	if len(recent) != 2 || recent[0].Alg != "sha512" || recent[1].Alg != "sha256" {
+		t.Errorf("recent uploads = %+v; want sha512 then sha256", recent)
+	}
+
+	rw := httptest.NewRecorder()
+	handlePost(rw, httptest.NewRequest("PUT", "/upload?alg=md5", strings.NewReader("hello")))
+	if rw.Code != 400 || !strings.Contains(rw.Body.String(), "crc32, sha1, sha256, sha512") {
+		t.Errorf("PUT /upload?alg=md5 = %d %q; want 400 listing the hashes", rw.Code, rw.Body)
+	}
+	for _, query := range []string{"?alg=sha1,sha1", "?alg=sha1,", "?alg=,"} {
+		rw := httptest.NewRecorder()
+		handlePost(rw, httptest.NewRequest("PUT", "/upload"+query, strings.NewReader("hello")))
+		if rw.Code != 400 {
+			t.Errorf("PUT /upload%s = %d %q; want 400", query, rw.Code, rw.Body)
+		}
+	}
+}
+
+// BenchmarkPutDigests compares hashing a PUT's body with one digest
+// against three from the same read, sha1, sha256, and crc32, written
+// one after another with io.MultiWriter or at once with a
+// fanoutWriter:
+//
+//	go test -run=^$ -bench=PutDigests -benchmem ./stepn
+func BenchmarkPutDigests(b *testing.B) {
+	for _, bb := range []struct {
+		name, query string
+	}{
+		{"Single", "?alg=sha1"},
+		{"MultiWriter", "?alg=sha1,sha256,crc32"},
+		{"Fanout", "?alg=sha1,sha256,crc32&fanout=1"},
+	} {
+		b.Run(bb.name, func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(putLength)
+			f := benchtest.NewFixture(b, strings.Replace(putRequest, "PUT / ", "PUT /"+bb.query+" ", 1))
+			defer hashedPerOp(b)()
+			for benchtest.Loop(b) {
+				f.Reset()
+				handlePost(f.Rec, f.Req)
+			}
+		})
+	}
+}
+
+// BenchmarkPutAlg compares the hashes a PUT can ask for, each copying
+// the body through the pooled buffer:
+//
+//	go test -run=^$ -bench=PutAlg -benchmem ./stepn
+//
+// Build with -tags=blake2b to include blake2b.
+func BenchmarkPutAlg(b *testing.B) {
+	var names []string
+	for name := range hashes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(putLength)
+			f := benchtest.NewFixture(b, strings.Replace(putRequest, "PUT / ", "PUT /?alg="+name+" ", 1))
+			defer hashedPerOp(b)()
+			for benchtest.Loop(b) {
+				f.Reset()
+				handlePost(f.Rec, f.Req)
+			}
+		})
+	}
+}
+
+// TestUploadCanceled cancels an upload whose body never ends, and
+// checks that handlePost gives up promptly and logs how far it got.
+func TestUploadCanceled(t *testing.T) {
+	var logs bytes.Buffer
+	h := logRequests(slog.New(slog.NewTextHandler(&logs, nil)), http.HandlerFunc(handlePost))
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	req := httptest.NewRequest("PUT", "/upload", neverEnding('a')).WithContext(ctx)
+	before := bytesHashed.Value()
+	rw := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		h.ServeHTTP(rw, req)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("handlePost still hashing 10s after its request was canceled")
+	}
+	hashed := int64(bytesHashed.Value() - before)
+	if hashed == 0 || hashed >= *maxUpload {
+		t.Errorf("hashed %d bytes; want some, but not all -maxupload", hashed)
+	}
+	if want := fmt.Sprintf("hashed=%d", hashed); !strings.Contains(logs.String(), "upload abandoned by client") || !strings.Contains(logs.String(), want) {
+		t.Errorf("logs = %q; want %q", logs.String(), want)
+	}
+	if rw.Body.Len() != 0 {
+		t.Errorf("wrote %q to a client that's gone", rw.Body)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	body := "hello"
+	req, err := http.ReadRequest(bufio.NewReader(strings.NewReader("PUT /upload HTTP/1.1\r\n" +
+		"Content-Length: " + strconv.Itoa(len(body)) + "\r\n" +
+		"\r\n" + body)))
 	if err != nil {
-		b.Fatal(err)
+		t.Fatal(err)
 	}
+	handlePost(httptest.NewRecorder(), req)
+
 	rw := httptest.NewRecorder()
-	lr := io.LimitReader(neverEnding('a'), length)
-	body := ioutil.NopCloser(lr)
-	for i := 0; i < b.N; i++ {
-		rw.Body.Reset()
-		lr.(*io.LimitedReader).N = length
-		req.Body = body
-		handlePost(rw, req)
+	handleHistory(rw, httptest.NewRequest("GET", "/history", nil))
+	var got []store.Upload
+	if err := json.Unmarshal(rw.Body.Bytes(), &got); err != nil {
+		t.Fatalf("bad /history JSON %q: %v", rw.Body, err)
+	}
+	if len(got) == 0 || got[0].Size != 5 || got[0].Sum != "aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d" {
+		t.Errorf("history = %+v", got)
+	}
+}
+
+func TestErrorResponses(t *testing.T) {
+	defer func(v int64) { *maxUpload = v }(*maxUpload)
+	*maxUpload = 4
+
+	tests := []struct {
+		h      http.HandlerFunc
+		req    *http.Request
+		status int
+		code   string
+	}{
+		{handleRoot, httptest.NewRequest("GET", "/?id=x", nil), 400, "invalid_params"},
+		{handleHistory, httptest.NewRequest("GET", "/history?n=0", nil), 400, "invalid_params"},
+		{handlePost, httptest.NewRequest("PUT", "/upload", strings.NewReader("too long")), 413, "too_large"},
+	}
+	for _, tt := range tests {
+		rw := httptest.NewRecorder()
+		tt.h(rw, tt.req)
+		var res errcode.Response
+		if err := json.Unmarshal(rw.Body.Bytes(), &res); err != nil {
+			t.Errorf("%s %s: bad JSON %q: %v", tt.req.Method, tt.req.URL, rw.Body, err)
+			continue
+		}
+		if rw.Code != tt.status || res.Code != tt.code {
+			t.Errorf("%s %s = %d %q; want %d %q", tt.req.Method, tt.req.URL, rw.Code, res.Code, tt.status, tt.code)
+		}
+	}
+}
+
+func TestHandleRootJSON(t *testing.T) {
+	defer func(c store.Counter) { counter = c }(counter)
+	counter = new(store.Memory)
+
+	json1 := httptest.NewRequest("GET", "/", nil)
+	json1.Header.Set("Accept", "application/json")
+	for i, req := range []*http.Request{json1, httptest.NewRequest("GET", "/?format=json", nil)} {
+		rw := httptest.NewRecorder()
+		handleRoot(rw, req)
+		if ct := rw.Header().Get("Content-Type"); ct != "application/json" {
+			t.Errorf("request %d: Content-Type = %q; want application/json", i, ct)
+		}
+		if got, want := strings.TrimSpace(rw.Body.String()), `{"visitor":`+strconv.Itoa(i+1)+`,"yourVisits":1}`; got != want {
+			t.Errorf("request %d: body = %q; want %q", i, got, want)
+		}
+	}
+
+	rw := httptest.NewRecorder()
+	handleRoot(rw, httptest.NewRequest("GET", "/", nil))
+	if body := rw.Body.String(); !strings.Contains(body, "<html>") || !strings.Contains(body, "visitor number 3") {
+		t.Errorf("default body = %q; want HTML", body)
+	}
+
+	counter = failingCounter{}
+	rw = httptest.NewRecorder()
+	handleRoot(rw, httptest.NewRequest("GET", "/?format=json", nil))
+	if got, want := strings.TrimSpace(rw.Body.String()), `{"visitor":null,"lastCounted":3,"yourVisits":1}`; got != want {
+		t.Errorf("degraded body = %q; want %q", got, want)
+	}
+}
+
+func TestBufClass(t *testing.T) {
+	for _, tt := range []struct {
+		contentLength int64
+		want          int // bytes
+	}{
+		{-1, 32 << 10},
+		{0, 4 << 10},
+		{4 << 10, 4 << 10},
+		{4<<10 + 1, 32 << 10},
+		{256 << 10, 256 << 10},
+		{1 << 30, 256 << 10},
+	} {
+		if got := bufClasses[bufClass(tt.contentLength)]; got != tt.want {
+			t.Errorf("bufClass(%d) is %d bytes; want %d", tt.contentLength, got, tt.want)
+		}
+	}
+
+	defer func(sized bool) { *sizedBufs = sized }(*sizedBufs)
+	*sizedBufs = true
+	bufp := getBuf(100)
+	if len(*bufp) != 4<<10 {
+		t.Errorf("getBuf(100) with -sizedbufs is %d bytes; want 4K", len(*bufp))
 	}
+	putBuf(bufp)
 }
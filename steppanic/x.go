@@ -0,0 +1,110 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"runtime/debug"
+	"time"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/logtail"
+	"github.com/bradfitz/talk-yapc-asia-2015/store"
+)
+
+var crashDir = flag.String("crashdir", os.TempDir(), "directory to write crash reports to")
+
+var (
+	visitors store.Memory
+	logRing  = logtail.NewRing(100)
+)
+
+var rxOptionalID = regexp.MustCompile(`^\d*$`)
+
+func handleRoot(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		http.Error(w, "Bad method.", http.StatusBadRequest)
+		return
+	}
+	if !rxOptionalID.MatchString(r.FormValue("id")) {
+		http.Error(w, "Optional numeric id is invalid", http.StatusBadRequest)
+		return
+	}
+	if r.FormValue("panic") != "" {
+		log.Printf("About to look up visitor %q", r.FormValue("id"))
+		var byID map[string]int64
+		byID[r.FormValue("id")]++ // deliberate: assignment to entry in nil map
+	}
+	visitNum, _ := visitors.Incr(r.Context())
+	fmt.Fprintf(w, "<html><h1>Welcome!</h1>You are visitor number %d!", visitNum)
+}
+
+// crashReporting wraps h so that a panic writes a crash report to dir
+// before the panic continues on up to net/http.
+func crashReporting(dir string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if e := recover(); e != nil {
+				stack := debug.Stack()
+				if path, err := writeCrashFile(dir, r, e, stack); err != nil {
+					log.Printf("ERROR: writing crash report: %v", err)
+				} else {
+					log.Printf("ERROR: crash report written to %s", path)
+				}
+				panic(e)
+			}
+		}()
+		h.ServeHTTP(w, r)
+	})
+}
+
+func writeCrashFile(dir string, r *http.Request, e interface{}, stack []byte) (string, error) {
+	f, err := ioutil.TempFile(dir, "crash-"+time.Now().Format("20060102-150405")+"-")
+	if err != nil {
+		return "", err
+	}
+	writeCrashReport(f, r, e, stack)
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return "", err
+	}
+	return filepath.Clean(f.Name()), f.Close()
+}
+
+// writeCrashReport writes everything we know about a panic: the
+// request, the panic value and stack, the recent log lines, and a
+// snapshot of the process metrics.
+func writeCrashReport(w io.Writer, r *http.Request, e interface{}, stack []byte) {
+	fmt.Fprintf(w, "crash at %v\n", time.Now().UTC().Format(time.RFC3339Nano))
+	fmt.Fprintf(w, "request: %s %s\n", r.Method, r.URL)
+	fmt.Fprintf(w, "panic: %v\n\n%s\n", e, stack)
+
+	fmt.Fprintf(w, "recent log:\n")
+	for _, line := range logRing.Last(100) {
+		fmt.Fprintf(w, "  %s\n", line)
+	}
+
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	n, _ := visitors.Load(r.Context())
+	fmt.Fprintf(w, "\nmetrics:\n")
+	fmt.Fprintf(w, "  visitors %d\n", n)
+	fmt.Fprintf(w, "  goroutines %d\n", runtime.NumGoroutine())
+	fmt.Fprintf(w, "  heap_alloc %d\n", ms.HeapAlloc)
+	fmt.Fprintf(w, "  total_alloc %d\n", ms.TotalAlloc)
+	fmt.Fprintf(w, "  num_gc %d\n", ms.NumGC)
+}
+
+func main() {
+	flag.Parse()
+	log.SetOutput(io.MultiWriter(os.Stderr, logRing))
+	log.Printf("Starting on port 8080")
+	http.HandleFunc("/", handleRoot)
+	log.Fatal(http.ListenAndServe("127.0.0.1:8080", crashReporting(*crashDir, http.DefaultServeMux)))
+}
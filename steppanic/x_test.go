@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bufio"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCrashReport(t *testing.T) {
+	log.SetOutput(logRing)
+	defer log.SetOutput(os.Stderr)
+
+	dir, err := ioutil.TempDir("", "steppanic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	req, err := http.ReadRequest(bufio.NewReader(strings.NewReader("GET /?panic=1&id=7 HTTP/1.0\r\n\r\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	func() {
+		defer func() {
+			if e := recover(); e == nil {
+				t.Error("handler didn't re-panic")
+			}
+		}()
+		crashReporting(dir, http.HandlerFunc(handleRoot)).ServeHTTP(httptest.NewRecorder(), req)
+	}()
+
+	files, _ := filepath.Glob(filepath.Join(dir, "crash-*"))
+	if len(files) != 1 {
+		t.Fatalf("crash files = %q; want 1", files)
+	}
+	slurp, err := ioutil.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"request: GET /?panic=1&id=7",
+		"panic: assignment to entry in nil map",
+		"handleRoot(",
+		`About to look up visitor "7"`,
+		"visitors ",
+	} {
+		if !strings.Contains(string(slurp), want) {
+			t.Errorf("crash report missing %q:\n%s", want, slurp)
+		}
+	}
+}
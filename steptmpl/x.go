@@ -0,0 +1,37 @@
+// Command steptmpl is step0's handleHi done safely: the page comes
+// from an html/template parsed once at startup, which escapes the
+// color for the CSS attribute it lands in, so a crafted color can't
+// break out of the page.
+package main
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+	"sync/atomic"
+)
+
+var visitors int64 // must be accessed atomically
+
+var hiTmpl = template.Must(template.New("hi").Parse(
+	`<h1 style="color: {{.Color}}">Welcome!</h1>You are visitor number {{.Visitor}}!`))
+
+func handleHi(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err := hiTmpl.Execute(w, struct {
+		Color   string
+		Visitor int64
+	}{
+		Color:   r.FormValue("color"),
+		Visitor: atomic.AddInt64(&visitors, 1),
+	})
+	if err != nil {
+		log.Printf("ERROR: rendering hi: %v", err)
+	}
+}
+
+func main() {
+	log.Printf("Starting on port 8080")
+	http.HandleFunc("/hi", handleHi)
+	log.Fatal(http.ListenAndServe("127.0.0.1:8080", nil))
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/internal/attacktest"
+)
+
+func hi(color string) string {
+	rw := httptest.NewRecorder()
+	handleHi(rw, httptest.NewRequest("GET", "/hi?color="+url.QueryEscape(color), nil))
+	return rw.Body.String()
+}
+
+func TestHandleHi(t *testing.T) {
+	body := hi("red")
+	if !strings.Contains(body, `style="color: red"`) || !strings.Contains(body, "visitor number") {
+		t.Errorf("body = %q", body)
+	}
+}
+
+func TestHandleHiEscapesColor(t *testing.T) {
+	for _, color := range []string{
+		`red'><script>alert(1)</script>`,
+		`red"><script>alert(1)</script>`,
+		`red; background: url(javascript:alert(1))`,
+	} {
+		body := hi(color)
+		if strings.Contains(body, "<script>") || strings.Contains(body, "javascript:") {
+			t.Errorf("color %q not escaped: %s", color, body)
+		}
+		if !strings.HasPrefix(body, `<h1 style="color: `) || strings.Count(body, `"`) != 2 {
+			t.Errorf("color %q broke out of the style attribute: %s", color, body)
+		}
+	}
+}
+
+func TestAttacks(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(handleHi))
+	defer ts.Close()
+	attacktest.Run(t, ts.URL, attacktest.Target{
+		Reflect: []string{"/hi?color="},
+		Inject:  []string{"/hi?color="},
+	})
+}
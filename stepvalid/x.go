@@ -0,0 +1,73 @@
+// Command stepvalid is the step after compiling the regexps once: not
+// using them at all. step0's ?color= must match `^\w*$` and step1's
+// ?id= `^\d*$`; here each is a loop over the bytes, which is all
+// either pattern asks, without the regexp engine's setup and
+// bookkeeping on every request. Compare them with
+//
+//	go test -bench=. -benchmem
+//
+// TestValidatorsMatchRegexps checks that the loops accept exactly
+// what the patterns do.
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sync/atomic"
+)
+
+var visitors int64 // must be accessed atomically
+
+// isDigits reports whether s matches `^\d*$`: RE2's \d is ASCII
+// digits only.
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// isWord reports whether s matches `^\w*$`: ASCII letters, digits,
+// and underscores.
+func isWord(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+func handleHi(w http.ResponseWriter, r *http.Request) {
+	color := r.FormValue("color")
+	if !isWord(color) {
+		http.Error(w, "Optional color is invalid", http.StatusBadRequest)
+		return
+	}
+	num := atomic.AddInt64(&visitors, 1)
+	fmt.Fprintf(w, "<h1 style='color: %s'>Welcome!</h1>You are visitor number %d!", color, num)
+}
+
+func handleRoot(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		http.Error(w, "Bad method.", http.StatusBadRequest)
+		return
+	}
+	if !isDigits(r.FormValue("id")) {
+		http.Error(w, "Optional numeric id is invalid", http.StatusBadRequest)
+		return
+	}
+	num := atomic.AddInt64(&visitors, 1)
+	fmt.Fprintf(w, "<h1>Welcome!</h1>You are visitor number %d!", num)
+}
+
+func main() {
+	log.Printf("Starting on port 8080")
+	http.HandleFunc("/hi", handleHi)
+	http.HandleFunc("/", handleRoot)
+	log.Fatal(http.ListenAndServe("127.0.0.1:8080", nil))
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/internal/benchtest"
+)
+
+// The patterns the validators replace.
+var (
+	rxOptionalID = regexp.MustCompile(`^\d*$`)
+	rxColor      = regexp.MustCompile(`^\w*$`)
+)
+
+func TestValidatorsMatchRegexps(t *testing.T) {
+	inputs := []string{"", "0", "123", "a1", "1a", "red", "Red_2", "red-2", " ", "1\n", "\n", "١٢٣", "é", "x\x00"}
+	// Random strings over bytes near the classes' edges.
+	const alphabet = "/09:@AZ[_`az{-é\x00\n"
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 10000; i++ {
+		b := make([]byte, rnd.Intn(6))
+		for j := range b {
+			b[j] = alphabet[rnd.Intn(len(alphabet))]
+		}
+		inputs = append(inputs, string(b))
+	}
+	for _, s := range inputs {
+		if got, want := isDigits(s), rxOptionalID.MatchString(s); got != want {
+			t.Errorf("isDigits(%q) = %v; `^\\d*$` says %v", s, got, want)
+		}
+		if got, want := isWord(s), rxColor.MatchString(s); got != want {
+			t.Errorf("isWord(%q) = %v; `^\\w*$` says %v", s, got, want)
+		}
+	}
+}
+
+func TestHandlers(t *testing.T) {
+	for _, tt := range []struct {
+		h      http.HandlerFunc
+		target string
+		code   int
+		prefix string
+	}{
+		{handleHi, "/hi?color=red", 200, "<h1 style='color: red'>Welcome!</h1>"},
+		{handleHi, "/hi?color=red-x", 400, "Optional color is invalid"},
+		{handleRoot, "/?id=42", 200, "<h1>Welcome!</h1>"},
+		{handleRoot, "/?id=4x", 400, "Optional numeric id is invalid"},
+	} {
+		rw := httptest.NewRecorder()
+		tt.h(rw, httptest.NewRequest("GET", tt.target, nil))
+		if rw.Code != tt.code || !strings.HasPrefix(rw.Body.String(), tt.prefix) {
+			t.Errorf("GET %s = %d %q; want %d starting %q", tt.target, rw.Code, rw.Body, tt.code, tt.prefix)
+		}
+	}
+}
+
+var sink bool
+
+// BenchmarkMatch compares each regexp with its loop on a valid input
+// and an invalid one.
+func BenchmarkMatch(b *testing.B) {
+	for _, bb := range []struct {
+		name string
+		rx   *regexp.Regexp
+		loop func(string) bool
+		in   string
+	}{
+		{"ID/Empty", rxOptionalID, isDigits, ""},
+		{"ID/Valid", rxOptionalID, isDigits, "1234567890"},
+		{"ID/Invalid", rxOptionalID, isDigits, "12345x"},
+		{"Color/Valid", rxColor, isWord, "cornflowerblue"},
+		{"Color/Invalid", rxColor, isWord, "red' onmouseover='x"},
+	} {
+		b.Run(bb.name+"/Regexp", func(b *testing.B) {
+			b.ReportAllocs()
+			for benchtest.Loop(b) {
+				sink = bb.rx.MatchString(bb.in)
+			}
+		})
+		b.Run(bb.name+"/Loop", func(b *testing.B) {
+			b.ReportAllocs()
+			for benchtest.Loop(b) {
+				sink = bb.loop(bb.in)
+			}
+		})
+	}
+}
+
+// BenchmarkRoot is step1's BenchmarkRoot, for seeing what the regexp
+// was of the whole request.
+func BenchmarkRoot(b *testing.B) {
+	b.ReportAllocs()
+	f := benchtest.NewFixture(b, "GET /?id=1234567890 HTTP/1.0\r\n\r\n")
+	for benchtest.Loop(b) {
+		f.Reset()
+		handleRoot(f.Rec, f.Req)
+	}
+}
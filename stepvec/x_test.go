@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/internal/benchtest"
+)
+
+// handleRootFprintf is handleRoot as the talk's "Optimize memory"
+// section leaves it, formatting the whole page with fmt.Fprintf.
+func handleRootFprintf(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		http.Error(w, "Bad method.", http.StatusBadRequest)
+		return
+	}
+	if !rxOptionalID.MatchString(r.FormValue("id")) {
+		http.Error(w, "Optional numeric id is invalid", http.StatusBadRequest)
+		return
+	}
+	num := atomic.AddInt64(&visitors, 1)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, "<h1>Welcome!</h1>You are visitor number %d!", num)
+}
+
+func TestHandleRoot(t *testing.T) {
+	for _, h := range []http.HandlerFunc{handleRoot, handleRootFprintf} {
+		atomic.StoreInt64(&visitors, 41)
+		f := benchtest.NewFixture(t, "GET /?id=7 HTTP/1.0\r\n\r\n")
+		h(f.Rec, f.Req)
+		if got, want := f.Rec.Body.String(), "<h1>Welcome!</h1>You are visitor number 42!"; got != want {
+			t.Errorf("got %q; want %q", got, want)
+		}
+		f = benchtest.NewFixture(t, "GET /?id=x HTTP/1.0\r\n\r\n")
+		h(f.Rec, f.Req)
+		if f.Rec.Code != 400 {
+			t.Errorf("bad id: status %d; want 400", f.Rec.Code)
+		}
+	}
+}
+
+// BenchmarkRoot compares the page written in chunks with it formatted
+// by fmt.Fprintf, each into a reset benchtest.Fixture.
+func BenchmarkRoot(b *testing.B) {
+	for _, bb := range []struct {
+		name string
+		h    http.HandlerFunc
+	}{
+		{"Chunks", handleRoot},
+		{"Fprintf", handleRootFprintf},
+	} {
+		b.Run(bb.name, func(b *testing.B) {
+			b.ReportAllocs()
+			f := benchtest.NewFixture(b, "GET / HTTP/1.0\r\n\r\n")
+			for benchtest.Loop(b) {
+				f.Reset()
+				bb.h(f.Rec, f.Req)
+			}
+		})
+	}
+}
+
+// BenchmarkConn writes the page to a loopback TCP connection three
+// ways: as a net.Buffers, which is one writev; a Write per chunk, one
+// write system call each; and the chunks copied into one buffer and
+// written together. Large is the same with 40 KB of pre-rendered HTML
+// before the number instead of 40 bytes.
+func BenchmarkConn(b *testing.B) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go io.Copy(io.Discard, c)
+		}
+	}()
+	for _, size := range []struct {
+		name  string
+		start []byte
+	}{
+		{"Small", pageStart},
+		{"Large", bytes.Repeat(pageStart, 1000)},
+	} {
+		for _, bb := range []struct {
+			name  string
+			write func(c net.Conn, chunks *[3][]byte, buf []byte) []byte
+		}{
+			{"Buffers", func(c net.Conn, chunks *[3][]byte, buf []byte) []byte {
+				bufs := net.Buffers(chunks[:])
+				bufs.WriteTo(c)
+				return buf
+			}},
+			{"Writes", func(c net.Conn, chunks *[3][]byte, buf []byte) []byte {
+				for _, p := range chunks {
+					c.Write(p)
+				}
+				return buf
+			}},
+			{"Concat", func(c net.Conn, chunks *[3][]byte, buf []byte) []byte {
+				buf = buf[:0]
+				for _, p := range chunks {
+					buf = append(buf, p...)
+				}
+				c.Write(buf)
+				return buf
+			}},
+		} {
+			b.Run(size.name+"/"+bb.name, func(b *testing.B) {
+				c, err := net.Dial("tcp", ln.Addr().String())
+				if err != nil {
+					b.Fatal(err)
+				}
+				defer c.Close()
+				b.ReportAllocs()
+				b.SetBytes(int64(len(size.start) + len(pageEnd) + 3))
+				var numBuf [20]byte
+				var buf []byte
+				var num int64 = 99
+				for benchtest.Loop(b) {
+					num++
+					chunks := [3][]byte{size.start, strconv.AppendInt(numBuf[:0], num, 10), pageEnd}
+					buf = bb.write(c, &chunks, buf)
+				}
+			})
+		}
+	}
+}
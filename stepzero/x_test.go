@@ -0,0 +1,102 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/internal/benchtest"
+)
+
+// allocBudget is how many allocations handleRoot may make per request.
+// Raising it takes a reason.
+const allocBudget = 0
+
+func TestHandleRoot(t *testing.T) {
+	atomic.StoreInt64(&visitors, 41)
+	for _, tt := range []struct {
+		method, target string
+		code           int
+		body           string
+	}{
+		{"GET", "/", 200, "<h1>Welcome!</h1>You are visitor number 42!"},
+		{"GET", "/?id=123", 200, "<h1>Welcome!</h1>You are visitor number 43!"},
+		{"GET", "/?x=y&id=&z", 200, "<h1>Welcome!</h1>You are visitor number 44!"},
+		{"GET", "/?id=12&id=x", 200, "<h1>Welcome!</h1>You are visitor number 45!"},
+		{"GET", "/?id=12x", 400, "Optional numeric id is invalid\n"},
+		{"GET", "/?x=1&id=-1", 400, "Optional numeric id is invalid\n"},
+		{"POST", "/", 400, "Bad method.\n"},
+	} {
+		rw := httptest.NewRecorder()
+		handleRoot(rw, httptest.NewRequest(tt.method, tt.target, nil))
+		if rw.Code != tt.code || rw.Body.String() != tt.body {
+			t.Errorf("%s %s = %d %q; want %d %q", tt.method, tt.target, rw.Code, rw.Body, tt.code, tt.body)
+		}
+		if tt.code == 200 && rw.Header().Get("Content-Type") != "text/html; charset=utf-8" {
+			t.Errorf("%s %s: Content-Type %q", tt.method, tt.target, rw.Header().Get("Content-Type"))
+		}
+	}
+}
+
+// discardWriter is a ResponseWriter that throws the response away.
+// httptest.ResponseRecorder allocates a copy of the header when it's
+// written, which would count against handleRoot.
+type discardWriter struct{ h http.Header }
+
+func (w discardWriter) Header() http.Header       { return w.h }
+func (discardWriter) Write(p []byte) (int, error) { return len(p), nil }
+func (discardWriter) WriteHeader(int)             {}
+
+// TestAllocs fails if handleRoot allocates more than allocBudget per
+// request.
+func TestAllocs(t *testing.T) {
+	w := discardWriter{http.Header{}}
+	req := httptest.NewRequest("GET", "/?id=123", nil)
+	if n := testing.AllocsPerRun(1000, func() { handleRoot(w, req) }); n > allocBudget {
+		t.Errorf("handleRoot: %v allocs per request; the budget is %d", n, allocBudget)
+	}
+}
+
+func TestValidID(t *testing.T) {
+	for q, want := range map[string]bool{
+		"":              true,
+		"id":            true,
+		"id=":           true,
+		"id=007":        true,
+		"idx=a":         true,
+		"a=1&b=2&id=09": true,
+		"id=1a":         false,
+		"id=%31":        false,
+		"b=&id= 1":      false,
+	} {
+		if got := validID(q); got != want {
+			t.Errorf("validID(%q) = %v; want %v", q, got, want)
+		}
+	}
+}
+
+func BenchmarkRoot(b *testing.B) {
+	b.ReportAllocs()
+	w := discardWriter{http.Header{}}
+	req := httptest.NewRequest("GET", "/?id=123", nil)
+	for benchtest.Loop(b) {
+		handleRoot(w, req)
+	}
+}
+
+// BenchmarkRootRecorder is BenchmarkRoot through a reset
+// benchtest.Fixture, as step1's is, for comparing the two; the
+// recorder's own allocations are counted too.
+func BenchmarkRootRecorder(b *testing.B) {
+	b.ReportAllocs()
+	f := benchtest.NewFixture(b, "GET / HTTP/1.0\r\n\r\n")
+	for benchtest.Loop(b) {
+		f.Reset()
+		handleRoot(f.Rec, f.Req)
+	}
+	if !strings.HasPrefix(f.Rec.Body.String(), "<h1>Welcome!</h1>") {
+		b.Fatalf("got %q", f.Rec.Body)
+	}
+}
@@ -0,0 +1,201 @@
+//go:build bolt
+
+package store
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"math"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	countersBucket = []byte("counters")
+	uploadsBucket  = []byte("uploads")
+	visitorsKey    = []byte("visitors")
+)
+
+// Bolt is a Counter and UploadLog in a bbolt database file.
+//
+// It's only built with -tags=bolt, so the default build has no
+// dependencies outside the standard library.
+//
+// A bbolt transaction can't be interrupted once it starts, and the
+// local ones here are short, so its methods only check that the
+// context isn't already done before starting one.
+type Bolt struct {
+	db *bolt.DB
+}
+
+// OpenBolt opens or creates the database at path.
+func OpenBolt(path string) (*Bolt, error) {
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(countersBucket); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists(uploadsBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Bolt{db: db}, nil
+}
+
+func (b *Bolt) Close() error { return b.db.Close() }
+
+func (b *Bolt) Incr(ctx context.Context) (n int64, err error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	err = b.db.Update(func(tx *bolt.Tx) error {
+		bk := tx.Bucket(countersBucket)
+		n = decodeInt(bk.Get(visitorsKey)) + 1
+		return bk.Put(visitorsKey, encodeInt(n))
+	})
+	return
+}
+
+func (b *Bolt) IncrBy(ctx context.Context, delta int64) (n int64, err error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	err = b.db.Update(func(tx *bolt.Tx) error {
+		bk := tx.Bucket(countersBucket)
+		n = decodeInt(bk.Get(visitorsKey)) + delta
+		return bk.Put(visitorsKey, encodeInt(n))
+	})
+	return
+}
+
+func (b *Bolt) Load(ctx context.Context) (n int64, err error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	err = b.db.View(func(tx *bolt.Tx) error {
+		n = decodeInt(tx.Bucket(countersBucket).Get(visitorsKey))
+		return nil
+	})
+	return
+}
+
+// Store sets the counter to v.
+func (b *Bolt) Store(ctx context.Context, v int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(countersBucket).Put(visitorsKey, encodeInt(v))
+	})
+}
+
+func (b *Bolt) Swap(ctx context.Context, v int64) (old int64, err error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	err = b.db.Update(func(tx *bolt.Tx) error {
+		bk := tx.Bucket(countersBucket)
+		old = decodeInt(bk.Get(visitorsKey))
+		return bk.Put(visitorsKey, encodeInt(v))
+	})
+	return
+}
+
+func (b *Bolt) Add(ctx context.Context, u Upload) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	v, err := json.Marshal(u)
+	if err != nil {
+		return err
+	}
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bk := tx.Bucket(uploadsBucket)
+		seq, err := bk.NextSequence()
+		if err != nil {
+			return err
+		}
+		return bk.Put(encodeInt(int64(seq)), v)
+	})
+}
+
+func (b *Bolt) Recent(ctx context.Context, n int) ([]Upload, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var out []Upload
+	err := b.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(uploadsBucket).Cursor()
+		for k, v := c.Last(); k != nil && len(out) < n; k, v = c.Prev() {
+			var u Upload
+			if err := json.Unmarshal(v, &u); err != nil {
+				return err
+			}
+			out = append(out, u)
+		}
+		return nil
+	})
+	return out, err
+}
+
+// Walk reads the uploads a chunk per read transaction, so a slow fn
+// doesn't keep one open.
+func (b *Bolt) Walk(ctx context.Context, fn func(Upload) error) error {
+	before := int64(math.MaxInt64) // visit keys below this
+	chunk := make([]Upload, 0, walkChunk)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		chunk = chunk[:0]
+		err := b.db.View(func(tx *bolt.Tx) error {
+			c := tx.Bucket(uploadsBucket).Cursor()
+			k, v := c.Seek(encodeInt(before))
+			if k == nil {
+				k, v = c.Last()
+			} else {
+				k, v = c.Prev()
+			}
+			for ; k != nil && len(chunk) < walkChunk; k, v = c.Prev() {
+				var u Upload
+				if err := json.Unmarshal(v, &u); err != nil {
+					return err
+				}
+				chunk = append(chunk, u)
+				before = decodeInt(k)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if len(chunk) == 0 {
+			return nil
+		}
+		for _, u := range chunk {
+			if err := fn(u); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func encodeInt(n int64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(n))
+	return b
+}
+
+func decodeInt(b []byte) int64 {
+	if len(b) != 8 {
+		return 0
+	}
+	return int64(binary.BigEndian.Uint64(b))
+}
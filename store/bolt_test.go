@@ -0,0 +1,43 @@
+//go:build bolt
+
+package store
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBoltReopen(t *testing.T) {
+	ctx := context.Background()
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "talk.db")
+
+	db, err := OpenBolt(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Incr(ctx)
+	db.Incr(ctx)
+	db.Add(ctx, Upload{Time: time.Unix(1, 0), Size: 10, Sum: "aa"})
+	db.Add(ctx, Upload{Time: time.Unix(2, 0), Size: 20, Sum: "bb"})
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err = OpenBolt(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if n, err := db.Load(ctx); err != nil || n != 2 {
+		t.Errorf("Load after reopen = %d, %v; want 2", n, err)
+	}
+	ups, err := db.Recent(ctx, 1)
+	if err != nil || len(ups) != 1 || ups[0].Sum != "bb" {
+		t.Errorf("Recent(1) = %+v, %v; want the bb upload", ups, err)
+	}
+}
@@ -0,0 +1,35 @@
+//go:build bolt
+
+package store_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/store"
+	"github.com/bradfitz/talk-yapc-asia-2015/store/storagetest"
+)
+
+func openBolt(t *testing.T, path string) *store.Bolt {
+	db, err := store.OpenBolt(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestBoltContract(t *testing.T) {
+	newDB := func(t *testing.T) *store.Bolt {
+		db := openBolt(t, filepath.Join(t.TempDir(), "talk.db"))
+		t.Cleanup(func() { db.Close() })
+		return db
+	}
+	storagetest.TestCounter(t, func(t *testing.T) store.Counter { return newDB(t) })
+	storagetest.TestCounterProperties(t, func(t *testing.T) store.Counter { return newDB(t) }, storagetest.Props{Exact: true})
+	storagetest.TestUploadLog(t, func(t *testing.T) store.UploadLog { return newDB(t) })
+
+	path := filepath.Join(t.TempDir(), "durable.db")
+	storagetest.TestDurableCounter(t,
+		func(t *testing.T) store.Counter { return openBolt(t, path) },
+		func(c store.Counter) { c.(*store.Bolt).Close() })
+}
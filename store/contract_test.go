@@ -0,0 +1,95 @@
+package store_test
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/store"
+	"github.com/bradfitz/talk-yapc-asia-2015/store/fakeredis"
+	"github.com/bradfitz/talk-yapc-asia-2015/store/storagetest"
+)
+
+func TestMemoryContract(t *testing.T) {
+	newMemory := func(t *testing.T) store.Counter { return new(store.Memory) }
+	storagetest.TestCounter(t, newMemory)
+
+	// Snapshots restore a value the counter really had.
+	path := filepath.Join(t.TempDir(), "visitors")
+	var mu sync.Mutex // so each Snapshot restores its own save
+	storagetest.TestCounterProperties(t, newMemory, storagetest.Props{
+		Exact: true,
+		Snapshot: func(c store.Counter) (int64, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if err := (&store.Snapshotter{Path: path, C: c.(*store.Memory)}).Snapshot(); err != nil {
+				return 0, err
+			}
+			m := new(store.Memory)
+			if err := (&store.Snapshotter{Path: path, C: m}).Restore(); err != nil {
+				return 0, err
+			}
+			return m.Load(context.Background())
+		},
+	})
+}
+
+func TestSnapshotterContract(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "visitors")
+	snaps := map[store.Counter]*store.Snapshotter{}
+	storagetest.TestDurableCounter(t,
+		func(t *testing.T) store.Counter {
+			s := &store.Snapshotter{Path: path, C: new(store.Memory)}
+			if err := s.Restore(); err != nil {
+				t.Fatal(err)
+			}
+			snaps[s.C] = s
+			return s.C
+		},
+		func(c store.Counter) {
+			if err := snaps[c].Snapshot(); err != nil {
+				t.Fatal(err)
+			}
+		})
+}
+
+func TestShardedContract(t *testing.T) {
+	newSharded := func(t *testing.T) store.Counter { return new(store.Sharded) }
+	storagetest.TestCounter(t, newSharded)
+	storagetest.TestCounterProperties(t, newSharded, storagetest.Props{})
+}
+
+func TestGuardedContract(t *testing.T) {
+	newGuarded := func(t *testing.T) store.Counter { return &store.Guarded{C: new(store.Memory)} }
+	storagetest.TestCounter(t, newGuarded)
+	storagetest.TestCounterProperties(t, newGuarded, storagetest.Props{Exact: true})
+}
+
+func TestRedisContract(t *testing.T) {
+	newRedis := func(t *testing.T) store.Counter {
+		s, err := fakeredis.Start()
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { s.Close() })
+		r := &store.Redis{Addr: s.Addr()}
+		t.Cleanup(func() { r.Close() })
+		return r
+	}
+	storagetest.TestCounter(t, newRedis)
+	storagetest.TestCounterProperties(t, newRedis, storagetest.Props{Exact: true})
+
+	s, err := fakeredis.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := s.Addr()
+	s.Close()
+	storagetest.TestBrokenCounter(t, &store.Redis{Addr: addr})
+	storagetest.TestBrokenCounter(t, &store.Guarded{C: &store.Redis{Addr: addr}, Retries: 2})
+}
+
+func TestMemoryUploadsContract(t *testing.T) {
+	storagetest.TestUploadLog(t, func(t *testing.T) store.UploadLog { return store.NewMemoryUploads(10) })
+}
@@ -0,0 +1,170 @@
+// Package fakeredis is an in-memory stand-in for a Redis server. It
+// understands just the commands the store package uses, so the demo
+// and its tests can run in Redis mode with no network at all.
+package fakeredis
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// A Server is a fake Redis server listening on localhost.
+type Server struct {
+	ln net.Listener
+
+	mu    sync.Mutex
+	vals  map[string]string
+	dials int
+	stall bool
+}
+
+// Start starts a Server on a random localhost port.
+func Start() (*Server, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{ln: ln, vals: make(map[string]string)}
+	go s.serve()
+	return s, nil
+}
+
+// Addr returns the host:port the server listens on.
+func (s *Server) Addr() string { return s.ln.Addr().String() }
+
+// Close stops accepting connections.
+func (s *Server) Close() error { return s.ln.Close() }
+
+// Dials returns how many connections have been accepted.
+func (s *Server) Dials() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dials
+}
+
+// Stall makes the server read commands but never reply, like a
+// wedged real server.
+func (s *Server) Stall() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stall = true
+}
+
+func (s *Server) serve() {
+	for {
+		c, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.dials++
+		s.mu.Unlock()
+		go s.handle(c)
+	}
+}
+
+func (s *Server) handle(c net.Conn) {
+	defer c.Close()
+	br := bufio.NewReader(c)
+	for {
+		args, err := readCommand(br)
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		if s.stall {
+			s.mu.Unlock()
+			io.Copy(ioutil.Discard, br)
+			return
+		}
+		reply := s.exec(args)
+		s.mu.Unlock()
+		if _, err := io.WriteString(c, reply); err != nil {
+			return
+		}
+	}
+}
+
+func (s *Server) exec(args []string) string {
+	if len(args) == 0 {
+		return "-ERR empty command\r\n"
+	}
+	cmd := strings.ToUpper(args[0])
+	want := map[string]int{"PING": 1, "GET": 2, "SET": 3, "INCR": 2, "INCRBY": 3, "DEL": 2, "GETSET": 3}
+	if n, ok := want[cmd]; !ok {
+		return fmt.Sprintf("-ERR unknown command '%s'\r\n", args[0])
+	} else if len(args) != n {
+		return fmt.Sprintf("-ERR wrong number of arguments for '%s' command\r\n", args[0])
+	}
+	switch cmd {
+	case "PING":
+		return "+PONG\r\n"
+	case "GET":
+		v, ok := s.vals[args[1]]
+		if !ok {
+			return "$-1\r\n"
+		}
+		return fmt.Sprintf("$%d\r\n%s\r\n", len(v), v)
+	case "SET":
+		s.vals[args[1]] = args[2]
+		return "+OK\r\n"
+	case "GETSET":
+		v, ok := s.vals[args[1]]
+		s.vals[args[1]] = args[2]
+		if !ok {
+			return "$-1\r\n"
+		}
+		return fmt.Sprintf("$%d\r\n%s\r\n", len(v), v)
+	case "DEL":
+		_, ok := s.vals[args[1]]
+		delete(s.vals, args[1])
+		if ok {
+			return ":1\r\n"
+		}
+		return ":0\r\n"
+	}
+	// INCR or INCRBY
+	delta := int64(1)
+	if cmd == "INCRBY" {
+		var err error
+		if delta, err = strconv.ParseInt(args[2], 10, 64); err != nil {
+			return "-ERR value is not an integer or out of range\r\n"
+		}
+	}
+	var n int64
+	if v, ok := s.vals[args[1]]; ok {
+		var err error
+		if n, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return "-ERR value is not an integer or out of range\r\n"
+		}
+	}
+	n += delta
+	s.vals[args[1]] = strconv.FormatInt(n, 10)
+	return fmt.Sprintf(":%d\r\n", n)
+}
+
+func readCommand(br *bufio.Reader) ([]string, error) {
+	var n int
+	if _, err := fmt.Fscanf(br, "*%d\r\n", &n); err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		var size int
+		if _, err := fmt.Fscanf(br, "$%d\r\n", &size); err != nil {
+			return nil, err
+		}
+		p := make([]byte, size+2)
+		if _, err := io.ReadFull(br, p); err != nil {
+			return nil, err
+		}
+		args[i] = string(p[:size])
+	}
+	return args, nil
+}
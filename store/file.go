@@ -0,0 +1,94 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A Snapshotter saves a Memory counter to a file so the count
+// survives restarts.
+type Snapshotter struct {
+	Path string
+	C    *Memory
+}
+
+// Restore loads the last snapshot into s.C.
+// A missing snapshot file is not an error; the counter is left alone.
+func (s *Snapshotter) Restore() error {
+	slurp, err := ioutil.ReadFile(s.Path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	v, err := strconv.ParseInt(strings.TrimSpace(string(slurp)), 10, 64)
+	if err != nil {
+		return fmt.Errorf("store: bad snapshot %s: %v", s.Path, err)
+	}
+	s.C.Store(v)
+	return nil
+}
+
+// Snapshot writes the current count to s.Path.
+//
+// The value is written to a temporary file in the same directory,
+// fsynced, and renamed over the old snapshot, so a crash at any point
+// leaves either the old or the new value on disk, never a torn one.
+func (s *Snapshotter) Snapshot() error {
+	v, _ := s.C.Load(context.Background())
+	dir := filepath.Dir(s.Path)
+	f, err := ioutil.TempFile(dir, filepath.Base(s.Path)+".tmp")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	_, err = fmt.Fprintf(f, "%d\n", v)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, s.Path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return syncDir(dir)
+}
+
+// syncDir fsyncs dir so a preceding rename within it is durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// Run snapshots every interval until stop is closed, then takes a
+// final snapshot and returns its error.
+func (s *Snapshotter) Run(every time.Duration, stop <-chan struct{}) error {
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			if err := s.Snapshot(); err != nil {
+				return err
+			}
+		case <-stop:
+			return s.Snapshot()
+		}
+	}
+}
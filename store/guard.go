@@ -0,0 +1,172 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/errcode"
+)
+
+// Both wrap errcode.ErrBackendUnavailable.
+var (
+	ErrTimeout = fmt.Errorf("store: backend call timed out: %w", errcode.ErrBackendUnavailable)
+	ErrBusy    = fmt.Errorf("store: too many backend calls in flight: %w", errcode.ErrBackendUnavailable)
+)
+
+// Guarded wraps a slow or flaky Counter, such as Redis, so it can't
+// tie up handlers: each attempt gets a timeout, only MaxInFlight
+// attempts may be outstanding at once (a timed out attempt keeps its
+// slot until it really returns), and retries come out of a budget
+// shared by all calls so that a failing backend isn't hit harder.
+//
+// Load is retried on any error. Incr isn't idempotent, so it's only
+// retried when the backend was never reached (a failed dial).
+//
+// Each attempt's context is the caller's with the timeout applied, so
+// a backend that honors it, as Redis does, stops as soon as either
+// runs out. When the caller's context is done first, the call returns
+// its error, not ErrTimeout, and isn't retried.
+type Guarded struct {
+	C           Counter
+	Timeout     time.Duration // per attempt; default 250ms
+	MaxInFlight int           // default 100
+	Retries     int           // max retries per call
+
+	// RetryRatio is how many retries each successful call earns for
+	// the shared budget; default 0.1. The budget starts at, and is
+	// capped at, MaxRetryTokens (default 10).
+	RetryRatio     float64
+	MaxRetryTokens float64
+
+	once   sync.Once
+	sem    chan struct{}
+	mu     sync.Mutex
+	tokens float64
+}
+
+func (g *Guarded) init() {
+	n := g.MaxInFlight
+	if n == 0 {
+		n = 100
+	}
+	g.sem = make(chan struct{}, n)
+	if g.RetryRatio == 0 {
+		g.RetryRatio = 0.1
+	}
+	if g.MaxRetryTokens == 0 {
+		g.MaxRetryTokens = 10
+	}
+	g.tokens = g.MaxRetryTokens
+}
+
+func (g *Guarded) Incr(ctx context.Context) (int64, error) {
+	return g.call(ctx, g.C.Incr, isDialError)
+}
+
+// IncrBy calls C's IncrBy under the same guards as Incr. It fails if
+// C isn't an IncrByer.
+func (g *Guarded) IncrBy(ctx context.Context, n int64) (int64, error) {
+	ib, ok := g.C.(IncrByer)
+	if !ok {
+		return 0, fmt.Errorf("store: %T has no IncrBy", g.C)
+	}
+	return g.call(ctx, func(ctx context.Context) (int64, error) { return ib.IncrBy(ctx, n) }, isDialError)
+}
+
+// Swap calls C's Swap under the same guards as Incr. It fails if C
+// isn't a Swapper.
+func (g *Guarded) Swap(ctx context.Context, v int64) (int64, error) {
+	sw, ok := g.C.(Swapper)
+	if !ok {
+		return 0, fmt.Errorf("store: %T has no Swap", g.C)
+	}
+	return g.call(ctx, func(ctx context.Context) (int64, error) { return sw.Swap(ctx, v) }, isDialError)
+}
+
+func (g *Guarded) Load(ctx context.Context) (int64, error) {
+	return g.call(ctx, g.C.Load, func(error) bool { return true })
+}
+
+func isDialError(err error) bool {
+	var oe *net.OpError
+	return errors.As(err, &oe) && oe.Op == "dial"
+}
+
+func (g *Guarded) call(ctx context.Context, fn func(context.Context) (int64, error), retryable func(error) bool) (int64, error) {
+	g.once.Do(g.init)
+	for try := 0; ; try++ {
+		n, err := g.attempt(ctx, fn)
+		if err == nil {
+			g.deposit()
+			return n, nil
+		}
+		if ctx.Err() != nil || try >= g.Retries || !retryable(err) || !g.withdraw() {
+			return 0, err
+		}
+	}
+}
+
+func (g *Guarded) attempt(ctx context.Context, fn func(context.Context) (int64, error)) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	timeout := g.Timeout
+	if timeout == 0 {
+		timeout = 250 * time.Millisecond
+	}
+	actx, cancel := context.WithTimeout(ctx, timeout)
+	select {
+	case g.sem <- struct{}{}:
+	default:
+		cancel()
+		return 0, ErrBusy
+	}
+	type result struct {
+		n   int64
+		err error
+		// expired is whether fn failed after actx was done, in which
+		// case it most likely gave up because of that.
+		expired bool
+	}
+	ch := make(chan result, 1)
+	go func() {
+		defer func() { <-g.sem }()
+		defer cancel()
+		n, err := fn(actx)
+		ch <- result{n, err, err != nil && actx.Err() != nil}
+	}()
+	select {
+	case r := <-ch:
+		if !r.expired {
+			return r.n, r.err
+		}
+	case <-actx.Done():
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	return 0, ErrTimeout
+}
+
+func (g *Guarded) deposit() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.tokens += g.RetryRatio
+	if g.tokens > g.MaxRetryTokens {
+		g.tokens = g.MaxRetryTokens
+	}
+}
+
+func (g *Guarded) withdraw() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.tokens < 1 {
+		return false
+	}
+	g.tokens--
+	return true
+}
@@ -0,0 +1,129 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/errcode"
+)
+
+// slowCounter is a Counter that takes d to answer, or gives up early
+// when its context is done unless it's stubborn.
+type slowCounter struct {
+	d        time.Duration
+	stubborn bool
+	calls    int32 // atomic
+	gaveUp   int32 // atomic
+}
+
+func (c *slowCounter) Incr(ctx context.Context) (int64, error) { return c.Load(ctx) }
+
+func (c *slowCounter) Load(ctx context.Context) (int64, error) {
+	n := atomic.AddInt32(&c.calls, 1)
+	if c.stubborn {
+		time.Sleep(c.d)
+		return int64(n), nil
+	}
+	select {
+	case <-time.After(c.d):
+		return int64(n), nil
+	case <-ctx.Done():
+		atomic.AddInt32(&c.gaveUp, 1)
+		return 0, ctx.Err()
+	}
+}
+
+// brokenCounter always fails.
+type brokenCounter struct {
+	calls int32 // atomic
+}
+
+func (c *brokenCounter) Incr(ctx context.Context) (int64, error) { return c.Load(ctx) }
+
+func (c *brokenCounter) Load(context.Context) (int64, error) {
+	atomic.AddInt32(&c.calls, 1)
+	return 0, errors.New("broken")
+}
+
+func TestGuardedTimeout(t *testing.T) {
+	ctx := context.Background()
+	g := &Guarded{C: &slowCounter{d: time.Second}, Timeout: 20 * time.Millisecond}
+	t0 := time.Now()
+	if _, err := g.Load(ctx); err != ErrTimeout {
+		t.Errorf("Load error = %v; want ErrTimeout", err)
+	}
+	if d := time.Since(t0); d > 500*time.Millisecond {
+		t.Errorf("Load took %v", d)
+	}
+	if !errors.Is(ErrTimeout, errcode.ErrBackendUnavailable) || !errors.Is(ErrBusy, errcode.ErrBackendUnavailable) {
+		t.Errorf("ErrTimeout and ErrBusy should both wrap errcode.ErrBackendUnavailable")
+	}
+}
+
+func TestGuardedInFlightLimit(t *testing.T) {
+	ctx := context.Background()
+	slow := &slowCounter{d: 200 * time.Millisecond, stubborn: true}
+	g := &Guarded{C: slow, Timeout: 10 * time.Millisecond, MaxInFlight: 2}
+	for i := 0; i < 2; i++ {
+		if _, err := g.Load(ctx); err != ErrTimeout {
+			t.Fatalf("call %d: error = %v; want ErrTimeout", i, err)
+		}
+	}
+	// Both slots are still held by the abandoned calls, which ignore
+	// their contexts.
+	if _, err := g.Load(ctx); err != ErrBusy {
+		t.Errorf("third call error = %v; want ErrBusy", err)
+	}
+	if n := atomic.LoadInt32(&slow.calls); n != 2 {
+		t.Errorf("backend saw %d calls; want 2", n)
+	}
+}
+
+func TestGuardedRetryBudget(t *testing.T) {
+	ctx := context.Background()
+	broken := new(brokenCounter)
+	g := &Guarded{C: broken, Retries: 3, MaxRetryTokens: 4}
+	for i := 0; i < 5; i++ {
+		g.Load(ctx)
+	}
+	// 5 calls plus only 4 retries from the budget.
+	if n := atomic.LoadInt32(&broken.calls); n != 9 {
+		t.Errorf("backend saw %d calls; want 9", n)
+	}
+
+	// Incr isn't retried on ordinary errors.
+	atomic.StoreInt32(&broken.calls, 0)
+	g = &Guarded{C: broken, Retries: 3}
+	g.Incr(ctx)
+	if n := atomic.LoadInt32(&broken.calls); n != 1 {
+		t.Errorf("Incr made %d attempts; want 1", n)
+	}
+}
+
+func TestGuardedCancel(t *testing.T) {
+	slow := &slowCounter{d: time.Minute}
+	g := &Guarded{C: slow, Timeout: time.Minute, Retries: 3}
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	t0 := time.Now()
+	if _, err := g.Load(ctx); err != context.Canceled {
+		t.Errorf("Load error = %v; want context.Canceled", err)
+	}
+	if d := time.Since(t0); d > time.Second {
+		t.Errorf("Load took %v to notice the cancel", d)
+	}
+	// The backend saw the cancel too, and a canceled call isn't retried.
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt32(&slow.gaveUp) == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if n := atomic.LoadInt32(&slow.gaveUp); n != 1 {
+		t.Errorf("backend gave up on %d calls; want 1", n)
+	}
+	if n := atomic.LoadInt32(&slow.calls); n != 1 {
+		t.Errorf("backend saw %d calls; want 1", n)
+	}
+}
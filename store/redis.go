@@ -0,0 +1,240 @@
+package store
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Redis is a Counter kept in a Redis server, so several server
+// processes behind a load balancer can share one count.
+//
+// It speaks just enough of the Redis protocol to INCR and GET one key,
+// over a small pool of connections. A command gives up at Timeout or
+// at its context's deadline, whichever is sooner, and as soon as its
+// context is canceled.
+type Redis struct {
+	Addr    string        // host:port
+	Key     string        // default "visitors"
+	Timeout time.Duration // per command, including dialing; default 1s
+	MaxIdle int           // idle connections to keep; default 4
+
+	mu   sync.Mutex
+	idle []*redisConn
+}
+
+type redisConn struct {
+	net.Conn
+	br *bufio.Reader
+}
+
+// A RedisError is an error reply from the Redis server.
+type RedisError string
+
+func (e RedisError) Error() string { return "redis: " + string(e) }
+
+func (r *Redis) key() string {
+	if r.Key == "" {
+		return "visitors"
+	}
+	return r.Key
+}
+
+func (r *Redis) timeout() time.Duration {
+	if r.Timeout == 0 {
+		return time.Second
+	}
+	return r.Timeout
+}
+
+func (r *Redis) Incr(ctx context.Context) (int64, error) {
+	v, err := r.do(ctx, "INCR", r.key())
+	if err != nil {
+		return 0, err
+	}
+	n, ok := v.(int64)
+	if !ok {
+		return 0, fmt.Errorf("redis: unexpected INCR reply %q", v)
+	}
+	return n, nil
+}
+
+func (r *Redis) IncrBy(ctx context.Context, n int64) (int64, error) {
+	v, err := r.do(ctx, "INCRBY", r.key(), strconv.FormatInt(n, 10))
+	if err != nil {
+		return 0, err
+	}
+	total, ok := v.(int64)
+	if !ok {
+		return 0, fmt.Errorf("redis: unexpected INCRBY reply %q", v)
+	}
+	return total, nil
+}
+
+func (r *Redis) Load(ctx context.Context) (int64, error) {
+	v, err := r.do(ctx, "GET", r.key())
+	if err != nil || v == nil {
+		return 0, err
+	}
+	s, ok := v.(string)
+	if !ok {
+		return 0, fmt.Errorf("redis: unexpected GET reply %q", v)
+	}
+	return strconv.ParseInt(s, 10, 64)
+}
+
+// Store sets the counter to v.
+func (r *Redis) Store(ctx context.Context, v int64) error {
+	_, err := r.do(ctx, "SET", r.key(), strconv.FormatInt(v, 10))
+	return err
+}
+
+func (r *Redis) Swap(ctx context.Context, v int64) (int64, error) {
+	old, err := r.do(ctx, "GETSET", r.key(), strconv.FormatInt(v, 10))
+	if err != nil || old == nil {
+		return 0, err
+	}
+	s, ok := old.(string)
+	if !ok {
+		return 0, fmt.Errorf("redis: unexpected GETSET reply %q", old)
+	}
+	return strconv.ParseInt(s, 10, 64)
+}
+
+// Close closes the idle connections.
+func (r *Redis) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, c := range r.idle {
+		c.Close()
+	}
+	r.idle = nil
+	return nil
+}
+
+func (r *Redis) get(ctx context.Context) (*redisConn, error) {
+	r.mu.Lock()
+	if n := len(r.idle); n > 0 {
+		c := r.idle[n-1]
+		r.idle = r.idle[:n-1]
+		r.mu.Unlock()
+		return c, nil
+	}
+	r.mu.Unlock()
+	d := net.Dialer{Timeout: r.timeout()}
+	c, err := d.DialContext(ctx, "tcp", r.Addr)
+	if err != nil {
+		return nil, err
+	}
+	return &redisConn{c, bufio.NewReader(c)}, nil
+}
+
+func (r *Redis) put(c *redisConn) {
+	max := r.MaxIdle
+	if max == 0 {
+		max = 4
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.idle) >= max {
+		c.Close()
+		return
+	}
+	r.idle = append(r.idle, c)
+}
+
+// do sends one command and returns its reply: an int64, a string, or
+// nil for a nil bulk reply.
+//
+// Canceling ctx moves the connection's deadline into the past, which
+// unblocks its read or write. The connection is then closed rather
+// than pooled, and a command that failed returns ctx's error.
+func (r *Redis) do(ctx context.Context, args ...string) (interface{}, error) {
+	c, err := r.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	deadline := time.Now().Add(r.timeout())
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	c.SetDeadline(deadline)
+	stop := context.AfterFunc(ctx, func() { c.SetDeadline(time.Unix(1, 0)) })
+	v, err := c.roundTrip(args)
+	if !stop() {
+		// The deadline may have been cut short under a finished
+		// command too, so don't pool the connection either way.
+		c.Close()
+		if err != nil {
+			return nil, ctx.Err()
+		}
+		return v, nil
+	}
+	if _, ok := err.(RedisError); err != nil && !ok {
+		// The connection is in an unknown state.
+		c.Close()
+		return nil, err
+	}
+	r.put(c)
+	return v, err
+}
+
+func (c *redisConn) roundTrip(args []string) (interface{}, error) {
+	buf := []byte("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, a := range args {
+		buf = append(buf, '$')
+		buf = strconv.AppendInt(buf, int64(len(a)), 10)
+		buf = append(buf, "\r\n"...)
+		buf = append(buf, a...)
+		buf = append(buf, "\r\n"...)
+	}
+	if _, err := c.Write(buf); err != nil {
+		return nil, err
+	}
+	return readReply(c.br)
+}
+
+var errBadReply = errors.New("redis: malformed reply")
+
+func readReply(br *bufio.Reader) (interface{}, error) {
+	line, err := br.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, errBadReply
+	}
+	kind, body := line[0], line[1:len(line)-2]
+	switch kind {
+	case '+':
+		return body, nil
+	case '-':
+		return nil, RedisError(body)
+	case ':':
+		n, err := strconv.ParseInt(body, 10, 64)
+		if err != nil {
+			return nil, errBadReply
+		}
+		return n, nil
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, errBadReply
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		p := make([]byte, n+2)
+		if _, err := io.ReadFull(br, p); err != nil {
+			return nil, err
+		}
+		return string(p[:n]), nil
+	}
+	return nil, errBadReply
+}
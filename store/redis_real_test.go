@@ -0,0 +1,33 @@
+//go:build redis
+
+package store
+
+import (
+	"context"
+	"os"
+	"testing"
+)
+
+// TestRealRedis runs against a real Redis server:
+//
+//	REDIS_ADDR=localhost:6379 go test -tags=redis -run=RealRedis
+func TestRealRedis(t *testing.T) {
+	ctx := context.Background()
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		addr = "localhost:6379"
+	}
+	r := &Redis{Addr: addr, Key: "talk-yapc-test-visitors"}
+	defer r.Close()
+	before, err := r.Load(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := r.Incr(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != before+1 {
+		t.Errorf("Incr = %d; want %d", n, before+1)
+	}
+}
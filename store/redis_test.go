@@ -0,0 +1,127 @@
+package store
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/store/fakeredis"
+)
+
+func startFakeRedis(t *testing.T) *fakeredis.Server {
+	s, err := fakeredis.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestRedisCounter(t *testing.T) {
+	ctx := context.Background()
+	s := startFakeRedis(t)
+	defer s.Close()
+	r := &Redis{Addr: s.Addr(), MaxIdle: 2}
+	defer r.Close()
+
+	if n, err := r.Load(ctx); err != nil || n != 0 {
+		t.Fatalf("Load of missing key = %d, %v; want 0, nil", n, err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := r.Incr(ctx); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n, err := r.Load(ctx); err != nil || n != 50 {
+		t.Errorf("Load = %d, %v; want 50, nil", n, err)
+	}
+
+	// Sequential calls reuse one pooled connection.
+	before := s.Dials()
+	for i := 0; i < 10; i++ {
+		r.Incr(ctx)
+	}
+	if d := s.Dials() - before; d != 0 {
+		t.Errorf("sequential Incrs dialed %d new conns; want 0", d)
+	}
+}
+
+func TestRedisErrorReply(t *testing.T) {
+	ctx := context.Background()
+	s := startFakeRedis(t)
+	defer s.Close()
+	r := &Redis{Addr: s.Addr()}
+	defer r.Close()
+	if _, err := r.do(ctx, "BOGUS"); err == nil {
+		t.Fatal("want error")
+	} else if _, ok := err.(RedisError); !ok {
+		t.Fatalf("error = %T %v; want RedisError", err, err)
+	}
+	if _, err := r.Incr(ctx); err != nil {
+		t.Errorf("Incr after error reply: %v", err)
+	}
+}
+
+func TestRedisTimeout(t *testing.T) {
+	ctx := context.Background()
+	s := startFakeRedis(t)
+	s.Stall()
+	defer s.Close()
+	r := &Redis{Addr: s.Addr(), Timeout: 50 * time.Millisecond}
+	defer r.Close()
+	t0 := time.Now()
+	if _, err := r.Incr(ctx); err == nil {
+		t.Fatal("Incr against stalled server succeeded")
+	}
+	if d := time.Since(t0); d > time.Second {
+		t.Errorf("Incr took %v to time out", d)
+	}
+}
+
+func TestRedisCancel(t *testing.T) {
+	s := startFakeRedis(t)
+	s.Stall()
+	defer s.Close()
+	r := &Redis{Addr: s.Addr(), Timeout: time.Minute}
+	defer r.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	t0 := time.Now()
+	if _, err := r.Incr(ctx); err != context.Canceled {
+		t.Errorf("Incr error = %v; want context.Canceled", err)
+	}
+	if d := time.Since(t0); d > time.Second {
+		t.Errorf("Incr took %v to notice the cancel", d)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	t0 = time.Now()
+	if _, err := r.Load(ctx); err == nil {
+		t.Error("Load past its deadline succeeded")
+	}
+	if d := time.Since(t0); d > time.Second {
+		t.Errorf("Load took %v to hit its context's deadline", d)
+	}
+}
+
+func TestRedisStore(t *testing.T) {
+	ctx := context.Background()
+	s := startFakeRedis(t)
+	defer s.Close()
+	r := &Redis{Addr: s.Addr()}
+	defer r.Close()
+	if err := r.Store(ctx, 41); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := r.Incr(ctx); err != nil || n != 42 {
+		t.Errorf("Incr after Store(41) = %d, %v; want 42, nil", n, err)
+	}
+}
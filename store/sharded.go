@@ -0,0 +1,67 @@
+package store
+
+import (
+	"context"
+	"math/rand/v2"
+	"sync/atomic"
+)
+
+const numShards = 32
+
+// Sharded is a Counter spread over several shards, each on its own
+// cache line, so that parallel increments rarely contend on the same
+// memory.
+//
+// The catch is reading it: Load sums every shard, and so does Incr,
+// since the Counter interface wants the new total back. Callers that
+// don't need the total should use Add, which touches just one shard.
+// BenchmarkCounter shows the difference.
+//
+// Incr's and IncrBy's results are approximate: the sum is read after
+// the add, not with it, so it takes in whatever other goroutines added
+// meanwhile. Concurrent callers may get the same number, and some
+// numbers go to no one. Don't hand them out as unique.
+type Sharded struct {
+	shards [numShards]shard
+}
+
+type shard struct {
+	n int64    // must be accessed atomically
+	_ [56]byte // pad to a 64 byte cache line
+}
+
+// Add adds one to a random shard.
+func (s *Sharded) Add() {
+	atomic.AddInt64(&s.shards[rand.Uint32()%numShards].n, 1)
+}
+
+// Incr adds one and returns the approximate new total.
+func (s *Sharded) Incr(ctx context.Context) (int64, error) {
+	s.Add()
+	return s.Load(ctx)
+}
+
+// IncrBy adds n and returns the approximate new total.
+func (s *Sharded) IncrBy(ctx context.Context, n int64) (int64, error) {
+	atomic.AddInt64(&s.shards[rand.Uint32()%numShards].n, n)
+	return s.Load(ctx)
+}
+
+// Swap sets the first shard to v and the rest to zero. An Add racing
+// with it is counted either in the old value or the new one, never
+// both or neither, as each shard is swapped atomically.
+func (s *Sharded) Swap(_ context.Context, v int64) (int64, error) {
+	old := atomic.SwapInt64(&s.shards[0].n, v)
+	for i := 1; i < numShards; i++ {
+		old += atomic.SwapInt64(&s.shards[i].n, 0)
+	}
+	return old, nil
+}
+
+func (s *Sharded) Load(context.Context) (int64, error) {
+	var sum int64
+	for i := range s.shards {
+		sum += atomic.LoadInt64(&s.shards[i].n)
+	}
+	return sum, nil
+}
@@ -0,0 +1,77 @@
+package store
+
+import (
+	"context"
+	"sync"
+	"testing"
+)
+
+func TestSharded(t *testing.T) {
+	ctx := context.Background()
+	var s Sharded
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				s.Add()
+			}
+		}()
+	}
+	wg.Wait()
+	if n, _ := s.Load(ctx); n != 8000 {
+		t.Errorf("Load = %d; want 8000", n)
+	}
+	if n, _ := s.Incr(ctx); n != 8001 {
+		t.Errorf("Incr = %d; want 8001", n)
+	}
+}
+
+type mutexCounter struct {
+	mu sync.Mutex
+	n  int64
+}
+
+func (c *mutexCounter) Incr(context.Context) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.n++
+	return c.n, nil
+}
+
+func (c *mutexCounter) Load(context.Context) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.n, nil
+}
+
+// Compare at several parallelism levels with:
+//
+//	go test -run=^$ -bench=Counter -cpu=1,4,16
+func BenchmarkCounter(b *testing.B) {
+	ctx := context.Background()
+	bench := func(b *testing.B, incr func()) {
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				incr()
+			}
+		})
+	}
+	b.Run("Atomic", func(b *testing.B) {
+		c := new(Memory)
+		bench(b, func() { c.Incr(ctx) })
+	})
+	b.Run("Mutex", func(b *testing.B) {
+		c := new(mutexCounter)
+		bench(b, func() { c.Incr(ctx) })
+	})
+	b.Run("ShardedIncr", func(b *testing.B) {
+		c := new(Sharded)
+		bench(b, func() { c.Incr(ctx) })
+	})
+	b.Run("ShardedAdd", func(b *testing.B) {
+		c := new(Sharded)
+		bench(b, c.Add)
+	})
+}
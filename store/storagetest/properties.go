@@ -0,0 +1,157 @@
+package storagetest
+
+import (
+	"context"
+	"flag"
+	"math/rand/v2"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/store"
+)
+
+var seed = flag.Uint64("storagetest.seed", 0, "seed for TestCounterProperties' random plans; 0 picks one from the clock")
+
+// Props describes what TestCounterProperties may assume of a counter.
+type Props struct {
+	// Exact says an Incr or IncrBy returns the count just after its
+	// own addition, so no two increments' results overlap. Sharded's
+	// aren't exact: it adds, then sums the shards, and the sum may
+	// include other goroutines' additions.
+	Exact bool
+
+	// Snapshot, if non-nil, saves the counter and returns what a fresh
+	// counter restored from the save loads. It may be called from
+	// several goroutines at once.
+	Snapshot func(c store.Counter) (int64, error)
+}
+
+// An op is one step of a worker's plan.
+type op struct {
+	kind byte  // 'i' Incr, 'b' IncrBy, 'l' Load, 's' Snapshot
+	n    int64 // for IncrBy
+}
+
+// TestCounterProperties runs random plans of concurrent Incrs,
+// IncrBys, Loads, and Snapshots against fresh counters from
+// newCounter, checking that:
+//
+//   - each goroutine sees the count only go up;
+//   - every result lies between the increments that finished before
+//     the call and those that started before it returned;
+//   - with p.Exact, the increments' results tile the count without
+//     gaps or overlaps;
+//   - in the end no increment has been lost.
+//
+// A failure reports the seed, which -storagetest.seed replays. The
+// goroutines' interleaving isn't replayed, so a race may take a few
+// runs to show up again.
+func TestCounterProperties(t *testing.T, newCounter func(t *testing.T) store.Counter, p Props) {
+	s := *seed
+	if s == 0 {
+		s = uint64(time.Now().UnixNano())
+	}
+	rng := rand.New(rand.NewPCG(s, 0))
+	trials := 20
+	if testing.Short() {
+		trials = 4
+	}
+	for i := 0; i < trials; i++ {
+		c := newCounter(t)
+		_, canIncrBy := c.(store.IncrByer)
+		plans := make([][]op, 2+rng.IntN(7))
+		for w := range plans {
+			n := 10 + rng.IntN(90)
+			for j := 0; j < n; j++ {
+				o := op{kind: 'i'}
+				switch r := rng.IntN(10); {
+				case r < 3 && canIncrBy:
+					o = op{kind: 'b', n: 1 + rng.Int64N(20)}
+				case r < 6:
+					o.kind = 'l'
+				case r == 6 && p.Snapshot != nil:
+					o.kind = 's'
+				}
+				plans[w] = append(plans[w], o)
+			}
+		}
+		runPlans(t, c, plans, p)
+		if t.Failed() {
+			t.Fatalf("trial %d failed; replay with -storagetest.seed=%d", i, s)
+		}
+	}
+}
+
+func runPlans(t *testing.T, c store.Counter, plans [][]op, p Props) {
+	ctx := context.Background()
+	var started, done int64          // sums of increments, must be accessed atomically
+	type span struct{ lo, hi int64 } // an increment's (lo, hi]
+	var mu sync.Mutex
+	var spans []span
+
+	var wg sync.WaitGroup
+	for _, plan := range plans {
+		wg.Add(1)
+		go func(plan []op) {
+			defer wg.Done()
+			var last int64 // largest count this goroutine has seen
+			for _, o := range plan {
+				lo := atomic.LoadInt64(&done)
+				var delta, got int64
+				var err error
+				switch o.kind {
+				case 'i':
+					delta = 1
+					atomic.AddInt64(&started, delta)
+					got, err = c.Incr(ctx)
+				case 'b':
+					delta = o.n
+					atomic.AddInt64(&started, delta)
+					got, err = c.(store.IncrByer).IncrBy(ctx, delta)
+				case 'l':
+					got, err = c.Load(ctx)
+				case 's':
+					got, err = p.Snapshot(c)
+				}
+				if err != nil {
+					t.Errorf("op %c: %v", o.kind, err)
+					return
+				}
+				if delta > 0 {
+					atomic.AddInt64(&done, delta)
+					lo += delta
+					mu.Lock()
+					spans = append(spans, span{got - delta, got})
+					mu.Unlock()
+				}
+				if hi := atomic.LoadInt64(&started); got < lo || got > hi {
+					t.Errorf("op %c returned %d; want %d through %d", o.kind, got, lo, hi)
+				}
+				if got < last {
+					t.Errorf("op %c returned %d after this goroutine saw %d", o.kind, got, last)
+				}
+				last = max(last, got)
+			}
+		}(plan)
+	}
+	wg.Wait()
+
+	if n, err := c.Load(ctx); err != nil || n != done {
+		t.Errorf("final Load = %d, %v; want %d, the sum of the increments", n, err, done)
+	}
+	if !p.Exact {
+		return
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i].lo < spans[j].lo })
+	var next int64
+	for _, s := range spans {
+		if s.lo != next {
+			t.Errorf("increment returned (%d, %d]; want it to start at %d, where the one before ended", s.lo, s.hi, next)
+			return
+		}
+		next = s.hi
+	}
+}
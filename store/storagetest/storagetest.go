@@ -0,0 +1,207 @@
+// Package storagetest checks that store backends all behave the same
+// way, so a new backend can't quietly diverge from the others.
+//
+// A backend's tests call the suites with a constructor:
+//
+//	func TestContract(t *testing.T) {
+//		storagetest.TestCounter(t, func(t *testing.T) store.Counter { return new(store.Memory) })
+//	}
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/store"
+)
+
+// TestCounter checks the behavior every Counter must have.
+// Each call to newCounter must return a fresh, zeroed counter.
+func TestCounter(t *testing.T, newCounter func(t *testing.T) store.Counter) {
+	ctx := context.Background()
+	t.Run("Fresh", func(t *testing.T) {
+		c := newCounter(t)
+		if n, err := c.Load(ctx); err != nil || n != 0 {
+			t.Errorf("Load of new counter = %d, %v; want 0, nil", n, err)
+		}
+	})
+	t.Run("Sequential", func(t *testing.T) {
+		c := newCounter(t)
+		for want := int64(1); want <= 5; want++ {
+			n, err := c.Incr(ctx)
+			if err != nil || n != want {
+				t.Fatalf("Incr = %d, %v; want %d, nil", n, err, want)
+			}
+			if n, err := c.Load(ctx); err != nil || n != want {
+				t.Fatalf("Load = %d, %v; want %d, nil", n, err, want)
+			}
+		}
+	})
+	t.Run("Concurrent", func(t *testing.T) {
+		c := newCounter(t)
+		const workers, each = 8, 50
+		var wg sync.WaitGroup
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				var last int64
+				for j := 0; j < each; j++ {
+					n, err := c.Incr(ctx)
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					if n <= last {
+						t.Errorf("Incr went from %d to %d in one goroutine", last, n)
+					}
+					last = n
+				}
+			}()
+		}
+		wg.Wait()
+		if n, err := c.Load(ctx); err != nil || n != workers*each {
+			t.Errorf("after concurrent Incrs, Load = %d, %v; want %d", n, err, workers*each)
+		}
+	})
+	t.Run("IncrBy", func(t *testing.T) {
+		c, ok := newCounter(t).(store.IncrByer)
+		if !ok {
+			t.Skip("not an IncrByer")
+		}
+		if _, err := c.Incr(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if n, err := c.IncrBy(ctx, 41); err != nil || n != 42 {
+			t.Fatalf("IncrBy(41) after Incr = %d, %v; want 42, nil", n, err)
+		}
+		if n, err := c.Load(ctx); err != nil || n != 42 {
+			t.Errorf("Load = %d, %v; want 42, nil", n, err)
+		}
+	})
+	t.Run("Swap", func(t *testing.T) {
+		c, ok := newCounter(t).(store.Swapper)
+		if !ok {
+			t.Skip("not a Swapper")
+		}
+		if old, err := c.Swap(ctx, 7); err != nil || old != 0 {
+			t.Fatalf("Swap(7) on a new counter = %d, %v; want 0, nil", old, err)
+		}
+		for i := 0; i < 3; i++ {
+			if _, err := c.Incr(ctx); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if old, err := c.Swap(ctx, 0); err != nil || old != 10 {
+			t.Fatalf("Swap(0) = %d, %v; want 10, nil", old, err)
+		}
+		if n, err := c.Load(ctx); err != nil || n != 0 {
+			t.Errorf("Load after Swap(0) = %d, %v; want 0, nil", n, err)
+		}
+	})
+}
+
+// TestDurableCounter checks that a counter's value survives being
+// closed and opened again. open must return the same stored counter
+// each time it's called within one test; close releases it.
+func TestDurableCounter(t *testing.T, open func(t *testing.T) store.Counter, close func(store.Counter)) {
+	ctx := context.Background()
+	c := open(t)
+	for i := 0; i < 3; i++ {
+		if _, err := c.Incr(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(c)
+	c = open(t)
+	defer close(c)
+	if n, err := c.Load(ctx); err != nil || n != 3 {
+		t.Errorf("Load after reopen = %d, %v; want 3, nil", n, err)
+	}
+}
+
+// TestBrokenCounter checks that a counter whose backend is
+// unreachable reports errors, and zero values, rather than inventing
+// counts or hanging.
+func TestBrokenCounter(t *testing.T, c store.Counter) {
+	ctx := context.Background()
+	done := make(chan bool)
+	go func() {
+		defer close(done)
+		if n, err := c.Incr(ctx); err == nil || n != 0 {
+			t.Errorf("Incr on broken backend = %d, %v; want 0 and an error", n, err)
+		}
+		if n, err := c.Load(ctx); err == nil || n != 0 {
+			t.Errorf("Load on broken backend = %d, %v; want 0 and an error", n, err)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("broken backend hung")
+	}
+}
+
+// TestUploadLog checks the behavior every UploadLog must have.
+// Each call to newLog must return a fresh, empty log able to hold at
+// least 10 uploads.
+func TestUploadLog(t *testing.T, newLog func(t *testing.T) store.UploadLog) {
+	ctx := context.Background()
+	l := newLog(t)
+	if got, err := l.Recent(ctx, 5); err != nil || len(got) != 0 {
+		t.Fatalf("Recent on new log = %v, %v; want none", got, err)
+	}
+	base := time.Date(2015, 8, 22, 10, 0, 0, 0, time.UTC)
+	for i := 0; i < 10; i++ {
+		u := store.Upload{Time: base.Add(time.Duration(i) * time.Second), Size: int64(i), Sum: "x"}
+		if err := l.Add(ctx, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err := l.Recent(ctx, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 {
+		t.Fatalf("Recent(3) returned %d uploads", len(got))
+	}
+	for i, u := range got {
+		if want := int64(9 - i); u.Size != want {
+			t.Errorf("Recent(3)[%d].Size = %d; want %d (newest first)", i, u.Size, want)
+		}
+		if !u.Time.Equal(base.Add(time.Duration(u.Size) * time.Second)) {
+			t.Errorf("Recent(3)[%d].Time = %v; didn't round trip", i, u.Time)
+		}
+	}
+
+	w, ok := l.(store.UploadWalker)
+	if !ok {
+		return
+	}
+	var sizes []int64
+	err = w.Walk(ctx, func(u store.Upload) error {
+		sizes = append(sizes, u.Size)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Walk: %v", err)
+	}
+	if len(sizes) != 10 || sizes[0] != 9 || sizes[9] != 0 {
+		t.Errorf("Walk visited sizes %v; want 9 down to 0", sizes)
+	}
+	stop := errors.New("stop")
+	sizes = nil
+	err = w.Walk(ctx, func(u store.Upload) error {
+		sizes = append(sizes, u.Size)
+		if len(sizes) == 2 {
+			return stop
+		}
+		return nil
+	})
+	if err != stop || len(sizes) != 2 {
+		t.Errorf("Walk stopped by fn = %v after %d uploads; want its error after 2", err, len(sizes))
+	}
+}
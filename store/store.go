@@ -0,0 +1,67 @@
+// Package store contains the visitor counter backends used by the
+// later steps of the talk.
+package store
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// A Counter counts visitors.
+//
+// Handlers call it through this interface, which costs an indirect
+// call the compiler can't inline. BenchmarkDispatch measures that: on
+// a plain (non-atomic) counter, about 2.8ns through the interface or a
+// func value against 2.0ns for the inlined call on the concrete type,
+// but for Memory all three ways of calling take about 8.5ns. The
+// atomic instruction dominates and the dispatch is noise, so the
+// interface's flexibility is free where it's used.
+//
+// Every method takes a context. Handlers pass the request's, so a
+// client that hangs up or a request past its deadline stops waiting on
+// a remote backend instead of holding the handler. Backends in memory
+// ignore it.
+type Counter interface {
+	// Incr adds one to the counter and returns the new value.
+	Incr(ctx context.Context) (int64, error)
+	// Load returns the current value.
+	Load(ctx context.Context) (int64, error)
+}
+
+// An IncrByer is a Counter that can add more than one in a single
+// atomic step, for applying a batch of visits at once.
+type IncrByer interface {
+	Counter
+	// IncrBy adds n, which must be positive, and returns the new value.
+	IncrBy(ctx context.Context, n int64) (int64, error)
+}
+
+// A Swapper is a Counter that can be set to a new value, returning
+// the old one in the same atomic step, as for resetting it to zero
+// without losing track of what it was.
+type Swapper interface {
+	Counter
+	// Swap sets the counter to v and returns its previous value.
+	Swap(ctx context.Context, v int64) (old int64, err error)
+}
+
+// Memory is a Counter held in memory.
+// The zero value is ready to use.
+type Memory struct {
+	n int64 // must be accessed atomically
+}
+
+func (m *Memory) Incr(context.Context) (int64, error) { return atomic.AddInt64(&m.n, 1), nil }
+
+func (m *Memory) IncrBy(_ context.Context, n int64) (int64, error) {
+	return atomic.AddInt64(&m.n, n), nil
+}
+
+func (m *Memory) Load(context.Context) (int64, error) { return atomic.LoadInt64(&m.n), nil }
+
+// Store sets the counter to v.
+func (m *Memory) Store(v int64) { atomic.StoreInt64(&m.n, v) }
+
+func (m *Memory) Swap(_ context.Context, v int64) (int64, error) {
+	return atomic.SwapInt64(&m.n, v), nil
+}
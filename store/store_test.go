@@ -0,0 +1,72 @@
+package store
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/internal/benchtest"
+)
+
+// plainCounter is a Counter with no atomics, so benchmarks through it
+// measure the call and nothing else.
+type plainCounter struct{ n int64 }
+
+func (c *plainCounter) Incr(context.Context) (int64, error) { c.n++; return c.n, nil }
+func (c *plainCounter) Load(context.Context) (int64, error) { return c.n, nil }
+
+// Package-level, like stepn's counter, so the compiler can't see
+// which Counter is behind the interface.
+var (
+	sinkN int64
+	rawN  int64
+)
+
+// BenchmarkDispatch compares calling Incr through the Counter
+// interface, on the concrete type, and through a func value. Run it
+// serially, so the numbers are the cost of the call and not of
+// contention:
+//
+//	go test -run=^$ -bench=Dispatch
+//
+// See the Counter docs for what it showed.
+func BenchmarkDispatch(b *testing.B) {
+	ctx := context.Background()
+	run := func(b *testing.B, iface Counter, incr func(context.Context) (int64, error)) {
+		b.Run("Interface", func(b *testing.B) {
+			for benchtest.Loop(b) {
+				sinkN, _ = iface.Incr(ctx)
+			}
+		})
+		b.Run("FuncField", func(b *testing.B) {
+			for benchtest.Loop(b) {
+				sinkN, _ = incr(ctx)
+			}
+		})
+	}
+	// The Concrete cases are written out for each type, as a method
+	// call passed in as a func would be a FuncField call again.
+	b.Run("Memory", func(b *testing.B) {
+		m := new(Memory)
+		run(b, m, m.Incr)
+		b.Run("Concrete", func(b *testing.B) {
+			for benchtest.Loop(b) {
+				sinkN, _ = m.Incr(ctx)
+			}
+		})
+	})
+	b.Run("Plain", func(b *testing.B) {
+		p := new(plainCounter)
+		run(b, p, p.Incr)
+		b.Run("Concrete", func(b *testing.B) {
+			for benchtest.Loop(b) {
+				sinkN, _ = p.Incr(ctx)
+			}
+		})
+	})
+	b.Run("RawAtomic", func(b *testing.B) {
+		for benchtest.Loop(b) {
+			sinkN = atomic.AddInt64(&rawN, 1)
+		}
+	})
+}
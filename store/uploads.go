@@ -0,0 +1,124 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// An Upload records one request body hashed by the server.
+type Upload struct {
+	Time time.Time `json:"time"`
+	Size int64     `json:"size"`
+	// Alg names the hash Sum is the digest from, such as "sha256", if
+	// it isn't sha1.
+	Alg string `json:"alg,omitempty"`
+	Sum string `json:"sum"` // in hex
+}
+
+// UnmarshalJSON decodes an Upload, taking Sum from "sha1" if there's
+// no "sum", as in uploads recorded before the field was renamed.
+func (u *Upload) UnmarshalJSON(b []byte) error {
+	type upload Upload // without this method
+	var v struct {
+		upload
+		SHA1 string `json:"sha1"`
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	*u = Upload(v.upload)
+	if u.Sum == "" {
+		u.Sum = v.SHA1
+	}
+	return nil
+}
+
+// An UploadLog records uploads.
+// Like a Counter's, its methods take the caller's context.
+type UploadLog interface {
+	Add(ctx context.Context, u Upload) error
+	// Recent returns up to n of the most recent uploads, newest first.
+	Recent(ctx context.Context, n int) ([]Upload, error)
+}
+
+// An UploadWalker is an UploadLog that can visit every upload it
+// holds without loading them all at once, for exporting a log too
+// big for Recent.
+type UploadWalker interface {
+	UploadLog
+	// Walk calls fn on each upload, newest first, until fn returns an
+	// error, which Walk returns. Uploads added during the walk aren't
+	// visited.
+	Walk(ctx context.Context, fn func(Upload) error) error
+}
+
+// walkChunk is how many uploads Walk copies out at a time.
+const walkChunk = 64
+
+// MemoryUploads is an UploadLog remembering the last few uploads.
+type MemoryUploads struct {
+	mu   sync.Mutex
+	ring []Upload
+	n    int // total added
+}
+
+// NewMemoryUploads returns an UploadLog holding up to size uploads.
+func NewMemoryUploads(size int) *MemoryUploads {
+	return &MemoryUploads{ring: make([]Upload, size)}
+}
+
+func (m *MemoryUploads) Add(_ context.Context, u Upload) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.ring[m.n%len(m.ring)] = u
+	m.n++
+	return nil
+}
+
+func (m *MemoryUploads) Recent(_ context.Context, n int) ([]Upload, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if n > m.n {
+		n = m.n
+	}
+	if n > len(m.ring) {
+		n = len(m.ring)
+	}
+	out := make([]Upload, n)
+	for i := range out {
+		out[i] = m.ring[(m.n-1-i)%len(m.ring)]
+	}
+	return out, nil
+}
+
+// Walk visits the uploads in chunks, holding the lock only while it
+// copies each one out, so a slow fn doesn't hold up Add. An upload
+// overwritten before the walk reaches it ends the walk early.
+func (m *MemoryUploads) Walk(ctx context.Context, fn func(Upload) error) error {
+	m.mu.Lock()
+	next := m.n - 1 // sequence number of the next upload to visit
+	m.mu.Unlock()
+	chunk := make([]Upload, 0, walkChunk)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		chunk = chunk[:0]
+		m.mu.Lock()
+		oldest := m.n - len(m.ring)
+		for ; next >= 0 && next >= oldest && len(chunk) < walkChunk; next-- {
+			chunk = append(chunk, m.ring[next%len(m.ring)])
+		}
+		m.mu.Unlock()
+		if len(chunk) == 0 {
+			return nil
+		}
+		for _, u := range chunk {
+			if err := fn(u); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestUploadJSON(t *testing.T) {
+	for _, tt := range []struct{ in, want string }{
+		{`{"size":5,"sum":"aa"}`, "aa"},
+		{`{"size":5,"sha1":"aa"}`, "aa"}, // as recorded before Sum was renamed
+		{`{"size":5,"sum":"bb","sha1":"aa"}`, "bb"},
+	} {
+		var u Upload
+		if err := json.Unmarshal([]byte(tt.in), &u); err != nil || u.Sum != tt.want || u.Size != 5 {
+			t.Errorf("Unmarshal(%s) = %+v, %v; want Sum %q", tt.in, u, err, tt.want)
+		}
+	}
+	b, _ := json.Marshal(Upload{Size: 5, Sum: "aa"})
+	var u Upload
+	if err := json.Unmarshal(b, &u); err != nil || u.Sum != "aa" {
+		t.Errorf("%s reads back as %+v, %v", b, u, err)
+	}
+}
+
+func TestMemoryUploads(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemoryUploads(2)
+	if got, _ := m.Recent(ctx, 10); len(got) != 0 {
+		t.Fatalf("Recent on empty = %v", got)
+	}
+	for i := int64(1); i <= 3; i++ {
+		m.Add(ctx, Upload{Time: time.Unix(i, 0), Size: i})
+	}
+	got, _ := m.Recent(ctx, 10)
+	if len(got) != 2 || got[0].Size != 3 || got[1].Size != 2 {
+		t.Errorf("Recent = %+v; want sizes [3 2]", got)
+	}
+}
+
+func TestMemoryUploadsWalk(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemoryUploads(200)
+	for i := int64(1); i <= 150; i++ {
+		m.Add(ctx, Upload{Size: i})
+	}
+	var sizes []int64
+	m.Walk(ctx, func(u Upload) error {
+		if len(sizes) == 0 {
+			// Not visited: it's newer than the walk.
+			m.Add(ctx, Upload{Size: 1000})
+		}
+		sizes = append(sizes, u.Size)
+		return nil
+	})
+	if len(sizes) != 150 || sizes[0] != 150 || sizes[149] != 1 {
+		t.Errorf("Walk visited %d uploads, %d first and %d last; want 150, from 150 down to 1", len(sizes), sizes[0], sizes[len(sizes)-1])
+	}
+
+	// Uploads overwritten during the walk end it.
+	m = NewMemoryUploads(100)
+	for i := int64(1); i <= 100; i++ {
+		m.Add(ctx, Upload{Size: i})
+	}
+	sizes = nil
+	m.Walk(ctx, func(u Upload) error {
+		if len(sizes) == 0 {
+			for i := 0; i < 50; i++ {
+				m.Add(ctx, Upload{Size: 1000})
+			}
+		}
+		sizes = append(sizes, u.Size)
+		return nil
+	})
+	if len(sizes) != walkChunk || sizes[walkChunk-1] != 100-walkChunk+1 {
+		t.Errorf("Walk racing overwrites visited %d uploads; want just the first chunk of %d", len(sizes), walkChunk)
+	}
+}
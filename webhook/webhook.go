@@ -0,0 +1,236 @@
+// Package webhook POSTs JSON events to configured URLs, signed so the
+// receiver can check they came from us, and retries failed deliveries
+// in the background so the sender never waits on a receiver.
+//
+// Each request carries a header
+//
+//	X-Webhook-Signature: t=<unix time>,v1=<hex HMAC-SHA256>
+//
+// whose HMAC, keyed by the shared secret, covers the time, a dot, and
+// the body. Covering the time lets Verify reject old requests that
+// are replayed.
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bradfitz/talk-yapc-asia-2015/internal/clock"
+)
+
+// SignatureHeader is the request header carrying the signature.
+const SignatureHeader = "X-Webhook-Signature"
+
+// An Event is the JSON body of a webhook request.
+type Event struct {
+	Type string      `json:"type"` // such as "visitor.milestone"
+	Time time.Time   `json:"time"`
+	Data interface{} `json:"data,omitempty"`
+}
+
+func mac(secret []byte, ts string, body []byte) []byte {
+	m := hmac.New(sha256.New, secret)
+	m.Write([]byte(ts))
+	m.Write([]byte{'.'})
+	m.Write(body)
+	return m.Sum(nil)
+}
+
+// Sign returns the SignatureHeader value for body sent at t.
+func Sign(secret, body []byte, t time.Time) string {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	return "t=" + ts + ",v1=" + hex.EncodeToString(mac(secret, ts, body))
+}
+
+var (
+	ErrBadSignature = errors.New("webhook: missing or invalid signature")
+	ErrTooOld       = errors.New("webhook: signature timestamp outside tolerance")
+)
+
+// Verify checks sig, a SignatureHeader value, against body. It
+// rejects signatures made more than tolerance away from now.
+func Verify(secret []byte, sig string, body []byte, now time.Time, tolerance time.Duration) error {
+	var ts, v1 string
+	for _, part := range strings.Split(sig, ",") {
+		k, v, _ := strings.Cut(part, "=")
+		switch k {
+		case "t":
+			ts = v
+		case "v1":
+			v1 = v
+		}
+	}
+	got, err := hex.DecodeString(v1)
+	if ts == "" || err != nil || !hmac.Equal(got, mac(secret, ts, body)) {
+		return ErrBadSignature
+	}
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return ErrBadSignature
+	}
+	if d := now.Sub(time.Unix(sec, 0)); d > tolerance || d < -tolerance {
+		return ErrTooOld
+	}
+	return nil
+}
+
+// Receive reads, verifies, and decodes a webhook request, allowing
+// five minutes of clock skew.
+func Receive(secret []byte, r *http.Request) (Event, error) {
+	var ev Event
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		return ev, err
+	}
+	if err := Verify(secret, r.Header.Get(SignatureHeader), body, time.Now(), 5*time.Minute); err != nil {
+		return ev, err
+	}
+	err = json.Unmarshal(body, &ev)
+	return ev, err
+}
+
+// A Sender delivers events to URLs. Send only queues an event; Run
+// does the delivering. A failed delivery (an error or a non-2xx
+// status) is retried after Backoff, doubling each time, until
+// MaxAttempts. When the queue is full, new deliveries are dropped
+// rather than making Send block.
+type Sender struct {
+	URLs        []string
+	Secret      []byte
+	Client      *http.Client  // default: one with a 10s timeout
+	MaxAttempts int           // default 5
+	Backoff     time.Duration // default 1s
+	QueueSize   int           // default 100
+
+	once  sync.Once
+	queue chan *delivery
+
+	delivered, failed, dropped int64 // accessed atomically
+}
+
+type delivery struct {
+	url      string
+	body     []byte
+	attempts int
+}
+
+func (s *Sender) init() {
+	n := s.QueueSize
+	if n == 0 {
+		n = 100
+	}
+	s.queue = make(chan *delivery, n)
+}
+
+func (s *Sender) client() *http.Client {
+	if s.Client != nil {
+		return s.Client
+	}
+	return defaultClient
+}
+
+var defaultClient = &http.Client{Timeout: 10 * time.Second}
+
+func (s *Sender) maxAttempts() int {
+	if s.MaxAttempts == 0 {
+		return 5
+	}
+	return s.MaxAttempts
+}
+
+func (s *Sender) backoff() time.Duration {
+	if s.Backoff == 0 {
+		return time.Second
+	}
+	return s.Backoff
+}
+
+// Send queues ev for each URL. It never blocks.
+func (s *Sender) Send(ev Event) {
+	s.once.Do(s.init)
+	if ev.Time.IsZero() {
+		ev.Time = clock.Now()
+	}
+	body, err := json.Marshal(ev)
+	if err != nil {
+		log.Printf("ERROR: webhook: encoding %s event: %v", ev.Type, err)
+		return
+	}
+	for _, u := range s.URLs {
+		s.enqueue(&delivery{url: u, body: body})
+	}
+}
+
+func (s *Sender) enqueue(d *delivery) {
+	select {
+	case s.queue <- d:
+	default:
+		atomic.AddInt64(&s.dropped, 1)
+	}
+}
+
+// Run delivers queued events until stop is closed.
+func (s *Sender) Run(stop <-chan struct{}) {
+	s.once.Do(s.init)
+	for {
+		select {
+		case d := <-s.queue:
+			s.deliver(d)
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (s *Sender) deliver(d *delivery) {
+	d.attempts++
+	err := s.post(d)
+	if err == nil {
+		atomic.AddInt64(&s.delivered, 1)
+		return
+	}
+	if d.attempts >= s.maxAttempts() {
+		atomic.AddInt64(&s.failed, 1)
+		log.Printf("ERROR: webhook: giving up on %s after %d attempts: %v", d.url, d.attempts, err)
+		return
+	}
+	time.AfterFunc(s.backoff()<<(d.attempts-1), func() { s.enqueue(d) })
+}
+
+func (s *Sender) post(d *delivery) error {
+	req, err := http.NewRequest("POST", d.url, bytes.NewReader(d.body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	// Sign at send time, so a retry isn't rejected as stale.
+	req.Header.Set(SignatureHeader, Sign(s.Secret, d.body, time.Now()))
+	res, err := s.client().Do(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, res.Body)
+	res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		return errors.New("webhook: " + res.Status)
+	}
+	return nil
+}
+
+// Stats returns how many deliveries succeeded, failed after every
+// attempt, and were dropped because the queue was full.
+func (s *Sender) Stats() (delivered, failed, dropped int64) {
+	return atomic.LoadInt64(&s.delivered), atomic.LoadInt64(&s.failed), atomic.LoadInt64(&s.dropped)
+}
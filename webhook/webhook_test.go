@@ -0,0 +1,124 @@
+package webhook
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var secret = []byte("shh")
+
+func TestSignVerify(t *testing.T) {
+	body := []byte(`{"type":"x"}`)
+	now := time.Unix(1e9, 0)
+	sig := Sign(secret, body, now)
+	if err := Verify(secret, sig, body, now.Add(time.Minute), 5*time.Minute); err != nil {
+		t.Fatalf("Verify of good signature: %v", err)
+	}
+	tests := []struct {
+		name   string
+		secret []byte
+		sig    string
+		body   string
+		now    time.Time
+		want   error
+	}{
+		{"other secret", []byte("loud"), sig, string(body), now, ErrBadSignature},
+		{"changed body", secret, sig, `{"type":"y"}`, now, ErrBadSignature},
+		{"changed time", secret, strings.Replace(sig, "t=1000000000", "t=1000000001", 1), string(body), now, ErrBadSignature},
+		{"no signature", secret, "", string(body), now, ErrBadSignature},
+		{"replayed later", secret, sig, string(body), now.Add(time.Hour), ErrTooOld},
+	}
+	for _, tt := range tests {
+		if err := Verify(tt.secret, tt.sig, []byte(tt.body), tt.now, 5*time.Minute); err != tt.want {
+			t.Errorf("%s: Verify = %v; want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestSenderRetries(t *testing.T) {
+	var calls int64
+	got := make(chan Event, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt64(&calls, 1) < 3 {
+			http.Error(w, "not yet", http.StatusServiceUnavailable)
+			return
+		}
+		ev, err := Receive(secret, r)
+		if err != nil {
+			t.Errorf("Receive: %v", err)
+		}
+		got <- ev
+	}))
+	defer ts.Close()
+
+	s := &Sender{URLs: []string{ts.URL}, Secret: secret, Backoff: time.Millisecond}
+	stop := make(chan struct{})
+	defer close(stop)
+	go s.Run(stop)
+	s.Send(Event{Type: "visitor.milestone", Data: map[string]int{"visitor": 1000}})
+
+	select {
+	case ev := <-got:
+		if ev.Type != "visitor.milestone" || ev.Time.IsZero() {
+			t.Errorf("received %+v", ev)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("event never delivered")
+	}
+	if n := atomic.LoadInt64(&calls); n != 3 {
+		t.Errorf("%d attempts; want 3", n)
+	}
+	waitStats(t, func(delivered, failed, dropped int64) bool {
+		return delivered == 1 && failed == 0 && dropped == 0
+	}, s)
+}
+
+// waitStats waits for s.Stats to satisfy cond; the counts are updated
+// after the receiver has replied.
+func waitStats(t *testing.T, cond func(delivered, failed, dropped int64) bool, s *Sender) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond(s.Stats()) {
+		if time.Now().After(deadline) {
+			d, f, dr := s.Stats()
+			t.Fatalf("Stats = %d delivered, %d failed, %d dropped", d, f, dr)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSenderGivesUp(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "never", http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+	s := &Sender{URLs: []string{ts.URL}, Secret: secret, Backoff: time.Millisecond, MaxAttempts: 2}
+	stop := make(chan struct{})
+	defer close(stop)
+	go s.Run(stop)
+	s.Send(Event{Type: "x"})
+	waitStats(t, func(delivered, failed, dropped int64) bool { return failed == 1 }, s)
+}
+
+func TestSendNeverBlocks(t *testing.T) {
+	s := &Sender{URLs: []string{"http://192.0.2.1/"}, QueueSize: 2} // never Run
+	done := make(chan bool)
+	go func() {
+		for i := 0; i < 5; i++ {
+			s.Send(Event{Type: "x"})
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Send blocked on a full queue")
+	}
+	if _, _, dropped := s.Stats(); dropped != 3 {
+		t.Errorf("dropped %d; want 3", dropped)
+	}
+}
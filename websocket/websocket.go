@@ -0,0 +1,238 @@
+// Package websocket speaks just enough of the WebSocket protocol
+// (RFC 6455) for the demo's live feeds: the opening handshake, and
+// unfragmented text, ping, pong, and close frames. There are no
+// extensions and no subprotocols.
+package websocket
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Opcodes of the frames this package handles.
+const (
+	OpText  = 1
+	OpClose = 8
+	OpPing  = 9
+	OpPong  = 10
+)
+
+// maxPayload bounds incoming frames. The demo's clients have nothing
+// to say beyond control frames.
+const maxPayload = 64 << 10
+
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+var (
+	ErrNotWebSocket = errors.New("websocket: not a WebSocket handshake")
+	errTooLarge     = errors.New("websocket: frame too large")
+	errFragmented   = errors.New("websocket: fragmented frames not supported")
+)
+
+// A Conn is a WebSocket connection. Writes may be called from one
+// goroutine while another reads.
+type Conn struct {
+	c      net.Conn
+	br     *bufio.Reader
+	client bool // frames we send are masked
+
+	wmu sync.Mutex // guards writes to c
+}
+
+func acceptKey(key string) string {
+	h := sha1.Sum([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+func headerHas(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Upgrade completes the opening handshake for r and takes over its
+// connection. If r isn't a WebSocket handshake, Upgrade replies with
+// a 400 and returns ErrNotWebSocket.
+func Upgrade(w http.ResponseWriter, r *http.Request) (*Conn, error) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if r.Method != "GET" || key == "" ||
+		!headerHas(r.Header, "Connection", "upgrade") ||
+		!headerHas(r.Header, "Upgrade", "websocket") ||
+		r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "WebSocket handshake expected", http.StatusBadRequest)
+		return nil, ErrNotWebSocket
+	}
+	c, brw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		return nil, err
+	}
+	// Clear any deadlines from the server's timeouts; the connection
+	// is ours now and lives as long as we like.
+	c.SetDeadline(time.Time{})
+	fmt.Fprintf(brw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n", acceptKey(key))
+	if err := brw.Flush(); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return &Conn{c: c, br: brw.Reader}, nil
+}
+
+// Dial opens a client connection to a ws:// URL. It's used by tests.
+func Dial(rawurl string) (*Conn, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "ws" {
+		return nil, fmt.Errorf("websocket: unsupported scheme %q", u.Scheme)
+	}
+	c, err := net.Dial("tcp", u.Host)
+	if err != nil {
+		return nil, err
+	}
+	var nonce [16]byte
+	rand.Read(nonce[:])
+	key := base64.StdEncoding.EncodeToString(nonce[:])
+	fmt.Fprintf(c, "GET %s HTTP/1.1\r\nHost: %s\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Key: %s\r\nSec-WebSocket-Version: 13\r\n\r\n", u.RequestURI(), u.Host, key)
+	br := bufio.NewReader(c)
+	res, err := http.ReadResponse(br, nil)
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	if res.StatusCode != http.StatusSwitchingProtocols || res.Header.Get("Sec-WebSocket-Accept") != acceptKey(key) {
+		c.Close()
+		return nil, fmt.Errorf("websocket: handshake failed: %s", res.Status)
+	}
+	return &Conn{c: c, br: br, client: true}, nil
+}
+
+// WriteText sends s as one text message.
+func (c *Conn) WriteText(s string) error { return c.writeFrame(OpText, []byte(s)) }
+
+func (c *Conn) writeFrame(op byte, payload []byte) error {
+	buf := []byte{0x80 | op} // FIN
+	var maskBit byte
+	if c.client {
+		maskBit = 0x80
+	}
+	switch n := len(payload); {
+	case n < 126:
+		buf = append(buf, maskBit|byte(n))
+	case n <= 0xffff:
+		buf = append(buf, maskBit|126)
+		buf = binary.BigEndian.AppendUint16(buf, uint16(n))
+	default:
+		buf = append(buf, maskBit|127)
+		buf = binary.BigEndian.AppendUint64(buf, uint64(n))
+	}
+	if c.client {
+		var mask [4]byte
+		rand.Read(mask[:])
+		buf = append(buf, mask[:]...)
+		start := len(buf)
+		buf = append(buf, payload...)
+		for i := range buf[start:] {
+			buf[start+i] ^= mask[i%4]
+		}
+	} else {
+		buf = append(buf, payload...)
+	}
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	_, err := c.c.Write(buf)
+	return err
+}
+
+// ReadMessage returns the next text message. It answers pings itself.
+// When the peer closes the connection, it echoes the close and
+// returns io.EOF.
+func (c *Conn) ReadMessage() (string, error) {
+	for {
+		op, payload, err := c.readFrame()
+		if err != nil {
+			return "", err
+		}
+		switch op {
+		case OpText:
+			return string(payload), nil
+		case OpPing:
+			if err := c.writeFrame(OpPong, payload); err != nil {
+				return "", err
+			}
+		case OpClose:
+			c.writeFrame(OpClose, payload)
+			return "", io.EOF
+		}
+	}
+}
+
+func (c *Conn) readFrame() (op byte, payload []byte, err error) {
+	var hdr [2]byte
+	if _, err := io.ReadFull(c.br, hdr[:]); err != nil {
+		return 0, nil, err
+	}
+	if hdr[0]&0x80 == 0 || hdr[0]&0x0f == 0 {
+		return 0, nil, errFragmented
+	}
+	op = hdr[0] & 0x0f
+	masked := hdr[1]&0x80 != 0
+	n := uint64(hdr[1] & 0x7f)
+	switch n {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		n = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		n = binary.BigEndian.Uint64(ext[:])
+	}
+	if n > maxPayload {
+		return 0, nil, errTooLarge
+	}
+	var mask [4]byte
+	if masked {
+		if _, err := io.ReadFull(c.br, mask[:]); err != nil {
+			return 0, nil, err
+		}
+	}
+	payload = make([]byte, n)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		return 0, nil, err
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return op, payload, nil
+}
+
+// Close sends a close frame and closes the connection.
+func (c *Conn) Close() error {
+	c.writeFrame(OpClose, nil)
+	return c.c.Close()
+}
@@ -0,0 +1,89 @@
+package websocket
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func wsURL(ts *httptest.Server) string { return "ws" + strings.TrimPrefix(ts.URL, "http") }
+
+// echo upgrades and echoes text messages back until the client closes.
+func echo() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		for {
+			msg, err := c.ReadMessage()
+			if err != nil {
+				return
+			}
+			c.WriteText(msg)
+		}
+	}))
+}
+
+func TestRoundTrip(t *testing.T) {
+	ts := echo()
+	defer ts.Close()
+	c, err := Dial(wsURL(ts) + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	for _, msg := range []string{"hello", "", strings.Repeat("x", 200), strings.Repeat("y", 70000)[:maxPayload]} {
+		if err := c.WriteText(msg); err != nil {
+			t.Fatal(err)
+		}
+		got, err := c.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != msg {
+			t.Errorf("echo of %d bytes came back as %d bytes", len(msg), len(got))
+		}
+	}
+}
+
+func TestPingAndClose(t *testing.T) {
+	ts := echo()
+	defer ts.Close()
+	c, err := Dial(wsURL(ts))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.c.Close()
+	if err := c.writeFrame(OpPing, []byte("are you there")); err != nil {
+		t.Fatal(err)
+	}
+	op, payload, err := c.readFrame()
+	if err != nil || op != OpPong || string(payload) != "are you there" {
+		t.Errorf("reply to ping = %d %q, %v; want pong with same payload", op, payload, err)
+	}
+	c.writeFrame(OpClose, nil)
+	if _, err := c.ReadMessage(); err != io.EOF {
+		t.Errorf("ReadMessage after close = %v; want io.EOF from the echoed close", err)
+	}
+}
+
+func TestNotWebSocket(t *testing.T) {
+	rw := httptest.NewRecorder()
+	if _, err := Upgrade(rw, httptest.NewRequest("GET", "/", nil)); err != ErrNotWebSocket {
+		t.Errorf("Upgrade of plain GET = %v; want ErrNotWebSocket", err)
+	}
+	if rw.Code != 400 {
+		t.Errorf("status = %d; want 400", rw.Code)
+	}
+}
+
+func TestAcceptKey(t *testing.T) {
+	// The example from RFC 6455, section 1.3.
+	if got, want := acceptKey("dGhlIHNhbXBsZSBub25jZQ=="), "s3pPLMBiTxaQ9kYGzzhZRbK+xOo="; got != want {
+		t.Errorf("acceptKey = %q; want %q", got, want)
+	}
+}